@@ -1,27 +1,129 @@
 package main
 
 import (
+	"context"
+	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/criteo/s3-probe/pkg/config"
+	"github.com/criteo/s3-probe/pkg/metrics"
+	"github.com/criteo/s3-probe/pkg/probe"
 	"github.com/criteo/s3-probe/pkg/watcher"
 
 	_ "net/http/pprof"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
 )
 
 func healthCheck(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(200)
 }
 
+// pushMetrics periodically pushes the collected metrics to a Pushgateway
+// for contexts where the probe cannot be scraped, until stop is closed
+func pushMetrics(pusher *push.Pusher, addr string, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			pushOnce(pusher, addr)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// pushOnce pushes the collected metrics to a Pushgateway
+func pushOnce(pusher *push.Pusher, addr string) {
+	if err := pusher.Push(); err != nil {
+		log.Printf("Error while pushing metrics to %s: %s", addr, err)
+	}
+}
+
+// reloadOnSighup reloads the configuration each time the process receives SIGHUP
+func reloadOnSighup(w *watcher.Watcher) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	for range signals {
+		log.Printf("SIGHUP received, reloading configuration")
+		cfg, err := config.ReloadConfig()
+		if err != nil {
+			log.Printf("Error while reloading configuration: %s", err)
+			continue
+		}
+		w.Reload(cfg)
+	}
+}
+
+// stopOnTermination stops the watcher when the process receives SIGTERM or SIGINT
+func stopOnTermination(w *watcher.Watcher) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	sig := <-signals
+	log.Printf("%s received, shutting down", sig)
+	// A second signal kills the process without waiting
+	signal.Reset(syscall.SIGTERM, syscall.SIGINT)
+	w.Stop()
+}
+
 func main() {
 	cfg := config.ParseConfig()
+	if err := metrics.Register(prometheus.DefaultRegisterer, *cfg.ProbeHost); err != nil {
+		log.Fatalf("Error while registering metrics: %s", err)
+	}
+	if *cfg.DisableSDKRetries {
+		probe.DisableSDKRetries()
+	}
+	probe.SetGlobalRateLimit(*cfg.GlobalMaxOpsPerMin)
+	probe.SetGlobalMaxConcurrentChecks(*cfg.GlobalMaxConcurrentChecks)
+	var gatherer prometheus.Gatherer = prometheus.DefaultGatherer
+	if *cfg.EndpointIDLabel {
+		gatherer = metrics.WithEndpointID(gatherer)
+	}
 	w := watcher.NewWatcher(cfg)
 
 	http.HandleFunc("/ready", healthCheck)
-	http.Handle("/metrics", promhttp.Handler())
+	http.Handle("/metrics", promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer, promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{})))
+	http.HandleFunc("/probe", w.ServeProbe)
+	http.HandleFunc("/config", w.ServeConfig)
+	http.HandleFunc("/sd", w.ServeSD)
+	http.HandleFunc("/status", w.ServeStatus)
+	http.HandleFunc("/probes/", w.ServeProbeAdmin)
+
+	var pusher *push.Pusher
+	stopPushing := make(chan struct{})
+	if *cfg.PushgatewayAddr != "" {
+		pusher = push.New(*cfg.PushgatewayAddr, *cfg.PushgatewayJob).Gatherer(gatherer)
+		go pushMetrics(pusher, *cfg.PushgatewayAddr, *cfg.PushInterval, stopPushing)
+	}
 
-	go http.ListenAndServe(*cfg.Addr, nil)
+	server := &http.Server{Addr: *cfg.Addr}
+	go reloadOnSighup(&w)
+	go stopOnTermination(&w)
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("Error while serving HTTP: %s", err)
+		}
+	}()
 	w.WatchPools(*cfg.Interval)
+
+	// Push the results of the drained probes, a short run would otherwise exit before the first push
+	close(stopPushing)
+	if pusher != nil {
+		pushOnce(pusher, *cfg.PushgatewayAddr)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *cfg.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Error while shutting down the HTTP server: %s", err)
+	}
+	log.Printf("Probe stopped")
 }
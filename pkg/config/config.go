@@ -2,59 +2,534 @@ package config
 
 import (
 	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
 	"os"
+	"reflect"
+	"strings"
 	"time"
 )
 
 // Config contains the configuration of the probe
 type Config struct {
-	ConsulAddr                *string
-	Tag                       *string
-	GatewayTag                *string
-	LatencyBucketName         *string
-	GatewayBucketName         *string
-	DurabilityBucketName      *string
-	Interval                  *time.Duration
-	Addr                      *string
-	AccessKey                 *string
-	SecretKey                 *string
-	ProbeRatePerMin           *int
-	DurabilityProbeRatePerMin *int
-	LatencyItemSize           *int
-	DurabilityItemSize        *int
-	DurabilityItemTotal       *int
-	DurabilityTimeout         *time.Duration
-	LatencyTimeout            *time.Duration
-	CleanupDelay              *time.Duration
+	ConsulAddr                   *string
+	Tag                          *string
+	GatewayTag                   *string
+	LatencyBucketName            *string
+	GatewayBucketName            *string
+	DurabilityBucketName         *string
+	Interval                     *time.Duration
+	Addr                         *string
+	AccessKey                    *string
+	SecretKey                    *string
+	ProbeRatePerMin              *int
+	DurabilityProbeRatePerMin    *int
+	LatencyItemSize              *int
+	DurabilityItemSize           *int
+	DurabilityItemTotal          *int
+	DurabilityTimeout            *time.Duration
+	LatencyTimeout               *time.Duration
+	CleanupDelay                 *time.Duration
+	UpThreshold                  *int
+	DownThreshold                *int
+	ACLCheck                     *bool
+	CannedACL                    *string
+	PushgatewayAddr              *string
+	PushgatewayJob               *string
+	PushInterval                 *time.Duration
+	DurabilityListRetries        *int
+	DurabilityListRetryDelay     *time.Duration
+	AnonymousAccessCheck         *bool
+	MaxGatewayReplicationWaits   *int
+	ListOrderCheck               *bool
+	ListOrderItems               *int
+	DefaultOperationTimeout      *time.Duration
+	IdleThreshold                *time.Duration
+	GatewayIgnoredErrorCodes     *string
+	ExpectedVersioning           *string
+	RemediateVersioning          *bool
+	SummaryOperations            *string
+	RemoveMissingObjectCheck     *bool
+	DiscoveryConcurrency         *int
+	EndpointTemplate             *string
+	GatewayObjectsThreshold      *int
+	ProbeHost                    *string
+	ContentMD5Check              *bool
+	ContentMD5NegativeCheck      *bool
+	ConfigFile                   *string
+	MaxInflightOperations        *int
+	PresignedCheck               *bool
+	PresignedExpectedStatus      *int
+	PresignedRange               *string
+	RepairDurabilityOnSizeChange *bool
+	CompressionCheck             *bool
+	DurabilityTolerance          *string
+	BucketScanName               *string
+	BucketScanRatePerMin         *int
+	BucketScanTimeout            *time.Duration
+	AmbiguousTagsPrecedence      *string
+	RestoreBucketName            *string
+	RestoreObjectName            *string
+	RestoreDays                  *int
+	MultipartAbortCheck          *bool
+	ConcurrentGetRatePerMin      *int
+	ConcurrentGets               *int
+	CorsBucketName               *string
+	CorsExpectedFile             *string
+	CorsPreflightOrigin          *string
+	ListDelimiterCheck           *bool
+	OperationSchedule            *string
+	DisableSDKRetries            *bool
+	ClockSkewThreshold           *time.Duration
+	ForceHTTP1                   *bool
+	LastModifiedCheck            *bool
+	CanaryBucket                 *string
+	CanaryObjectKey              *string
+	CanaryChecksum               *string
+	DurabilityAccessKey          *string
+	DurabilitySecretKey          *string
+	PrepareTimeout               *time.Duration
+	DurabilityLifecycleCheck     *bool
+	BackendStatsRatePerMin       *int
+	DurabilityInstanceCheck      *bool
+	ConnectTimeout               *time.Duration
+	ConcurrentOverwriteWriters   *int
+	EndpointIDLabel              *bool
+	KeyLengthCheckMax            *int
+	IncompleteUploadsCheck       *bool
+	WarmupCycles                 *int
+	DefaultS3Port                *int
+	CopyDestinationBucket        *string
+	FlappingStabilityWindow      *time.Duration
+	ContentDispositionCheck      *bool
+	ManifestFile                 *string
+	ManifestBucket               *string
+	DurabilityPerDatacenter      *bool
+	GatewayPrepareRequireAll     *bool
+	OverwriteCheck               *bool
+	CapacityRampMax              *int
+	CapacityRampWindow           *time.Duration
+	CapacityRampInterval         *time.Duration
+	CapacityLatencyThreshold     *time.Duration
+	SSECWrongKeyCheck            *bool
+	GlobalMaxOpsPerMin           *int
+	ConsulBlockingQueries        *bool
+	ServiceInclude               *string
+	ServiceExclude               *string
+	SDFile                       *string
+	ShutdownTimeout              *time.Duration
+	GlobalMaxConcurrentChecks    *int
+	TickPhaseOffset              *bool
+	TickJitter                   *float64
+	PrepareRetryDelay            *time.Duration
+	PrepareRetryMaxDelay         *time.Duration
+	ConnectService               *string
+	HybridDiscovery              *bool
+	DiscoveryPrecedence          *string
+	MultipartUploadCheck         *bool
+	MultipartUploadParts         *int
+	MultipartPartSize            *int
+	ListPaginationCheck          *bool
+	ListPaginationItems          *int
+	ListPaginationPageSize       *int
+	BulkDeleteCheck              *bool
+	BulkDeleteItems              *int
+	VersionedBucket              *string
+	TaggingCheck                 *bool
+	AdminToken                   *string
 }
 
 // ParseConfig parse the configuration and create a Config struct
 func ParseConfig() Config {
-	config := Config{
-		ConsulAddr:                flag.String("consul", "localhost:8500", "Consul server address"),
-		Tag:                       flag.String("tag", "s3", "Tag to search on consul"),
-		GatewayTag:                flag.String("gateway-tag", "s3-gateway", "Tag to search on consul"),
-		LatencyBucketName:         flag.String("latency-bucket", "monitoring-latency", "Bucket used for the latency monitoring probe (will read and write)"),
-		GatewayBucketName:         flag.String("gateway-bucket", "monitoring-gateway", "Bucket used for the gateway latency monitoring probe (will read and write)"),
-		DurabilityBucketName:      flag.String("durability-bucket", "monitoring-durability", "Bucket used for the durability monitoring probe (will read and write)"),
-		Interval:                  flag.Duration("interval", 600*time.Second, "How often consul is polled to discover new S3 endoints"),
-		DurabilityTimeout:         flag.Duration("durablity-timeout", 60*time.Second, "Timeout duration of the durability check"),
-		LatencyTimeout:            flag.Duration("latency-timeout", 30*time.Second, "Timeout duration of the latency check"),
-		Addr:                      flag.String("listen-address", ":8080", "The address to listen on for HTTP requests."),
-		AccessKey:                 flag.String("s3-access-key", "", "User key of the S3 endpoint"),
-		SecretKey:                 flag.String("s3-secret-key", "", "Access key of the S3 endpoint"),
-		ProbeRatePerMin:           flag.Int("probe-rate", 120, "Rate of probing per minute (how many checks are done in a minute)"),
-		DurabilityProbeRatePerMin: flag.Int("durability-probe-rate", 1, "Rate of probing per minute (how many checks are done in a minute)"),
-		DurabilityItemSize:        flag.Int("durability-item-size", 1024*10, "Size of the item to insert into S3 for durability testing"),
-		LatencyItemSize:           flag.Int("latency-item-size", 1024*10, "Size of the item to insert into S3 for latency testing"),
-		DurabilityItemTotal:       flag.Int("item-total", 100000, "Total number of items to write into S3 for durability testing"),
-		CleanupDelay:              flag.Duration("cleanup-delay", 30*time.Second, "Delay before deleting objects created during probing"),
-	}
-
+	config := newConfig(flag.CommandLine)
 	flag.Parse()
+	if err := applyConfigFile(flag.CommandLine, *config.ConfigFile); err != nil {
+		log.Fatalf("Error while reading config file: %s", err)
+	}
+	if err := validate(config); err != nil {
+		log.Fatalf("Invalid configuration: %s", err)
+	}
 	return config
 }
 
+// ReloadConfig parses the command line and the config file again into a new Config struct
+func ReloadConfig() (Config, error) {
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	config := newConfig(fs)
+	if err := fs.Parse(os.Args[1:]); err != nil {
+		return Config{}, err
+	}
+	if err := applyConfigFile(fs, *config.ConfigFile); err != nil {
+		return Config{}, err
+	}
+	if err := validate(config); err != nil {
+		return Config{}, err
+	}
+	return config, nil
+}
+
+// validate rejects the settings whose wrong value would otherwise only show once the probes run
+func validate(config Config) error {
+	switch *config.ExpectedVersioning {
+	case "", "Enabled", "Suspended":
+	default:
+		return fmt.Errorf("expected-versioning must be Enabled or Suspended, got %q", *config.ExpectedVersioning)
+	}
+	if *config.PushgatewayAddr != "" && *config.PushInterval <= 0 {
+		return fmt.Errorf("push-interval must be positive when pushing to a Pushgateway, got %s", *config.PushInterval)
+	}
+	return nil
+}
+
+func newConfig(fs *flag.FlagSet) Config {
+	return Config{
+		ConsulAddr:                   fs.String("consul", "localhost:8500", "Consul server address"),
+		Tag:                          fs.String("tag", "s3", "Comma separated tags to search on consul, services carrying any of them are probed"),
+		GatewayTag:                   fs.String("gateway-tag", "s3-gateway", "Comma separated tags to search on consul, services carrying any of them are probed as gateways"),
+		LatencyBucketName:            fs.String("latency-bucket", "monitoring-latency", "Bucket used for the latency monitoring probe (will read and write)"),
+		GatewayBucketName:            fs.String("gateway-bucket", "monitoring-gateway", "Bucket used for the gateway latency monitoring probe (will read and write)"),
+		DurabilityBucketName:         fs.String("durability-bucket", "monitoring-durability", "Bucket used for the durability monitoring probe (will read and write)"),
+		Interval:                     fs.Duration("interval", 600*time.Second, "How often consul is polled to discover new S3 endoints"),
+		DurabilityTimeout:            fs.Duration("durablity-timeout", 60*time.Second, "Timeout duration of the durability check"),
+		LatencyTimeout:               fs.Duration("latency-timeout", 30*time.Second, "Timeout duration of the latency check"),
+		Addr:                         fs.String("listen-address", ":8080", "The address to listen on for HTTP requests."),
+		AccessKey:                    fs.String("s3-access-key", "", "User key of the S3 endpoint"),
+		SecretKey:                    fs.String("s3-secret-key", "", "Access key of the S3 endpoint"),
+		ProbeRatePerMin:              fs.Int("probe-rate", 120, "Rate of probing per minute (how many checks are done in a minute)"),
+		DurabilityProbeRatePerMin:    fs.Int("durability-probe-rate", 1, "Rate of probing per minute (how many checks are done in a minute), 0 disables durability checks and the preparation of the durability bucket"),
+		DurabilityItemSize:           fs.Int("durability-item-size", 1024*10, "Size of the item to insert into S3 for durability testing"),
+		LatencyItemSize:              fs.Int("latency-item-size", 1024*10, "Size of the item to insert into S3 for latency testing"),
+		DurabilityItemTotal:          fs.Int("item-total", 100000, "Total number of items to write into S3 for durability testing"),
+		CleanupDelay:                 fs.Duration("cleanup-delay", 30*time.Second, "Delay before deleting objects created during probing"),
+		UpThreshold:                  fs.Int("up-threshold", 1, "Number of consecutive successful checks before an endpoint is reported up"),
+		DownThreshold:                fs.Int("down-threshold", 3, "Number of consecutive failed checks before an endpoint is reported down"),
+		ACLCheck:                     fs.Bool("acl-check", false, "Check that a canned ACL set on upload is returned by the endpoint"),
+		CannedACL:                    fs.String("canned-acl", "private", "Canned ACL used by the ACL check"),
+		PushgatewayAddr:              fs.String("pushgateway", "", "Address of a Prometheus Pushgateway to push metrics to (disabled if empty)"),
+		PushgatewayJob:               fs.String("pushgateway-job", "s3-probe", "Job label used when pushing metrics to the Pushgateway"),
+		PushInterval:                 fs.Duration("push-interval", 60*time.Second, "How often metrics are pushed to the Pushgateway, they are also pushed once on shutdown"),
+		DurabilityListRetries:        fs.Int("durability-list-retries", 3, "Number of times the durability bucket is listed again before considering it lacks items"),
+		DurabilityListRetryDelay:     fs.Duration("durability-list-retry-delay", 10*time.Second, "Delay between listings of the durability bucket, to let eventually consistent backends settle"),
+		AnonymousAccessCheck:         fs.Bool("anonymous-access-check", false, "Check that objects of the latency bucket cannot be read anonymously"),
+		MaxGatewayReplicationWaits:   fs.Int("max-gateway-replication-waits", 10, "Maximum number of gateway checks reading the replicated object at the same time per probe (0 for unlimited)"),
+		ListOrderCheck:               fs.Bool("list-order-check", false, "Check that listing returns objects in lexicographic order across pages"),
+		ListOrderItems:               fs.Int("list-order-items", 5, "Number of objects written for the list order check"),
+		DefaultOperationTimeout:      fs.Duration("default-operation-timeout", 60*time.Second, "Timeout of S3 operations not covered by a more specific timeout"),
+		IdleThreshold:                fs.Duration("idle-threshold", 0, "Idle period after which operations opening a new connection are reported separately (0 to disable)"),
+		GatewayIgnoredErrorCodes:     fs.String("gateway-ignored-error-codes", "", "Comma separated list of S3 error codes expected when removing objects from gateway destinations (e.g. AccessDenied,MethodNotAllowed)"),
+		ExpectedVersioning:           fs.String("expected-versioning", "", "Expected versioning status of the durability bucket (Enabled or Suspended, empty to disable the check)"),
+		RemediateVersioning:          fs.Bool("remediate-versioning", false, "Set the expected versioning status on the durability bucket during preparation"),
+		SummaryOperations:            fs.String("summary-operations", "", "Comma separated list of operations feeding the latency summary (empty for all operations)"),
+		RemoveMissingObjectCheck:     fs.Bool("remove-missing-object-check", false, "Check that removing a non-existent object succeeds"),
+		DiscoveryConcurrency:         fs.Int("discovery-concurrency", 8, "Number of services whose endpoints are resolved concurrently during discovery"),
+		GatewayObjectsThreshold:      fs.Int("gateway-objects-threshold", 0, "Number of objects in the gateway bucket above which objects are considered leaked (0 to disable the check)"),
+		EndpointTemplate:             fs.String("endpoint-template", "", "Template of the endpoint used when consul meta doesn't provide one, supports {service}, {port}, {node} and {dc} placeholders"),
+		ConfigFile:                   fs.String("config-file", "", "File of flag values (one name=value per line) read at startup and on SIGHUP, flags given on the command line take precedence"),
+		MaxInflightOperations:        fs.Int("max-inflight-operations", 0, "Maximum number of S3 operations in flight at the same time per probe (0 for unlimited)"),
+		PresignedCheck:               fs.Bool("presigned-check", false, "Check that objects can be uploaded and read through presigned URLs"),
+		PresignedExpectedStatus:      fs.Int("presigned-expected-status", 200, "HTTP status expected from the presigned GET request (e.g. 206 when a range is requested), the presigned PUT must return 200"),
+		PresignedRange:               fs.String("presigned-range", "", "Range header sent with the presigned GET request (e.g. bytes=0-0, empty to read the whole object)"),
+		RepairDurabilityOnSizeChange: fs.Bool("repair-durability-on-size-change", false, "Write the durability items again when they don't have the configured size"),
+		CompressionCheck:             fs.Bool("compression-check", false, "Check that objects read with Accept-Encoding: gzip are decoded to their original content"),
+		DurabilityTolerance:          fs.String("durability-tolerance", "0", "Number of missing durability items tolerated, either absolute (e.g. 5) or as a percentage of item-total (e.g. 0.1%)"),
+		BucketScanName:               fs.String("bucket-scan-bucket", "", "Bucket whose object count and total size are periodically reported (empty to disable the scan)"),
+		BucketScanRatePerMin:         fs.Int("bucket-scan-rate", 0, "Rate of bucket scans per minute, scans list the whole bucket so keep it low (0 to disable the scan)"),
+		BucketScanTimeout:            fs.Duration("bucket-scan-timeout", 10*time.Minute, "Timeout duration of a bucket scan"),
+		AmbiguousTagsPrecedence:      fs.String("ambiguous-tags-precedence", "gateway", "How services carrying both the tag and the gateway tag are probed: gateway or standard"),
+		RestoreBucketName:            fs.String("restore-bucket", "", "Bucket holding the archived object used by the restore check"),
+		RestoreObjectName:            fs.String("restore-object", "", "Archived object whose restoration is requested and checked on each durability check (empty to disable the check)"),
+		RestoreDays:                  fs.Int("restore-days", 1, "Number of days the restored copy of the archived object is kept"),
+		MultipartAbortCheck:          fs.Bool("multipart-abort-check", false, "Check that aborting a multipart upload frees its parts"),
+		ConcurrentGetRatePerMin:      fs.Int("concurrent-get-rate", 0, "Rate per minute of the concurrent GET throughput check (0 to disable the check)"),
+		ConcurrentGets:               fs.Int("concurrent-gets", 8, "Number of concurrent GETs issued by the throughput check"),
+		CorsBucketName:               fs.String("cors-bucket", "", "Bucket whose CORS configuration is checked (empty to disable the check)"),
+		CorsExpectedFile:             fs.String("cors-expected-file", "", "File holding the expected CORS configuration of the bucket, in the S3 XML format"),
+		CorsPreflightOrigin:          fs.String("cors-preflight-origin", "", "Origin of a preflight request checked to be allowed on the bucket (empty to skip the preflight)"),
+		ListDelimiterCheck:           fs.Bool("list-delimiter-check", false, "Check that listing with a delimiter returns the expected common prefixes"),
+		OperationSchedule:            fs.String("operation-schedule", "", "Comma separated list of operation=N running list_buckets, put_object, stat_object, get_object, copy_object or remove_object only every Nth latency cycle (e.g. put_object=10,remove_object=10)"),
+		DisableSDKRetries:            fs.Bool("disable-sdk-retries", false, "Send each S3 request once instead of letting the SDK retry it, so that latency reflects a single attempt (not applied on reload)"),
+		ClockSkewThreshold:           fs.Duration("clock-skew-threshold", 0, "Clock skew between the probe and the endpoint above which the clock skew check fails, checked at the durability probe rate (0 to disable the check)"),
+		ForceHTTP1:                   fs.Bool("force-http1", false, "Probe endpoints over HTTP/1.1 only, without negotiating HTTP/2 (the default transport of the SDK already stays on HTTP/1.1, this keeps it pinned)"),
+		LastModifiedCheck:            fs.Bool("last-modified-check", false, "Check that overwriting an object advances its LastModified"),
+		CanaryBucket:                 fs.String("canary-bucket", "", "Bucket holding the canary object, defaults to the latency bucket"),
+		CanaryObjectKey:              fs.String("canary-object", "", "Externally managed object read at the probe rate as the canary_get operation, without writing anything (empty to disable the check)"),
+		CanaryChecksum:               fs.String("canary-sha256", "", "Expected hex SHA-256 of the canary object (empty to skip the comparison)"),
+		DurabilityAccessKey:          fs.String("durability-s3-access-key", "", "User key of the S3 endpoint used by the durability checks (empty to use -s3-access-key)"),
+		DurabilitySecretKey:          fs.String("durability-s3-secret-key", "", "Access key of the S3 endpoint used by the durability checks"),
+		PrepareTimeout:               fs.Duration("prepare-timeout", 30*time.Minute, "Maximum duration of the preparation of the buckets of a probe, after which the service is skipped until the next discovery (0 for no limit). Writing the durability items of a new bucket takes longer with a larger -item-total"),
+		DurabilityLifecycleCheck:     fs.Bool("durability-lifecycle-check", false, "Check at the durability probe rate that no lifecycle rule of the durability bucket expires the durability items"),
+		BackendStatsRatePerMin:       fs.Int("backend-stats-rate", 0, "Rate of the checks reading the storage usage from the MinIO admin API, which requires admin credentials (0 to disable the check)"),
+		DurabilityInstanceCheck:      fs.Bool("durability-instance-check", false, "Also count the durability items on every healthy instance of a service and report when they disagree"),
+		ConnectTimeout:               fs.Duration("connect-timeout", 0, "Maximum duration of the connection and of the TLS handshake to an endpoint, independently of the operation timeouts (0 to keep the SDK defaults of 30s and 10s)"),
+		ConcurrentOverwriteWriters:   fs.Int("concurrent-overwrite-writers", 0, "Number of concurrent overwrites of the same key checked to resolve to a single version read by all GETs on each latency cycle (0 to disable the check)"),
+		EndpointIDLabel:              fs.Bool("endpoint-id-label", false, "Add to the metrics an endpoint_id label, a short hash of the endpoint host which ignores its scheme, credentials and port (not applied on reload)"),
+		KeyLengthCheckMax:            fs.Int("key-length-check-max", 0, "Longest object key checked to round-trip at the durability probe rate, keys from 64 characters up to this length are checked (0 to disable the check)"),
+		IncompleteUploadsCheck:       fs.Bool("incomplete-uploads-check", false, "Count the multipart uploads in progress in the latency and durability buckets at the durability probe rate"),
+		WarmupCycles:                 fs.Int("warmup-cycles", 0, "Number of first check cycles of a probe whose latencies go to s3_latency_warmup_histogram_seconds instead of the main histogram"),
+		DefaultS3Port:                fs.Int("default-s3-port", 80, "Port used for the endpoints of consul services registered without port, 443 for https endpoints"),
+		CopyDestinationBucket:        fs.String("copy-destination-bucket", "", "Bucket receiving server side copies of latency objects, enables the cross bucket copy check when set"),
+		FlappingStabilityWindow:      fs.Duration("flapping-stability-window", 0, "How long the discovered description of a flapping service must stay stable before its probe is recreated, 0 never delays recreation"),
+		ContentDispositionCheck:      fs.Bool("content-disposition-check", false, "Check that the Content-Disposition of objects survives the round trip to the endpoint"),
+		ManifestFile:                 fs.String("manifest-file", "", "Manifest of pre-seeded objects in the sha256sum format, when set the probe only verifies them and writes nothing"),
+		ManifestBucket:               fs.String("manifest-bucket", "", "Bucket holding the objects of the manifest, defaults to the durability bucket"),
+		DurabilityPerDatacenter:      fs.Bool("durability-per-datacenter", false, "Keep durability items in a bucket per datacenter, named after the durability bucket and the consul datacenter of the service"),
+		GatewayPrepareRequireAll:     fs.Bool("gateway-prepare-require-all", false, "Fail the preparation of a gateway probe when the bucket of any destination cannot be prepared, instead of probing the reachable ones"),
+		OverwriteCheck:               fs.Bool("overwrite-check", false, "Overwrite an object and check that the endpoint serves the new content"),
+		CapacityRampMax:              fs.Int("capacity-ramp-max", 0, "Maximum concurrency of the capacity ramp, a load test finding the concurrency at which latency degrades, 0 disables it"),
+		CapacityRampWindow:           fs.Duration("capacity-ramp-window", 5*time.Minute, "Maximum duration of a capacity ramp, shared equally by the concurrency levels"),
+		CapacityRampInterval:         fs.Duration("capacity-ramp-interval", 24*time.Hour, "How often the capacity ramp runs"),
+		CapacityLatencyThreshold:     fs.Duration("capacity-latency-threshold", time.Second, "90th percentile GET latency above which the capacity ramp stops and reports the knee concurrency"),
+		SSECWrongKeyCheck:            fs.Bool("sse-c-wrong-key-check", false, "Check that an SSE-C object cannot be read with a wrong customer key, the endpoint must be reached over HTTPS"),
+		GlobalMaxOpsPerMin:           fs.Int("global-max-ops-per-min", 0, "Maximum number of measured operations per minute across all probes, operations over the budget are skipped, 0 disables the limit. Requests outside of the measured operations, e.g. preparation, removal of the objects of the checks or gateway reads, are not limited"),
+		ConsulBlockingQueries:        fs.Bool("consul-blocking-queries", true, "Watch the consul catalog with blocking queries to discover services as soon as it changes, -interval remains as periodic reconciliation (not applied on reload)"),
+		ServiceInclude:               fs.String("service-include", "", "Regular expression matching the whole name of the services to probe, all services when empty"),
+		ServiceExclude:               fs.String("service-exclude", "", "Regular expression matching the whole name of the services not to probe, applied after -service-include"),
+		SDFile:                       fs.String("sd-file", "", "JSON file listing the services to probe in the Prometheus file_sd format, used instead of consul and read again when it changes"),
+		ShutdownTimeout:              fs.Duration("shutdown-timeout", 30*time.Second, "Maximum time to wait for in-flight checks to complete on SIGTERM or SIGINT"),
+		GlobalMaxConcurrentChecks:    fs.Int("global-max-concurrent-checks", 0, "Maximum number of checks running at the same time across all probes, checks over the cap are skipped, 0 disables the cap"),
+		TickPhaseOffset:              fs.Bool("tick-phase-offset", true, "Start the checks of each probe at a random offset within their interval, so that probes created together do not fire at the same instant"),
+		TickJitter:                   fs.Float64("tick-jitter", 0, "Fraction of the check intervals by which each interval randomly varies, in [0, 1)"),
+		PrepareRetryDelay:            fs.Duration("prepare-retry-delay", 10*time.Second, "Delay before retrying the preparation of a probe which failed, doubled on each consecutive failure"),
+		PrepareRetryMaxDelay:         fs.Duration("prepare-retry-max-delay", 5*time.Minute, "Maximum delay between retries of the preparation of a probe"),
+		ConnectService:               fs.String("connect-service", "", "Consul Connect service the probe gets its leaf certificate for, services with a Connect sidecar are then probed through it with mTLS"),
+		HybridDiscovery:              fs.Bool("hybrid-discovery", false, "Probe the services of both the discovery file and consul"),
+		DiscoveryPrecedence:          fs.String("discovery-precedence", "file", "With hybrid discovery, the source probed for services found in both: file or consul"),
+		MultipartUploadCheck:         fs.Bool("multipart-upload-check", false, "Upload an object in several parts at the latency probe rate, measuring the initiation, parts and completion of the upload"),
+		MultipartUploadParts:         fs.Int("multipart-upload-parts", 3, "Number of parts of the objects uploaded by the multipart upload check"),
+		MultipartPartSize:            fs.Int("multipart-part-size", 5*1024*1024, "Size of the parts uploaded by the multipart upload check, S3 requires 5MiB for all but the last part"),
+		ListPaginationCheck:          fs.Bool("list-pagination-check", false, "List objects kept in the latency bucket by pages at the latency probe rate, measuring each page"),
+		ListPaginationItems:          fs.Int("list-pagination-items", 1000, "Number of objects listed by the list pagination check"),
+		ListPaginationPageSize:       fs.Int("list-pagination-page-size", 100, "Number of keys per page of the list pagination check"),
+		BulkDeleteCheck:              fs.Bool("bulk-delete-check", false, "Write objects and remove them with a single multi-object delete at the latency probe rate"),
+		BulkDeleteItems:              fs.Int("bulk-delete-items", 10, "Number of objects removed by the multi-object delete of the bulk delete check"),
+		VersionedBucket:              fs.String("versioned-bucket", "", "Bucket with versioning enabled receiving the objects of the versioning round-trip check, enables the check when set. It must differ from the latency and durability buckets"),
+		TaggingCheck:                 fs.Bool("tagging-check", false, "Set a tag on the latency object and check that it is read back"),
+		AdminToken:                   fs.String("admin-token", "", "Bearer token required by the POST admin endpoints pausing, resuming and running probes on demand, no authentication when empty"),
+		ProbeHost:                    fs.String("probe-host", defaultProbeHost(), "Value of the probe_host label identifying this probe instance on all metrics"),
+		ContentMD5Check:              fs.Bool("content-md5-check", false, "Check that the endpoint accepts uploads sent with their Content-MD5"),
+		ContentMD5NegativeCheck:      fs.Bool("content-md5-negative-check", false, "Also check that uploads sent with a wrong Content-MD5 are rejected with BadDigest (requires -content-md5-check)"),
+	}
+}
+
+// applyConfigFile sets the flags listed in the file, one name=value per line.
+// Empty lines and lines starting with # are ignored, as are flags already set on the command line
+func applyConfigFile(fs *flag.FlagSet, path string) error {
+	if path == "" {
+		return nil
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	setOnCommandLine := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		setOnCommandLine[f.Name] = true
+	})
+
+	for i, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("%s:%d: expected name=value", path, i+1)
+		}
+		name := strings.TrimPrefix(strings.TrimSpace(parts[0]), "-")
+		if setOnCommandLine[name] {
+			continue
+		}
+		if err := fs.Set(name, strings.TrimSpace(parts[1])); err != nil {
+			return fmt.Errorf("%s:%d: %s", path, i+1, err)
+		}
+	}
+	return nil
+}
+
+// ChangedSettings returns the names of the fields whose value differs between two configurations
+func ChangedSettings(old Config, new Config) []string {
+	changed := []string{}
+	oldValue := reflect.ValueOf(old)
+	newValue := reflect.ValueOf(new)
+	for i := 0; i < oldValue.NumField(); i++ {
+		if !reflect.DeepEqual(oldValue.Field(i).Interface(), newValue.Field(i).Interface()) {
+			changed = append(changed, oldValue.Type().Field(i).Name)
+		}
+	}
+	return changed
+}
+
+// publicSettings are the settings served as is by Redacted, any setting missing here is left out
+// so that new settings are not exposed until they are reviewed
+var publicSettings = map[string]bool{
+	"ConsulAddr":                   true,
+	"Tag":                          true,
+	"GatewayTag":                   true,
+	"LatencyBucketName":            true,
+	"GatewayBucketName":            true,
+	"DurabilityBucketName":         true,
+	"Interval":                     true,
+	"Addr":                         true,
+	"ProbeRatePerMin":              true,
+	"DurabilityProbeRatePerMin":    true,
+	"LatencyItemSize":              true,
+	"DurabilityItemSize":           true,
+	"DurabilityItemTotal":          true,
+	"DurabilityTimeout":            true,
+	"LatencyTimeout":               true,
+	"CleanupDelay":                 true,
+	"UpThreshold":                  true,
+	"DownThreshold":                true,
+	"ACLCheck":                     true,
+	"CannedACL":                    true,
+	"PushgatewayAddr":              true,
+	"PushgatewayJob":               true,
+	"PushInterval":                 true,
+	"DurabilityListRetries":        true,
+	"DurabilityListRetryDelay":     true,
+	"AnonymousAccessCheck":         true,
+	"MaxGatewayReplicationWaits":   true,
+	"ListOrderCheck":               true,
+	"ListOrderItems":               true,
+	"DefaultOperationTimeout":      true,
+	"IdleThreshold":                true,
+	"GatewayIgnoredErrorCodes":     true,
+	"ExpectedVersioning":           true,
+	"RemediateVersioning":          true,
+	"SummaryOperations":            true,
+	"RemoveMissingObjectCheck":     true,
+	"DiscoveryConcurrency":         true,
+	"EndpointTemplate":             true,
+	"GatewayObjectsThreshold":      true,
+	"ProbeHost":                    true,
+	"ContentMD5Check":              true,
+	"ContentMD5NegativeCheck":      true,
+	"ConfigFile":                   true,
+	"MaxInflightOperations":        true,
+	"PresignedCheck":               true,
+	"PresignedExpectedStatus":      true,
+	"PresignedRange":               true,
+	"RepairDurabilityOnSizeChange": true,
+	"CompressionCheck":             true,
+	"DurabilityTolerance":          true,
+	"BucketScanName":               true,
+	"BucketScanRatePerMin":         true,
+	"BucketScanTimeout":            true,
+	"AmbiguousTagsPrecedence":      true,
+	"RestoreBucketName":            true,
+	"RestoreObjectName":            true,
+	"RestoreDays":                  true,
+	"MultipartAbortCheck":          true,
+	"ConcurrentGetRatePerMin":      true,
+	"ConcurrentGets":               true,
+	"CorsBucketName":               true,
+	"CorsExpectedFile":             true,
+	"CorsPreflightOrigin":          true,
+	"ListDelimiterCheck":           true,
+	"OperationSchedule":            true,
+	"DisableSDKRetries":            true,
+	"ClockSkewThreshold":           true,
+	"ForceHTTP1":                   true,
+	"LastModifiedCheck":            true,
+	"CanaryBucket":                 true,
+	"CanaryObjectKey":              true,
+	"CanaryChecksum":               true,
+	"PrepareTimeout":               true,
+	"DurabilityLifecycleCheck":     true,
+	"BackendStatsRatePerMin":       true,
+	"DurabilityInstanceCheck":      true,
+	"ConnectTimeout":               true,
+	"ConcurrentOverwriteWriters":   true,
+	"EndpointIDLabel":              true,
+	"KeyLengthCheckMax":            true,
+	"IncompleteUploadsCheck":       true,
+	"WarmupCycles":                 true,
+	"DefaultS3Port":                true,
+	"CopyDestinationBucket":        true,
+	"FlappingStabilityWindow":      true,
+	"ContentDispositionCheck":      true,
+	"ManifestFile":                 true,
+	"ManifestBucket":               true,
+	"DurabilityPerDatacenter":      true,
+	"GatewayPrepareRequireAll":     true,
+	"OverwriteCheck":               true,
+	"CapacityRampMax":              true,
+	"CapacityRampWindow":           true,
+	"CapacityRampInterval":         true,
+	"CapacityLatencyThreshold":     true,
+	"SSECWrongKeyCheck":            true,
+	"GlobalMaxOpsPerMin":           true,
+	"ConsulBlockingQueries":        true,
+	"ServiceInclude":               true,
+	"ServiceExclude":               true,
+	"SDFile":                       true,
+	"ShutdownTimeout":              true,
+	"GlobalMaxConcurrentChecks":    true,
+	"TickPhaseOffset":              true,
+	"TickJitter":                   true,
+	"PrepareRetryDelay":            true,
+	"PrepareRetryMaxDelay":         true,
+	"ConnectService":               true,
+	"HybridDiscovery":              true,
+	"DiscoveryPrecedence":          true,
+	"MultipartUploadCheck":         true,
+	"MultipartUploadParts":         true,
+	"MultipartPartSize":            true,
+	"ListPaginationCheck":          true,
+	"ListPaginationItems":          true,
+	"ListPaginationPageSize":       true,
+	"BulkDeleteCheck":              true,
+	"BulkDeleteItems":              true,
+	"VersionedBucket":              true,
+	"TaggingCheck":                 true,
+}
+
+// maskedSettings are the credentials served by Redacted with only a short prefix, to tell them apart
+var maskedSettings = map[string]bool{
+	"AccessKey":           true,
+	"DurabilityAccessKey": true,
+}
+
+// Redacted returns the effective settings by field name, limited to the public settings and the masked
+// credentials, durations are given in the Go duration format
+func Redacted(cfg Config) map[string]interface{} {
+	settings := map[string]interface{}{}
+	value := reflect.ValueOf(cfg)
+	for i := 0; i < value.NumField(); i++ {
+		name := value.Type().Field(i).Name
+		if !publicSettings[name] && !maskedSettings[name] {
+			continue
+		}
+		field := value.Field(i)
+		if field.Kind() == reflect.Ptr {
+			if field.IsNil() {
+				settings[name] = nil
+				continue
+			}
+			field = field.Elem()
+		}
+		switch {
+		case maskedSettings[name]:
+			settings[name] = maskSecret(field.String())
+		case field.Type() == reflect.TypeOf(time.Duration(0)):
+			settings[name] = time.Duration(field.Int()).String()
+		default:
+			settings[name] = field.Interface()
+		}
+	}
+	return settings
+}
+
+// maskSecret keeps the first characters of a credential
+func maskSecret(secret string) string {
+	if len(secret) <= 4 {
+		return "****"
+	}
+	return secret[:4] + "****"
+}
+
 func GetTestConfig() Config {
 	dummyValue := ""
 	accessKey := GetEnv("S3_ACCESS_KEY", "9PWM3PGAOU5TESTINGKEY")
@@ -70,30 +545,263 @@ func GetTestConfig() Config {
 	durabilityTimeout := time.Duration(60_000_000_000)
 	latencyTimeout := time.Duration(5_000_000_000)
 	cleanupDelay := time.Duration(0)
+	upThreshold := 1
+	downThreshold := 1
+	aclCheck := false
+	cannedACL := "private"
+	pushInterval := time.Duration(0)
+	durabilityListRetries := 0
+	durabilityListRetryDelay := time.Duration(0)
+	anonymousAccessCheck := false
+	maxGatewayReplicationWaits := 0
+	listOrderCheck := false
+	listOrderItems := 5
+	defaultOperationTimeout := time.Duration(60_000_000_000)
+	idleThreshold := time.Duration(0)
+	gatewayIgnoredErrorCodes := ""
+	expectedVersioning := ""
+	remediateVersioning := false
+	summaryOperations := ""
+	removeMissingObjectCheck := false
+	discoveryConcurrency := 2
+	endpointTemplate := ""
+	gatewayObjectsThreshold := 0
+	probeHost := "test-probe"
+	contentMD5Check := false
+	contentMD5NegativeCheck := false
+	configFile := ""
+	maxInflightOperations := 0
+	presignedCheck := false
+	presignedExpectedStatus := 200
+	presignedRange := ""
+	repairDurabilityOnSizeChange := false
+	compressionCheck := false
+	durabilityTolerance := "0"
+	bucketScanName := ""
+	bucketScanRatePerMin := 0
+	bucketScanTimeout := time.Duration(60_000_000_000)
+	ambiguousTagsPrecedence := "gateway"
+	restoreBucketName := ""
+	restoreObjectName := ""
+	restoreDays := 1
+	multipartAbortCheck := false
+	concurrentGetRatePerMin := 0
+	concurrentGets := 4
+	corsBucketName := ""
+	corsExpectedFile := ""
+	corsPreflightOrigin := ""
+	listDelimiterCheck := false
+	operationSchedule := ""
+	disableSDKRetries := false
+	clockSkewThreshold := time.Duration(0)
+	forceHTTP1 := false
+	lastModifiedCheck := false
+	canaryBucket := ""
+	canaryObjectKey := ""
+	canaryChecksum := ""
+	durabilityAccessKey := ""
+	durabilitySecretKey := ""
+	prepareTimeout := 30 * time.Minute
+	durabilityLifecycleCheck := false
+	backendStatsRatePerMin := 0
+	durabilityInstanceCheck := false
+	connectTimeout := time.Duration(0)
+	concurrentOverwriteWriters := 0
+	endpointIDLabel := false
+	keyLengthCheckMax := 0
+	incompleteUploadsCheck := false
+	warmupCycles := 0
+	defaultS3Port := 80
+	copyDestinationBucket := ""
+	flappingStabilityWindow := time.Duration(0)
+	contentDispositionCheck := false
+	manifestFile := ""
+	manifestBucket := ""
+	durabilityPerDatacenter := false
+	gatewayPrepareRequireAll := false
+	overwriteCheck := false
+	capacityRampMax := 0
+	capacityRampWindow := time.Minute
+	capacityRampInterval := time.Hour
+	capacityLatencyThreshold := time.Second
+	ssecWrongKeyCheck := false
+	globalMaxOpsPerMin := 0
+	consulBlockingQueries := false
+	serviceInclude := ""
+	serviceExclude := ""
+	sdFile := ""
+	shutdownTimeout := 5 * time.Second
+	globalMaxConcurrentChecks := 0
+	tickPhaseOffset := false
+	tickJitter := 0.0
+	prepareRetryDelay := 10 * time.Millisecond
+	prepareRetryMaxDelay := 100 * time.Millisecond
+	connectService := ""
+	hybridDiscovery := false
+	discoveryPrecedence := "file"
+	multipartUploadCheck := false
+	multipartUploadParts := 2
+	multipartPartSize := 5 * 1024 * 1024
+	listPaginationCheck := false
+	listPaginationItems := 5
+	listPaginationPageSize := 2
+	bulkDeleteCheck := false
+	bulkDeleteItems := 3
+	versionedBucket := ""
+	taggingCheck := false
+	adminToken := ""
 
 	return Config{
-		ConsulAddr:                &dummyValue,
-		Tag:                       &dummyValue,
-		GatewayTag:                &dummyValue,
-		LatencyBucketName:         &latencyBucketName,
-		GatewayBucketName:         &latencyBucketName,
-		DurabilityBucketName:      &durabilityBucketName,
-		Interval:                  &interval,
-		Addr:                      &dummyValue,
-		ProbeRatePerMin:           &probeRatePerMin,
-		DurabilityProbeRatePerMin: &durabilityProbeRatePerMin,
-		LatencyItemSize:           &latencyItemSize,
-		DurabilityItemSize:        &durabilityItemSize,
-		DurabilityItemTotal:       &durabilityItemTotal,
-		DurabilityTimeout:         &durabilityTimeout,
-		LatencyTimeout:            &latencyTimeout,
-		CleanupDelay:              &cleanupDelay,
+		ConsulAddr:                   &dummyValue,
+		Tag:                          &dummyValue,
+		GatewayTag:                   &dummyValue,
+		LatencyBucketName:            &latencyBucketName,
+		GatewayBucketName:            &latencyBucketName,
+		DurabilityBucketName:         &durabilityBucketName,
+		Interval:                     &interval,
+		Addr:                         &dummyValue,
+		ProbeRatePerMin:              &probeRatePerMin,
+		DurabilityProbeRatePerMin:    &durabilityProbeRatePerMin,
+		LatencyItemSize:              &latencyItemSize,
+		DurabilityItemSize:           &durabilityItemSize,
+		DurabilityItemTotal:          &durabilityItemTotal,
+		DurabilityTimeout:            &durabilityTimeout,
+		LatencyTimeout:               &latencyTimeout,
+		CleanupDelay:                 &cleanupDelay,
+		UpThreshold:                  &upThreshold,
+		DownThreshold:                &downThreshold,
+		ACLCheck:                     &aclCheck,
+		CannedACL:                    &cannedACL,
+		PushgatewayAddr:              &dummyValue,
+		PushgatewayJob:               &dummyValue,
+		PushInterval:                 &pushInterval,
+		DurabilityListRetries:        &durabilityListRetries,
+		DurabilityListRetryDelay:     &durabilityListRetryDelay,
+		AnonymousAccessCheck:         &anonymousAccessCheck,
+		MaxGatewayReplicationWaits:   &maxGatewayReplicationWaits,
+		ListOrderCheck:               &listOrderCheck,
+		ListOrderItems:               &listOrderItems,
+		DefaultOperationTimeout:      &defaultOperationTimeout,
+		IdleThreshold:                &idleThreshold,
+		GatewayIgnoredErrorCodes:     &gatewayIgnoredErrorCodes,
+		ExpectedVersioning:           &expectedVersioning,
+		RemediateVersioning:          &remediateVersioning,
+		SummaryOperations:            &summaryOperations,
+		RemoveMissingObjectCheck:     &removeMissingObjectCheck,
+		DiscoveryConcurrency:         &discoveryConcurrency,
+		EndpointTemplate:             &endpointTemplate,
+		GatewayObjectsThreshold:      &gatewayObjectsThreshold,
+		ProbeHost:                    &probeHost,
+		ContentMD5Check:              &contentMD5Check,
+		ContentMD5NegativeCheck:      &contentMD5NegativeCheck,
+		ConfigFile:                   &configFile,
+		MaxInflightOperations:        &maxInflightOperations,
+		PresignedCheck:               &presignedCheck,
+		PresignedExpectedStatus:      &presignedExpectedStatus,
+		PresignedRange:               &presignedRange,
+		RepairDurabilityOnSizeChange: &repairDurabilityOnSizeChange,
+		CompressionCheck:             &compressionCheck,
+		DurabilityTolerance:          &durabilityTolerance,
+		BucketScanName:               &bucketScanName,
+		BucketScanRatePerMin:         &bucketScanRatePerMin,
+		BucketScanTimeout:            &bucketScanTimeout,
+		AmbiguousTagsPrecedence:      &ambiguousTagsPrecedence,
+		RestoreBucketName:            &restoreBucketName,
+		RestoreObjectName:            &restoreObjectName,
+		RestoreDays:                  &restoreDays,
+		MultipartAbortCheck:          &multipartAbortCheck,
+		ConcurrentGetRatePerMin:      &concurrentGetRatePerMin,
+		ConcurrentGets:               &concurrentGets,
+		CorsBucketName:               &corsBucketName,
+		CorsExpectedFile:             &corsExpectedFile,
+		CorsPreflightOrigin:          &corsPreflightOrigin,
+		ListDelimiterCheck:           &listDelimiterCheck,
+		OperationSchedule:            &operationSchedule,
+		DisableSDKRetries:            &disableSDKRetries,
+		ClockSkewThreshold:           &clockSkewThreshold,
+		ForceHTTP1:                   &forceHTTP1,
+		LastModifiedCheck:            &lastModifiedCheck,
+		CanaryBucket:                 &canaryBucket,
+		CanaryObjectKey:              &canaryObjectKey,
+		CanaryChecksum:               &canaryChecksum,
+		DurabilityAccessKey:          &durabilityAccessKey,
+		DurabilitySecretKey:          &durabilitySecretKey,
+		PrepareTimeout:               &prepareTimeout,
+		DurabilityLifecycleCheck:     &durabilityLifecycleCheck,
+		BackendStatsRatePerMin:       &backendStatsRatePerMin,
+		DurabilityInstanceCheck:      &durabilityInstanceCheck,
+		ConnectTimeout:               &connectTimeout,
+		ConcurrentOverwriteWriters:   &concurrentOverwriteWriters,
+		EndpointIDLabel:              &endpointIDLabel,
+		KeyLengthCheckMax:            &keyLengthCheckMax,
+		IncompleteUploadsCheck:       &incompleteUploadsCheck,
+		WarmupCycles:                 &warmupCycles,
+		DefaultS3Port:                &defaultS3Port,
+		CopyDestinationBucket:        &copyDestinationBucket,
+		FlappingStabilityWindow:      &flappingStabilityWindow,
+		ContentDispositionCheck:      &contentDispositionCheck,
+		ManifestFile:                 &manifestFile,
+		ManifestBucket:               &manifestBucket,
+		DurabilityPerDatacenter:      &durabilityPerDatacenter,
+		GatewayPrepareRequireAll:     &gatewayPrepareRequireAll,
+		OverwriteCheck:               &overwriteCheck,
+		CapacityRampMax:              &capacityRampMax,
+		CapacityRampWindow:           &capacityRampWindow,
+		CapacityRampInterval:         &capacityRampInterval,
+		CapacityLatencyThreshold:     &capacityLatencyThreshold,
+		SSECWrongKeyCheck:            &ssecWrongKeyCheck,
+		GlobalMaxOpsPerMin:           &globalMaxOpsPerMin,
+		ConsulBlockingQueries:        &consulBlockingQueries,
+		ServiceInclude:               &serviceInclude,
+		ServiceExclude:               &serviceExclude,
+		SDFile:                       &sdFile,
+		ShutdownTimeout:              &shutdownTimeout,
+		GlobalMaxConcurrentChecks:    &globalMaxConcurrentChecks,
+		TickPhaseOffset:              &tickPhaseOffset,
+		TickJitter:                   &tickJitter,
+		PrepareRetryDelay:            &prepareRetryDelay,
+		PrepareRetryMaxDelay:         &prepareRetryMaxDelay,
+		ConnectService:               &connectService,
+		HybridDiscovery:              &hybridDiscovery,
+		DiscoveryPrecedence:          &discoveryPrecedence,
+		MultipartUploadCheck:         &multipartUploadCheck,
+		MultipartUploadParts:         &multipartUploadParts,
+		MultipartPartSize:            &multipartPartSize,
+		ListPaginationCheck:          &listPaginationCheck,
+		ListPaginationItems:          &listPaginationItems,
+		ListPaginationPageSize:       &listPaginationPageSize,
+		BulkDeleteCheck:              &bulkDeleteCheck,
+		BulkDeleteItems:              &bulkDeleteItems,
+		VersionedBucket:              &versionedBucket,
+		TaggingCheck:                 &taggingCheck,
+		AdminToken:                   &adminToken,
 
 		AccessKey: &accessKey,
 		SecretKey: &secretKey,
 	}
 }
 
+// ParseList splits a comma separated list, ignoring empty elements
+func ParseList(value string) []string {
+	list := []string{}
+	for _, element := range strings.Split(value, ",") {
+		element = strings.TrimSpace(element)
+		if element != "" {
+			list = append(list, element)
+		}
+	}
+	return list
+}
+
+// defaultProbeHost returns the hostname of the machine running the probe
+func defaultProbeHost() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "unknown"
+	}
+	return hostname
+}
+
 func GetEnv(env string, defaultVal string) string {
 	val := os.Getenv(env)
 	if val == "" {
@@ -0,0 +1,123 @@
+package config
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseList(t *testing.T) {
+	if list := ParseList(""); len(list) != 0 {
+		t.Errorf("Empty value should give an empty list, got %v", list)
+	}
+	list := ParseList("AccessDenied, MethodNotAllowed,,")
+	if !reflect.DeepEqual(list, []string{"AccessDenied", "MethodNotAllowed"}) {
+		t.Errorf("Unexpected list %v", list)
+	}
+}
+
+func TestApplyConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "probe.conf")
+	content := "# comment\n\nlatency-bucket = from-file\n-durability-bucket=from-file\n"
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg := newConfig(fs)
+	if err := fs.Parse([]string{"-durability-bucket", "from-command-line"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyConfigFile(fs, path); err != nil {
+		t.Fatalf("Config file should be applied: %s", err)
+	}
+	if *cfg.LatencyBucketName != "from-file" {
+		t.Errorf("Expected latency bucket from file, got %s", *cfg.LatencyBucketName)
+	}
+	if *cfg.DurabilityBucketName != "from-command-line" {
+		t.Errorf("Command line should take precedence, got %s", *cfg.DurabilityBucketName)
+	}
+}
+
+func TestApplyConfigFileRejectsUnknownFlag(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "probe.conf")
+	if err := ioutil.WriteFile(path, []byte("unknown=1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	newConfig(fs)
+	if err := applyConfigFile(fs, path); err == nil {
+		t.Error("Unknown flag should be rejected")
+	}
+}
+
+func TestValidateExpectedVersioning(t *testing.T) {
+	cfg := GetTestConfig()
+	for _, status := range []string{"", "Enabled", "Suspended"} {
+		*cfg.ExpectedVersioning = status
+		if err := validate(cfg); err != nil {
+			t.Errorf("Versioning status '%s' should be accepted: %s", status, err)
+		}
+	}
+	*cfg.ExpectedVersioning = "enabled"
+	if err := validate(cfg); err == nil {
+		t.Error("Unknown versioning status should be rejected")
+	}
+}
+
+func TestValidatePushInterval(t *testing.T) {
+	cfg := GetTestConfig()
+	if err := validate(cfg); err != nil {
+		t.Errorf("Push interval should be ignored without Pushgateway: %s", err)
+	}
+	*cfg.PushgatewayAddr = "localhost:9091"
+	if err := validate(cfg); err == nil {
+		t.Error("Zero push interval should be rejected")
+	}
+	*cfg.PushInterval = time.Minute
+	if err := validate(cfg); err != nil {
+		t.Errorf("Positive push interval should be accepted: %s", err)
+	}
+}
+
+func TestChangedSettings(t *testing.T) {
+	old := GetTestConfig()
+	new := GetTestConfig()
+	if changed := ChangedSettings(old, new); len(changed) != 0 {
+		t.Errorf("Identical configs should not differ, got %v", changed)
+	}
+	rate := *old.ProbeRatePerMin + 1
+	new.ProbeRatePerMin = &rate
+	if changed := ChangedSettings(old, new); !reflect.DeepEqual(changed, []string{"ProbeRatePerMin"}) {
+		t.Errorf("Unexpected changed settings %v", changed)
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := GetTestConfig()
+	settings := Redacted(cfg)
+	if _, ok := settings["SecretKey"]; ok {
+		t.Errorf("Secret key should be omitted")
+	}
+	if _, ok := settings["DurabilitySecretKey"]; ok {
+		t.Errorf("Durability secret key should be omitted")
+	}
+	if settings["AccessKey"] != (*cfg.AccessKey)[:4]+"****" {
+		t.Errorf("Access key should be masked, got %v", settings["AccessKey"])
+	}
+	if settings["LatencyTimeout"] != cfg.LatencyTimeout.String() {
+		t.Errorf("Durations should be formatted, got %v", settings["LatencyTimeout"])
+	}
+	if settings["ProbeRatePerMin"] != *cfg.ProbeRatePerMin {
+		t.Errorf("Unexpected probe rate %v", settings["ProbeRatePerMin"])
+	}
+
+	delete(publicSettings, "ProbeRatePerMin")
+	defer func() { publicSettings["ProbeRatePerMin"] = true }()
+	if _, ok := Redacted(cfg)["ProbeRatePerMin"]; ok {
+		t.Errorf("Settings missing from the public settings should be omitted")
+	}
+}
@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// endpointDecorations are the parts of an endpoint ignored by its identifier: scheme, credentials, port and trailing slash
+var endpointDecorations = regexp.MustCompile(`^([a-z]+://)?([^@/]*@)?([^:/]*)(:[0-9]*)?/*$`)
+
+// EndpointID returns a short identifier of an endpoint which doesn't change with
+// its scheme, credentials, port or case
+func EndpointID(endpoint string) string {
+	host := strings.ToLower(endpoint)
+	if match := endpointDecorations.FindStringSubmatch(host); match != nil {
+		host = match[3]
+	}
+	sum := sha256.Sum256([]byte(host))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+type endpointIDGatherer struct {
+	gatherer prometheus.Gatherer
+}
+
+// WithEndpointID adds an endpoint_id label, computed with EndpointID, to the gathered metrics having an endpoint label
+func WithEndpointID(gatherer prometheus.Gatherer) prometheus.Gatherer {
+	return endpointIDGatherer{gatherer: gatherer}
+}
+
+func (g endpointIDGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.gatherer.Gather()
+	for _, family := range families {
+		for _, metric := range family.Metric {
+			for _, label := range metric.Label {
+				if label.GetName() != "endpoint" {
+					continue
+				}
+				name, value := "endpoint_id", EndpointID(label.GetValue())
+				metric.Label = append(metric.Label, &dto.LabelPair{Name: &name, Value: &value})
+				sort.Slice(metric.Label, func(i, j int) bool {
+					return metric.Label[i].GetName() < metric.Label[j].GetName()
+				})
+				break
+			}
+		}
+	}
+	return families, err
+}
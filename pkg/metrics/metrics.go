@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+// Registerer holds the probe metrics until they are registered with Register,
+// which allows labels known only once the configuration is parsed to be attached
+var Registerer = &deferredRegisterer{}
+
+// Factory creates metrics held by Registerer
+var Factory = promauto.With(Registerer)
+
+type deferredRegisterer struct {
+	mu         sync.Mutex
+	collectors []prometheus.Collector
+}
+
+func (r *deferredRegisterer) Register(collector prometheus.Collector) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, collector)
+	return nil
+}
+
+func (r *deferredRegisterer) MustRegister(collectors ...prometheus.Collector) {
+	for _, collector := range collectors {
+		_ = r.Register(collector)
+	}
+}
+
+func (r *deferredRegisterer) Unregister(collector prometheus.Collector) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.collectors {
+		if r.collectors[i] == collector {
+			r.collectors = append(r.collectors[:i], r.collectors[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Collectors returns all the metrics held by Registerer
+func Collectors() []prometheus.Collector {
+	Registerer.mu.Lock()
+	defer Registerer.mu.Unlock()
+	return append([]prometheus.Collector{}, Registerer.collectors...)
+}
+
+// Register registers all the probe metrics on reg, labeled with the host running the probe
+func Register(reg prometheus.Registerer, probeHost string) error {
+	wrapped := prometheus.WrapRegistererWith(prometheus.Labels{"probe_host": probeHost}, reg)
+	for _, collector := range Collectors() {
+		if err := wrapped.Register(collector); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deletableCollector is a metric vector whose series can be deleted
+type deletableCollector interface {
+	prometheus.Collector
+	Delete(labels prometheus.Labels) bool
+}
+
+// DeleteSeries deletes the series of all the metrics held by Registerer whose label is set to value,
+// and returns how many were deleted
+func DeleteSeries(label string, value string) int {
+	return DeleteCollectorSeries(Collectors(), label, value)
+}
+
+// DeleteCollectorSeries deletes the series of the given metrics whose label is set to value,
+// and returns how many were deleted
+func DeleteCollectorSeries(collectors []prometheus.Collector, label string, value string) int {
+	deleted := 0
+	for _, collector := range collectors {
+		vec, ok := collector.(deletableCollector)
+		if !ok {
+			continue
+		}
+		// Series are deleted once collected, the vector is locked during collection
+		for _, labels := range matchingSeries(vec, label, value) {
+			if vec.Delete(labels) {
+				deleted++
+			}
+		}
+	}
+	return deleted
+}
+
+// matchingSeries returns the labels of the series of collector whose label is set to value
+func matchingSeries(collector prometheus.Collector, label string, value string) []prometheus.Labels {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		collector.Collect(ch)
+		close(ch)
+	}()
+	matching := []prometheus.Labels{}
+	for metric := range ch {
+		m := &io_prometheus_client.Metric{}
+		if err := metric.Write(m); err != nil {
+			continue
+		}
+		labels := prometheus.Labels{}
+		for _, pair := range m.GetLabel() {
+			labels[pair.GetName()] = pair.GetValue()
+		}
+		if v, ok := labels[label]; ok && v == value {
+			matching = append(matching, labels)
+		}
+	}
+	return matching
+}
@@ -0,0 +1,86 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/criteo/s3-probe/pkg/metrics"
+
+	minio "github.com/minio/minio-go/v7"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var s3ACLUnsupportedCounter = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_acl_unsupported_total",
+	Help: "Total number of ACL checks rejected with AccessControlListNotSupported because the bucket enforces owner ownership",
+}, []string{"endpoint"})
+
+var s3ACLMismatchCounter = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_acl_mismatch_total",
+	Help: "Total number of ACL checks where the ACL read back differs from the one set on upload",
+}, []string{"endpoint"})
+
+// isACLUnsupportedError tells whether the endpoint rejected an ACL because it enforces bucket owner
+// ownership, which is an expected configuration rather than a failure
+func isACLUnsupportedError(err error) bool {
+	return minio.ToErrorResponse(err).Code == "AccessControlListNotSupported"
+}
+
+// performACLCheck uploads an object with a canned ACL and checks the ACL returned by the endpoint
+func (p *Probe) performACLCheck() error {
+	objectName, _ := randomHex(20)
+	objectSize := int64(p.latencyItemSize)
+	objectData, _ := randomObject(objectSize)
+	defer p.cleanTempObject(p.endpoint.s3Client, p.latencyBucketName, objectName)
+
+	unsupported := false
+	putOptions := minio.PutObjectOptions{UserMetadata: map[string]string{"x-amz-acl": p.cannedACL}}
+	put := func(ctx context.Context) error {
+		_, err := p.endpoint.s3Client.PutObject(ctx, p.latencyBucketName, objectName, objectData, objectSize, putOptions)
+		if isACLUnsupportedError(err) {
+			unsupported = true
+			return nil
+		}
+		if err == nil {
+			s3BytesPutCounter.WithLabelValues(p.name).Add(float64(objectSize))
+		}
+		return err
+	}
+	if err := p.mesureOperation("put_object_acl", put); err != nil {
+		return err
+	}
+	if unsupported {
+		s3ACLUnsupportedCounter.WithLabelValues(p.name).Inc()
+		return nil
+	}
+
+	cannedACL := ""
+	operation := func(ctx context.Context) error {
+		objectInfo, err := p.endpoint.s3Client.GetObjectACL(ctx, p.latencyBucketName, objectName)
+		if isACLUnsupportedError(err) {
+			unsupported = true
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		cannedACL = objectInfo.Metadata.Get("X-Amz-Acl")
+		return nil
+	}
+	if err := p.mesureOperation("get_object_acl", operation); err != nil {
+		return err
+	}
+
+	if unsupported {
+		s3ACLUnsupportedCounter.WithLabelValues(p.name).Inc()
+		return nil
+	}
+	if cannedACL != p.cannedACL {
+		s3ACLMismatchCounter.WithLabelValues(p.name).Inc()
+		err := fmt.Errorf("ACL mismatch: expected %s got %s", p.cannedACL, cannedACL)
+		log.Printf("Error while checking object ACL (endpoint:%s): %s", p.name, err)
+		return err
+	}
+	return nil
+}
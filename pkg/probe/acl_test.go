@@ -0,0 +1,58 @@
+package probe
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+// newACLTestProbe returns a probe whose uploads with a canned ACL are rejected with code
+func newACLTestProbe(t *testing.T, name string, code string) Probe {
+	p, _ := newLatencyTestProbe(t, func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method != http.MethodPut || r.Header.Get("X-Amz-Acl") == "" {
+			return false
+		}
+		w.WriteHeader(http.StatusNotImplemented)
+		fmt.Fprintf(w, `<Error><Code>%s</Code><Message>acl</Message></Error>`, code)
+		return true
+	})
+	p.name = name
+	p.cannedACL = "private"
+	return p
+}
+
+func TestPerformACLCheckOwnerEnforced(t *testing.T) {
+	p := newACLTestProbe(t, "acl-owner-enforced", "AccessControlListNotSupported")
+	if err := p.performACLCheck(); err != nil {
+		t.Fatalf("Buckets enforcing owner ownership should not fail the check: %s", err)
+	}
+
+	metric := &io_prometheus_client.Metric{}
+	s3ACLUnsupportedCounter.WithLabelValues(p.name).Write(metric)
+	if *metric.Counter.Value != 1 {
+		t.Errorf("Expected 1 unsupported ACL check got %f", *metric.Counter.Value)
+	}
+	s3TotalCounter.WithLabelValues("put_object_acl", p.name, p.datacenter).Write(metric)
+	if *metric.Counter.Value != 1 {
+		t.Errorf("The upload with an ACL should be measured, got %f", *metric.Counter.Value)
+	}
+}
+
+func TestPerformACLCheckNotImplemented(t *testing.T) {
+	p := newACLTestProbe(t, "acl-not-implemented", "NotImplemented")
+	if err := p.performACLCheck(); err == nil {
+		t.Fatal("Backends not implementing ACLs should fail the check")
+	}
+
+	metric := &io_prometheus_client.Metric{}
+	s3ACLUnsupportedCounter.WithLabelValues(p.name).Write(metric)
+	if *metric.Counter.Value != 0 {
+		t.Errorf("Backends not implementing ACLs should not be counted as enforcing owner ownership")
+	}
+	s3SuccessCounter.WithLabelValues("put_object_acl", p.name, p.datacenter).Write(metric)
+	if *metric.Counter.Value != 0 {
+		t.Errorf("The failed upload should not be counted as a success")
+	}
+}
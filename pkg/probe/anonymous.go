@@ -0,0 +1,73 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+
+	"github.com/criteo/s3-probe/pkg/metrics"
+
+	minio "github.com/minio/minio-go/v7"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var s3UnexpectedAnonymousAccessCounter = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_unexpected_anonymous_access_total",
+	Help: "Total number of objects successfully read without credentials on a private bucket",
+}, []string{"endpoint"})
+
+var errAnonymousAccessAllowed = errors.New("object could be read anonymously")
+
+// performAnonymousAccessCheck checks that an object can be read with the probe
+// credentials but not anonymously
+func (p *Probe) performAnonymousAccessCheck() error {
+	objectName, _ := randomHex(20)
+	objectSize := int64(p.latencyItemSize)
+	objectData, _ := randomObject(objectSize)
+	defer p.cleanTempObject(p.endpoint.s3Client, p.latencyBucketName, objectName)
+
+	ctx, cancel := p.newContext(0)
+	defer cancel()
+	_, err := p.endpoint.s3Client.PutObject(ctx, p.latencyBucketName, objectName, objectData, objectSize, minio.PutObjectOptions{})
+	if err != nil {
+		log.Printf("Error while uploading object for anonymous access check (endpoint:%s): %s", p.name, err)
+		return err
+	}
+	s3BytesPutCounter.WithLabelValues(p.name).Add(float64(objectSize))
+
+	operation := func(ctx context.Context) error {
+		n, err := readObject(ctx, p.endpoint.s3Client, p.latencyBucketName, objectName)
+		s3BytesGetCounter.WithLabelValues(p.name).Add(float64(n))
+		return err
+	}
+	if err := p.mesureOperation("authenticated_get_object", operation); err != nil {
+		return err
+	}
+
+	anonymousCtx, anonymousCancel := p.newContext(p.latencyTimeout)
+	defer anonymousCancel()
+	n, err := readObject(anonymousCtx, p.anonymousClient, p.latencyBucketName, objectName)
+	s3BytesGetCounter.WithLabelValues(p.name).Add(float64(n))
+	if err == nil {
+		s3UnexpectedAnonymousAccessCounter.WithLabelValues(p.name).Inc()
+		log.Printf("Error while checking anonymous access (endpoint:%s): %s", p.name, errAnonymousAccessAllowed)
+		return errAnonymousAccessAllowed
+	}
+	if minio.ToErrorResponse(err).Code != "AccessDenied" {
+		log.Printf("Error while checking anonymous access (endpoint:%s): %s", p.name, err)
+		return err
+	}
+	return nil
+}
+
+// readObject fully reads an object, returning the number of bytes read and any error met on the way
+func readObject(ctx context.Context, client *minio.Client, bucketName string, objectName string) (int64, error) {
+	obj, err := client.GetObject(ctx, bucketName, objectName, minio.GetObjectOptions{})
+	if err != nil {
+		return 0, err
+	}
+	defer obj.Close()
+	return io.Copy(ioutil.Discard, obj)
+}
@@ -0,0 +1,66 @@
+package probe
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/criteo/s3-probe/pkg/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var s3BackendFreeBytes = metrics.Factory.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "s3_backend_free_bytes",
+	Help: "Free space in bytes reported by the storage backend of S3 endpoint",
+}, []string{"endpoint"})
+
+var s3BackendQuotaUsedRatio = metrics.Factory.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "s3_backend_quota_used_ratio",
+	Help: "Ratio of the storage capacity of S3 endpoint already used",
+}, []string{"endpoint"})
+
+// backendStatsPath is the MinIO admin API reporting the usage of the disks
+const backendStatsPath = "/minio/admin/v3/storageinfo"
+
+// backendStorageInfo is the subset of the MinIO storage info used by the probe
+type backendStorageInfo struct {
+	Disks []struct {
+		TotalSpace     uint64 `json:"totalspace"`
+		UsedSpace      uint64 `json:"usedspace"`
+		AvailableSpace uint64 `json:"availspace"`
+	}
+}
+
+// performBackendStatsCheck reads the storage usage from the MinIO admin API.
+// Backends without this API are skipped
+func (p *Probe) performBackendStatsCheck() error {
+	ctx, cancel := p.newContext(0)
+	defer cancel()
+	resp, err := p.doSignedPathRequest(ctx, http.MethodGet, backendStatsPath, "", nil, "us-east-1")
+	if err != nil {
+		log.Printf("Error while getting backend stats (endpoint:%s): %s", p.name, err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	var info backendStorageInfo
+	if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&info) != nil || len(info.Disks) == 0 {
+		log.Printf("Backend stats are not available on %s (status %d), skipping", p.name, resp.StatusCode)
+		return nil
+	}
+
+	var total, used, free uint64
+	for _, disk := range info.Disks {
+		total += disk.TotalSpace
+		used += disk.UsedSpace
+		free += disk.AvailableSpace
+	}
+	if total == 0 {
+		return fmt.Errorf("backend of %s reports no capacity", p.name)
+	}
+	s3BackendFreeBytes.WithLabelValues(p.name).Set(float64(free))
+	s3BackendQuotaUsedRatio.WithLabelValues(p.name).Set(float64(used) / float64(total))
+	return nil
+}
@@ -0,0 +1,60 @@
+package probe
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+func newBackendStatsTestProbe(t *testing.T, handler http.HandlerFunc) Probe {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client, err := newMinioClientFromEndpoint(server.URL, "access", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Probe{
+		name:                    server.URL,
+		endpoint:                S3Endpoint{Name: server.URL, s3Client: client},
+		accessKey:               "access",
+		secretKey:               "secret",
+		defaultOperationTimeout: time.Second,
+	}
+}
+
+func TestPerformBackendStatsCheck(t *testing.T) {
+	p := newBackendStatsTestProbe(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != backendStatsPath || r.Header.Get("Authorization") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"Disks": [{"totalspace": 100, "usedspace": 30, "availspace": 70}, {"totalspace": 100, "usedspace": 50, "availspace": 50}]}`))
+	})
+	if err := p.performBackendStatsCheck(); err != nil {
+		t.Fatal(err)
+	}
+
+	metric := &io_prometheus_client.Metric{}
+	s3BackendFreeBytes.WithLabelValues(p.name).Write(metric)
+	if *metric.Gauge.Value != 120 {
+		t.Errorf("Expected 120 free bytes got %f", *metric.Gauge.Value)
+	}
+	s3BackendQuotaUsedRatio.WithLabelValues(p.name).Write(metric)
+	if *metric.Gauge.Value != 0.4 {
+		t.Errorf("Expected a used ratio of 0.4 got %f", *metric.Gauge.Value)
+	}
+}
+
+func TestPerformBackendStatsCheckSkipsUnsupportedBackend(t *testing.T) {
+	p := newBackendStatsTestProbe(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`<Error><Code>NoSuchBucket</Code></Error>`))
+	})
+	if err := p.performBackendStatsCheck(); err != nil {
+		t.Errorf("Backend without stats should be skipped: %s", err)
+	}
+}
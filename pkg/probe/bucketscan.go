@@ -0,0 +1,57 @@
+package probe
+
+import (
+	"log"
+
+	"github.com/criteo/s3-probe/pkg/metrics"
+
+	minio "github.com/minio/minio-go/v7"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var s3BucketObjectCount = metrics.Factory.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "s3_bucket_object_count",
+	Help: "Number of objects in the scanned bucket",
+}, []string{"endpoint", "bucket"})
+
+var s3BucketTotalBytes = metrics.Factory.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "s3_bucket_total_bytes",
+	Help: "Total size in bytes of the objects in the scanned bucket",
+}, []string{"endpoint", "bucket"})
+
+var s3BucketScanSkippedCounter = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_bucket_scan_skipped_total",
+	Help: "Total number of bucket scans skipped because the previous one was still running",
+}, []string{"endpoint", "bucket"})
+
+// performBucketScan lists the whole scanned bucket to aggregate its object count and size.
+// Scans don't overlap, a scan is skipped while the previous one is still running
+func (p *Probe) performBucketScan() error {
+	select {
+	case p.bucketScanSlot <- struct{}{}:
+		defer func() { <-p.bucketScanSlot }()
+	default:
+		s3BucketScanSkippedCounter.WithLabelValues(p.name, p.bucketScanName).Inc()
+		return nil
+	}
+
+	ctx, cancel := p.newContext(p.bucketScanTimeout)
+	defer cancel()
+
+	count := 0
+	size := int64(0)
+	// ListObjects follows the continuation tokens until the whole bucket is listed
+	objectCh := p.endpoint.s3Client.ListObjects(ctx, p.bucketScanName, minio.ListObjectsOptions{Recursive: true})
+	for object := range objectCh {
+		if object.Err != nil {
+			log.Printf("Error while scanning bucket (endpoint:%s, bucket:%s): %s", p.name, p.bucketScanName, object.Err)
+			return object.Err
+		}
+		count++
+		size += object.Size
+	}
+
+	s3BucketObjectCount.WithLabelValues(p.name, p.bucketScanName).Set(float64(count))
+	s3BucketTotalBytes.WithLabelValues(p.name, p.bucketScanName).Set(float64(size))
+	return nil
+}
@@ -0,0 +1,82 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/criteo/s3-probe/pkg/metrics"
+
+	minio "github.com/minio/minio-go/v7"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var s3BulkDeleteFailedObjectsCounter = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_bulk_delete_failed_objects_total",
+	Help: "Total number of objects the multi-object delete of the bulk delete check failed to remove",
+}, []string{"endpoint", "code"})
+
+var s3BulkDeletePartialFailureCounter = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_bulk_delete_partial_failures_total",
+	Help: "Total number of multi-object deletes of the bulk delete check removing only some of the objects",
+}, []string{"endpoint"})
+
+// performBulkDeleteCheck writes small objects and removes them with a single multi-object delete,
+// the objects the endpoint fails to remove are counted by error code then removed one by one
+func (p *Probe) performBulkDeleteCheck() error {
+	prefixSuffix, _ := randomHex(8)
+	prefix := fmt.Sprintf("bulk-delete-%s/", prefixSuffix)
+	objectSize := int64(p.latencyItemSize)
+
+	objectNames := []string{}
+	for i := 0; i < p.bulkDeleteItems; i++ {
+		objectName := fmt.Sprintf("%s%04d", prefix, i)
+		objectData, _ := randomObject(objectSize)
+
+		ctx, cancel := p.newContext(0)
+		_, err := p.endpoint.s3Client.PutObject(ctx, p.latencyBucketName, objectName, objectData, objectSize, minio.PutObjectOptions{})
+		cancel()
+		if err != nil {
+			log.Printf("Error while uploading object for bulk delete check (endpoint:%s): %s", p.name, err)
+			p.cleanTempObject(p.endpoint.s3Client, p.latencyBucketName, objectNames...)
+			return err
+		}
+		s3BytesPutCounter.WithLabelValues(p.name).Add(float64(objectSize))
+		objectNames = append(objectNames, objectName)
+	}
+
+	failed := []minio.RemoveObjectError{}
+	operation := func(ctx context.Context) error {
+		failed = failed[:0]
+		objectsCh := make(chan minio.ObjectInfo, len(objectNames))
+		for _, objectName := range objectNames {
+			objectsCh <- minio.ObjectInfo{Key: objectName}
+		}
+		close(objectsCh)
+		for removeErr := range p.endpoint.s3Client.RemoveObjects(ctx, p.latencyBucketName, objectsCh, minio.RemoveObjectsOptions{}) {
+			failed = append(failed, removeErr)
+		}
+		if len(failed) > 0 {
+			return fmt.Errorf("%d of %d objects were not removed: %w", len(failed), len(objectNames), failed[0].Err)
+		}
+		return nil
+	}
+	if err := p.mesureOperation("remove_objects", operation); err != nil {
+		if errors.Is(err, errGlobalRateLimited) {
+			p.cleanTempObject(p.endpoint.s3Client, p.latencyBucketName, objectNames...)
+			return err
+		}
+		if len(failed) > 0 && len(failed) < len(objectNames) {
+			s3BulkDeletePartialFailureCounter.WithLabelValues(p.name).Inc()
+		}
+		remaining := []string{}
+		for _, removeErr := range failed {
+			s3BulkDeleteFailedObjectsCounter.WithLabelValues(p.name, minio.ToErrorResponse(removeErr.Err).Code).Inc()
+			remaining = append(remaining, removeErr.ObjectName)
+		}
+		p.cleanTempObject(p.endpoint.s3Client, p.latencyBucketName, remaining...)
+		return err
+	}
+	return nil
+}
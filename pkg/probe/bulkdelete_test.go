@@ -0,0 +1,68 @@
+package probe
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+func TestPerformBulkDeleteCheck(t *testing.T) {
+	p, requests := newLatencyTestProbe(t, nil)
+	if err := p.performBulkDeleteCheck(); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "PUT,PUT,PUT,POST"; operations(requests()) != expected {
+		t.Errorf("Expected requests %s got %v", expected, requests())
+	}
+}
+
+func TestPerformBulkDeleteCheckPartialFailure(t *testing.T) {
+	p, requests := newLatencyTestProbe(t, func(w http.ResponseWriter, r *http.Request) bool {
+		if _, ok := r.URL.Query()["delete"]; !ok {
+			return false
+		}
+		removeObjects(w, r, map[string][]byte{}, func(key string) string {
+			if strings.HasSuffix(key, "0001") {
+				return "SlowDown"
+			}
+			return ""
+		})
+		return true
+	})
+	if err := p.performBulkDeleteCheck(); err == nil {
+		t.Fatal("Bulk delete check should fail when an object is not removed")
+	}
+	last := requests()[len(requests())-1]
+	if !strings.HasPrefix(last, "DELETE") || !strings.HasSuffix(last, "0001") {
+		t.Errorf("The object left behind should be removed, got %v", requests())
+	}
+
+	metric := &io_prometheus_client.Metric{}
+	s3BulkDeleteFailedObjectsCounter.WithLabelValues(p.name, "SlowDown").Write(metric)
+	if *metric.Counter.Value != 1 {
+		t.Errorf("Expected 1 failed object got %f", *metric.Counter.Value)
+	}
+	s3BulkDeletePartialFailureCounter.WithLabelValues(p.name).Write(metric)
+	if *metric.Counter.Value != 1 {
+		t.Errorf("Expected 1 partial failure got %f", *metric.Counter.Value)
+	}
+}
+
+func TestCleanTempObjectWaitsOnceForSeveralObjects(t *testing.T) {
+	p, requests := newLatencyTestProbe(t, nil)
+	clock := &fakeClock{}
+	p.clock = clock
+	p.cleanupDelay = time.Minute
+
+	p.cleanTempObject(p.endpoint.s3Client, p.latencyBucketName, "leftover-1", "leftover-2", "leftover-3")
+	for clock.tickerCount() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	clock.advance(time.Minute)
+	if deletes := strings.Count(operations(requests()), "DELETE"); deletes != 3 || clock.tickerCount() != 1 {
+		t.Errorf("Expected the 3 objects to be removed after a single delay, got %v after %d delays", requests(), clock.tickerCount())
+	}
+}
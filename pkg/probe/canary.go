@@ -0,0 +1,44 @@
+package probe
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	minio "github.com/minio/minio-go/v7"
+)
+
+// performCanaryCheck reads an object managed outside of the probe, so that
+// read-only credentials can probe a known-good object
+func (p *Probe) performCanaryCheck() error {
+	operation := func(ctx context.Context) error {
+		return p.readCanaryObject(ctx)
+	}
+	return p.mesureOperation("canary_get", operation)
+}
+
+// readCanaryObject reads the canary object and, if configured, compares its SHA-256 to the expected one
+func (p *Probe) readCanaryObject(ctx context.Context) error {
+	obj, err := p.endpoint.s3Client.GetObject(ctx, p.canaryBucketName, p.canaryObjectKey, minio.GetObjectOptions{})
+	if err != nil {
+		return err
+	}
+	defer obj.Close()
+
+	hash := sha256.New()
+	n, err := io.Copy(hash, obj)
+	s3BytesGetCounter.WithLabelValues(p.name).Add(float64(n))
+	if err != nil {
+		return err
+	}
+	if p.canaryChecksum == "" {
+		return nil
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != strings.ToLower(p.canaryChecksum) {
+		return fmt.Errorf("canary object %s/%s has SHA-256 %s, expected %s", p.canaryBucketName, p.canaryObjectKey, sum, p.canaryChecksum)
+	}
+	return nil
+}
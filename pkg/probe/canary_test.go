@@ -0,0 +1,51 @@
+package probe
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReadCanaryObject(t *testing.T) {
+	content := []byte("canary")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.URL.Query()["location"]; ok {
+			w.Write([]byte(`<LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/">us-east-1</LocationConstraint>`))
+			return
+		}
+		if r.Method != http.MethodGet || r.URL.Path != "/production/canary.txt" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Last-Modified", "Tue, 01 Jun 2021 10:00:00 GMT")
+		w.Header().Set("ETag", `"canary"`)
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	client, err := newMinioClientFromEndpoint(server.URL, "access", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(content)
+	p := Probe{
+		name:             "test",
+		endpoint:         S3Endpoint{Name: server.URL, s3Client: client},
+		canaryBucketName: "production",
+		canaryObjectKey:  "canary.txt",
+	}
+	if err := p.readCanaryObject(context.Background()); err != nil {
+		t.Errorf("Canary without checksum should be read: %s", err)
+	}
+	p.canaryChecksum = hex.EncodeToString(sum[:])
+	if err := p.readCanaryObject(context.Background()); err != nil {
+		t.Errorf("Canary with the expected checksum should be read: %s", err)
+	}
+	p.canaryChecksum = hex.EncodeToString(make([]byte, sha256.Size))
+	if err := p.readCanaryObject(context.Background()); err == nil {
+		t.Errorf("Canary with a different checksum should fail")
+	}
+}
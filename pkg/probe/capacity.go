@@ -0,0 +1,141 @@
+package probe
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/criteo/s3-probe/pkg/metrics"
+
+	minio "github.com/minio/minio-go/v7"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var s3CapacityLatency = metrics.Factory.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "s3_capacity_latency_seconds",
+	Help: "90th percentile GET latency at each concurrency level of the last capacity ramp",
+}, []string{"endpoint", "concurrency"})
+
+var s3CapacityKneeConcurrency = metrics.Factory.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "s3_capacity_knee_concurrency",
+	Help: "Concurrency at which the GET latency crossed the threshold during the last capacity ramp, 0 if it never did",
+}, []string{"endpoint"})
+
+// capacityLevel is the outcome of a concurrency level of a capacity ramp
+type capacityLevel struct {
+	latency time.Duration
+	failed  bool
+}
+
+// latencyPercentile returns the given percentile of the latencies, which are sorted in place
+func latencyPercentile(latencies []time.Duration, percentile float64) time.Duration {
+	if len(latencies) == 0 {
+		return 0
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	index := int(percentile * float64(len(latencies)-1))
+	return latencies[index]
+}
+
+// kneeConcurrency returns the first concurrency, starting at 1, whose level failed or whose
+// latency exceeds the threshold, or 0 if none did
+func kneeConcurrency(levels []capacityLevel, threshold time.Duration) int {
+	for i, level := range levels {
+		if level.failed || level.latency > threshold {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// performCapacityRamp reads an object with a concurrency growing from 1 to the configured
+// maximum, each level lasting an equal share of the ramp window. The ramp stops at the
+// first level whose latency crosses the threshold so that the endpoint isn't loaded further
+func (p *Probe) performCapacityRamp() error {
+	select {
+	case p.capacityRampSlot <- struct{}{}:
+		defer func() { <-p.capacityRampSlot }()
+	default:
+		log.Printf("Capacity ramp still running on %s, skipping", p.name)
+		return nil
+	}
+
+	objectName, _ := randomHex(20)
+	objectSize := int64(p.latencyItemSize)
+	objectData, _ := randomObject(objectSize)
+	defer p.cleanTempObject(p.endpoint.s3Client, p.latencyBucketName, objectName)
+
+	ctx, cancel := p.newContext(0)
+	defer cancel()
+	_, err := p.endpoint.s3Client.PutObject(ctx, p.latencyBucketName, objectName, objectData, objectSize, minio.PutObjectOptions{})
+	if err != nil {
+		log.Printf("Error while uploading object for capacity ramp (endpoint:%s): %s", p.name, err)
+		return err
+	}
+	s3BytesPutCounter.WithLabelValues(p.name).Add(float64(objectSize))
+
+	rampCtx, rampCancel := p.newContext(p.capacityRampWindow)
+	defer rampCancel()
+	levelDuration := p.capacityRampWindow / time.Duration(p.capacityRampMax)
+	levels := []capacityLevel{}
+	for concurrency := 1; concurrency <= p.capacityRampMax && rampCtx.Err() == nil; concurrency++ {
+		level := p.runCapacityLevel(rampCtx, objectName, concurrency, levelDuration)
+		levels = append(levels, level)
+		s3CapacityLatency.WithLabelValues(p.name, strconv.Itoa(concurrency)).Set(level.latency.Seconds())
+		if kneeConcurrency(levels, p.capacityLatencyThreshold) != 0 {
+			break
+		}
+	}
+	knee := kneeConcurrency(levels, p.capacityLatencyThreshold)
+	s3CapacityKneeConcurrency.WithLabelValues(p.name).Set(float64(knee))
+	log.Printf("Capacity ramp on %s reached concurrency %d, knee: %d", p.name, len(levels), knee)
+	return nil
+}
+
+// runCapacityLevel reads the object with concurrent readers for the given duration
+func (p *Probe) runCapacityLevel(parent context.Context, objectName string, concurrency int, duration time.Duration) capacityLevel {
+	ctx, cancel := context.WithTimeout(parent, duration)
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	level := capacityLevel{}
+	latencies := []time.Duration{}
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				start := p.clock.Now()
+				err := p.readCapacityObject(ctx, objectName)
+				latency := p.clock.Now().Sub(start)
+				mu.Lock()
+				if err == nil {
+					latencies = append(latencies, latency)
+				} else if ctx.Err() == nil {
+					level.failed = true
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	level.latency = latencyPercentile(latencies, 0.9)
+	return level
+}
+
+func (p *Probe) readCapacityObject(ctx context.Context, objectName string) error {
+	obj, err := p.endpoint.s3Client.GetObject(ctx, p.latencyBucketName, objectName, minio.GetObjectOptions{})
+	if err != nil {
+		return err
+	}
+	defer obj.Close()
+	n, err := io.Copy(ioutil.Discard, obj)
+	s3BytesGetCounter.WithLabelValues(p.name).Add(float64(n))
+	return err
+}
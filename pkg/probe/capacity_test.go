@@ -0,0 +1,33 @@
+package probe
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyPercentile(t *testing.T) {
+	latencies := []time.Duration{}
+	for i := 10; i >= 1; i-- {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	if p := latencyPercentile(latencies, 0.9); p != 9*time.Millisecond {
+		t.Errorf("Expected 9ms got %s", p)
+	}
+	if p := latencyPercentile(nil, 0.9); p != 0 {
+		t.Errorf("Expected 0 without latencies got %s", p)
+	}
+}
+
+func TestKneeConcurrency(t *testing.T) {
+	levels := []capacityLevel{{latency: 10 * time.Millisecond}, {latency: 20 * time.Millisecond}, {latency: 200 * time.Millisecond}}
+	if knee := kneeConcurrency(levels, 100*time.Millisecond); knee != 3 {
+		t.Errorf("Expected knee at 3 got %d", knee)
+	}
+	if knee := kneeConcurrency(levels, time.Second); knee != 0 {
+		t.Errorf("Expected no knee got %d", knee)
+	}
+	levels[1].failed = true
+	if knee := kneeConcurrency(levels, time.Second); knee != 2 {
+		t.Errorf("Expected failures to be the knee, got %d", knee)
+	}
+}
@@ -0,0 +1,42 @@
+package probe
+
+import (
+	"time"
+)
+
+// clock is the time source of a probe, it is replaced in tests to drive
+// tickers and sleeps without real delays
+type clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) ticker
+	Sleep(d time.Duration)
+}
+
+// ticker delivers ticks on its channel until it is stopped
+type ticker interface {
+	Chan() <-chan time.Time
+	Stop()
+}
+
+// systemClock is the clock backed by the time package
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTicker(d time.Duration) ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+func (systemClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+type systemTicker struct {
+	*time.Ticker
+}
+
+func (t systemTicker) Chan() <-chan time.Time {
+	return t.C
+}
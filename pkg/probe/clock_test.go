@@ -0,0 +1,121 @@
+package probe
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock hands out tickers fired manually by the test
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	tickers []*fakeTicker
+	slept   []time.Duration
+}
+
+type fakeTicker struct {
+	interval time.Duration
+	c        chan time.Time
+	stopped  bool
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) NewTicker(d time.Duration) ticker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTicker{interval: d, c: make(chan time.Time, 1)}
+	c.tickers = append(c.tickers, t)
+	return t
+}
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.slept = append(c.slept, d)
+	c.now = c.now.Add(d)
+}
+
+// advance moves the clock forward and fires the tickers whose interval elapsed
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	for _, t := range c.tickers {
+		if !t.stopped && d >= t.interval {
+			select {
+			case t.c <- c.now:
+			default:
+			}
+		}
+	}
+}
+
+func (c *fakeClock) tickerCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.tickers)
+}
+
+func (t *fakeTicker) Chan() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTicker) Stop() {
+	t.stopped = true
+}
+
+func TestTimerTicksAtTheConfiguredRate(t *testing.T) {
+	clock := &fakeClock{}
+	timer := newTimer(clock, 4)
+	defer timer.Stop()
+
+	if clock.tickers[0].interval != 15*time.Second {
+		t.Errorf("Expected a 15s interval for 4 checks per minute got %s", clock.tickers[0].interval)
+	}
+	clock.advance(15 * time.Second)
+	select {
+	case <-timer.C:
+	default:
+		t.Errorf("Expected a tick once the interval elapsed")
+	}
+}
+
+func TestSleepContextWaitsForTheClock(t *testing.T) {
+	clock := &fakeClock{}
+	p := Probe{clock: clock}
+
+	done := make(chan error, 1)
+	go func() { done <- p.sleepContext(context.Background(), time.Hour) }()
+	for clock.tickerCount() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-done:
+		t.Fatalf("Sleep returned before the delay elapsed")
+	default:
+	}
+	clock.advance(time.Hour)
+	if err := <-done; err != nil {
+		t.Errorf("Expected sleep to complete got %s", err)
+	}
+	if !clock.tickers[0].stopped {
+		t.Errorf("Expected the sleep ticker to be stopped")
+	}
+}
+
+func TestSleepContextStopsWithContext(t *testing.T) {
+	p := Probe{clock: &fakeClock{}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := p.sleepContext(ctx, time.Hour); err != context.Canceled {
+		t.Errorf("Expected the cancellation to interrupt the sleep got %v", err)
+	}
+}
@@ -0,0 +1,52 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/criteo/s3-probe/pkg/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var s3EndpointClockSkew = metrics.Factory.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "s3_endpoint_clock_skew_seconds",
+	Help: "Difference between the clock of the S3 endpoint, as given by the Date header of its responses, and the clock of the probe",
+}, []string{"endpoint"})
+
+// performClockSkewCheck compares the date of a response of the endpoint with the local clock.
+// SigV4 rejects requests whose date is more than 15 minutes off, skews above the threshold are reported before that happens
+func (p *Probe) performClockSkewCheck() error {
+	var trace *operationTrace
+	var sent, received time.Time
+	operation := func(ctx context.Context) error {
+		trace = traceFromContext(ctx)
+		sent = time.Now()
+		_, err := p.endpoint.s3Client.ListBuckets(ctx)
+		received = time.Now()
+		return err
+	}
+	if err := p.mesureOperation("clock_skew_list_buckets", operation); err != nil {
+		return err
+	}
+
+	serverDate, err := http.ParseTime(trace.responseDate())
+	if err != nil {
+		log.Printf("Error while reading the date of the endpoint (endpoint:%s): %s", p.name, err)
+		return err
+	}
+	// The Date header has a one second resolution, compare it with the middle of the request
+	localDate := sent.Add(received.Sub(sent) / 2)
+	skew := serverDate.Sub(localDate)
+	s3EndpointClockSkew.WithLabelValues(p.name).Set(skew.Seconds())
+
+	if skew > p.clockSkewThreshold || skew < -p.clockSkewThreshold {
+		err := fmt.Errorf("clock of the endpoint is %s off the probe clock", skew)
+		log.Printf("Error while checking clock skew (endpoint:%s): %s", p.name, err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package probe
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newClockSkewTestProbe(t *testing.T, skew time.Duration) Probe {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Now().Add(skew).UTC().Format(http.TimeFormat))
+		w.Write([]byte(`<ListAllMyBucketsResult><Buckets></Buckets></ListAllMyBucketsResult>`))
+	}))
+	t.Cleanup(server.Close)
+
+	endpoint, err := newS3Endpoint(server.URL, "access", "secret", transportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Probe{
+		name:                    "test",
+		endpoint:                endpoint,
+		latencyTimeout:          5 * time.Second,
+		defaultOperationTimeout: 5 * time.Second,
+		idleTracker:             &idleTracker{},
+		clockSkewThreshold:      time.Minute,
+	}
+}
+
+func TestPerformClockSkewCheck(t *testing.T) {
+	p := newClockSkewTestProbe(t, 0)
+	if err := p.performClockSkewCheck(); err != nil {
+		t.Errorf("Clock skew check should succeed: %s", err)
+	}
+
+	p = newClockSkewTestProbe(t, 10*time.Minute)
+	if err := p.performClockSkewCheck(); err == nil {
+		t.Errorf("Clock skew check should fail with a 10m skew")
+	}
+}
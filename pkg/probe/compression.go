@@ -0,0 +1,104 @@
+package probe
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/criteo/s3-probe/pkg/metrics"
+
+	minio "github.com/minio/minio-go/v7"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var s3CompressedResponseCounter = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_compressed_response_total",
+	Help: "Total number of GET requests sent with Accept-Encoding: gzip answered with a gzip encoded body",
+}, []string{"endpoint"})
+
+var s3CompressedContentMismatchCounter = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_compressed_content_mismatch_total",
+	Help: "Total number of GET requests sent with Accept-Encoding: gzip whose decoded body differs from the object",
+}, []string{"endpoint"})
+
+var errCompressedContentMismatch = errors.New("body read with Accept-Encoding: gzip differs from the object")
+
+// uncompressedTransport leaves the Content-Encoding of responses untouched so
+// that the check can tell whether the body was compressed on the way
+var uncompressedTransport = &http.Transport{
+	Proxy:              http.ProxyFromEnvironment,
+	DisableCompression: true,
+}
+
+// performCompressionCheck reads an object with Accept-Encoding: gzip through a
+// presigned URL and checks that the decoded body matches the object
+func (p *Probe) performCompressionCheck() error {
+	objectName, _ := randomHex(20)
+	objectData := make([]byte, p.latencyItemSize)
+	_, _ = rand.Read(objectData)
+	objectSize := int64(len(objectData))
+	defer p.cleanTempObject(p.endpoint.s3Client, p.latencyBucketName, objectName)
+
+	ctx, cancel := p.newContext(0)
+	defer cancel()
+	_, err := p.endpoint.s3Client.PutObject(ctx, p.latencyBucketName, objectName, bytes.NewReader(objectData), objectSize, minio.PutObjectOptions{})
+	if err != nil {
+		log.Printf("Error while uploading object for compression check (endpoint:%s): %s", p.name, err)
+		return err
+	}
+	s3BytesPutCounter.WithLabelValues(p.name).Add(float64(objectSize))
+
+	presignedURL, err := p.endpoint.s3Client.PresignedGetObject(ctx, p.latencyBucketName, objectName, presignedURLExpiry, url.Values{})
+	if err != nil {
+		log.Printf("Error while presigning object URL (endpoint:%s): %s", p.name, err)
+		return err
+	}
+
+	var body []byte
+	operation := func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, presignedURL.String(), nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Accept-Encoding", "gzip")
+		resp, err := uncompressedTransport.RoundTrip(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return &presignedStatusError{Expected: http.StatusOK, Actual: resp.StatusCode}
+		}
+
+		var reader io.Reader = resp.Body
+		if resp.Header.Get("Content-Encoding") == "gzip" {
+			s3CompressedResponseCounter.WithLabelValues(p.name).Inc()
+			gzipReader, err := gzip.NewReader(resp.Body)
+			if err != nil {
+				return err
+			}
+			defer gzipReader.Close()
+			reader = gzipReader
+		}
+		body, err = ioutil.ReadAll(reader)
+		s3BytesGetCounter.WithLabelValues(p.name).Add(float64(len(body)))
+		return err
+	}
+	if err := p.mesureOperation("get_object_gzip", operation); err != nil {
+		return err
+	}
+
+	if !bytes.Equal(body, objectData) {
+		s3CompressedContentMismatchCounter.WithLabelValues(p.name).Inc()
+		log.Printf("Error while checking compressed read (endpoint:%s): %s", p.name, errCompressedContentMismatch)
+		return errCompressedContentMismatch
+	}
+	return nil
+}
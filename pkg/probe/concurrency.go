@@ -0,0 +1,57 @@
+package probe
+
+import (
+	"sync"
+
+	"github.com/criteo/s3-probe/pkg/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var s3GlobalChecksSkippedCounter = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_global_checks_skipped_total",
+	Help: "Total number of checks on S3 endpoint skipped because too many checks were running across all probes",
+}, []string{"endpoint"})
+
+var (
+	globalCheckSlotsMu sync.Mutex
+	globalCheckSlots   chan struct{}
+)
+
+// SetGlobalMaxConcurrentChecks caps the number of checks running at the same time across all
+// the probes of the process to maxChecks, 0 removes the cap
+func SetGlobalMaxConcurrentChecks(maxChecks int) {
+	globalCheckSlotsMu.Lock()
+	defer globalCheckSlotsMu.Unlock()
+	if maxChecks <= 0 {
+		globalCheckSlots = nil
+		return
+	}
+	if globalCheckSlots != nil && cap(globalCheckSlots) == maxChecks {
+		return
+	}
+	globalCheckSlots = make(chan struct{}, maxChecks)
+}
+
+// acquireGlobalCheckSlot reserves a slot for a check, returning false if the cap is reached.
+// The returned slots must be given back to releaseGlobalCheckSlot, they outlive a change of the cap
+func acquireGlobalCheckSlot() (chan struct{}, bool) {
+	globalCheckSlotsMu.Lock()
+	slots := globalCheckSlots
+	globalCheckSlotsMu.Unlock()
+	if slots == nil {
+		return nil, true
+	}
+	select {
+	case slots <- struct{}{}:
+		return slots, true
+	default:
+		return nil, false
+	}
+}
+
+func releaseGlobalCheckSlot(slots chan struct{}) {
+	if slots != nil {
+		<-slots
+	}
+}
@@ -0,0 +1,48 @@
+package probe
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+func TestGlobalMaxConcurrentChecksSkipsChecksOverTheCap(t *testing.T) {
+	SetGlobalMaxConcurrentChecks(1)
+	defer SetGlobalMaxConcurrentChecks(0)
+	s3GlobalChecksSkippedCounter.Reset()
+
+	p := Probe{name: "test", checks: &sync.WaitGroup{}, cleanups: &sync.WaitGroup{}}
+	release := make(chan struct{})
+	p.runCheck(func(*Probe) error {
+		<-release
+		return nil
+	})
+	ran := false
+	p.runCheck(func(*Probe) error {
+		ran = true
+		return nil
+	})
+	close(release)
+	if !p.WaitChecks(time.Second) {
+		t.Fatal("Checks did not complete")
+	}
+	if ran {
+		t.Error("A check over the cap should have been skipped")
+	}
+	metric := &io_prometheus_client.Metric{}
+	s3GlobalChecksSkippedCounter.WithLabelValues("test").Write(metric)
+	if *metric.Counter.Value != 1 {
+		t.Errorf("Expected 1 skipped check got %f", *metric.Counter.Value)
+	}
+
+	p.runCheck(func(*Probe) error {
+		ran = true
+		return nil
+	})
+	p.WaitChecks(time.Second)
+	if !ran {
+		t.Error("A check should run once a slot is released")
+	}
+}
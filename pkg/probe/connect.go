@@ -0,0 +1,55 @@
+package probe
+
+import (
+	"context"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/criteo/s3-probe/pkg/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var s3ConnectHistogram = metrics.Factory.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "s3_connect_duration_seconds",
+	Help:    "Time spent opening new connections (DNS, TCP and TLS) during an operation on the S3 endpoint",
+	Buckets: []float64{.001, .0025, .005, .010, .015, .020, .025, .030, .040, .050, .060, .075, .100, .250, .500, 1, 2.5, 5, 10, 15, 30},
+}, []string{"operation", "endpoint"})
+
+// connectTimer sums the time spent waiting for new connections during an operation
+type connectTimer struct {
+	mu        sync.Mutex
+	start     time.Time
+	total     time.Duration
+	connected bool
+}
+
+// withConnectTimer returns a context timing the connections opened by requests
+func withConnectTimer(ctx context.Context) (context.Context, *connectTimer) {
+	timer := &connectTimer{}
+	trace := &httptrace.ClientTrace{
+		GetConn: func(hostPort string) {
+			timer.mu.Lock()
+			defer timer.mu.Unlock()
+			timer.start = time.Now()
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				return
+			}
+			timer.mu.Lock()
+			defer timer.mu.Unlock()
+			timer.total += time.Since(timer.start)
+			timer.connected = true
+		},
+	}
+	return httptrace.WithClientTrace(ctx, trace), timer
+}
+
+// duration returns the time spent connecting, ok is false if no connection was opened
+func (t *connectTimer) duration() (d time.Duration, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.total, t.connected
+}
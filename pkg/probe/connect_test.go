@@ -0,0 +1,45 @@
+package probe
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestConnectTimerOnlyTimesNewConnections(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	client := server.Client()
+
+	get := func() *connectTimer {
+		ctx, timer := withConnectTimer(context.Background())
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return timer
+	}
+
+	if _, ok := get().duration(); !ok {
+		t.Errorf("The first request should open a connection")
+	}
+	if _, ok := get().duration(); ok {
+		t.Errorf("The second request should reuse the connection")
+	}
+}
+
+func TestTransportOptionsConnectTimeout(t *testing.T) {
+	transport := &http.Transport{TLSHandshakeTimeout: 10 * time.Second}
+	transportOptions{}.apply(transport)
+	if transport.TLSHandshakeTimeout != 10*time.Second || transport.DialContext != nil {
+		t.Errorf("Transport should be left untouched without connect timeout")
+	}
+	transportOptions{connectTimeout: time.Second}.apply(transport)
+	if transport.TLSHandshakeTimeout != time.Second || transport.DialContext == nil {
+		t.Errorf("Connect timeout should bound the dial and the TLS handshake")
+	}
+}
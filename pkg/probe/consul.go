@@ -1,26 +1,63 @@
 package probe
 
 import (
+	"crypto/tls"
+	"fmt"
 	"log"
+	"net"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/criteo/s3-probe/pkg/config"
+	"github.com/criteo/s3-probe/pkg/metrics"
 
 	consul_api "github.com/hashicorp/consul/api"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
+var serviceAmbiguousTagsCounter = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_service_ambiguous_tags_total",
+	Help: "Total number of discoveries of a service carrying both the tag and the gateway tag",
+}, []string{"service"})
+
+var serviceMissingPortCounter = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_service_missing_port_total",
+	Help: "Total number of consul service entries without port, replaced by the default S3 port",
+}, []string{"service"})
+
 // ConsulClient is a wrapper around true consul client to ease mocking
 type ConsulClient interface {
 	GetAllMatchingRegisteredServices() (map[string]bool, error)
-	GetServiceEndPoints(serviceName string, isGateway bool) (string, []S3Endpoint, error)
+	GetServiceEndPoints(serviceName string, isGateway bool) (ServiceEndpoints, error)
+	GetServiceInstances(serviceName string) ([]string, error)
+	WaitForCatalogChange(lastIndex uint64) (uint64, error)
+}
+
+// ServiceEndpoints are the addresses resolved for a service
+type ServiceEndpoints struct {
+	Endpoint             string
+	GatewayReadEndpoints []S3Endpoint
+	// Overrides are the settings of the global configuration overridden by the service metadata
+	Overrides map[string]string
+	// MeshTLS is the mTLS configuration reaching the endpoint through the Consul Connect mesh, nil outside of it
+	MeshTLS *tls.Config
+	// Datacenter is the datacenter of the instances of the service, empty when unknown
+	Datacenter string
 }
 
+// catalogWaitTime bounds the blocking queries waiting for a catalog change
+const catalogWaitTime = 5 * time.Minute
+
 // concrete implementation
 type consulClientImpl struct {
 	cfg          *config.Config
 	consulClient *consul_api.Client
+	// mesh is the identity of the probe in the Consul Connect mesh, nil when disabled
+	mesh *meshIdentity
 }
 
 // S3Service describe a S3 service and associated metadata
@@ -29,17 +66,38 @@ type S3Service struct {
 	Endpoint            string
 	Gateway             bool
 	GatewayReadEnpoints []S3Endpoint
+	// InstanceEndpoints are the addresses of the healthy instances of the service, only
+	// resolved when durability is compared across instances
+	InstanceEndpoints []string
+	// Datacenter is the datacenter of the service, only resolved when durability items are
+	// partitioned by datacenter
+	Datacenter string
+	// Overrides are the settings of the global configuration overridden by the service metadata
+	Overrides map[string]string
+	// MeshTLS is set for services reached through the Consul Connect mesh, only whether it is set
+	// tells descriptions apart
+	MeshTLS *tls.Config
 }
 
-// Equals checks that to S3Service description are identical
+// Equals checks that to S3Service description are identical. Instances are not compared,
+// a running probe switches to new ones with UpdateInstances
 func (s *S3Service) Equals(other *S3Service) bool {
 	if s.Name != other.Name ||
 		s.Endpoint != other.Endpoint ||
 		s.Gateway != other.Gateway ||
-		len(s.GatewayReadEnpoints) != len(other.GatewayReadEnpoints) {
+		s.Datacenter != other.Datacenter ||
+		len(s.GatewayReadEnpoints) != len(other.GatewayReadEnpoints) ||
+		len(s.Overrides) != len(other.Overrides) ||
+		(s.MeshTLS == nil) != (other.MeshTLS == nil) {
 		return false
 	}
 
+	for key, value := range s.Overrides {
+		if otherValue, ok := other.Overrides[key]; !ok || value != otherValue {
+			return false
+		}
+	}
+
 	for i, gatewayReadEndPoint := range s.GatewayReadEnpoints {
 		if gatewayReadEndPoint.Name != other.GatewayReadEnpoints[i].Name {
 			return false
@@ -49,8 +107,47 @@ func (s *S3Service) Equals(other *S3Service) bool {
 	return true
 }
 
-// MakeConsulClient builds a new ConsulClient
+// MakeConsulClient builds a new ConsulClient, reading the services from the discovery file instead of consul
+// when one is set, or from both with hybrid discovery
 func MakeConsulClient(cfg *config.Config) (ConsulClient, error) {
+	include, err := compileServiceFilter(*cfg.ServiceInclude)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := compileServiceFilter(*cfg.ServiceExclude)
+	if err != nil {
+		return nil, err
+	}
+	client, err := makeDiscoveryClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if include == nil && exclude == nil {
+		return client, nil
+	}
+	return &serviceFilterClient{ConsulClient: client, include: include, exclude: exclude}, nil
+}
+
+// makeDiscoveryClient creates the client of the discovery configured, consul, a discovery file or both
+func makeDiscoveryClient(cfg *config.Config) (ConsulClient, error) {
+	if *cfg.SDFile == "" {
+		return newConsulClient(cfg)
+	}
+	fileClient, err := newFileDiscoveryClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if !*cfg.HybridDiscovery {
+		return fileClient, nil
+	}
+	consulClient, err := newConsulClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return newHybridDiscoveryClient(fileClient, consulClient, *cfg.DiscoveryPrecedence)
+}
+
+func newConsulClient(cfg *config.Config) (*consulClientImpl, error) {
 	defaultConfig := consul_api.DefaultConfig()
 	defaultConfig.Address = *cfg.ConsulAddr
 
@@ -59,72 +156,216 @@ func MakeConsulClient(cfg *config.Config) (ConsulClient, error) {
 		return nil, err
 	}
 
-	return &consulClientImpl{cfg: cfg, consulClient: client}, nil
+	var mesh *meshIdentity
+	if *cfg.ConnectService != "" {
+		mesh = newMeshIdentity(client.Agent(), *cfg.ConnectService)
+	}
+
+	return &consulClientImpl{cfg: cfg, consulClient: client, mesh: mesh}, nil
+}
+
+// compileServiceFilter compiles a service name filter, which must match the whole name. An empty filter returns nil
+func compileServiceFilter(filter string) (*regexp.Regexp, error) {
+	if filter == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile("^(?:" + filter + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid service filter %q: %s", filter, err)
+	}
+	return re, nil
+}
+
+// serviceFilterClient drops the services not selected by the service filters, whatever their discovery
+type serviceFilterClient struct {
+	ConsulClient
+	include *regexp.Regexp
+	exclude *regexp.Regexp
+}
+
+func (c *serviceFilterClient) GetAllMatchingRegisteredServices() (map[string]bool, error) {
+	services, err := c.ConsulClient.GetAllMatchingRegisteredServices()
+	if err != nil {
+		return nil, err
+	}
+	// the services are copied, the discovery may keep returning the same map
+	selected := map[string]bool{}
+	for serviceName, isGateway := range services {
+		if serviceNameSelected(serviceName, c.include, c.exclude) {
+			selected[serviceName] = isGateway
+		}
+	}
+	return selected, nil
+}
+
+// serviceNameSelected tells whether a service name matches include, when set, and doesn't match exclude
+func serviceNameSelected(name string, include *regexp.Regexp, exclude *regexp.Regexp) bool {
+	if include != nil && !include.MatchString(name) {
+		return false
+	}
+	return exclude == nil || !exclude.MatchString(name)
 }
 
 // getAllMatchingRegisteredServices returns all registered services in consul that matched Tag or GatewayTag
 func (cc *consulClientImpl) GetAllMatchingRegisteredServices() (map[string]bool, error) {
 	catalog := cc.consulClient.Catalog()
 
-	services, _, err := catalog.Services(nil)
+	// Filtering on consul side avoids downloading the whole catalog, tags are still checked below
+	// as older consul versions don't support filtering
+	services, _, err := catalog.Services(&consul_api.QueryOptions{Filter: serviceTagsFilter(*cc.cfg.Tag, *cc.cfg.GatewayTag)})
 	if err != nil {
-		return map[string]bool{}, err
+		log.Printf("Fail to list services filtered by tags, listing all services: %s", err)
+		services, _, err = catalog.Services(nil)
+		if err != nil {
+			return map[string]bool{}, err
+		}
 	}
 
 	results := map[string]bool{}
 	for serviceName := range services {
-		for i := range services[serviceName] {
-			isGateway := services[serviceName][i] == *cc.cfg.GatewayTag
-			if isGateway || services[serviceName][i] == *cc.cfg.Tag {
-				results[serviceName] = isGateway
-				break
-			}
+		matched, isGateway, ambiguous := classifyServiceTags(services[serviceName], *cc.cfg.Tag, *cc.cfg.GatewayTag, *cc.cfg.AmbiguousTagsPrecedence)
+		if ambiguous {
+			log.Printf("Service %s has both tags among %s and among %s, probing it as gateway: %t", serviceName, *cc.cfg.Tag, *cc.cfg.GatewayTag, isGateway)
+			serviceAmbiguousTagsCounter.WithLabelValues(serviceName).Inc()
+		}
+		if matched {
+			results[serviceName] = isGateway
 		}
 	}
 
 	return results, nil
 }
 
-// getServiceEndPoint resolves the endpoint address of the given serviceName via consul
-func (cc *consulClientImpl) GetServiceEndPoints(serviceName string, isGateway bool) (string, []S3Endpoint, error) {
+// WaitForCatalogChange blocks until the catalog of services changes from lastIndex, or the wait
+// time elapses, and returns the new catalog index. A zero lastIndex returns immediately
+func (cc *consulClientImpl) WaitForCatalogChange(lastIndex uint64) (uint64, error) {
+	_, meta, err := cc.consulClient.Catalog().Services(&consul_api.QueryOptions{WaitIndex: lastIndex, WaitTime: catalogWaitTime})
+	if err != nil {
+		return lastIndex, err
+	}
+	return meta.LastIndex, nil
+}
+
+// serviceTagsFilter builds the consul filter expression selecting services carrying any of the
+// comma separated tags or gateway tags
+func serviceTagsFilter(tag string, gatewayTag string) string {
+	conditions := []string{}
+	for _, t := range append(config.ParseList(tag), config.ParseList(gatewayTag)...) {
+		conditions = append(conditions, fmt.Sprintf("ServiceTags contains %s", strconv.Quote(t)))
+	}
+	return strings.Join(conditions, " or ")
+}
+
+// classifyServiceTags tells whether a service carries one of the comma separated tags or gateway tags and whether
+// it is a gateway. When both kinds are present the service is ambiguous and precedence decides: "gateway" or "standard"
+func classifyServiceTags(tags []string, tag string, gatewayTag string, precedence string) (matched bool, isGateway bool, ambiguous bool) {
+	searched := map[string]bool{}
+	for _, t := range config.ParseList(tag) {
+		searched[t] = false
+	}
+	for _, t := range config.ParseList(gatewayTag) {
+		searched[t] = true
+	}
+	hasTag := false
+	hasGatewayTag := false
+	for _, t := range tags {
+		gateway, ok := searched[t]
+		hasTag = hasTag || (ok && !gateway)
+		hasGatewayTag = hasGatewayTag || (ok && gateway)
+	}
+	ambiguous = hasTag && hasGatewayTag
+	if ambiguous {
+		return true, precedence != "standard", true
+	}
+	return hasTag || hasGatewayTag, hasGatewayTag, false
+}
+
+// getServiceEndPoint resolves the endpoint address of the given serviceName via consul, and the settings its metadata overrides.
+// With a mesh identity, services having a Connect sidecar are reached through it with mTLS
+func (cc *consulClientImpl) GetServiceEndPoints(serviceName string, isGateway bool) (ServiceEndpoints, error) {
 	log.Printf("Fetching endpoints for service: %s", serviceName)
 	health := cc.consulClient.Health()
 	serviceEntries, _, err := health.Service(serviceName, "", true, nil)
 	if err != nil {
 		log.Printf("Fail to query health information for service %s from consul: %s\n", serviceName, err)
-		return "", []S3Endpoint{}, err
+		return ServiceEndpoints{}, err
 	}
 
-	endpoint, err := getEndpointFromConsul(serviceName, serviceEntries)
+	endpoints := ServiceEndpoints{GatewayReadEndpoints: []S3Endpoint{}, Overrides: getOverridesFromConsul(serviceEntries)}
+	if len(serviceEntries) > 0 {
+		endpoints.Datacenter = serviceEntries[0].Node.Datacenter
+	}
+	meshEndpoint, err := cc.getMeshEndpoint(serviceName)
 	if err != nil {
-		log.Printf("Fail to resolve service endpoint from consul service entries for service %s: %s\n", serviceName, err)
-		return "", []S3Endpoint{}, err
+		log.Printf("Fail to query Connect sidecars for service %s from consul: %s\n", serviceName, err)
+		return ServiceEndpoints{}, err
+	}
+	if meshEndpoint != "" {
+		endpoints.Endpoint = meshEndpoint
+		endpoints.MeshTLS = newMeshTLSConfig(cc.mesh, serviceName)
+	} else {
+		endpoints.Endpoint, err = getEndpointFromConsul(serviceName, serviceEntries, *cc.cfg.EndpointTemplate, *cc.cfg.DefaultS3Port)
+		if err != nil {
+			log.Printf("Fail to resolve service endpoint from consul service entries for service %s: %s\n", serviceName, err)
+			return ServiceEndpoints{}, err
+		}
 	}
 
 	if isGateway {
-		readEndpoints, err := extractGatewayEndoints(serviceEntries, cc.cfg, cc.consulClient)
+		endpoints.GatewayReadEndpoints, err = extractGatewayEndoints(serviceEntries, cc.cfg, cc.consulClient)
 		if err != nil {
 			log.Printf("Resolving gateway endpoints failed for %s: %s", serviceName, err)
-			return "", []S3Endpoint{}, err
+			return ServiceEndpoints{}, err
 		}
-		return endpoint, readEndpoints, err
 	}
 
-	return endpoint, []S3Endpoint{}, nil
+	return endpoints, nil
+}
+
+// GetServiceInstances returns the sorted addresses of the healthy instances of the given serviceName
+func (cc *consulClientImpl) GetServiceInstances(serviceName string) ([]string, error) {
+	serviceEntries, _, err := cc.consulClient.Health().Service(serviceName, "", true, nil)
+	if err != nil {
+		log.Printf("Fail to query health information for service %s from consul: %s\n", serviceName, err)
+		return []string{}, err
+	}
+	return getInstanceAddresses(serviceName, serviceEntries, *cc.cfg.DefaultS3Port), nil
+}
+
+// getInstanceAddresses returns the sorted host:port of each service entry, the service address
+// being preferred over the node one
+func getInstanceAddresses(name string, serviceEntries []*consul_api.ServiceEntry, defaultPort int) []string {
+	addresses := []string{}
+	for _, entry := range serviceEntries {
+		host := entry.Service.Address
+		if host == "" {
+			host = entry.Node.Address
+		}
+		addresses = append(addresses, net.JoinHostPort(host, strconv.Itoa(servicePort(name, entry, defaultPort))))
+	}
+	sort.Strings(addresses)
+	return addresses
 }
 
-// NewProbeFromConsul Create a new probe using consul to generate endpoint configuration
+// NewProbeFromConsul Create a new probe using consul to generate endpoint configuration, the overrides of the service
+// taking precedence over the global configuration
 func NewProbeFromConsul(service S3Service, cfg *config.Config, controlChan chan bool) (Probe, error) {
+	cfg, err := ServiceConfig(service, cfg)
+	if err != nil {
+		return Probe{}, err
+	}
 	return NewProbe(service, service.Endpoint, service.GatewayReadEnpoints, cfg, controlChan)
 }
 
-func getEndpointFromConsul(name string, serviceEntries []*consul_api.ServiceEntry) (string, error) {
+func getEndpointFromConsul(name string, serviceEntries []*consul_api.ServiceEntry, template string, defaultPort int) (string, error) {
 	endpoint := ""
 	if proxy, ok := getProxyEndpoint(serviceEntries); ok {
 		endpoint = proxy
 	} else {
 		if externalClusterFqdn, ok := getExternalClusterFqdn(serviceEntries); ok {
 			endpoint = externalClusterFqdn
+		} else if template != "" && len(serviceEntries) > 0 {
+			endpoint = renderEndpointTemplate(template, name, serviceEntries[0], defaultPort)
 		} else {
 			return "", errors.Errorf("Endpoint name not found for %s", name)
 		}
@@ -133,6 +374,27 @@ func getEndpointFromConsul(name string, serviceEntries []*consul_api.ServiceEntr
 	return endpoint, nil
 }
 
+// renderEndpointTemplate substitutes the {service}, {port}, {node} and {dc} placeholders of template
+func renderEndpointTemplate(template string, name string, serviceEntry *consul_api.ServiceEntry, defaultPort int) string {
+	replacer := strings.NewReplacer(
+		"{service}", name,
+		"{port}", strconv.Itoa(servicePort(name, serviceEntry, defaultPort)),
+		"{node}", serviceEntry.Node.Node,
+		"{dc}", serviceEntry.Node.Datacenter,
+	)
+	return replacer.Replace(template)
+}
+
+// servicePort returns the port of a service entry, or defaultPort when consul doesn't know it
+func servicePort(name string, serviceEntry *consul_api.ServiceEntry, defaultPort int) int {
+	if serviceEntry.Service.Port != 0 {
+		return serviceEntry.Service.Port
+	}
+	log.Printf("Service %s has no port in consul, using default port %d", name, defaultPort)
+	serviceMissingPortCounter.WithLabelValues(name).Inc()
+	return defaultPort
+}
+
 func extractGatewayEndoints(serviceEntries []*consul_api.ServiceEntry, cfg *config.Config, consulClient *consul_api.Client) ([]S3Endpoint, error) {
 	s3endpoints := []S3Endpoint{}
 
@@ -150,16 +412,16 @@ func extractGatewayEndoints(serviceEntries []*consul_api.ServiceEntry, cfg *conf
 			log.Printf("Consul query failed for %s (dc: %s, service: %s): %s", destination.raw, destination.datacenter, destination.service, err)
 			return s3endpoints, err
 		}
-		endpointName, err := getEndpointFromConsul(destination.service, endpointEntries)
+		endpointName, err := getEndpointFromConsul(destination.service, endpointEntries, *cfg.EndpointTemplate, *cfg.DefaultS3Port)
 		if err != nil {
 			return s3endpoints, err
 		}
-		minioClient, err := newMinioClientFromEndpoint(endpointName, *cfg.AccessKey, *cfg.SecretKey)
+		s3endpoint, err := newS3Endpoint(endpointName, *cfg.AccessKey, *cfg.SecretKey, newTransportOptions(cfg))
 		if err != nil {
 			log.Printf("Could not create minio client for %s (dc: %s, service: %s) : %s", destination.raw, destination.datacenter, destination.service, err)
 			return []S3Endpoint{}, err
 		}
-		s3endpoints = append(s3endpoints, S3Endpoint{Name: endpointName, s3Client: minioClient})
+		s3endpoints = append(s3endpoints, s3endpoint)
 		log.Printf("Added gateway destination: %s", endpointName)
 	}
 	return s3endpoints, nil
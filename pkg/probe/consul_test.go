@@ -2,10 +2,14 @@ package probe
 
 import (
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"sort"
 	"testing"
 
+	"github.com/criteo/s3-probe/pkg/config"
+
 	consul_api "github.com/hashicorp/consul/api"
 )
 
@@ -41,6 +45,25 @@ func TestS3ServiceEquals(t *testing.T) {
 	if !service.Equals(&otherService) {
 		t.Error("S3Service equality should have return true due to perfect deep equality between both services")
 	}
+
+	otherService.InstanceEndpoints = []string{"10.0.0.1:9000"}
+	if !service.Equals(&otherService) {
+		t.Error("S3Service equality should ignore the instances")
+	}
+	if service.SameInstances(&otherService) {
+		t.Error("Services with different instances should not have the same instances")
+	}
+}
+
+func TestGetInstanceAddresses(t *testing.T) {
+	entries := []*consul_api.ServiceEntry{
+		{Node: &consul_api.Node{Address: "10.0.0.2"}, Service: &consul_api.AgentService{Port: 9000}},
+		{Node: &consul_api.Node{Address: "10.0.0.3"}, Service: &consul_api.AgentService{Address: "10.0.1.1", Port: 9000}},
+	}
+	addresses := getInstanceAddresses("test", entries, 80)
+	if !reflect.DeepEqual(addresses, []string{"10.0.0.2:9000", "10.0.1.1:9000"}) {
+		t.Errorf("Unexpected instance addresses %v", addresses)
+	}
 }
 
 func getTestServiceEntries() (entries []*consul_api.ServiceEntry) {
@@ -64,7 +87,7 @@ func getTestServiceEntries() (entries []*consul_api.ServiceEntry) {
 func TestGenerateEndointFromConsulWithoutProxyData(t *testing.T) {
 	entries := getTestServiceEntries()
 	entries[0].Service.Meta["external_cluster_fqdn"] = "http://test.us-east-1.prod:8080"
-	endpoint, err := getEndpointFromConsul("test", entries)
+	endpoint, err := getEndpointFromConsul("test", entries, "", 80)
 	if endpoint != "http://test.us-east-1.prod:8080" || err != nil {
 		t.Errorf("Failed to generate URL from Consul data")
 	}
@@ -73,12 +96,47 @@ func TestGenerateEndointFromConsulWithoutProxyData(t *testing.T) {
 func TestGenerateEndointFromConsulWithProxyData(t *testing.T) {
 	entries := getTestServiceEntries()
 	entries[0].Service.Meta["proxy_address"] = "foo.bar"
-	endpoint, err := getEndpointFromConsul("test", entries)
+	endpoint, err := getEndpointFromConsul("test", entries, "", 80)
 	if endpoint != "foo.bar" || err != nil {
 		t.Errorf("Failed to generate URL from proxy_address data")
 	}
 }
 
+func TestGenerateEndointFromConsulWithTemplate(t *testing.T) {
+	entries := getTestServiceEntries()
+	entries[0].Node.Node = "node-1"
+	endpoint, err := getEndpointFromConsul("test", entries, "http://{service}.{node}.{dc}.prod:{port}", 80)
+	if endpoint != "http://test.node-1.us-east-1.prod:8080" || err != nil {
+		t.Errorf("Failed to generate URL from template, got %s", endpoint)
+	}
+
+	entries[0].Service.Meta["external_cluster_fqdn"] = "http://test.us-east-1.prod:8080"
+	endpoint, err = getEndpointFromConsul("test", entries, "http://{service}.{node}.{dc}.prod:{port}", 80)
+	if endpoint != "http://test.us-east-1.prod:8080" || err != nil {
+		t.Errorf("Consul meta should take precedence over the template")
+	}
+}
+
+func TestGenerateEndointFromConsulWithoutPortUsesDefaultPort(t *testing.T) {
+	entries := getTestServiceEntries()
+	entries[0].Node.Node = "node-1"
+	entries[0].Service.Port = 0
+	endpoint, err := getEndpointFromConsul("test", entries, "https://{service}.{node}.{dc}.prod:{port}", 443)
+	if endpoint != "https://test.node-1.us-east-1.prod:443" || err != nil {
+		t.Errorf("Expected the default port in the endpoint, got %s", endpoint)
+	}
+}
+
+func TestGetInstanceAddressesWithoutPortUsesDefaultPort(t *testing.T) {
+	entries := []*consul_api.ServiceEntry{
+		{Node: &consul_api.Node{Address: "10.0.0.2"}, Service: &consul_api.AgentService{}},
+	}
+	addresses := getInstanceAddresses("test", entries, 9000)
+	if !reflect.DeepEqual(addresses, []string{"10.0.0.2:9000"}) {
+		t.Errorf("Unexpected instance addresses %v", addresses)
+	}
+}
+
 func TestExtractDestinations(t *testing.T) {
 	dst1 := destination{datacenter: "us-east-2", service: "barfoo", raw: "us-east-2:barfoo"}
 	dst2 := destination{datacenter: "us-west-1", service: "foobar", raw: "us-west-1:foobar"}
@@ -98,7 +156,7 @@ func TestExtractDestinations(t *testing.T) {
 
 func TestGenerateEndointFailIfConsulServiceEmpty(t *testing.T) {
 	entries := []*consul_api.ServiceEntry{}
-	_, err := getEndpointFromConsul("test", entries)
+	_, err := getEndpointFromConsul("test", entries, "", 80)
 	if err == nil {
 		t.Errorf("GenerateEndpoint should fail when given empty service")
 	}
@@ -113,3 +171,121 @@ func TestExtractDestinationsFailIfWronglyFormatted(t *testing.T) {
 		t.Errorf("Extract destination didn't fail on poorly formated destinations")
 	}
 }
+
+func TestClassifyServiceTags(t *testing.T) {
+	matched, isGateway, ambiguous := classifyServiceTags([]string{"foo", "s3"}, "s3", "s3-gateway", "gateway")
+	if !matched || isGateway || ambiguous {
+		t.Errorf("Service with tag should be a standard service")
+	}
+	matched, isGateway, ambiguous = classifyServiceTags([]string{"s3-gateway"}, "s3", "s3-gateway", "gateway")
+	if !matched || !isGateway || ambiguous {
+		t.Errorf("Service with gateway tag should be a gateway")
+	}
+	matched, _, _ = classifyServiceTags([]string{"foo"}, "s3", "s3-gateway", "gateway")
+	if matched {
+		t.Errorf("Service without tags should not match")
+	}
+	for _, tags := range [][]string{{"s3", "s3-gateway"}, {"s3-gateway", "s3"}} {
+		matched, isGateway, ambiguous = classifyServiceTags(tags, "s3", "s3-gateway", "gateway")
+		if !matched || !isGateway || !ambiguous {
+			t.Errorf("Ambiguous service should be a gateway whatever the tag order (%v)", tags)
+		}
+		matched, isGateway, ambiguous = classifyServiceTags(tags, "s3", "s3-gateway", "standard")
+		if !matched || isGateway || !ambiguous {
+			t.Errorf("Ambiguous service should be a standard service whatever the tag order (%v)", tags)
+		}
+	}
+}
+
+func TestGetAllMatchingRegisteredServicesFallsBackWithoutFilter(t *testing.T) {
+	var filters []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		filter := r.URL.Query().Get("filter")
+		filters = append(filters, filter)
+		if filter != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"s3-a": ["s3"], "s3-b": ["s3-gateway"], "other": ["foo"]}`))
+	}))
+	defer server.Close()
+
+	tag, gatewayTag := "s3", "s3-gateway"
+	cfg := config.GetTestConfig()
+	cfg.ConsulAddr = &server.URL
+	cfg.Tag = &tag
+	cfg.GatewayTag = &gatewayTag
+	cc, err := MakeConsulClient(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	services, err := cc.GetAllMatchingRegisteredServices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(services, map[string]bool{"s3-a": false, "s3-b": true}) {
+		t.Errorf("Unexpected services %v", services)
+	}
+	expectedFilters := []string{serviceTagsFilter(*cfg.Tag, *cfg.GatewayTag), ""}
+	if !reflect.DeepEqual(filters, expectedFilters) {
+		t.Errorf("Expected queries with filters %v got %v", expectedFilters, filters)
+	}
+}
+
+func TestServiceTagsFilter(t *testing.T) {
+	expected := `ServiceTags contains "s3" or ServiceTags contains "s3 \"gateway\""`
+	if filter := serviceTagsFilter("s3", `s3 "gateway"`); filter != expected {
+		t.Errorf("Expected %s got %s", expected, filter)
+	}
+}
+
+func TestServiceTagsFilterWithSeveralTags(t *testing.T) {
+	expected := `ServiceTags contains "s3" or ServiceTags contains "s3-preprod" or ServiceTags contains "s3-gateway"`
+	if filter := serviceTagsFilter("s3, s3-preprod", "s3-gateway"); filter != expected {
+		t.Errorf("Expected %s got %s", expected, filter)
+	}
+}
+
+func TestClassifyServiceTagsWithSeveralTags(t *testing.T) {
+	matched, isGateway, _ := classifyServiceTags([]string{"s3-preprod"}, "s3,s3-preprod", "s3-gateway,s3-gateway-preprod", "gateway")
+	if !matched || isGateway {
+		t.Errorf("Service with any of the tags should be a standard service")
+	}
+	matched, isGateway, _ = classifyServiceTags([]string{"s3-gateway-preprod"}, "s3,s3-preprod", "s3-gateway,s3-gateway-preprod", "gateway")
+	if !matched || !isGateway {
+		t.Errorf("Service with any of the gateway tags should be a gateway")
+	}
+	matched, _, _ = classifyServiceTags([]string{"s3,s3-preprod"}, "s3,s3-preprod", "s3-gateway", "gateway")
+	if matched {
+		t.Errorf("Tags should be matched individually")
+	}
+}
+
+func TestServiceNameSelected(t *testing.T) {
+	include, err := compileServiceFilter("s3-prod-.*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exclude, err := compileServiceFilter("s3-prod-legacy|.*-canary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]bool{
+		"s3-prod-par":       true,
+		"s3-prod-legacy":    false,
+		"s3-prod-am-canary": false,
+		"s3-preprod-par":    false,
+		"my-s3-prod-par":    false,
+	}
+	for name, expected := range cases {
+		if serviceNameSelected(name, include, exclude) != expected {
+			t.Errorf("Expected selection of %s to be %t", name, expected)
+		}
+	}
+	if !serviceNameSelected("anything", nil, nil) {
+		t.Errorf("Services should be selected without filters")
+	}
+	if _, err := compileServiceFilter("s3-("); err == nil {
+		t.Errorf("Invalid filters should be rejected")
+	}
+}
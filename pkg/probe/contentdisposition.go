@@ -0,0 +1,64 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/criteo/s3-probe/pkg/metrics"
+
+	minio "github.com/minio/minio-go/v7"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// probeContentDisposition has a quoted filename with a space so that proxies rewriting it are noticed
+const probeContentDisposition = `attachment; filename="s3 probe.bin"`
+
+var s3ContentDispositionMismatchCounter = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_content_disposition_mismatch_total",
+	Help: "Total number of objects on S3 endpoint whose Content-Disposition was lost or altered",
+}, []string{"endpoint"})
+
+// checkContentDisposition checks the Content-Disposition returned for an object
+func checkContentDisposition(expected string, info minio.ObjectInfo) error {
+	actual := info.Metadata.Get("Content-Disposition")
+	if actual != expected {
+		return fmt.Errorf("Content-Disposition %q returned instead of %q", actual, expected)
+	}
+	return nil
+}
+
+// performContentDispositionCheck uploads an object with a Content-Disposition and checks
+// that StatObject returns it intact
+func (p *Probe) performContentDispositionCheck() error {
+	objectName, _ := randomHex(20)
+	objectSize := int64(p.latencyItemSize)
+	objectData, _ := randomObject(objectSize)
+	defer p.cleanTempObject(p.endpoint.s3Client, p.latencyBucketName, objectName)
+
+	ctx, cancel := p.newContext(0)
+	defer cancel()
+	putOptions := minio.PutObjectOptions{ContentDisposition: probeContentDisposition}
+	_, err := p.endpoint.s3Client.PutObject(ctx, p.latencyBucketName, objectName, objectData, objectSize, putOptions)
+	if err != nil {
+		log.Printf("Error while uploading object with Content-Disposition (endpoint:%s): %s", p.name, err)
+		return err
+	}
+	s3BytesPutCounter.WithLabelValues(p.name).Add(float64(objectSize))
+
+	var info minio.ObjectInfo
+	operation := func(ctx context.Context) error {
+		info, err = p.endpoint.s3Client.StatObject(ctx, p.latencyBucketName, objectName, minio.StatObjectOptions{})
+		return err
+	}
+	if err := p.mesureOperation("stat_object_content_disposition", operation); err != nil {
+		return err
+	}
+
+	if err := checkContentDisposition(probeContentDisposition, info); err != nil {
+		s3ContentDispositionMismatchCounter.WithLabelValues(p.name).Inc()
+		log.Printf("Error while checking Content-Disposition (endpoint:%s): %s", p.name, err)
+		return err
+	}
+	return nil
+}
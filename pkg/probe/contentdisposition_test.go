@@ -0,0 +1,23 @@
+package probe
+
+import (
+	"net/http"
+	"testing"
+
+	minio "github.com/minio/minio-go/v7"
+)
+
+func TestCheckContentDisposition(t *testing.T) {
+	info := minio.ObjectInfo{Metadata: http.Header{"Content-Disposition": []string{probeContentDisposition}}}
+	if err := checkContentDisposition(probeContentDisposition, info); err != nil {
+		t.Errorf("Expected no error got %s", err)
+	}
+
+	info.Metadata.Set("Content-Disposition", "attachment")
+	if err := checkContentDisposition(probeContentDisposition, info); err == nil {
+		t.Errorf("Expected an altered Content-Disposition to be detected")
+	}
+	if err := checkContentDisposition(probeContentDisposition, minio.ObjectInfo{}); err == nil {
+		t.Errorf("Expected a lost Content-Disposition to be detected")
+	}
+}
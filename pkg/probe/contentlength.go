@@ -0,0 +1,48 @@
+package probe
+
+import (
+	"fmt"
+	"io"
+
+	minio "github.com/minio/minio-go/v7"
+)
+
+// contentLengthError is returned when the bytes read from an object differ from its reported size
+type contentLengthError struct {
+	Expected int64
+	Actual   int64
+}
+
+func (e *contentLengthError) Error() string {
+	return fmt.Sprintf("read %d bytes from an object of reported size %d", e.Actual, e.Expected)
+}
+
+// objectReader is the part of minio.Object needed to read an object and check its size
+type objectReader interface {
+	io.Reader
+	Stat() (minio.ObjectInfo, error)
+}
+
+// readObjectChecked reads an object until EOF with the given buffer, reporting each read to onRead,
+// and checks that the number of bytes read matches the size reported by the endpoint
+func readObjectChecked(obj objectReader, data []byte, onRead func(n int)) error {
+	var read int64
+	for {
+		n, err := obj.Read(data)
+		onRead(n)
+		read += int64(n)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+	info, err := obj.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size != read {
+		return &contentLengthError{Expected: info.Size, Actual: read}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package probe
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	minio "github.com/minio/minio-go/v7"
+)
+
+type fakeObject struct {
+	*bytes.Reader
+	size int64
+}
+
+func (o fakeObject) Stat() (minio.ObjectInfo, error) {
+	return minio.ObjectInfo{Size: o.size}, nil
+}
+
+func TestReadObjectCheckedAcceptsMatchingSize(t *testing.T) {
+	obj := fakeObject{Reader: bytes.NewReader(make([]byte, 10)), size: 10}
+	total := 0
+	if err := readObjectChecked(obj, make([]byte, 3), func(n int) { total += n }); err != nil {
+		t.Errorf("Expected no error got %s", err)
+	}
+	if total != 10 {
+		t.Errorf("Expected 10 bytes reported got %d", total)
+	}
+}
+
+func TestReadObjectCheckedDetectsTruncation(t *testing.T) {
+	obj := fakeObject{Reader: bytes.NewReader(make([]byte, 6)), size: 10}
+	err := readObjectChecked(obj, make([]byte, 4), func(int) {})
+	var lengthErr *contentLengthError
+	if !errors.As(err, &lengthErr) {
+		t.Fatalf("Expected a content length error got %v", err)
+	}
+	if lengthErr.Expected != 10 || lengthErr.Actual != 6 {
+		t.Errorf("Unexpected sizes in %s", lengthErr)
+	}
+}
@@ -0,0 +1,119 @@
+package probe
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"reflect"
+
+	"github.com/criteo/s3-probe/pkg/metrics"
+
+	minio "github.com/minio/minio-go/v7"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var s3BucketCorsMatches = metrics.Factory.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "s3_bucket_cors_matches",
+	Help: "Whether the CORS configuration of the bucket matches the expected one (1) or not (0)",
+}, []string{"endpoint", "bucket"})
+
+var s3CorsPreflightFailureCounter = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_cors_preflight_failure_total",
+	Help: "Total number of preflight requests not allowed for the configured origin",
+}, []string{"endpoint", "bucket"})
+
+// corsConfiguration is the CORS configuration of a bucket as returned by GET ?cors
+type corsConfiguration struct {
+	Rules []corsRule `xml:"CORSRule"`
+}
+
+type corsRule struct {
+	AllowedOrigins []string `xml:"AllowedOrigin"`
+	AllowedMethods []string `xml:"AllowedMethod"`
+	AllowedHeaders []string `xml:"AllowedHeader"`
+	ExposeHeaders  []string `xml:"ExposeHeader"`
+	MaxAgeSeconds  int      `xml:"MaxAgeSeconds"`
+}
+
+// loadCorsConfiguration reads the expected CORS configuration, in the S3 XML format, from a file
+func loadCorsConfiguration(path string) (*corsConfiguration, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cors := &corsConfiguration{}
+	if err := xml.Unmarshal(content, cors); err != nil {
+		return nil, fmt.Errorf("invalid CORS configuration in %s: %s", path, err)
+	}
+	return cors, nil
+}
+
+// performCorsCheck compares the CORS configuration of the bucket with the expected one
+// and, if an origin is configured, checks that a preflight request from it is allowed
+func (p *Probe) performCorsCheck() error {
+	cors := &corsConfiguration{}
+	operation := func(ctx context.Context) error {
+		resp, err := p.doSignedRequest(ctx, http.MethodGet, p.corsBucketName, "", "cors", nil)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			errorResponse := minio.ErrorResponse{StatusCode: resp.StatusCode}
+			_ = xml.NewDecoder(resp.Body).Decode(&errorResponse)
+			// a bucket without CORS configuration has no rules
+			if errorResponse.Code == "NoSuchCORSConfiguration" {
+				return nil
+			}
+			return fmt.Errorf("CORS request returned status %d: %s", resp.StatusCode, errorResponse.Code)
+		}
+		return xml.NewDecoder(resp.Body).Decode(cors)
+	}
+	if err := p.mesureOperation("get_bucket_cors", operation); err != nil {
+		return err
+	}
+
+	if reflect.DeepEqual(cors, p.expectedCors) {
+		s3BucketCorsMatches.WithLabelValues(p.name, p.corsBucketName).Set(1)
+	} else {
+		log.Printf("CORS configuration of bucket %s on %s differs from the expected one", p.corsBucketName, p.name)
+		s3BucketCorsMatches.WithLabelValues(p.name, p.corsBucketName).Set(0)
+	}
+
+	if p.corsPreflightOrigin != "" {
+		return p.performCorsPreflight()
+	}
+	return nil
+}
+
+// performCorsPreflight sends a preflight request for a GET from the configured origin
+func (p *Probe) performCorsPreflight() error {
+	ctx, cancel := p.newContext(0)
+	defer cancel()
+	target := *p.endpoint.s3Client.EndpointURL()
+	target.Path = "/" + p.corsBucketName + "/"
+	req, err := http.NewRequestWithContext(ctx, http.MethodOptions, target.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Origin", p.corsPreflightOrigin)
+	req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	resp, err := p.endpoint.httpClient().Do(req)
+	if err != nil {
+		log.Printf("Error while sending CORS preflight request (endpoint:%s): %s", p.name, err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	allowedOrigin := resp.Header.Get("Access-Control-Allow-Origin")
+	if resp.StatusCode != http.StatusOK || (allowedOrigin != p.corsPreflightOrigin && allowedOrigin != "*") {
+		s3CorsPreflightFailureCounter.WithLabelValues(p.name, p.corsBucketName).Inc()
+		err := fmt.Errorf("preflight from %s returned status %d and allowed origin '%s'", p.corsPreflightOrigin, resp.StatusCode, allowedOrigin)
+		log.Printf("Error while checking CORS preflight (endpoint:%s): %s", p.name, err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package probe
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testCorsConfiguration = `<CORSConfiguration xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <CORSRule>
+    <AllowedOrigin>https://example.com</AllowedOrigin>
+    <AllowedMethod>GET</AllowedMethod>
+    <AllowedMethod>HEAD</AllowedMethod>
+    <MaxAgeSeconds>3000</MaxAgeSeconds>
+  </CORSRule>
+</CORSConfiguration>`
+
+func TestLoadCorsConfiguration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cors.xml")
+	if err := ioutil.WriteFile(path, []byte(testCorsConfiguration), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cors, err := loadCorsConfiguration(path)
+	if err != nil {
+		t.Fatalf("CORS configuration should be loaded: %s", err)
+	}
+	expected := &corsConfiguration{Rules: []corsRule{{
+		AllowedOrigins: []string{"https://example.com"},
+		AllowedMethods: []string{"GET", "HEAD"},
+		MaxAgeSeconds:  3000,
+	}}}
+	if !reflect.DeepEqual(cors, expected) {
+		t.Errorf("Unexpected CORS configuration %+v", cors)
+	}
+
+	// the response of the endpoint is decoded the same way, whatever the namespace
+	fromEndpoint := &corsConfiguration{}
+	_ = xml.Unmarshal([]byte(`<CORSConfiguration><CORSRule><AllowedOrigin>https://example.com</AllowedOrigin><AllowedMethod>GET</AllowedMethod><AllowedMethod>HEAD</AllowedMethod><MaxAgeSeconds>3000</MaxAgeSeconds></CORSRule></CORSConfiguration>`), fromEndpoint)
+	if !reflect.DeepEqual(cors, fromEndpoint) {
+		t.Errorf("Configurations should match: %+v %+v", cors, fromEndpoint)
+	}
+}
+
+func TestLoadCorsConfigurationFailsOnInvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cors.xml")
+	if err := ioutil.WriteFile(path, []byte("not xml <"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadCorsConfiguration(path); err == nil {
+		t.Errorf("Invalid CORS configuration should be rejected")
+	}
+}
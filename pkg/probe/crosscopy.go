@@ -0,0 +1,118 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"log"
+
+	"github.com/criteo/s3-probe/pkg/metrics"
+
+	minio "github.com/minio/minio-go/v7"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var s3CrossBucketCopyCrossRegionCounter = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_cross_bucket_copy_cross_region_errors_total",
+	Help: "Total number of cross bucket copies rejected because the destination bucket is in another region",
+}, []string{"endpoint", "code"})
+
+// crossRegionCodes are returned when a request reaches a bucket located in another region
+var crossRegionCodes = map[string]bool{
+	"AuthorizationHeaderMalformed": true,
+	"PermanentRedirect":            true,
+	"IncorrectEndpoint":            true,
+	"InvalidRegion":                true,
+}
+
+// crossRegionCopyError is returned when a cross bucket copy fails because of the destination region
+type crossRegionCopyError struct {
+	Bucket string
+	Code   string
+}
+
+func (e *crossRegionCopyError) Error() string {
+	return fmt.Sprintf("copy to bucket %s rejected as cross-region (%s)", e.Bucket, e.Code)
+}
+
+// asCrossRegionCopyError wraps the errors caused by the destination region in a crossRegionCopyError
+func asCrossRegionCopyError(err error, bucketName string) error {
+	code := minio.ToErrorResponse(err).Code
+	if !crossRegionCodes[code] {
+		return err
+	}
+	return &crossRegionCopyError{Bucket: bucketName, Code: code}
+}
+
+// performCrossBucketCopyCheck copies an object of the latency bucket to the copy destination
+// bucket server side and checks that the copy has the content of the source
+func (p *Probe) performCrossBucketCopyCheck() error {
+	objectName, _ := randomHex(20)
+	objectSize := int64(p.latencyItemSize)
+	content := make([]byte, objectSize)
+	_, _ = rand.Read(content)
+	defer p.cleanTempObject(p.endpoint.s3Client, p.latencyBucketName, objectName)
+
+	ctx, cancel := p.newContext(0)
+	defer cancel()
+	_, err := p.endpoint.s3Client.PutObject(ctx, p.latencyBucketName, objectName, bytes.NewReader(content), objectSize, minio.PutObjectOptions{})
+	if err != nil {
+		log.Printf("Error while uploading object for cross bucket copy check (endpoint:%s): %s", p.name, err)
+		return err
+	}
+	s3BytesPutCounter.WithLabelValues(p.name).Add(float64(objectSize))
+
+	defer p.cleanTempObject(p.endpoint.s3Client, p.copyDestinationBucketName, objectName)
+	operation := func(ctx context.Context) error {
+		dst := minio.CopyDestOptions{Bucket: p.copyDestinationBucketName, Object: objectName}
+		src := minio.CopySrcOptions{Bucket: p.latencyBucketName, Object: objectName}
+		_, err := p.endpoint.s3Client.CopyObject(ctx, dst, src)
+		if err != nil {
+			return asCrossRegionCopyError(err, p.copyDestinationBucketName)
+		}
+		return nil
+	}
+	if err := p.mesureOperation("cross_bucket_copy", operation); err != nil {
+		if regionErr, ok := err.(*crossRegionCopyError); ok {
+			s3CrossBucketCopyCrossRegionCounter.WithLabelValues(p.name, regionErr.Code).Inc()
+		}
+		return err
+	}
+
+	ctx, cancel = p.newContext(0)
+	defer cancel()
+	obj, err := p.endpoint.s3Client.GetObject(ctx, p.copyDestinationBucketName, objectName, minio.GetObjectOptions{})
+	if err != nil {
+		return err
+	}
+	defer obj.Close()
+	copied, err := ioutil.ReadAll(obj)
+	if err != nil {
+		log.Printf("Error while reading copied object (endpoint:%s): %s", p.name, err)
+		return err
+	}
+	if !bytes.Equal(copied, content) {
+		err = fmt.Errorf("object copied to bucket %s differs from its source", p.copyDestinationBucketName)
+		log.Printf("Error: %s (endpoint:%s)", err, p.name)
+		return err
+	}
+	return nil
+}
+
+// prepareCopyDestinationBucket creates the destination bucket of the cross bucket copy check
+func (p *Probe) prepareCopyDestinationBucket(parent context.Context) error {
+	ctx, cancel := p.newContextFrom(parent, 0)
+	defer cancel()
+	exists, err := p.endpoint.s3Client.BucketExists(ctx, p.copyDestinationBucketName)
+	if err != nil || exists {
+		return err
+	}
+	log.Printf("Preparing copy destination bucket on %s", p.name)
+	if err := makeBucket(ctx, p.endpoint.s3Client, p.copyDestinationBucketName); err != nil {
+		return err
+	}
+	setBucketLifecycle1d(ctx, p.endpoint.s3Client, p.copyDestinationBucketName)
+	return nil
+}
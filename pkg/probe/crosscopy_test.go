@@ -0,0 +1,24 @@
+package probe
+
+import (
+	"errors"
+	"testing"
+
+	minio "github.com/minio/minio-go/v7"
+)
+
+func TestAsCrossRegionCopyError(t *testing.T) {
+	err := asCrossRegionCopyError(minio.ErrorResponse{Code: "AuthorizationHeaderMalformed"}, "destination")
+	regionErr, ok := err.(*crossRegionCopyError)
+	if !ok {
+		t.Fatalf("Expected a cross region error got %v", err)
+	}
+	if regionErr.Bucket != "destination" || regionErr.Code != "AuthorizationHeaderMalformed" {
+		t.Errorf("Unexpected cross region error %s", regionErr)
+	}
+
+	other := errors.New("failure")
+	if err := asCrossRegionCopyError(other, "destination"); err != other {
+		t.Errorf("Expected other errors to be returned unchanged got %v", err)
+	}
+}
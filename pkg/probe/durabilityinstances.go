@@ -0,0 +1,56 @@
+package probe
+
+import (
+	"log"
+
+	"github.com/criteo/s3-probe/pkg/metrics"
+
+	minio "github.com/minio/minio-go/v7"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var s3DurabilityInstanceDivergence = metrics.Factory.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "s3_durability_instance_divergence",
+	Help: "Difference between the highest and the lowest number of durability items found on the instances of S3 endpoint",
+}, []string{"endpoint"})
+
+// countDurabilityItems lists the durability bucket through the given client
+func (p *Probe) countDurabilityItems(client *minio.Client) (int, error) {
+	ctx, cancel := p.newContext(p.durabilityTimeout)
+	defer cancel()
+	count := 0
+	for object := range client.ListObjects(ctx, p.durabilityBucketName, minio.ListObjectsOptions{}) {
+		if object.Err != nil {
+			return 0, object.Err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// performDurabilityInstanceComparison counts the durability items on each instance of the service,
+// so that items lost by a single node behind a load balancer are noticed
+func (p *Probe) performDurabilityInstanceComparison() error {
+	if len(p.instanceEndpoints) == 0 {
+		return nil
+	}
+	lowest, highest := -1, 0
+	for i := range p.instanceEndpoints {
+		count, err := p.countDurabilityItems(p.instanceEndpoints[i].s3Client)
+		if err != nil {
+			log.Printf("Error while listing durability items on instance %s of %s: %s", p.instanceEndpoints[i].Name, p.name, err)
+			return err
+		}
+		if lowest < 0 || count < lowest {
+			lowest = count
+		}
+		if count > highest {
+			highest = count
+		}
+	}
+	if highest != lowest {
+		log.Printf("Instances of %s disagree on the number of durability items (between %d and %d)", p.name, lowest, highest)
+	}
+	s3DurabilityInstanceDivergence.WithLabelValues(p.name).Set(float64(highest - lowest))
+	return nil
+}
@@ -0,0 +1,52 @@
+package probe
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+// newListingServer serves a durability bucket holding itemCount items
+func newListingServer(t *testing.T, itemCount int) S3Endpoint {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.URL.Query()["location"]; ok {
+			w.Write([]byte(`<LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/">us-east-1</LocationConstraint>`))
+			return
+		}
+		contents := strings.Builder{}
+		for i := 0; i < itemCount; i++ {
+			fmt.Fprintf(&contents, "<Contents><Key>%s%d</Key><Size>1</Size></Contents>", durabilityItemPrefix, i)
+		}
+		fmt.Fprintf(w, "<ListBucketResult><Name>durability</Name><IsTruncated>false</IsTruncated>%s</ListBucketResult>", contents.String())
+	}))
+	t.Cleanup(server.Close)
+
+	endpoint, err := newS3Endpoint(server.URL, "access", "secret", transportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return endpoint
+}
+
+func TestPerformDurabilityInstanceComparison(t *testing.T) {
+	p := Probe{
+		name:                    "instances",
+		durabilityBucketName:    "durability",
+		defaultOperationTimeout: time.Second,
+		instanceEndpoints:       []S3Endpoint{newListingServer(t, 3), newListingServer(t, 5), newListingServer(t, 5)},
+	}
+	if err := p.performDurabilityInstanceComparison(); err != nil {
+		t.Fatal(err)
+	}
+
+	metric := &io_prometheus_client.Metric{}
+	s3DurabilityInstanceDivergence.WithLabelValues(p.name).Write(metric)
+	if *metric.Gauge.Value != 2 {
+		t.Errorf("Expected a divergence of 2 items got %f", *metric.Gauge.Value)
+	}
+}
@@ -0,0 +1,103 @@
+package probe
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCloseEndpointsClosesGatewayConnections(t *testing.T) {
+	var closed int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<ListAllMyBucketsResult><Buckets></Buckets></ListAllMyBucketsResult>`))
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			atomic.AddInt32(&closed, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	gatewayEndpoint, err := newS3Endpoint(server.URL, "access", "secret", transportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gatewayEndpoint.s3Client.ListBuckets(context.Background()); err != nil {
+		t.Fatalf("Listing buckets failed: %s", err)
+	}
+
+	p := Probe{gatewayEndpoints: []S3Endpoint{gatewayEndpoint}}
+	p.closeEndpoints()
+
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&closed) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if atomic.LoadInt32(&closed) == 0 {
+		t.Errorf("Connection to the gateway endpoint should have been closed")
+	}
+}
+
+func TestDurabilityClientDefaultsToEndpointClient(t *testing.T) {
+	endpoint, _ := newS3Endpoint("http://localhost:9000", "access", "secret", transportOptions{})
+	durabilityEndpoint, _ := newS3Endpoint("http://localhost:9000", "durability-access", "durability-secret", transportOptions{})
+
+	p := Probe{endpoint: endpoint}
+	if p.durabilityClient() != endpoint.s3Client {
+		t.Errorf("Durability checks should use the endpoint client without their own credentials")
+	}
+	p.durabilityEndpoint = durabilityEndpoint
+	if p.durabilityClient() != durabilityEndpoint.s3Client {
+		t.Errorf("Durability checks should use their own client")
+	}
+}
+
+func TestPrepareGatewayBucketToleratesPartialFailure(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.URL.Query()["location"]; ok {
+			w.Write([]byte(`<LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/">us-east-1</LocationConstraint>`))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer healthy.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer broken.Close()
+
+	healthyEndpoint, _ := newS3Endpoint(healthy.URL, "access", "secret", transportOptions{})
+	brokenEndpoint, _ := newS3Endpoint(broken.URL, "access", "secret", transportOptions{})
+	p := Probe{
+		name:                    "gateway",
+		gatewayBucketName:       "gateway-bucket",
+		defaultOperationTimeout: time.Minute,
+		gatewayEndpoints:        []S3Endpoint{brokenEndpoint, healthyEndpoint},
+		gatewayPreparation:      newGatewayPreparation(),
+	}
+	if err := p.prepareGatewayBucket(context.Background()); err != nil {
+		t.Errorf("Preparation should succeed with a reachable destination: %s", err)
+	}
+	if p.gatewayPreparation.isPrepared(brokenEndpoint.Name) || !p.gatewayPreparation.isPrepared(healthyEndpoint.Name) {
+		t.Errorf("Only the reachable destination should be prepared")
+	}
+	if p.ensureGatewayDestinationPrepared(brokenEndpoint) {
+		t.Errorf("A destination which still can't be prepared should be skipped")
+	}
+
+	p.gatewayPrepareRequireAll = true
+	if err := p.prepareGatewayBucket(context.Background()); err == nil {
+		t.Errorf("Preparation should fail when all destinations are required")
+	}
+
+	p.gatewayPrepareRequireAll = false
+	p.gatewayEndpoints = []S3Endpoint{brokenEndpoint}
+	if err := p.prepareGatewayBucket(context.Background()); err == nil {
+		t.Errorf("Preparation should fail without any reachable destination")
+	}
+}
@@ -0,0 +1,204 @@
+package probe
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/criteo/s3-probe/pkg/config"
+	minio "github.com/minio/minio-go/v7"
+)
+
+// endpointUpdate holds the clients replacing those of a running probe
+type endpointUpdate struct {
+	endpoint           S3Endpoint
+	durabilityEndpoint S3Endpoint
+	anonymousClient    *minio.Client
+	gatewayEndpoints   []S3Endpoint
+}
+
+func (u *endpointUpdate) close() {
+	u.endpoint.close()
+	u.durabilityEndpoint.close()
+	for i := range u.gatewayEndpoints {
+		u.gatewayEndpoints[i].close()
+	}
+}
+
+// clientUsage guards the swap of the clients of a probe and tracks the checks using the current ones,
+// so that replaced clients are closed once the checks using them completed
+type clientUsage struct {
+	mu    sync.RWMutex
+	users *sync.WaitGroup
+}
+
+func newClientUsage() *clientUsage {
+	return &clientUsage{users: &sync.WaitGroup{}}
+}
+
+// snapshot returns a copy of the probe for a check, holding the current clients until release is called
+func (p *Probe) snapshot() (run *Probe, release func()) {
+	if p.clientUsage == nil {
+		copied := *p
+		return &copied, func() {}
+	}
+	p.clientUsage.mu.RLock()
+	defer p.clientUsage.mu.RUnlock()
+	copied := *p
+	users := p.clientUsage.users
+	users.Add(1)
+	return &copied, users.Done
+}
+
+// swapClients replaces the clients of the probe with update, it must only be called by StartProbing.
+// The replaced clients are closed once the checks using them completed, without waiting for them
+func (p *Probe) swapClients(update func(), closeReplaced func()) {
+	if p.clientUsage == nil {
+		closeReplaced()
+		update()
+		return
+	}
+	p.clientUsage.mu.Lock()
+	users := p.clientUsage.users
+	p.clientUsage.users = &sync.WaitGroup{}
+	update()
+	p.clientUsage.mu.Unlock()
+	go func() {
+		users.Wait()
+		closeReplaced()
+	}()
+}
+
+// SameExceptEndpoints tells whether two descriptions of a service differ at most by their
+// endpoint and gateway read endpoints, which a running probe can switch to with UpdateEndpoints
+func (s *S3Service) SameExceptEndpoints(other *S3Service) bool {
+	withOtherEndpoints := *s
+	withOtherEndpoints.Endpoint = other.Endpoint
+	withOtherEndpoints.GatewayReadEnpoints = other.GatewayReadEnpoints
+	return withOtherEndpoints.Equals(other)
+}
+
+// UpdateEndpoints switches a running probe to a new endpoint address and gateway read endpoints,
+// keeping its buckets and schedule instead of recreating it. The checks in flight complete with the
+// previous clients
+func (p *Probe) UpdateEndpoints(endpoint string, gatewayEndpoints []S3Endpoint, cfg *config.Config) error {
+	update := endpointUpdate{gatewayEndpoints: gatewayEndpoints}
+	options := newTransportOptions(cfg)
+	options.tlsConfig = p.meshTLS
+	var err error
+	update.endpoint, err = newS3Endpoint(endpoint, *cfg.AccessKey, *cfg.SecretKey, options)
+	if err != nil {
+		return err
+	}
+	if *cfg.DurabilityAccessKey != "" {
+		update.durabilityEndpoint, err = newS3Endpoint(endpoint, *cfg.DurabilityAccessKey, *cfg.DurabilitySecretKey, options)
+		if err != nil {
+			return err
+		}
+	}
+	if *cfg.AnonymousAccessCheck {
+		update.anonymousClient, _, err = newMinioClientWithTransport(endpoint, "", "", options)
+		if err != nil {
+			return err
+		}
+	}
+
+	select {
+	case p.endpointUpdates <- update:
+		return nil
+	case <-p.terminated:
+		update.close()
+		return fmt.Errorf("probe %s is not running", p.name)
+	}
+}
+
+// applyEndpointUpdate swaps the clients of the probe, it must only be called by StartProbing
+func (p *Probe) applyEndpointUpdate(update endpointUpdate) {
+	log.Printf("Updating endpoints of %s: %s", p.name, update.endpoint.Name)
+	replaced := endpointUpdate{
+		endpoint:           p.endpoint,
+		durabilityEndpoint: p.durabilityEndpoint,
+		gatewayEndpoints:   p.gatewayEndpoints,
+	}
+	p.swapClients(func() {
+		p.endpoint = update.endpoint
+		p.durabilityEndpoint = update.durabilityEndpoint
+		p.anonymousClient = update.anonymousClient
+		p.gatewayEndpoints = update.gatewayEndpoints
+	}, replaced.close)
+	// The first operations on the new endpoint open new connections
+	p.warmup.reset()
+}
+
+// newInstanceEndpoints creates the clients of the instances of a service. Instances are reached with the
+// scheme of the endpoint of the service and the credentials of the durability checks
+func newInstanceEndpoints(endpoint string, instances []string, cfg *config.Config) ([]S3Endpoint, error) {
+	accessKey, secretKey := *cfg.AccessKey, *cfg.SecretKey
+	if *cfg.DurabilityAccessKey != "" {
+		accessKey, secretKey = *cfg.DurabilityAccessKey, *cfg.DurabilitySecretKey
+	}
+	scheme := ""
+	if strings.HasPrefix(endpoint, "https://") {
+		scheme = "https://"
+	}
+	instanceEndpoints := []S3Endpoint{}
+	for _, instance := range instances {
+		instanceEndpoint, err := newS3Endpoint(scheme+instance, accessKey, secretKey, newTransportOptions(cfg))
+		if err != nil {
+			for i := range instanceEndpoints {
+				instanceEndpoints[i].close()
+			}
+			return nil, err
+		}
+		instanceEndpoints = append(instanceEndpoints, instanceEndpoint)
+	}
+	return instanceEndpoints, nil
+}
+
+// SameInstances tells whether two descriptions of a service list the same instances
+func (s *S3Service) SameInstances(other *S3Service) bool {
+	if len(s.InstanceEndpoints) != len(other.InstanceEndpoints) {
+		return false
+	}
+	for i := range s.InstanceEndpoints {
+		if s.InstanceEndpoints[i] != other.InstanceEndpoints[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// UpdateInstances switches a running probe to new instances of its service, so that a change of their
+// health doesn't recreate the probe. The checks in flight complete with the previous clients
+func (p *Probe) UpdateInstances(instances []string, cfg *config.Config) error {
+	run, release := p.snapshot()
+	endpoint := run.endpoint.Name
+	release()
+	instanceEndpoints, err := newInstanceEndpoints(endpoint, instances, cfg)
+	if err != nil {
+		return err
+	}
+	select {
+	case p.instanceUpdates <- instanceEndpoints:
+		return nil
+	case <-p.terminated:
+		for i := range instanceEndpoints {
+			instanceEndpoints[i].close()
+		}
+		return fmt.Errorf("probe %s is not running", p.name)
+	}
+}
+
+// applyInstanceUpdate swaps the clients of the instances, it must only be called by StartProbing
+func (p *Probe) applyInstanceUpdate(instanceEndpoints []S3Endpoint) {
+	log.Printf("Updating instances of %s: %d instances", p.name, len(instanceEndpoints))
+	replaced := p.instanceEndpoints
+	p.swapClients(func() {
+		p.instanceEndpoints = instanceEndpoints
+	}, func() {
+		for i := range replaced {
+			replaced[i].close()
+		}
+	})
+}
@@ -0,0 +1,137 @@
+package probe
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/criteo/s3-probe/pkg/config"
+)
+
+func TestSameExceptEndpoints(t *testing.T) {
+	service := S3Service{Name: "my-service", Endpoint: "127.0.0.1", Gateway: true, GatewayReadEnpoints: []S3Endpoint{{Name: "127.0.0.2"}}}
+
+	other := S3Service{Name: "my-service", Endpoint: "127.0.0.5", Gateway: true, GatewayReadEnpoints: []S3Endpoint{{Name: "127.0.0.3"}, {Name: "127.0.0.4"}}}
+	if !service.SameExceptEndpoints(&other) {
+		t.Error("Services differing by their endpoints only should be the same")
+	}
+	other = S3Service{Name: "my-service", Endpoint: "127.0.0.5", Gateway: false}
+	if service.SameExceptEndpoints(&other) {
+		t.Error("Services differing by their gateway flag should not be the same")
+	}
+	other = S3Service{Name: "my-service", Endpoint: "127.0.0.1", Gateway: true, GatewayReadEnpoints: []S3Endpoint{{Name: "127.0.0.2"}}, Datacenter: "par"}
+	if service.SameExceptEndpoints(&other) {
+		t.Error("Services differing by their datacenter should not be the same")
+	}
+}
+
+func TestUpdateEndpointsSwapsClients(t *testing.T) {
+	cfg := config.GetTestConfig()
+	p := Probe{name: "update", checks: &sync.WaitGroup{}, cleanups: &sync.WaitGroup{}, endpointUpdates: make(chan endpointUpdate), terminated: make(chan struct{}), warmup: newWarmupState(1)}
+	p.warmup.cycleCompleted()
+	done := make(chan struct{})
+	go func() {
+		p.applyEndpointUpdate(<-p.endpointUpdates)
+		close(done)
+	}()
+
+	gatewayEndpoints := []S3Endpoint{{Name: "127.0.0.3:9000"}}
+	if err := p.UpdateEndpoints("127.0.0.2:9000", gatewayEndpoints, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	if p.endpoint.Name != "127.0.0.2:9000" || p.endpoint.s3Client == nil {
+		t.Errorf("Expected the client of the new endpoint got %s", p.endpoint.Name)
+	}
+	if len(p.gatewayEndpoints) != 1 || p.gatewayEndpoints[0].Name != "127.0.0.3:9000" {
+		t.Errorf("Expected the new gateway endpoints got %v", p.gatewayEndpoints)
+	}
+	if !p.warmup.active() {
+		t.Errorf("Expected the probe to warm up again on the new endpoint")
+	}
+}
+
+func TestUpdateEndpointsOfAStoppedProbe(t *testing.T) {
+	cfg := config.GetTestConfig()
+	p := Probe{name: "stopped", endpointUpdates: make(chan endpointUpdate), terminated: make(chan struct{})}
+	close(p.terminated)
+	if err := p.UpdateEndpoints("127.0.0.2:9000", []S3Endpoint{}, &cfg); err == nil {
+		t.Error("Updating a stopped probe should fail")
+	}
+}
+
+func TestNewInstanceEndpointsKeepTheSchemeOfTheEndpoint(t *testing.T) {
+	cfg := config.GetTestConfig()
+	instances, err := newInstanceEndpoints("https://s3.example.com", []string{"10.0.0.1:9000"}, &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if instances[0].s3Client.EndpointURL().Scheme != "https" {
+		t.Errorf("Instances of an https endpoint should be reached over https, got %s", instances[0].s3Client.EndpointURL())
+	}
+	instances, err = newInstanceEndpoints("s3.example.com", []string{"10.0.0.1:9000"}, &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if instances[0].s3Client.EndpointURL().Scheme != "http" {
+		t.Errorf("Instances of an http endpoint should be reached over http, got %s", instances[0].s3Client.EndpointURL())
+	}
+}
+
+func TestUpdateInstancesSwapsClients(t *testing.T) {
+	cfg := config.GetTestConfig()
+	p := Probe{name: "update", checks: &sync.WaitGroup{}, instanceUpdates: make(chan []S3Endpoint), terminated: make(chan struct{})}
+	done := make(chan struct{})
+	go func() {
+		p.applyInstanceUpdate(<-p.instanceUpdates)
+		close(done)
+	}()
+
+	if err := p.UpdateInstances([]string{"10.0.0.1:9000", "10.0.0.2:9000"}, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	if len(p.instanceEndpoints) != 2 || p.instanceEndpoints[1].Name != "10.0.0.2:9000" {
+		t.Errorf("Expected the clients of the new instances got %v", p.instanceEndpoints)
+	}
+}
+
+func TestUpdateEndpointsDoesNotWaitForTheChecks(t *testing.T) {
+	cfg := config.GetTestConfig()
+	p := Probe{name: "update", endpoint: S3Endpoint{Name: "127.0.0.1:9000"}, checks: &sync.WaitGroup{}, cleanups: &sync.WaitGroup{},
+		endpointUpdates: make(chan endpointUpdate), terminated: make(chan struct{}), warmup: newWarmupState(1), clientUsage: newClientUsage()}
+	release := make(chan struct{})
+	running := make(chan *Probe)
+	p.runCheck(func(run *Probe) error {
+		running <- run
+		<-release
+		return nil
+	})
+	check := <-running
+
+	done := make(chan struct{})
+	go func() {
+		p.applyEndpointUpdate(<-p.endpointUpdates)
+		close(done)
+	}()
+	if err := p.UpdateEndpoints("127.0.0.2:9000", []S3Endpoint{}, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("The update should not wait for the checks in flight")
+	}
+	if check.endpoint.Name != "127.0.0.1:9000" {
+		t.Errorf("The check in flight should keep the previous endpoint, got %s", check.endpoint.Name)
+	}
+	run, releaseRun := p.snapshot()
+	releaseRun()
+	if run.endpoint.Name != "127.0.0.2:9000" {
+		t.Errorf("New checks should use the new endpoint, got %s", run.endpoint.Name)
+	}
+	close(release)
+	if !p.WaitChecks(time.Second) {
+		t.Error("The check should complete")
+	}
+}
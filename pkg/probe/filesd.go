@@ -0,0 +1,183 @@
+package probe
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/criteo/s3-probe/pkg/config"
+)
+
+// fileDiscoveryPollInterval is how often the modification time of the discovery file is checked
+const fileDiscoveryPollInterval = 5 * time.Second
+
+// fileTargetGroup is an entry of a discovery file, in the Prometheus file_sd format
+type fileTargetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+// fileService is a service read from a discovery file
+type fileService struct {
+	endpoint      string
+	gateway       bool
+	readEndpoints []string
+	datacenter    string
+	overrides     map[string]string
+}
+
+// fileDiscoveryClient discovers the services from a JSON file instead of consul, the file is read
+// again each time its modification time changes
+type fileDiscoveryClient struct {
+	cfg      *config.Config
+	path     string
+	mu       sync.Mutex
+	modTime  time.Time
+	services map[string]fileService
+}
+
+func newFileDiscoveryClient(cfg *config.Config) (*fileDiscoveryClient, error) {
+	client := &fileDiscoveryClient{cfg: cfg, path: *cfg.SDFile}
+	if _, err := client.reload(); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// parseTargetGroups converts target groups to services. Each target is a service named after
+// the service label, suffixed with the target when the group has several, or after the target.
+// The gateway label set to true makes them gateways read through the comma separated
+// gateway_read_endpoints label, the dc label gives their datacenter and the override labels their settings
+func parseTargetGroups(groups []fileTargetGroup) (map[string]fileService, error) {
+	services := map[string]fileService{}
+	for _, group := range groups {
+		for _, target := range group.Targets {
+			name := target
+			if serviceName := group.Labels["service"]; serviceName != "" {
+				name = serviceName
+				if len(group.Targets) > 1 {
+					name = serviceName + "/" + target
+				}
+			}
+			if _, ok := services[name]; ok {
+				return nil, fmt.Errorf("service %s is listed twice", name)
+			}
+			service := fileService{
+				endpoint:   target,
+				gateway:    group.Labels["gateway"] == "true",
+				datacenter: group.Labels["dc"],
+				overrides:  extractServiceOverrides(group.Labels),
+			}
+			if service.gateway {
+				service.readEndpoints = config.ParseList(group.Labels["gateway_read_endpoints"])
+			}
+			services[name] = service
+		}
+	}
+	return services, nil
+}
+
+// reload reads the discovery file if it changed since it was last read and returns its modification time
+func (c *fileDiscoveryClient) reload() (time.Time, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	info, err := os.Stat(c.path)
+	if err != nil {
+		return c.modTime, err
+	}
+	if info.ModTime().Equal(c.modTime) {
+		return c.modTime, nil
+	}
+	content, err := ioutil.ReadFile(c.path)
+	if err != nil {
+		return c.modTime, err
+	}
+	groups := []fileTargetGroup{}
+	if err := json.Unmarshal(content, &groups); err != nil {
+		return c.modTime, fmt.Errorf("invalid discovery file %s: %s", c.path, err)
+	}
+	services, err := parseTargetGroups(groups)
+	if err != nil {
+		return c.modTime, fmt.Errorf("invalid discovery file %s: %s", c.path, err)
+	}
+	log.Printf("Discovery file %s loaded, %d services", c.path, len(services))
+	c.services = services
+	c.modTime = info.ModTime()
+	return c.modTime, nil
+}
+
+func (c *fileDiscoveryClient) service(serviceName string) (fileService, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	service, ok := c.services[serviceName]
+	if !ok {
+		return fileService{}, fmt.Errorf("service %s is not in the discovery file", serviceName)
+	}
+	return service, nil
+}
+
+// GetAllMatchingRegisteredServices returns the services of the discovery file, read again if it changed
+func (c *fileDiscoveryClient) GetAllMatchingRegisteredServices() (map[string]bool, error) {
+	if _, err := c.reload(); err != nil {
+		// Keep probing the services last read rather than removing them all
+		log.Printf("Error while reading discovery file, keeping the previous services: %s", err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	results := map[string]bool{}
+	for name, service := range c.services {
+		results[name] = service.gateway
+	}
+	return results, nil
+}
+
+// GetServiceEndPoints returns the endpoint of a service of the discovery file, its overrides and, for gateways, their read endpoints
+func (c *fileDiscoveryClient) GetServiceEndPoints(serviceName string, isGateway bool) (ServiceEndpoints, error) {
+	service, err := c.service(serviceName)
+	if err != nil {
+		return ServiceEndpoints{}, err
+	}
+	readEndpoints := []S3Endpoint{}
+	if isGateway {
+		if len(service.readEndpoints) == 0 {
+			return ServiceEndpoints{}, fmt.Errorf("gateway %s has no gateway_read_endpoints", serviceName)
+		}
+		for _, readEndpoint := range service.readEndpoints {
+			s3endpoint, err := newS3Endpoint(readEndpoint, *c.cfg.AccessKey, *c.cfg.SecretKey, newTransportOptions(c.cfg))
+			if err != nil {
+				return ServiceEndpoints{}, err
+			}
+			readEndpoints = append(readEndpoints, s3endpoint)
+		}
+	}
+	return ServiceEndpoints{Endpoint: service.endpoint, GatewayReadEndpoints: readEndpoints, Overrides: service.overrides, Datacenter: service.datacenter}, nil
+}
+
+// GetServiceInstances returns no instance, a discovery file only lists endpoints
+func (c *fileDiscoveryClient) GetServiceInstances(serviceName string) ([]string, error) {
+	if _, err := c.service(serviceName); err != nil {
+		return []string{}, err
+	}
+	return []string{}, nil
+}
+
+// WaitForCatalogChange polls the modification time of the discovery file until it differs from lastIndex,
+// or the wait time elapses, and returns it as index. A zero lastIndex returns immediately
+func (c *fileDiscoveryClient) WaitForCatalogChange(lastIndex uint64) (uint64, error) {
+	deadline := time.Now().Add(catalogWaitTime)
+	for {
+		info, err := os.Stat(c.path)
+		if err != nil {
+			return lastIndex, err
+		}
+		index := uint64(info.ModTime().UnixNano())
+		if lastIndex == 0 || index != lastIndex || time.Now().After(deadline) {
+			return index, nil
+		}
+		time.Sleep(fileDiscoveryPollInterval)
+	}
+}
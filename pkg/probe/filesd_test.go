@@ -0,0 +1,94 @@
+package probe
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/criteo/s3-probe/pkg/config"
+)
+
+func TestParseTargetGroups(t *testing.T) {
+	groups := []fileTargetGroup{
+		{Targets: []string{"10.0.0.1:80"}, Labels: map[string]string{"service": "s3-par", "dc": "par"}},
+		{Targets: []string{"10.0.0.2:80", "10.0.0.3:80"}, Labels: map[string]string{"service": "s3-am5", "probe_rate": "10"}},
+		{Targets: []string{"gateway:80"}, Labels: map[string]string{"gateway": "true", "gateway_read_endpoints": "10.0.0.1:80, 10.0.0.2:80"}},
+	}
+	services, err := parseTargetGroups(groups)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]fileService{
+		"s3-par":             {endpoint: "10.0.0.1:80", datacenter: "par", overrides: map[string]string{}},
+		"s3-am5/10.0.0.2:80": {endpoint: "10.0.0.2:80", overrides: map[string]string{"probe_rate": "10"}},
+		"s3-am5/10.0.0.3:80": {endpoint: "10.0.0.3:80", overrides: map[string]string{"probe_rate": "10"}},
+		"gateway:80":         {endpoint: "gateway:80", gateway: true, readEndpoints: []string{"10.0.0.1:80", "10.0.0.2:80"}, overrides: map[string]string{}},
+	}
+	if !reflect.DeepEqual(services, expected) {
+		t.Errorf("Unexpected services %v", services)
+	}
+
+	groups = append(groups, fileTargetGroup{Targets: []string{"10.0.0.4:80"}, Labels: map[string]string{"service": "s3-par"}})
+	if _, err := parseTargetGroups(groups); err == nil {
+		t.Error("A service listed twice should be rejected")
+	}
+}
+
+func TestFileDiscoveryClientReloadsOnChange(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sd-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "targets.json")
+	if err := ioutil.WriteFile(path, []byte(`[{"targets": ["10.0.0.1:80"], "labels": {"service": "s3-par"}}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.GetTestConfig()
+	cfg.SDFile = &path
+	client, err := newFileDiscoveryClient(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	services, _ := client.GetAllMatchingRegisteredServices()
+	if !reflect.DeepEqual(services, map[string]bool{"s3-par": false}) {
+		t.Errorf("Unexpected services %v", services)
+	}
+	index, err := client.WaitForCatalogChange(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte(`[{"targets": ["10.0.0.2:80"], "labels": {"service": "s3-am5"}}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	newIndex, err := client.WaitForCatalogChange(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newIndex == index {
+		t.Error("A change of the file should change the index")
+	}
+	services, _ = client.GetAllMatchingRegisteredServices()
+	if !reflect.DeepEqual(services, map[string]bool{"s3-am5": false}) {
+		t.Errorf("Unexpected services %v", services)
+	}
+
+	if err := ioutil.WriteFile(path, []byte(`not json`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	modTime = modTime.Add(time.Minute)
+	os.Chtimes(path, modTime, modTime)
+	services, _ = client.GetAllMatchingRegisteredServices()
+	if !reflect.DeepEqual(services, map[string]bool{"s3-am5": false}) {
+		t.Errorf("An invalid file should keep the previous services, got %v", services)
+	}
+}
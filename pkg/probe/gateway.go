@@ -0,0 +1,101 @@
+package probe
+
+import (
+	"log"
+	"sync"
+
+	"github.com/criteo/s3-probe/pkg/metrics"
+
+	minio "github.com/minio/minio-go/v7"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var s3GatewayBucketObjects = metrics.Factory.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "s3_gateway_bucket_objects",
+	Help: "Number of objects present in the gateway bucket of a gateway destination",
+}, []string{"endpoint", "gateway_endpoint"})
+
+var s3GatewayBucketObjectsExceeded = metrics.Factory.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "s3_gateway_bucket_objects_exceeded",
+	Help: "Whether the gateway bucket holds more objects than the configured threshold (1) or not (0)",
+}, []string{"endpoint", "gateway_endpoint"})
+
+// performGatewayBucketObjectsCheck counts the objects left in the gateway bucket
+// of every destination, which should stay roughly empty as objects are removed each cycle
+func (p *Probe) performGatewayBucketObjectsCheck() {
+	for i := range p.gatewayEndpoints {
+		count, err := p.countGatewayBucketObjects(p.gatewayEndpoints[i])
+		if err != nil {
+			log.Printf("Error while listing gateway bucket (endpoint:%s, gateway_endpoint:%s): %s", p.name, p.gatewayEndpoints[i].Name, err)
+			continue
+		}
+		s3GatewayBucketObjects.WithLabelValues(p.name, p.gatewayEndpoints[i].Name).Set(float64(count))
+		if count > p.gatewayObjectsThreshold {
+			log.Printf("Gateway bucket on %s holds %d objects (threshold: %d)", p.gatewayEndpoints[i].Name, count, p.gatewayObjectsThreshold)
+			s3GatewayBucketObjectsExceeded.WithLabelValues(p.name, p.gatewayEndpoints[i].Name).Set(1)
+		} else {
+			s3GatewayBucketObjectsExceeded.WithLabelValues(p.name, p.gatewayEndpoints[i].Name).Set(0)
+		}
+	}
+}
+
+func (p *Probe) countGatewayBucketObjects(endpoint S3Endpoint) (int, error) {
+	ctx, cancel := p.newContext(p.durabilityTimeout)
+	defer cancel()
+	count := 0
+	for object := range endpoint.s3Client.ListObjects(ctx, p.gatewayBucketName, minio.ListObjectsOptions{Recursive: true}) {
+		if object.Err != nil {
+			return count, object.Err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// gatewayPreparation tracks the gateway destinations whose bucket has been prepared
+type gatewayPreparation struct {
+	mu       sync.Mutex
+	prepared map[string]bool
+}
+
+func newGatewayPreparation() *gatewayPreparation {
+	return &gatewayPreparation{prepared: map[string]bool{}}
+}
+
+func (g *gatewayPreparation) set(name string) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.prepared[name] = true
+}
+
+// isPrepared tells whether the bucket of a destination has been prepared, destinations are
+// considered prepared when they aren't tracked
+func (g *gatewayPreparation) isPrepared(name string) bool {
+	if g == nil {
+		return true
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.prepared[name]
+}
+
+// ensureGatewayDestinationPrepared prepares the bucket of a destination which couldn't be prepared with the probe,
+// or which was added by an endpoint update. It returns false while the bucket can't be prepared, the destination
+// being skipped meanwhile
+func (p *Probe) ensureGatewayDestinationPrepared(endpoint S3Endpoint) bool {
+	if p.gatewayPreparation.isPrepared(endpoint.Name) {
+		return true
+	}
+	ctx, cancel := p.newContext(0)
+	defer cancel()
+	if err := p.prepareGatewayEndpointBucket(ctx, endpoint); err != nil {
+		log.Printf("Error: cannot prepare gateway bucket on %s, skipping it: %s", endpoint.Name, err)
+		probeGatewayPrepareErrorCounter.WithLabelValues(p.name, endpoint.Name).Inc()
+		return false
+	}
+	p.gatewayPreparation.set(endpoint.Name)
+	return true
+}
@@ -0,0 +1,34 @@
+package probe
+
+import (
+	"net/http"
+	"testing"
+
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+func TestPerformGatewayChecksResetsHealthyEndpointsOnFailedPut(t *testing.T) {
+	p, _ := newLatencyTestProbe(t, func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method != http.MethodPut {
+			return false
+		}
+		w.WriteHeader(http.StatusForbidden)
+		return true
+	})
+	p.name = "gateway-put-failure"
+	p.gateway = true
+	p.gatewayBucketName = "gateway"
+	p.gatewayEndpoints = []S3Endpoint{p.endpoint}
+	s3GatewayHealthyEndpoints.WithLabelValues(p.name).Set(1)
+
+	if err := p.performGatewayChecks(); err == nil {
+		t.Fatal("Gateway checks should fail when the object can't be written")
+	}
+	metric := io_prometheus_client.Metric{}
+	if err := s3GatewayHealthyEndpoints.WithLabelValues(p.name).Write(&metric); err != nil {
+		t.Fatal(err)
+	}
+	if metric.GetGauge().GetValue() != 0 {
+		t.Errorf("No destination should be healthy without the object, got %f", metric.GetGauge().GetValue())
+	}
+}
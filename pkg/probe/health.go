@@ -0,0 +1,83 @@
+package probe
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/criteo/s3-probe/pkg/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var s3Up = metrics.Factory.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "s3_up",
+	Help: "Whether the S3 endpoint is considered up (1) or down (0)",
+}, []string{"endpoint"})
+
+// upState tracks consecutive check results so that s3_up only flips
+// once a configurable number of cycles agree
+type upState struct {
+	mu            sync.Mutex
+	known         bool
+	up            bool
+	successes     int
+	failures      int
+	upThreshold   int
+	downThreshold int
+}
+
+func newUpState(upThreshold int, downThreshold int) *upState {
+	if upThreshold < 1 {
+		upThreshold = 1
+	}
+	if downThreshold < 1 {
+		downThreshold = 1
+	}
+	return &upState{upThreshold: upThreshold, downThreshold: downThreshold}
+}
+
+// record registers the result of a check cycle and returns the current state.
+// known is false until enough cycles have been observed to decide.
+func (s *upState) record(success bool) (up bool, known bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if success {
+		s.successes++
+		s.failures = 0
+		if s.successes >= s.upThreshold {
+			s.up = true
+			s.known = true
+		}
+	} else {
+		s.failures++
+		s.successes = 0
+		if s.failures >= s.downThreshold {
+			s.up = false
+			s.known = true
+		}
+	}
+	return s.up, s.known
+}
+
+// recordCycle runs a check cycle and updates s3_up with its outcome, the cycle
+// counts towards the warm-up of the probe. Cycles cut short by the global rate limit are ignored, as are
+// cycles completing once the probe is paused.
+// Objects created by the checks are removed in the background, the cycle is recorded without waiting for them
+func (p *Probe) recordCycle(check func() error) {
+	err := check()
+	if errors.Is(err, errGlobalRateLimited) {
+		return
+	}
+	p.warmup.cycleCompleted()
+	p.lastCycle.record(p.clock.Now(), err)
+	up, known := p.upState.record(err == nil)
+	if !known || p.pause.isPaused() {
+		return
+	}
+	if up {
+		s3Up.WithLabelValues(p.name).Set(1)
+	} else {
+		s3Up.WithLabelValues(p.name).Set(0)
+	}
+}
@@ -0,0 +1,34 @@
+package probe
+
+import "testing"
+
+func TestUpStateRequiresConsecutiveFailures(t *testing.T) {
+	state := newUpState(1, 3)
+	if up, known := state.record(true); !up || !known {
+		t.Errorf("Endpoint should be up after the first success")
+	}
+	state.record(false)
+	state.record(false)
+	if up, _ := state.record(true); !up {
+		t.Errorf("Endpoint shouldn't go down before reaching the down threshold")
+	}
+	state.record(false)
+	state.record(false)
+	if up, _ := state.record(false); up {
+		t.Errorf("Endpoint should be down after 3 consecutive failures")
+	}
+}
+
+func TestUpStateRequiresConsecutiveSuccesses(t *testing.T) {
+	state := newUpState(2, 1)
+	if _, known := state.record(true); known {
+		t.Errorf("State shouldn't be known before reaching the up threshold")
+	}
+	if up, _ := state.record(false); up {
+		t.Errorf("Endpoint should be down after a failure")
+	}
+	state.record(true)
+	if up, _ := state.record(true); !up {
+		t.Errorf("Endpoint should be up after 2 consecutive successes")
+	}
+}
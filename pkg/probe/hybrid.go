@@ -0,0 +1,109 @@
+package probe
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/criteo/s3-probe/pkg/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var serviceDiscoveryConflictCounter = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_service_discovery_conflict_total",
+	Help: "Total number of services found both in the discovery file and in consul, only one of them being probed",
+}, []string{"service"})
+
+// hybridDiscoveryClient merges the services of the discovery file and of consul. Services found in
+// both are taken from the source given precedence, "file" or "consul"
+type hybridDiscoveryClient struct {
+	file       ConsulClient
+	consul     ConsulClient
+	precedence string
+	mu         sync.Mutex
+	// sources tells which client discovered each service in the last listing
+	sources map[string]ConsulClient
+}
+
+func newHybridDiscoveryClient(file ConsulClient, consul ConsulClient, precedence string) (*hybridDiscoveryClient, error) {
+	if precedence != "file" && precedence != "consul" {
+		return nil, fmt.Errorf("invalid discovery precedence %q, expected file or consul", precedence)
+	}
+	return &hybridDiscoveryClient{file: file, consul: consul, precedence: precedence, sources: map[string]ConsulClient{}}, nil
+}
+
+// GetAllMatchingRegisteredServices lists the services of both sources. When one of them fails the
+// services of the other are still returned, so that its probes are kept
+func (c *hybridDiscoveryClient) GetAllMatchingRegisteredServices() (map[string]bool, error) {
+	fileServices, fileErr := c.file.GetAllMatchingRegisteredServices()
+	consulServices, consulErr := c.consul.GetAllMatchingRegisteredServices()
+	if fileErr != nil && consulErr != nil {
+		return map[string]bool{}, fmt.Errorf("both discovery sources failed: %s, %s", fileErr, consulErr)
+	}
+	if consulErr != nil {
+		log.Printf("Fail to list services from consul, keeping the services of the discovery file: %s", consulErr)
+	}
+	if fileErr != nil {
+		log.Printf("Fail to list services from the discovery file, keeping the services of consul: %s", fileErr)
+	}
+
+	first, firstServices, second, secondServices := c.file, fileServices, c.consul, consulServices
+	if c.precedence == "consul" {
+		first, firstServices, second, secondServices = c.consul, consulServices, c.file, fileServices
+	}
+	results := map[string]bool{}
+	sources := map[string]ConsulClient{}
+	for name, isGateway := range firstServices {
+		results[name] = isGateway
+		sources[name] = first
+	}
+	for name, isGateway := range secondServices {
+		if _, ok := results[name]; ok {
+			log.Printf("Service %s is both in the discovery file and in consul, probing the one from %s", name, c.precedence)
+			serviceDiscoveryConflictCounter.WithLabelValues(name).Inc()
+			continue
+		}
+		results[name] = isGateway
+		sources[name] = second
+	}
+
+	c.mu.Lock()
+	c.sources = sources
+	c.mu.Unlock()
+	return results, nil
+}
+
+func (c *hybridDiscoveryClient) source(serviceName string) (ConsulClient, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	source, ok := c.sources[serviceName]
+	if !ok {
+		return nil, fmt.Errorf("service %s was not discovered", serviceName)
+	}
+	return source, nil
+}
+
+// GetServiceEndPoints resolves the endpoints of a service with the source it was discovered from
+func (c *hybridDiscoveryClient) GetServiceEndPoints(serviceName string, isGateway bool) (ServiceEndpoints, error) {
+	source, err := c.source(serviceName)
+	if err != nil {
+		return ServiceEndpoints{}, err
+	}
+	return source.GetServiceEndPoints(serviceName, isGateway)
+}
+
+// GetServiceInstances resolves the instances of a service with the source it was discovered from
+func (c *hybridDiscoveryClient) GetServiceInstances(serviceName string) ([]string, error) {
+	source, err := c.source(serviceName)
+	if err != nil {
+		return []string{}, err
+	}
+	return source.GetServiceInstances(serviceName)
+}
+
+// WaitForCatalogChange waits for changes of the consul catalog, changes of the discovery file
+// are picked up by the periodic discovery
+func (c *hybridDiscoveryClient) WaitForCatalogChange(lastIndex uint64) (uint64, error) {
+	return c.consul.WaitForCatalogChange(lastIndex)
+}
@@ -0,0 +1,103 @@
+package probe
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// staticDiscoveryClient is a discovery source returning fixed services, all resolved to the same endpoint
+type staticDiscoveryClient struct {
+	services map[string]bool
+	endpoint string
+	err      error
+}
+
+func (c *staticDiscoveryClient) GetAllMatchingRegisteredServices() (map[string]bool, error) {
+	return c.services, c.err
+}
+
+func (c *staticDiscoveryClient) GetServiceEndPoints(serviceName string, isGateway bool) (ServiceEndpoints, error) {
+	return ServiceEndpoints{Endpoint: c.endpoint}, nil
+}
+
+func (c *staticDiscoveryClient) GetServiceInstances(serviceName string) ([]string, error) {
+	return []string{c.endpoint}, nil
+}
+
+func (c *staticDiscoveryClient) WaitForCatalogChange(lastIndex uint64) (uint64, error) {
+	return lastIndex + 1, nil
+}
+
+func TestHybridDiscoveryMergesSources(t *testing.T) {
+	file := &staticDiscoveryClient{services: map[string]bool{"aws-bucket": false, "s3-par": false}, endpoint: "file"}
+	consul := &staticDiscoveryClient{services: map[string]bool{"s3-par": true, "s3-am5": false}, endpoint: "consul"}
+
+	for precedence, expected := range map[string]map[string]string{
+		"file":   {"aws-bucket": "file", "s3-par": "file", "s3-am5": "consul"},
+		"consul": {"aws-bucket": "file", "s3-par": "consul", "s3-am5": "consul"},
+	} {
+		client, err := newHybridDiscoveryClient(file, consul, precedence)
+		if err != nil {
+			t.Fatal(err)
+		}
+		services, err := client.GetAllMatchingRegisteredServices()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(services) != 3 || services["s3-par"] != (precedence == "consul") {
+			t.Errorf("Precedence %s: unexpected services %v", precedence, services)
+		}
+		resolved := map[string]string{}
+		for name := range services {
+			endpoints, _ := client.GetServiceEndPoints(name, services[name])
+			resolved[name] = endpoints.Endpoint
+		}
+		if !reflect.DeepEqual(resolved, expected) {
+			t.Errorf("Precedence %s: expected services resolved by %v got %v", precedence, expected, resolved)
+		}
+	}
+}
+
+func TestHybridDiscoveryKeepsServicesOfAHealthySource(t *testing.T) {
+	file := &staticDiscoveryClient{services: map[string]bool{"aws-bucket": false}, endpoint: "file"}
+	consul := &staticDiscoveryClient{services: map[string]bool{}, err: errors.New("consul unreachable")}
+	client, _ := newHybridDiscoveryClient(file, consul, "file")
+
+	services, err := client.GetAllMatchingRegisteredServices()
+	if err != nil || !reflect.DeepEqual(services, map[string]bool{"aws-bucket": false}) {
+		t.Errorf("Expected the services of the discovery file got %v, %v", services, err)
+	}
+
+	file.err = errors.New("invalid file")
+	if _, err := client.GetAllMatchingRegisteredServices(); err == nil {
+		t.Error("Discovery should fail when both sources fail")
+	}
+	if _, err := client.GetServiceEndPoints("unknown", false); err == nil {
+		t.Error("Services not discovered should not be resolved")
+	}
+}
+
+func TestHybridDiscoveryRejectsInvalidPrecedence(t *testing.T) {
+	if _, err := newHybridDiscoveryClient(&staticDiscoveryClient{}, &staticDiscoveryClient{}, "both"); err == nil {
+		t.Error("Precedence should be file or consul")
+	}
+}
+
+func TestServiceFiltersApplyToEveryDiscovery(t *testing.T) {
+	file := &staticDiscoveryClient{services: map[string]bool{"s3-par": false, "s3-par-canary": false, "aws-bucket": true}, endpoint: "file"}
+	include, _ := compileServiceFilter("s3-.*")
+	exclude, _ := compileServiceFilter(".*-canary")
+	client := &serviceFilterClient{ConsulClient: file, include: include, exclude: exclude}
+
+	services, err := client.GetAllMatchingRegisteredServices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(services, map[string]bool{"s3-par": false}) {
+		t.Errorf("Unexpected services %v", services)
+	}
+	if len(file.services) != 3 {
+		t.Errorf("The services of the discovery should be left untouched, got %v", file.services)
+	}
+}
@@ -0,0 +1,70 @@
+package probe
+
+import (
+	"context"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/criteo/s3-probe/pkg/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var s3LatencyAfterIdleHistogram = metrics.Factory.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "s3_latency_after_idle_histogram_seconds",
+	Help:    "Latency for operation on the S3 endpoint opening a new connection after an idle period",
+	Buckets: []float64{.001, .0025, .005, .010, .015, .020, .025, .030, .040, .050, .060, .075, .100, .250, .500, 1, 2.5, 5, 10, 15, 30, 45, 60},
+}, []string{"operation", "endpoint"})
+
+var s3FreshConnectionCounter = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_request_fresh_connection_total",
+	Help: "Total number of operations on S3 endpoint which opened a new connection",
+}, []string{"operation", "endpoint"})
+
+// idleTracker remembers when the last operation of a probe completed
+type idleTracker struct {
+	mu   sync.Mutex
+	last time.Time
+}
+
+// idleSince returns for how long no operation completed, or zero if none ever did
+func (t *idleTracker) idleSince(now time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.last.IsZero() {
+		return 0
+	}
+	return now.Sub(t.last)
+}
+
+func (t *idleTracker) touch(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if now.After(t.last) {
+		t.last = now
+	}
+}
+
+// connectionFlag is set when a request of the operation did not reuse a connection
+type connectionFlag struct {
+	fresh int32
+}
+
+func (f *connectionFlag) Load() bool {
+	return atomic.LoadInt32(&f.fresh) == 1
+}
+
+// withConnectionTrace returns a context tracing whether requests open new connections
+func withConnectionTrace(ctx context.Context) (context.Context, *connectionFlag) {
+	flag := &connectionFlag{}
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if !info.Reused {
+				atomic.StoreInt32(&flag.fresh, 1)
+			}
+		},
+	}
+	return httptrace.WithClientTrace(ctx, trace), flag
+}
@@ -0,0 +1,23 @@
+package probe
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIdleTrackerReportsIdlePeriod(t *testing.T) {
+	tracker := idleTracker{}
+	now := time.Now()
+	if tracker.idleSince(now) != 0 {
+		t.Errorf("Idle period should be zero before any operation")
+	}
+	tracker.touch(now)
+	if idle := tracker.idleSince(now.Add(time.Minute)); idle != time.Minute {
+		t.Errorf("Expected 1m idle period got %s", idle)
+	}
+	// An older operation completing late shouldn't move the tracker backwards
+	tracker.touch(now.Add(-time.Minute))
+	if idle := tracker.idleSince(now.Add(time.Minute)); idle != time.Minute {
+		t.Errorf("Expected 1m idle period got %s", idle)
+	}
+}
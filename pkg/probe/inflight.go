@@ -0,0 +1,43 @@
+package probe
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/criteo/s3-probe/pkg/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var s3QueueWaitHistogram = metrics.Factory.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "s3_probe_queue_wait_seconds",
+	Help:    "Time spent by an operation waiting for an in-flight slot before being sent to the S3 endpoint",
+	Buckets: []float64{.001, .0025, .005, .010, .025, .050, .100, .250, .500, 1, 2.5, 5, 10, 30, 60},
+}, []string{"operation", "endpoint"})
+
+// acquireOperationSlot waits for an in-flight operation slot, giving up after
+// the default operation timeout. The time spent waiting is reported separately
+// from the operation latency, as it is backpressure internal to the probe
+func (p *Probe) acquireOperationSlot(operationName string) error {
+	if p.operationSlots == nil {
+		return nil
+	}
+	start := time.Now()
+	ctx, cancel := p.newContext(0)
+	defer cancel()
+	defer func() {
+		s3QueueWaitHistogram.WithLabelValues(operationName, p.name).Observe(time.Since(start).Seconds())
+	}()
+	select {
+	case p.operationSlots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("no in-flight slot available for %s: %w", operationName, ctx.Err())
+	}
+}
+
+func (p *Probe) releaseOperationSlot() {
+	if p.operationSlots != nil {
+		<-p.operationSlots
+	}
+}
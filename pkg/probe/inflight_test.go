@@ -0,0 +1,65 @@
+package probe
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAcquireOperationSlotWithoutLimit(t *testing.T) {
+	p := Probe{name: "test"}
+	if err := p.acquireOperationSlot("put_object"); err != nil {
+		t.Errorf("Acquiring a slot without limit should succeed: %s", err)
+	}
+	p.releaseOperationSlot()
+}
+
+func TestAcquireOperationSlotGivesUpWhenFull(t *testing.T) {
+	p := Probe{name: "test", operationSlots: make(chan struct{}, 1), defaultOperationTimeout: 10 * time.Millisecond}
+	if err := p.acquireOperationSlot("put_object"); err != nil {
+		t.Fatalf("First slot should be available: %s", err)
+	}
+	if err := p.acquireOperationSlot("get_object"); err == nil {
+		t.Errorf("Acquiring a slot should fail while all slots are taken")
+	}
+	p.releaseOperationSlot()
+	if err := p.acquireOperationSlot("get_object"); err != nil {
+		t.Errorf("Slot should be available once released: %s", err)
+	}
+}
+
+func TestInflightOperationsOldest(t *testing.T) {
+	operations := newInflightOperations()
+	now := time.Now()
+	if age := operations.oldest(now); age != 0 {
+		t.Errorf("Expected no operation in flight got %s", age)
+	}
+	doneFirst := operations.start(now.Add(-time.Minute))
+	doneSecond := operations.start(now.Add(-time.Second))
+	if age := operations.oldest(now); age != time.Minute {
+		t.Errorf("Expected the oldest operation to be a minute old got %s", age)
+	}
+	doneFirst()
+	if age := operations.oldest(now); age != time.Second {
+		t.Errorf("Expected the oldest operation to be a second old got %s", age)
+	}
+	doneSecond()
+	if age := operations.oldest(now); age != 0 {
+		t.Errorf("Expected no operation in flight got %s", age)
+	}
+}
+
+func TestInflightCollectorKeepsReplacingProbe(t *testing.T) {
+	collector := &inflightCollector{probes: map[string]*inflightOperations{}}
+	previous := newInflightOperations()
+	current := newInflightOperations()
+	collector.track("endpoint", previous)
+	collector.track("endpoint", current)
+	collector.untrack("endpoint", previous)
+	if collector.probes["endpoint"] != current {
+		t.Errorf("The terminated probe should not untrack its replacement")
+	}
+	collector.untrack("endpoint", current)
+	if len(collector.probes) != 0 {
+		t.Errorf("Expected no probe tracked")
+	}
+}
@@ -0,0 +1,72 @@
+package probe
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// jitteredTicker ticks first after a phase offset, then at intervals varied randomly so that
+// probes created together don't hit shared infrastructure at the same instant
+type jitteredTicker struct {
+	c    chan time.Time
+	stop chan struct{}
+	once sync.Once
+}
+
+func (t *jitteredTicker) Chan() <-chan time.Time {
+	return t.c
+}
+
+// Stop stops the ticks, the goroutine delivering them exits at the end of its current wait
+func (t *jitteredTicker) Stop() {
+	t.once.Do(func() { close(t.stop) })
+}
+
+func (t *jitteredTicker) run(c clock, interval time.Duration, offset time.Duration, jitter float64) {
+	c.Sleep(offset)
+	for {
+		select {
+		case <-t.stop:
+			return
+		default:
+		}
+		// Like time.Ticker, ticks are dropped while the previous one is not consumed
+		select {
+		case t.c <- c.Now():
+		default:
+		}
+		c.Sleep(jitteredInterval(interval, jitter, rand.Float64()))
+	}
+}
+
+// jitteredInterval varies interval by up to jitter times itself in both directions, r being
+// a random number in [0, 1)
+func jitteredInterval(interval time.Duration, jitter float64, r float64) time.Duration {
+	return interval + time.Duration((2*r-1)*jitter*float64(interval))
+}
+
+// validateTickJitter checks that a jitter keeps intervals positive
+func validateTickJitter(jitter float64) error {
+	if jitter < 0 || jitter >= 1 {
+		return fmt.Errorf("invalid tick jitter %g, expected a fraction of the interval in [0, 1)", jitter)
+	}
+	return nil
+}
+
+// newProbeTimer ticks rate times per minute like newTimer, shifted by a random phase offset
+// and jittered when the probe is configured so
+func (p *Probe) newProbeTimer(rate int) timer {
+	if rate == 0 || (!p.tickPhaseOffset && p.tickJitter == 0) {
+		return newTimer(p.clock, rate)
+	}
+	interval := time.Duration(millisecondInMinute/rate) * time.Millisecond
+	offset := time.Duration(0)
+	if p.tickPhaseOffset {
+		offset = time.Duration(rand.Int63n(int64(interval)))
+	}
+	t := &jitteredTicker{c: make(chan time.Time, 1), stop: make(chan struct{})}
+	go t.run(p.clock, interval, offset, p.tickJitter)
+	return timer{Ticker: t, C: t.c}
+}
@@ -0,0 +1,68 @@
+package probe
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJitteredInterval(t *testing.T) {
+	interval := 10 * time.Second
+	if d := jitteredInterval(interval, 0.2, 0); d != 8*time.Second {
+		t.Errorf("Expected the shortest interval to be 8s got %s", d)
+	}
+	if d := jitteredInterval(interval, 0.2, 0.5); d != interval {
+		t.Errorf("Expected the median interval to be 10s got %s", d)
+	}
+	if d := jitteredInterval(interval, 0, 0.9); d != interval {
+		t.Errorf("Expected no jitter to keep the interval got %s", d)
+	}
+}
+
+func TestValidateTickJitter(t *testing.T) {
+	for _, jitter := range []float64{0, 0.5} {
+		if err := validateTickJitter(jitter); err != nil {
+			t.Errorf("Jitter %g should be accepted: %s", jitter, err)
+		}
+	}
+	for _, jitter := range []float64{-0.1, 1, 2} {
+		if err := validateTickJitter(jitter); err == nil {
+			t.Errorf("Jitter %g should be rejected", jitter)
+		}
+	}
+}
+
+func TestProbeTimerStartsAtAPhaseOffset(t *testing.T) {
+	clock := &fakeClock{}
+	p := Probe{clock: clock, tickPhaseOffset: true, tickJitter: 0.1}
+	timer := p.newProbeTimer(4)
+	select {
+	case <-timer.C:
+	case <-time.After(time.Second):
+		t.Fatal("Expected a tick after the phase offset")
+	}
+	timer.Stop()
+
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	if len(clock.slept) == 0 {
+		t.Fatal("Expected the offset to be waited")
+	}
+	if clock.slept[0] < 0 || clock.slept[0] >= 15*time.Second {
+		t.Errorf("Expected an offset within the 15s interval got %s", clock.slept[0])
+	}
+	for _, d := range clock.slept[1:] {
+		if d < 13500*time.Millisecond || d > 16500*time.Millisecond {
+			t.Errorf("Expected intervals within 10%% of 15s got %s", d)
+		}
+	}
+}
+
+func TestProbeTimerWithoutJitterUsesATicker(t *testing.T) {
+	clock := &fakeClock{}
+	p := Probe{clock: clock}
+	timer := p.newProbeTimer(4)
+	defer timer.Stop()
+	if clock.tickerCount() != 1 {
+		t.Errorf("Expected a regular ticker without phase offset nor jitter")
+	}
+}
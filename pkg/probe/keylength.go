@@ -0,0 +1,83 @@
+package probe
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+
+	"github.com/criteo/s3-probe/pkg/metrics"
+
+	minio "github.com/minio/minio-go/v7"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var s3MaxWorkingKeyLength = metrics.Factory.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "s3_max_working_key_length",
+	Help: "Longest object key checked to round-trip on S3 endpoint",
+}, []string{"endpoint"})
+
+// minCheckedKeyLength is the first key length checked, lengths are then doubled up to the maximum
+const minCheckedKeyLength = 64
+
+// checkedKeyLengths returns the key lengths checked, doubling from minCheckedKeyLength up to max included
+func checkedKeyLengths(max int) []int {
+	lengths := []int{}
+	for length := minCheckedKeyLength; length < max; length *= 2 {
+		lengths = append(lengths, length)
+	}
+	return append(lengths, max)
+}
+
+// performKeyLengthCheck writes objects with longer and longer keys and reads them back,
+// stopping at the first key which doesn't round-trip
+func (p *Probe) performKeyLengthCheck() error {
+	maxWorking := 0
+	for _, length := range checkedKeyLengths(p.keyLengthCheckMax) {
+		if err := p.checkKeyRoundTrip(length); err != nil {
+			log.Printf("Key of %d characters doesn't round-trip on %s: %s", length, p.name, err)
+			break
+		}
+		maxWorking = length
+	}
+	s3MaxWorkingKeyLength.WithLabelValues(p.name).Set(float64(maxWorking))
+	return nil
+}
+
+// checkKeyRoundTrip writes an object whose key has the given length and reads it back with the same key
+func (p *Probe) checkKeyRoundTrip(length int) error {
+	suffix, _ := randomHex(8)
+	prefix := "key-length-" + suffix + "-"
+	objectName := prefix
+	if length < len(prefix) {
+		objectName = prefix[:length]
+	} else {
+		objectName += strings.Repeat("k", length-len(prefix))
+	}
+	payload := []byte(objectName)
+
+	ctx, cancel := p.newContext(0)
+	defer cancel()
+	_, err := p.endpoint.s3Client.PutObject(ctx, p.latencyBucketName, objectName, bytes.NewReader(payload), int64(len(payload)), minio.PutObjectOptions{})
+	if err != nil {
+		return err
+	}
+	s3BytesPutCounter.WithLabelValues(p.name).Add(float64(len(payload)))
+	defer p.cleanTempObject(p.endpoint.s3Client, p.latencyBucketName, objectName)
+
+	obj, err := p.endpoint.s3Client.GetObject(ctx, p.latencyBucketName, objectName, minio.GetObjectOptions{})
+	if err != nil {
+		return err
+	}
+	defer obj.Close()
+	data, err := ioutil.ReadAll(obj)
+	s3BytesGetCounter.WithLabelValues(p.name).Add(float64(len(data)))
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(data, payload) {
+		return fmt.Errorf("object read back differs from the object written")
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+package probe
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheckedKeyLengths(t *testing.T) {
+	cases := map[int][]int{
+		1024: {64, 128, 256, 512, 1024},
+		1000: {64, 128, 256, 512, 1000},
+		32:   {32},
+	}
+	for max, expected := range cases {
+		if lengths := checkedKeyLengths(max); !reflect.DeepEqual(lengths, expected) {
+			t.Errorf("Max %d: expected %v got %v", max, expected, lengths)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/criteo/s3-probe/pkg/metrics"
+
+	minio "github.com/minio/minio-go/v7"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var s3LastModifiedRegressionCounter = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_lastmodified_regression_total",
+	Help: "Total number of overwrites on S3 endpoint returning a LastModified earlier than the previous one",
+}, []string{"endpoint"})
+
+// checkLastModified checks that the LastModified of an overwritten object didn't go back in time.
+// LastModified is served with a one second resolution, so both dates are compared at this resolution
+func checkLastModified(previous time.Time, current time.Time) error {
+	if current.Truncate(time.Second).Before(previous.Truncate(time.Second)) {
+		return fmt.Errorf("LastModified went back from %s to %s", previous.UTC(), current.UTC())
+	}
+	return nil
+}
+
+// performLastModifiedCheck overwrites an object and checks that its LastModified advances
+func (p *Probe) performLastModifiedCheck() error {
+	objectName, _ := randomHex(20)
+	objectSize := int64(p.latencyItemSize)
+	defer p.cleanTempObject(p.endpoint.s3Client, p.latencyBucketName, objectName)
+
+	var lastModified []time.Time
+	for i := 0; i < 2; i++ {
+		objectData, _ := randomObject(objectSize)
+		operation := func(ctx context.Context) error {
+			_, err := p.endpoint.s3Client.PutObject(ctx, p.latencyBucketName, objectName, objectData, objectSize, minio.PutObjectOptions{})
+			if err != nil {
+				return err
+			}
+			s3BytesPutCounter.WithLabelValues(p.name).Add(float64(objectSize))
+			info, err := p.endpoint.s3Client.StatObject(ctx, p.latencyBucketName, objectName, minio.StatObjectOptions{})
+			if err != nil {
+				return err
+			}
+			lastModified = append(lastModified, info.LastModified)
+			return nil
+		}
+		if err := p.mesureOperation("put_object_last_modified", operation); err != nil {
+			return err
+		}
+	}
+
+	if err := checkLastModified(lastModified[0], lastModified[1]); err != nil {
+		s3LastModifiedRegressionCounter.WithLabelValues(p.name).Inc()
+		log.Printf("Error while checking LastModified of an overwritten object (endpoint:%s): %s", p.name, err)
+		return err
+	}
+	return nil
+}
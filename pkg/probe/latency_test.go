@@ -0,0 +1,238 @@
+package probe
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/criteo/s3-probe/pkg/config"
+)
+
+// newLatencyTestProbe returns a probe running its latency checks against an in-memory S3 server,
+// the requests received by the server are returned as "<method> <path>" once the cleanups completed
+func newLatencyTestProbe(t *testing.T, handler func(w http.ResponseWriter, r *http.Request) bool) (Probe, func() []string) {
+	var mu sync.Mutex
+	objects := map[string][]byte{}
+	requests := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.URL.Query()["location"]; ok {
+			w.Write([]byte(`<LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/">us-east-1</LocationConstraint>`))
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		if handler != nil && handler(w, r) {
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			if r.URL.Query().Get("list-type") == "2" {
+				listObjects(w, r, objects)
+				return
+			}
+			if r.URL.Path == "/" {
+				w.Write([]byte(`<ListAllMyBucketsResult></ListAllMyBucketsResult>`))
+				return
+			}
+			data, ok := objects[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+			w.Header().Set("Last-Modified", "Tue, 01 Jun 2021 10:00:00 GMT")
+			w.Header().Set("ETag", `"object"`)
+			if r.Method == http.MethodGet {
+				w.Write(data)
+			}
+		case http.MethodPut:
+			if source := r.Header.Get("X-Amz-Copy-Source"); source != "" {
+				source, _ = url.PathUnescape(source)
+				objects[r.URL.Path] = objects["/"+strings.TrimPrefix(source, "/")]
+				w.Write([]byte(`<CopyObjectResult><ETag>"object"</ETag><LastModified>2021-06-01T10:00:00.000Z</LastModified></CopyObjectResult>`))
+				return
+			}
+			objects[r.URL.Path] = readBody(r)
+			w.Header().Set("ETag", `"object"`)
+		case http.MethodPost:
+			if _, ok := r.URL.Query()["delete"]; ok {
+				removeObjects(w, r, objects, nil)
+			}
+		case http.MethodDelete:
+			delete(objects, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	testConfig := config.GetTestConfig()
+	p, err := NewProbe(S3Service{Name: "latency"}, server.URL, []S3Endpoint{}, &testConfig, make(chan bool, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.cleanupDelay = 0
+	return p, func() []string {
+		// Objects are removed in the background once the checks complete
+		p.cleanups.Wait()
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string{}, requests...)
+	}
+}
+
+// readBody returns the content uploaded by a request, decoding the chunks of the uploads
+// signed by chunks over plain HTTP
+func readBody(r *http.Request) []byte {
+	body, _ := ioutil.ReadAll(r.Body)
+	if r.Header.Get("X-Amz-Decoded-Content-Length") == "" {
+		return body
+	}
+	content := []byte{}
+	for {
+		header := bytes.SplitN(body, []byte("\r\n"), 2)
+		size, err := strconv.ParseInt(string(bytes.SplitN(header[0], []byte(";"), 2)[0]), 16, 64)
+		if err != nil || size == 0 || len(header) < 2 || int64(len(header[1])) < size {
+			return content
+		}
+		content = append(content, header[1][:size]...)
+		body = bytes.TrimPrefix(header[1][size:], []byte("\r\n"))
+	}
+}
+
+// listObjects answers a ListObjectsV2 request with the objects of the in-memory server, the continuation
+// token is the index of the first key of the page
+func listObjects(w http.ResponseWriter, r *http.Request, objects map[string][]byte) {
+	query := r.URL.Query()
+	keys := []string{}
+	for path := range objects {
+		key := strings.TrimPrefix(path, strings.TrimSuffix(r.URL.Path, "/")+"/")
+		if key != path && strings.HasPrefix(key, query.Get("prefix")) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	start, _ := strconv.Atoi(query.Get("continuation-token"))
+	maxKeys, err := strconv.Atoi(query.Get("max-keys"))
+	if err != nil {
+		maxKeys = 1000
+	}
+	end := len(keys)
+	if start+maxKeys < end {
+		end = start + maxKeys
+	}
+	fmt.Fprint(w, `<ListBucketResult>`)
+	for _, key := range keys[start:end] {
+		fmt.Fprintf(w, `<Contents><Key>%s</Key><Size>0</Size></Contents>`, key)
+	}
+	if end < len(keys) {
+		fmt.Fprintf(w, `<IsTruncated>true</IsTruncated><NextContinuationToken>%d</NextContinuationToken>`, end)
+	}
+	fmt.Fprint(w, `</ListBucketResult>`)
+}
+
+// removeObjects answers a multi-object delete request, removing the objects of the in-memory server
+// except those for which failed returns an error code
+func removeObjects(w http.ResponseWriter, r *http.Request, objects map[string][]byte, failed func(key string) string) {
+	var request struct {
+		Objects []struct{ Key string } `xml:"Object"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	fmt.Fprint(w, `<DeleteResult>`)
+	for _, object := range request.Objects {
+		if failed != nil && failed(object.Key) != "" {
+			fmt.Fprintf(w, `<Error><Key>%s</Key><Code>%s</Code><Message>failed</Message></Error>`, object.Key, failed(object.Key))
+			continue
+		}
+		delete(objects, strings.TrimSuffix(r.URL.Path, "/")+"/"+object.Key)
+		fmt.Fprintf(w, `<Deleted><Key>%s</Key></Deleted>`, object.Key)
+	}
+	fmt.Fprint(w, `</DeleteResult>`)
+}
+
+// operations returns the methods of the requests, the object keys being random
+func operations(requests []string) string {
+	methods := []string{}
+	for _, request := range requests {
+		methods = append(methods, strings.SplitN(request, " ", 2)[0])
+	}
+	return strings.Join(methods, ",")
+}
+
+func TestPerformLatencyChecksStatsTheObject(t *testing.T) {
+	p, requests := newLatencyTestProbe(t, nil)
+	if err := p.performLatencyChecks(); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "GET,PUT,HEAD,GET,PUT,HEAD,DELETE,DELETE,DELETE"; operations(requests()) != expected {
+		t.Errorf("Expected requests %s got %v", expected, requests())
+	}
+}
+
+func TestPerformLatencyChecksCopiesTheObject(t *testing.T) {
+	p, requests := newLatencyTestProbe(t, nil)
+	if err := p.performLatencyChecks(); err != nil {
+		t.Fatal(err)
+	}
+	copies := []string{}
+	for _, request := range requests() {
+		if strings.HasSuffix(request, "-copy") {
+			copies = append(copies, strings.SplitN(request, " ", 2)[0])
+		}
+	}
+	if expected := "PUT,HEAD,DELETE"; strings.Join(copies, ",") != expected {
+		t.Errorf("Expected the copy to be created, checked and removed, got %v", requests())
+	}
+}
+
+func TestPerformLatencyChecksFailsOnTruncatedCopy(t *testing.T) {
+	p, requests := newLatencyTestProbe(t, func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method != http.MethodHead || !strings.HasSuffix(r.URL.Path, "-copy") {
+			return false
+		}
+		w.Header().Set("Content-Length", "1")
+		w.Header().Set("Last-Modified", "Tue, 01 Jun 2021 10:00:00 GMT")
+		w.Header().Set("ETag", `"object"`)
+		return true
+	})
+	if err := p.performLatencyChecks(); err == nil {
+		t.Error("Latency checks should fail when the copy doesn't match its source")
+	}
+	removed := false
+	for _, request := range requests() {
+		if strings.HasPrefix(request, "DELETE") && strings.HasSuffix(request, "-copy") {
+			removed = true
+		}
+	}
+	if !removed {
+		t.Errorf("The copy should be removed after a failed check, got %v", requests())
+	}
+}
+
+func TestPerformLatencyChecksFailsOnTruncatedStat(t *testing.T) {
+	p, _ := newLatencyTestProbe(t, func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method != http.MethodHead {
+			return false
+		}
+		w.Header().Set("Content-Length", "1")
+		w.Header().Set("Last-Modified", "Tue, 01 Jun 2021 10:00:00 GMT")
+		w.Header().Set("ETag", `"object"`)
+		return true
+	})
+	if err := p.performLatencyChecks(); err == nil {
+		t.Error("Latency checks should fail when the stat of the object doesn't match its size")
+	}
+}
@@ -0,0 +1,62 @@
+package probe
+
+import (
+	"log"
+	"strings"
+
+	"github.com/criteo/s3-probe/pkg/metrics"
+
+	minio "github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/lifecycle"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var s3DurabilityUnexpectedLifecycle = metrics.Factory.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "s3_durability_unexpected_lifecycle",
+	Help: "Whether a lifecycle rule of the durability bucket would expire the durability items (1) or not (0)",
+}, []string{"endpoint"})
+
+// ruleExpiresItems tells whether an enabled lifecycle rule would expire the current version of
+// some untagged objects named after itemPrefix. Noncurrent version expirations and transitions
+// keep the objects readable
+func ruleExpiresItems(rule lifecycle.Rule, itemPrefix string) bool {
+	if rule.Status != "Enabled" || (rule.Expiration.IsDaysNull() && rule.Expiration.IsDateNull()) {
+		return false
+	}
+	filter := rule.RuleFilter
+	if filter.Tag.Key != "" || len(filter.And.Tags) > 0 {
+		return false
+	}
+	for _, prefix := range []string{rule.Prefix, filter.Prefix, filter.And.Prefix} {
+		// a longer prefix still matches part of the items
+		if !strings.HasPrefix(itemPrefix, prefix) && !strings.HasPrefix(prefix, itemPrefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// performDurabilityLifecycleCheck checks that no lifecycle rule of the durability bucket would expire the durability items
+func (p *Probe) performDurabilityLifecycleCheck() error {
+	ctx, cancel := p.newContext(0)
+	defer cancel()
+	config, err := p.durabilityClient().GetBucketLifecycle(ctx, p.durabilityBucketName)
+	if minio.ToErrorResponse(err).Code == "NoSuchLifecycleConfiguration" {
+		s3DurabilityUnexpectedLifecycle.WithLabelValues(p.name).Set(0)
+		return nil
+	}
+	if err != nil {
+		log.Printf("Error while getting bucket lifecycle (endpoint:%s, bucket:%s): %s", p.name, p.durabilityBucketName, err)
+		return err
+	}
+
+	for _, rule := range config.Rules {
+		if ruleExpiresItems(rule, durabilityItemPrefix) {
+			log.Printf("Warning: lifecycle rule %s of bucket %s on %s expires the durability items", rule.ID, p.durabilityBucketName, p.name)
+			s3DurabilityUnexpectedLifecycle.WithLabelValues(p.name).Set(1)
+			return nil
+		}
+	}
+	s3DurabilityUnexpectedLifecycle.WithLabelValues(p.name).Set(0)
+	return nil
+}
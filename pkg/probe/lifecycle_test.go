@@ -0,0 +1,30 @@
+package probe
+
+import (
+	"testing"
+
+	"github.com/minio/minio-go/v7/pkg/lifecycle"
+)
+
+func TestRuleExpiresItems(t *testing.T) {
+	expiration := lifecycle.Expiration{Days: 30}
+	cases := []struct {
+		rule     lifecycle.Rule
+		expected bool
+	}{
+		{lifecycle.Rule{Status: "Enabled", Expiration: expiration}, true},
+		{lifecycle.Rule{Status: "Disabled", Expiration: expiration}, false},
+		{lifecycle.Rule{Status: "Enabled", NoncurrentVersionExpiration: lifecycle.NoncurrentVersionExpiration{NoncurrentDays: 1}}, false},
+		{lifecycle.Rule{Status: "Enabled", Expiration: expiration, RuleFilter: lifecycle.Filter{Prefix: "fake-"}}, true},
+		{lifecycle.Rule{Status: "Enabled", Expiration: expiration, RuleFilter: lifecycle.Filter{Prefix: "fake-item-1"}}, true},
+		{lifecycle.Rule{Status: "Enabled", Expiration: expiration, RuleFilter: lifecycle.Filter{Prefix: "logs/"}}, false},
+		{lifecycle.Rule{Status: "Enabled", Expiration: expiration, Prefix: "logs/"}, false},
+		{lifecycle.Rule{Status: "Enabled", Expiration: expiration, RuleFilter: lifecycle.Filter{And: lifecycle.And{Prefix: "fake-item-"}}}, true},
+		{lifecycle.Rule{Status: "Enabled", Expiration: expiration, RuleFilter: lifecycle.Filter{Tag: lifecycle.Tag{Key: "temporary", Value: "true"}}}, false},
+	}
+	for i, c := range cases {
+		if expires := ruleExpiresItems(c.rule, durabilityItemPrefix); expires != c.expected {
+			t.Errorf("Case %d: expected %t got %t", i, c.expected, expires)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/criteo/s3-probe/pkg/metrics"
+
+	minio "github.com/minio/minio-go/v7"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var s3ListDelimiterViolationCounter = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_list_delimiter_violation_total",
+	Help: "Total number of listings with a delimiter not returning the expected common prefixes and objects",
+}, []string{"endpoint"})
+
+// listDelimiterObjects are written under a random prefix, listing it with a delimiter
+// must return the listDelimiterEntries
+var listDelimiterObjects = []string{"a/0", "a/1", "b/c/0", "d"}
+var listDelimiterEntries = []string{"a/", "b/", "d"}
+
+// performListDelimiterCheck writes objects under nested prefixes and checks that
+// listing them with a delimiter returns the expected common prefixes
+func (p *Probe) performListDelimiterCheck() error {
+	prefixSuffix, _ := randomHex(8)
+	prefix := fmt.Sprintf("list-delimiter-%s/", prefixSuffix)
+	objectSize := int64(p.latencyItemSize)
+
+	for _, name := range listDelimiterObjects {
+		objectName := prefix + name
+		objectData, _ := randomObject(objectSize)
+		defer p.cleanTempObject(p.endpoint.s3Client, p.latencyBucketName, objectName)
+
+		ctx, cancel := p.newContext(0)
+		_, err := p.endpoint.s3Client.PutObject(ctx, p.latencyBucketName, objectName, objectData, objectSize, minio.PutObjectOptions{})
+		cancel()
+		if err != nil {
+			log.Printf("Error while uploading object for list delimiter check (endpoint:%s): %s", p.name, err)
+			return err
+		}
+		s3BytesPutCounter.WithLabelValues(p.name).Add(float64(objectSize))
+	}
+
+	expected := []string{}
+	for _, entry := range listDelimiterEntries {
+		expected = append(expected, prefix+entry)
+	}
+
+	listed := []string{}
+	operation := func(ctx context.Context) error {
+		options := minio.ListObjectsOptions{Prefix: prefix, Recursive: false}
+		for object := range p.endpoint.s3Client.ListObjects(ctx, p.latencyBucketName, options) {
+			if object.Err != nil {
+				return object.Err
+			}
+			listed = append(listed, object.Key)
+		}
+		return nil
+	}
+	if err := p.mesureOperation("list_objects_delimiter", operation); err != nil {
+		return err
+	}
+
+	if err := checkListOrder(expected, listed); err != nil {
+		s3ListDelimiterViolationCounter.WithLabelValues(p.name).Inc()
+		log.Printf("Error while checking list with delimiter (endpoint:%s): %s", p.name, err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/criteo/s3-probe/pkg/metrics"
+
+	minio "github.com/minio/minio-go/v7"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var s3ListOrderViolationCounter = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_list_order_violation_total",
+	Help: "Total number of listings returning objects out of order, duplicated or missing",
+}, []string{"endpoint"})
+
+// listOrderPageSize is kept small to force the listing to use continuation
+const listOrderPageSize = 2
+
+// performListOrderCheck writes objects with ordered keys and checks they are
+// listed back in lexicographic order across pages
+func (p *Probe) performListOrderCheck() error {
+	prefixSuffix, _ := randomHex(8)
+	prefix := fmt.Sprintf("list-order-%s/", prefixSuffix)
+	objectSize := int64(p.latencyItemSize)
+
+	expected := []string{}
+	for i := 0; i < p.listOrderItems; i++ {
+		objectName := fmt.Sprintf("%s%04d", prefix, i)
+		objectData, _ := randomObject(objectSize)
+		defer p.cleanTempObject(p.endpoint.s3Client, p.latencyBucketName, objectName)
+
+		ctx, cancel := p.newContext(0)
+		_, err := p.endpoint.s3Client.PutObject(ctx, p.latencyBucketName, objectName, objectData, objectSize, minio.PutObjectOptions{})
+		cancel()
+		if err != nil {
+			log.Printf("Error while uploading object for list order check (endpoint:%s): %s", p.name, err)
+			return err
+		}
+		s3BytesPutCounter.WithLabelValues(p.name).Add(float64(objectSize))
+		expected = append(expected, objectName)
+	}
+
+	listed := []string{}
+	operation := func(ctx context.Context) error {
+		options := minio.ListObjectsOptions{Prefix: prefix, Recursive: true, MaxKeys: listOrderPageSize}
+		for object := range p.endpoint.s3Client.ListObjects(ctx, p.latencyBucketName, options) {
+			if object.Err != nil {
+				return object.Err
+			}
+			listed = append(listed, object.Key)
+		}
+		return nil
+	}
+	if err := p.mesureOperation("list_objects_paginated", operation); err != nil {
+		return err
+	}
+
+	if err := checkListOrder(expected, listed); err != nil {
+		s3ListOrderViolationCounter.WithLabelValues(p.name).Inc()
+		log.Printf("Error while checking list order (endpoint:%s): %s", p.name, err)
+		return err
+	}
+	return nil
+}
+
+// checkListOrder returns an error if listed doesn't exactly match the sorted expected keys
+func checkListOrder(expected []string, listed []string) error {
+	if len(expected) != len(listed) {
+		return fmt.Errorf("expected %d objects got %d", len(expected), len(listed))
+	}
+	for i := range expected {
+		if expected[i] != listed[i] {
+			return fmt.Errorf("expected %s at position %d got %s", expected[i], i, listed[i])
+		}
+	}
+	return nil
+}
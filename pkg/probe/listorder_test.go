@@ -0,0 +1,19 @@
+package probe
+
+import "testing"
+
+func TestCheckListOrder(t *testing.T) {
+	expected := []string{"p/0000", "p/0001", "p/0002"}
+	if err := checkListOrder(expected, []string{"p/0000", "p/0001", "p/0002"}); err != nil {
+		t.Errorf("Ordered listing should be accepted: %s", err)
+	}
+	if err := checkListOrder(expected, []string{"p/0000", "p/0002", "p/0001"}); err == nil {
+		t.Errorf("Unordered listing should be rejected")
+	}
+	if err := checkListOrder(expected, []string{"p/0000", "p/0001"}); err == nil {
+		t.Errorf("Listing with missing objects should be rejected")
+	}
+	if err := checkListOrder(expected, []string{"p/0000", "p/0001", "p/0001", "p/0002"}); err == nil {
+		t.Errorf("Listing with duplicated objects should be rejected")
+	}
+}
@@ -0,0 +1,108 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/criteo/s3-probe/pkg/metrics"
+
+	minio "github.com/minio/minio-go/v7"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// listPaginationPrefix holds the objects listed by the list pagination check, unlike the objects of
+// the other latency checks they are kept from one cycle to the next
+const listPaginationPrefix = "list-pagination/"
+
+var s3ListPageLatencyHistogram = metrics.Factory.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "s3_list_page_latency_seconds",
+	Help:    "Time taken to receive each page of the listing of the list pagination check",
+	Buckets: []float64{.005, .010, .025, .050, .100, .250, .500, 1, 2.5, 5, 10, 30},
+}, []string{"endpoint", "datacenter"})
+
+var s3ListPaginationPages = metrics.Factory.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "s3_list_pagination_pages",
+	Help: "Number of pages returned by the last listing of the list pagination check",
+}, []string{"endpoint", "datacenter"})
+
+// listPageResult is the outcome of the request of a page of listing
+type listPageResult struct {
+	page minio.ListBucketV2Result
+	err  error
+}
+
+// listObjectsPage requests a page of the objects of prefix. The request of minio.Core can't be
+// cancelled, it is left completing in the background once ctx is done
+func listObjectsPage(ctx context.Context, core minio.Core, bucketName string, prefix string, continuationToken string, maxKeys int) (minio.ListBucketV2Result, error) {
+	result := make(chan listPageResult, 1)
+	go func() {
+		page, err := core.ListObjectsV2(bucketName, prefix, "", continuationToken, "", maxKeys)
+		result <- listPageResult{page: page, err: err}
+	}()
+	select {
+	case <-ctx.Done():
+		return minio.ListBucketV2Result{}, ctx.Err()
+	case r := <-result:
+		return r.page, r.err
+	}
+}
+
+// performListPaginationCheck lists the objects of the list pagination prefix by pages of at most listPaginationPageSize keys.
+// The whole listing is measured as the list_objects_pages operation, each page request feeds s3_list_page_latency_seconds.
+// Missing objects are uploaded once the listing is done, so that the next cycles list them all
+func (p *Probe) performListPaginationCheck() error {
+	listed := map[string]bool{}
+	pageLatencies := []time.Duration{}
+	core := minio.Core{Client: p.endpoint.s3Client}
+	operation := func(ctx context.Context) error {
+		listed = map[string]bool{}
+		pageLatencies = pageLatencies[:0]
+		continuationToken := ""
+		for {
+			pageStart := time.Now()
+			page, err := listObjectsPage(ctx, core, p.latencyBucketName, listPaginationPrefix, continuationToken, p.listPaginationPageSize)
+			if err != nil {
+				return err
+			}
+			pageLatencies = append(pageLatencies, time.Since(pageStart))
+			for _, object := range page.Contents {
+				listed[object.Key] = true
+			}
+			if !page.IsTruncated {
+				return nil
+			}
+			if page.NextContinuationToken == "" {
+				return fmt.Errorf("truncated listing of %s without continuation token", p.latencyBucketName)
+			}
+			continuationToken = page.NextContinuationToken
+		}
+	}
+	if err := p.mesureOperation("list_objects_pages", operation); err != nil {
+		return err
+	}
+	for _, latency := range pageLatencies {
+		s3ListPageLatencyHistogram.WithLabelValues(p.name, p.datacenter).Observe(latency.Seconds())
+	}
+	s3ListPaginationPages.WithLabelValues(p.name, p.datacenter).Set(float64(len(pageLatencies)))
+
+	if len(listed) < p.listPaginationItems {
+		log.Printf("Uploading %d objects for list pagination check (endpoint:%s)", p.listPaginationItems-len(listed), p.name)
+	}
+	for i := 0; i < p.listPaginationItems; i++ {
+		objectName := fmt.Sprintf("%s%08d", listPaginationPrefix, i)
+		if listed[objectName] {
+			continue
+		}
+		ctx, cancel := p.newContext(0)
+		_, err := p.endpoint.s3Client.PutObject(ctx, p.latencyBucketName, objectName, bytes.NewReader(nil), 0, minio.PutObjectOptions{})
+		cancel()
+		if err != nil {
+			log.Printf("Error while uploading object for list pagination check (endpoint:%s): %s", p.name, err)
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package probe
+
+import (
+	"net/http"
+	"testing"
+
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+func TestPerformListPaginationCheck(t *testing.T) {
+	p, requests := newLatencyTestProbe(t, nil)
+	p.listPaginationItems = 5
+	p.listPaginationPageSize = 2
+
+	// The first cycle finds no object and uploads them
+	if err := p.performListPaginationCheck(); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "GET,PUT,PUT,PUT,PUT,PUT"; operations(requests()) != expected {
+		t.Errorf("Expected requests %s got %v", expected, requests())
+	}
+
+	if err := p.performListPaginationCheck(); err != nil {
+		t.Fatal(err)
+	}
+	// The next cycles only list them
+	if listings := requests()[6:]; operations(listings) != "GET,GET,GET" {
+		t.Errorf("Expected 3 pages to be listed got %v", listings)
+	}
+	metric := &io_prometheus_client.Metric{}
+	s3ListPaginationPages.WithLabelValues(p.name, p.datacenter).Write(metric)
+	if *metric.Gauge.Value != 3 {
+		t.Errorf("Expected 3 pages got %f", *metric.Gauge.Value)
+	}
+}
+
+func TestPerformListPaginationCheckWithShorterPages(t *testing.T) {
+	p, _ := newLatencyTestProbe(t, func(w http.ResponseWriter, r *http.Request) bool {
+		// the endpoint returns less keys per page than requested
+		if query := r.URL.Query(); query.Get("list-type") == "2" {
+			query.Set("max-keys", "1")
+			r.URL.RawQuery = query.Encode()
+		}
+		return false
+	})
+	p.listPaginationItems = 3
+	p.listPaginationPageSize = 2
+
+	for i := 0; i < 2; i++ {
+		if err := p.performListPaginationCheck(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	metric := &io_prometheus_client.Metric{}
+	s3ListPaginationPages.WithLabelValues(p.name, p.datacenter).Write(metric)
+	if *metric.Gauge.Value != 3 {
+		t.Errorf("Expected a page per object got %f", *metric.Gauge.Value)
+	}
+}
@@ -0,0 +1,137 @@
+package probe
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/criteo/s3-probe/pkg/metrics"
+
+	minio "github.com/minio/minio-go/v7"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var s3ManifestItemsVerified = metrics.Factory.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "s3_manifest_items_verified",
+	Help: "Number of manifest items read with the expected checksum during the last verification",
+}, []string{"endpoint", "bucket"})
+
+var s3ManifestItemsFailed = metrics.Factory.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "s3_manifest_items_failed",
+	Help: "Number of manifest items missing, unreadable or with a wrong checksum during the last verification",
+}, []string{"endpoint", "bucket"})
+
+// manifestItem is an object expected in the manifest bucket with its SHA-256
+type manifestItem struct {
+	key      string
+	checksum string
+}
+
+// loadManifest reads a manifest in the sha256sum output format: one "<sha256>  <key>" line per object
+func loadManifest(path string) ([]manifestItem, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return parseManifest(file, path)
+}
+
+func parseManifest(r io.Reader, path string) ([]manifestItem, error) {
+	items := []manifestItem{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.SplitN(text, " ", 2)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid manifest line %d in %s, expected <sha256>  <key>", line, path)
+		}
+		checksum := strings.ToLower(fields[0])
+		if decoded, err := hex.DecodeString(checksum); err != nil || len(decoded) != sha256.Size {
+			return nil, fmt.Errorf("invalid SHA-256 on manifest line %d in %s", line, path)
+		}
+		// sha256sum marks files read in binary mode with a '*' before the name
+		key := strings.TrimPrefix(strings.TrimLeft(fields[1], " "), "*")
+		if key == "" {
+			return nil, fmt.Errorf("missing key on manifest line %d in %s", line, path)
+		}
+		items = append(items, manifestItem{key: key, checksum: checksum})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("manifest %s lists no object", path)
+	}
+	return items, nil
+}
+
+// readOnly tells whether the probe only verifies the manifest, it then writes nothing to the endpoint
+func (p *Probe) readOnly() bool {
+	return p.manifestItems != nil
+}
+
+// performManifestCheck reads every object of the manifest and compares its SHA-256 to the expected one
+func (p *Probe) performManifestCheck() error {
+	verified, failed, skipped := 0, 0, 0
+	var firstErr error
+	for _, item := range p.manifestItems {
+		item := item
+		operation := func(ctx context.Context) error {
+			return p.readManifestItem(ctx, item)
+		}
+		err := p.mesureOperation("manifest_get_object", operation)
+		if errors.Is(err, errGlobalRateLimited) {
+			skipped++
+			continue
+		}
+		if err != nil {
+			failed++
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		verified++
+	}
+	// Items skipped by the global rate limit are neither verified nor failed, the gauges would be off
+	if skipped > 0 && firstErr == nil {
+		return errGlobalRateLimited
+	}
+	s3ManifestItemsVerified.WithLabelValues(p.name, p.manifestBucketName).Set(float64(verified))
+	s3ManifestItemsFailed.WithLabelValues(p.name, p.manifestBucketName).Set(float64(failed))
+	if firstErr != nil {
+		log.Printf("Error: %d of %d manifest items failed verification on %s", failed, len(p.manifestItems), p.name)
+	}
+	return firstErr
+}
+
+// readManifestItem reads an object of the manifest and checks its SHA-256
+func (p *Probe) readManifestItem(ctx context.Context, item manifestItem) error {
+	obj, err := p.durabilityClient().GetObject(ctx, p.manifestBucketName, item.key, minio.GetObjectOptions{})
+	if err != nil {
+		return err
+	}
+	defer obj.Close()
+
+	hash := sha256.New()
+	n, err := io.Copy(hash, obj)
+	s3BytesGetCounter.WithLabelValues(p.name).Add(float64(n))
+	if err != nil {
+		return err
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != item.checksum {
+		return fmt.Errorf("manifest object %s has SHA-256 %s instead of %s", item.key, sum, item.checksum)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package probe
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+func TestParseManifest(t *testing.T) {
+	sum := sha256.Sum256([]byte("content"))
+	checksum := hex.EncodeToString(sum[:])
+	manifest := "# seeded objects\n" + checksum + "  dir/object one\n\n" + strings.ToUpper(checksum) + " *binary\n"
+	items, err := parseManifest(strings.NewReader(manifest), "manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []manifestItem{{key: "dir/object one", checksum: checksum}, {key: "binary", checksum: checksum}}
+	if len(items) != 2 || items[0] != expected[0] || items[1] != expected[1] {
+		t.Errorf("Unexpected manifest items %v", items)
+	}
+}
+
+func TestParseManifestRejectsInvalidLines(t *testing.T) {
+	for _, manifest := range []string{"", "deadbeef  object\n", "object\n"} {
+		if _, err := parseManifest(strings.NewReader(manifest), "manifest"); err == nil {
+			t.Errorf("Expected manifest %q to be rejected", manifest)
+		}
+	}
+}
+
+func TestPerformManifestCheck(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.URL.Query()["location"]; ok {
+			w.Write([]byte(`<LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/">us-east-1</LocationConstraint>`))
+			return
+		}
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.URL.Path == "/seeded/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`<Error><Code>NoSuchKey</Code></Error>`))
+			return
+		}
+		w.Header().Set("Last-Modified", "Tue, 01 Jun 2021 10:00:00 GMT")
+		w.Header().Set("ETag", `"seeded"`)
+		w.Write([]byte(strings.TrimPrefix(r.URL.Path, "/seeded/")))
+	}))
+	defer server.Close()
+
+	client, err := newMinioClientFromEndpoint(server.URL, "access", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checksum := func(content string) string {
+		sum := sha256.Sum256([]byte(content))
+		return hex.EncodeToString(sum[:])
+	}
+	p := Probe{
+		name:                    "manifest",
+		endpoint:                S3Endpoint{Name: server.URL, s3Client: client},
+		defaultOperationTimeout: time.Minute,
+		idleTracker:             &idleTracker{},
+		manifestBucketName:      "seeded",
+		manifestItems: []manifestItem{
+			{key: "good", checksum: checksum("good")},
+			{key: "corrupted", checksum: checksum("original")},
+			{key: "missing", checksum: checksum("missing")},
+		},
+	}
+	if err := p.performManifestCheck(); err == nil {
+		t.Errorf("Expected the manifest check to fail")
+	}
+
+	metric := &io_prometheus_client.Metric{}
+	s3ManifestItemsVerified.WithLabelValues("manifest", "seeded").Write(metric)
+	if *metric.Gauge.Value != 1 {
+		t.Errorf("Expected 1 verified item got %f", *metric.Gauge.Value)
+	}
+	s3ManifestItemsFailed.WithLabelValues("manifest", "seeded").Write(metric)
+	if *metric.Gauge.Value != 2 {
+		t.Errorf("Expected 2 failed items got %f", *metric.Gauge.Value)
+	}
+}
+
+func TestPerformManifestCheckDoesNotCountRateLimitedItemsAsFailed(t *testing.T) {
+	SetGlobalRateLimit(1)
+	defer SetGlobalRateLimit(0)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.URL.Query()["location"]; ok {
+			w.Write([]byte(`<LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/">us-east-1</LocationConstraint>`))
+			return
+		}
+		w.Header().Set("Last-Modified", "Tue, 01 Jun 2021 10:00:00 GMT")
+		w.Header().Set("ETag", `"seeded"`)
+		w.Write([]byte(strings.TrimPrefix(r.URL.Path, "/seeded/")))
+	}))
+	defer server.Close()
+
+	client, err := newMinioClientFromEndpoint(server.URL, "access", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("good"))
+	p := Probe{
+		name:                    "manifest-rate-limited",
+		endpoint:                S3Endpoint{Name: server.URL, s3Client: client},
+		defaultOperationTimeout: time.Minute,
+		idleTracker:             &idleTracker{},
+		manifestBucketName:      "seeded",
+		manifestItems: []manifestItem{
+			{key: "good", checksum: hex.EncodeToString(sum[:])},
+			{key: "good", checksum: hex.EncodeToString(sum[:])},
+		},
+	}
+	if err := p.performManifestCheck(); !errors.Is(err, errGlobalRateLimited) {
+		t.Errorf("Expected the manifest check to be rate limited got %v", err)
+	}
+	if s3ManifestItemsFailed.DeleteLabelValues("manifest-rate-limited", "seeded") {
+		t.Errorf("Rate limited items should not be reported as failed")
+	}
+}
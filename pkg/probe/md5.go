@@ -0,0 +1,79 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/criteo/s3-probe/pkg/metrics"
+
+	minio "github.com/minio/minio-go/v7"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var s3ContentMD5Validated = metrics.Factory.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "s3_content_md5_validated",
+	Help: "Whether the endpoint accepts uploads with a valid Content-MD5 and, if checked, rejects a wrong one (1) or not (0)",
+}, []string{"endpoint"})
+
+// performContentMD5Check uploads an object along with its Content-MD5 and,
+// optionally, an object with a wrong Content-MD5 which must be rejected
+func (p *Probe) performContentMD5Check() error {
+	objectName, _ := randomHex(20)
+	objectSize := int64(p.latencyItemSize)
+	objectData, _ := randomObject(objectSize)
+	defer p.cleanTempObject(p.endpoint.s3Client, p.latencyBucketName, objectName)
+
+	operation := func(ctx context.Context) error {
+		_, err := p.endpoint.s3Client.PutObject(ctx, p.latencyBucketName, objectName, objectData, objectSize, minio.PutObjectOptions{SendContentMd5: true})
+		if err == nil {
+			s3BytesPutCounter.WithLabelValues(p.name).Add(float64(objectSize))
+		}
+		return err
+	}
+	if err := p.mesureOperation("put_object_content_md5", operation); err != nil {
+		if !errors.Is(err, errGlobalRateLimited) {
+			s3ContentMD5Validated.WithLabelValues(p.name).Set(0)
+		}
+		return err
+	}
+
+	if p.contentMD5NegativeCheck {
+		if err := p.performWrongContentMD5Check(); err != nil {
+			s3ContentMD5Validated.WithLabelValues(p.name).Set(0)
+			return err
+		}
+	}
+
+	s3ContentMD5Validated.WithLabelValues(p.name).Set(1)
+	return nil
+}
+
+// performWrongContentMD5Check checks that an upload whose Content-MD5 doesn't match the payload is rejected with BadDigest
+func (p *Probe) performWrongContentMD5Check() error {
+	objectName, _ := randomHex(20)
+	objectSize := int64(p.latencyItemSize)
+	payload := make([]byte, objectSize)
+	wrongSum := md5.Sum([]byte("not the payload"))
+	wrongMD5 := base64.StdEncoding.EncodeToString(wrongSum[:])
+
+	core := minio.Core{Client: p.endpoint.s3Client}
+	ctx, cancel := p.newContext(0)
+	defer cancel()
+	_, err := core.PutObject(ctx, p.latencyBucketName, objectName, bytes.NewReader(payload), objectSize, wrongMD5, "", minio.PutObjectOptions{})
+	if err == nil {
+		p.cleanTempObject(p.endpoint.s3Client, p.latencyBucketName, objectName)
+		err = fmt.Errorf("upload with a wrong Content-MD5 was accepted")
+		log.Printf("Error while checking Content-MD5 validation (endpoint:%s): %s", p.name, err)
+		return err
+	}
+	if code := minio.ToErrorResponse(err).Code; code != "BadDigest" {
+		log.Printf("Error while checking Content-MD5 validation (endpoint:%s): expected BadDigest, got %s", p.name, err)
+		return err
+	}
+	return nil
+}
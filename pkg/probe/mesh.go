@@ -0,0 +1,134 @@
+package probe
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	consul_api "github.com/hashicorp/consul/api"
+)
+
+// meshCertificateRenewMargin is how long before its expiry the leaf certificate is renewed
+const meshCertificateRenewMargin = 10 * time.Minute
+
+// meshIdentity is the identity of the probe in the Consul Connect mesh: a leaf certificate
+// issued by the Connect CA, renewed before it expires, and the roots of the CA
+type meshIdentity struct {
+	agent       *consul_api.Agent
+	service     string
+	mu          sync.Mutex
+	certificate *tls.Certificate
+	roots       *x509.CertPool
+	validBefore time.Time
+}
+
+func newMeshIdentity(agent *consul_api.Agent, service string) *meshIdentity {
+	return &meshIdentity{agent: agent, service: service}
+}
+
+// refresh fetches a new leaf certificate and the CA roots once the current certificate is about to expire
+func (m *meshIdentity) refresh() (*tls.Certificate, *x509.CertPool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.certificate != nil && time.Now().Before(m.validBefore.Add(-meshCertificateRenewMargin)) {
+		return m.certificate, m.roots, nil
+	}
+
+	leaf, _, err := m.agent.ConnectCALeaf(m.service, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot get the Connect leaf certificate of %s: %s", m.service, err)
+	}
+	certificate, err := tls.X509KeyPair([]byte(leaf.CertPEM), []byte(leaf.PrivateKeyPEM))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid Connect leaf certificate: %s", err)
+	}
+	rootList, _, err := m.agent.ConnectCARoots(nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot get the Connect CA roots: %s", err)
+	}
+	roots := x509.NewCertPool()
+	for _, root := range rootList.Roots {
+		roots.AppendCertsFromPEM([]byte(root.RootCertPEM))
+	}
+
+	m.certificate = &certificate
+	m.roots = roots
+	m.validBefore = leaf.ValidBefore
+	return m.certificate, m.roots, nil
+}
+
+// newMeshTLSConfig returns the mTLS configuration reaching serviceName through its Connect sidecar
+func newMeshTLSConfig(identity *meshIdentity, serviceName string) *tls.Config {
+	return &tls.Config{
+		// Connect certificates identify services by SPIFFE URI rather than host name,
+		// the peer is verified against the CA roots and its URI below
+		InsecureSkipVerify: true,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			certificate, _, err := identity.refresh()
+			return certificate, err
+		},
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			_, roots, err := identity.refresh()
+			if err != nil {
+				return err
+			}
+			return verifyMeshPeer(rawCerts, roots, serviceName)
+		},
+	}
+}
+
+// verifyMeshPeer checks that the certificate chain of a sidecar is issued by the Connect CA
+// and identifies serviceName
+func verifyMeshPeer(rawCerts [][]byte, roots *x509.CertPool, serviceName string) error {
+	if len(rawCerts) == 0 {
+		return fmt.Errorf("no certificate presented by the sidecar of %s", serviceName)
+	}
+	certificates := []*x509.Certificate{}
+	for _, raw := range rawCerts {
+		certificate, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return err
+		}
+		certificates = append(certificates, certificate)
+	}
+	intermediates := x509.NewCertPool()
+	for _, certificate := range certificates[1:] {
+		intermediates.AddCert(certificate)
+	}
+	if _, err := certificates[0].Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates}); err != nil {
+		return err
+	}
+	for _, uri := range certificates[0].URIs {
+		if uri.Scheme == "spiffe" && strings.HasSuffix(uri.Path, "/svc/"+serviceName) {
+			return nil
+		}
+	}
+	return fmt.Errorf("the sidecar certificate does not identify %s", serviceName)
+}
+
+// getMeshEndpoint returns the https address of the Connect sidecar of serviceName, or an empty
+// string when the probe has no mesh identity or the service has no sidecar
+func (cc *consulClientImpl) getMeshEndpoint(serviceName string) (string, error) {
+	if cc.mesh == nil {
+		return "", nil
+	}
+	entries, _, err := cc.consulClient.Health().Connect(serviceName, "", true, nil)
+	if err != nil || len(entries) == 0 {
+		return "", err
+	}
+	return meshEndpoint(entries[0]), nil
+}
+
+// meshEndpoint returns the https address of a sidecar service entry
+func meshEndpoint(entry *consul_api.ServiceEntry) string {
+	host := entry.Service.Address
+	if host == "" {
+		host = entry.Node.Address
+	}
+	return "https://" + net.JoinHostPort(host, strconv.Itoa(entry.Service.Port))
+}
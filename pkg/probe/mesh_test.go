@@ -0,0 +1,95 @@
+package probe
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/url"
+	"testing"
+	"time"
+
+	consul_api "github.com/hashicorp/consul/api"
+)
+
+// newTestCertificate issues a certificate signed by parent, or self-signed without parent
+func newTestCertificate(t *testing.T, serial int64, uri string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if uri != "" {
+		parsed, _ := url.Parse(uri)
+		template.URIs = []*url.URL{parsed}
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		parent, parentKey = template, key
+	}
+	raw, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, _ := x509.ParseCertificate(raw)
+	return certificate, key
+}
+
+func TestVerifyMeshPeer(t *testing.T) {
+	ca, caKey := newTestCertificate(t, 1, "", nil, nil)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	sidecar, _ := newTestCertificate(t, 2, "spiffe://11111111.consul/ns/default/dc/par/svc/s3-par", ca, caKey)
+
+	if err := verifyMeshPeer([][]byte{sidecar.Raw}, roots, "s3-par"); err != nil {
+		t.Errorf("The sidecar of s3-par should be accepted: %s", err)
+	}
+	if err := verifyMeshPeer([][]byte{sidecar.Raw}, roots, "s3-am5"); err == nil {
+		t.Error("A sidecar identifying another service should be rejected")
+	}
+	otherCA, otherKey := newTestCertificate(t, 3, "", nil, nil)
+	untrusted, _ := newTestCertificate(t, 4, "spiffe://22222222.consul/ns/default/dc/par/svc/s3-par", otherCA, otherKey)
+	if err := verifyMeshPeer([][]byte{untrusted.Raw}, roots, "s3-par"); err == nil {
+		t.Error("A sidecar certificate issued by another CA should be rejected")
+	}
+	if err := verifyMeshPeer([][]byte{}, roots, "s3-par"); err == nil {
+		t.Error("A sidecar without certificate should be rejected")
+	}
+}
+
+func TestMeshEndpoint(t *testing.T) {
+	entry := &consul_api.ServiceEntry{
+		Node:    &consul_api.Node{Address: "10.0.0.1"},
+		Service: &consul_api.AgentService{Port: 21000},
+	}
+	if endpoint := meshEndpoint(entry); endpoint != "https://10.0.0.1:21000" {
+		t.Errorf("Expected the sidecar address on the node got %s", endpoint)
+	}
+	entry.Service.Address = "10.0.0.2"
+	if endpoint := meshEndpoint(entry); endpoint != "https://10.0.0.2:21000" {
+		t.Errorf("Expected the sidecar service address got %s", endpoint)
+	}
+}
+
+func TestS3ServiceEqualsMeshTLS(t *testing.T) {
+	service := S3Service{Name: "my-service", Endpoint: "https://127.0.0.1:21000", MeshTLS: &tls.Config{}}
+	otherService := S3Service{Name: "my-service", Endpoint: "https://127.0.0.1:21000"}
+	if service.Equals(&otherService) {
+		t.Error("S3Service equality should have return false when only one is in the mesh")
+	}
+	otherService.MeshTLS = &tls.Config{}
+	if !service.Equals(&otherService) {
+		t.Error("S3Service equality should not depend on the mesh TLS configuration instance")
+	}
+}
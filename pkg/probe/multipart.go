@@ -0,0 +1,194 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/criteo/s3-probe/pkg/metrics"
+
+	minio "github.com/minio/minio-go/v7"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var s3MultipartOrphanedUploads = metrics.Factory.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "s3_multipart_orphaned_uploads",
+	Help: "Number of multipart uploads still listed after being aborted by the last multipart abort check",
+}, []string{"endpoint"})
+
+var s3IncompleteMultipartUploads = metrics.Factory.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "s3_incomplete_multipart_uploads",
+	Help: "Number of multipart uploads in progress in the bucket",
+}, []string{"endpoint", "bucket"})
+
+var s3MultipartUploadAbortedCounter = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_multipart_upload_aborted_total",
+	Help: "Total number of multipart uploads of the multipart upload check aborted after a failed phase",
+}, []string{"endpoint", "phase"})
+
+// performMultipartUploadCheck uploads an object in several parts then removes it, the initiation, each part
+// and the completion of the upload are measured as their own operation. An upload failing midway is aborted
+// so that its parts don't pile up in the bucket
+func (p *Probe) performMultipartUploadCheck() error {
+	objectRandSuffix, _ := randomHex(20)
+	objectName := fmt.Sprintf("multipart-upload-%s", objectRandSuffix)
+	partSize := int64(p.multipartPartSize)
+	core := minio.Core{Client: p.endpoint.s3Client}
+
+	uploadID := ""
+	operation := func(ctx context.Context) error {
+		var err error
+		uploadID, err = core.NewMultipartUpload(ctx, p.latencyBucketName, objectName, minio.PutObjectOptions{})
+		return err
+	}
+	if err := p.mesureOperation("new_multipart_upload", operation); err != nil {
+		return err
+	}
+
+	parts := make([]minio.CompletePart, 0, p.multipartUploadParts)
+	for partNumber := 1; partNumber <= p.multipartUploadParts; partNumber++ {
+		partData, _ := randomObject(partSize)
+		operation = func(ctx context.Context) error {
+			part, err := core.PutObjectPart(ctx, p.latencyBucketName, objectName, uploadID, partNumber, partData, partSize, "", "", nil)
+			if err == nil {
+				s3BytesPutCounter.WithLabelValues(p.name).Add(float64(partSize))
+				parts = append(parts, minio.CompletePart{PartNumber: part.PartNumber, ETag: part.ETag})
+			}
+			return err
+		}
+		if err := p.mesureOperation("put_object_part", operation); err != nil {
+			p.abortMultipartUpload(core, objectName, uploadID)
+			if !errors.Is(err, errGlobalRateLimited) {
+				s3MultipartUploadAbortedCounter.WithLabelValues(p.name, "put_object_part").Inc()
+			}
+			return err
+		}
+	}
+
+	operation = func(ctx context.Context) error {
+		_, err := core.CompleteMultipartUpload(ctx, p.latencyBucketName, objectName, uploadID, parts, minio.PutObjectOptions{})
+		return err
+	}
+	if err := p.mesureOperation("complete_multipart_upload", operation); err != nil {
+		p.abortMultipartUpload(core, objectName, uploadID)
+		if !errors.Is(err, errGlobalRateLimited) {
+			s3MultipartUploadAbortedCounter.WithLabelValues(p.name, "complete_multipart_upload").Inc()
+		}
+		return err
+	}
+
+	operation = func(ctx context.Context) error {
+		return p.endpoint.s3Client.RemoveObject(ctx, p.latencyBucketName, objectName, minio.RemoveObjectOptions{})
+	}
+	return p.mesureOperation("remove_multipart_object", operation)
+}
+
+// performMultipartAbortCheck starts a multipart upload, uploads a part, aborts the upload
+// and checks that it is not listed anymore, meaning its parts were freed
+func (p *Probe) performMultipartAbortCheck() error {
+	objectRandSuffix, _ := randomHex(20)
+	objectName := fmt.Sprintf("multipart-%s", objectRandSuffix)
+	objectSize := int64(p.latencyItemSize)
+	objectData, _ := randomObject(objectSize)
+	core := minio.Core{Client: p.endpoint.s3Client}
+
+	uploadID := ""
+	operation := func(ctx context.Context) error {
+		var err error
+		uploadID, err = core.NewMultipartUpload(ctx, p.latencyBucketName, objectName, minio.PutObjectOptions{})
+		return err
+	}
+	if err := p.mesureOperation("new_multipart_upload", operation); err != nil {
+		return err
+	}
+
+	operation = func(ctx context.Context) error {
+		_, err := core.PutObjectPart(ctx, p.latencyBucketName, objectName, uploadID, 1, objectData, objectSize, "", "", nil)
+		if err == nil {
+			s3BytesPutCounter.WithLabelValues(p.name).Add(float64(objectSize))
+		}
+		return err
+	}
+	if err := p.mesureOperation("put_object_part", operation); err != nil {
+		p.abortMultipartUpload(core, objectName, uploadID)
+		return err
+	}
+
+	operation = func(ctx context.Context) error {
+		return core.AbortMultipartUpload(ctx, p.latencyBucketName, objectName, uploadID)
+	}
+	if err := p.mesureOperation("abort_multipart_upload", operation); err != nil {
+		return err
+	}
+
+	ctx, cancel := p.newContext(0)
+	defer cancel()
+	orphaned := 0
+	for upload := range p.endpoint.s3Client.ListIncompleteUploads(ctx, p.latencyBucketName, objectName, false) {
+		if upload.Err != nil {
+			log.Printf("Error while listing incomplete uploads (endpoint:%s): %s", p.name, upload.Err)
+			return upload.Err
+		}
+		if upload.UploadID == uploadID {
+			orphaned++
+		}
+	}
+	s3MultipartOrphanedUploads.WithLabelValues(p.name).Set(float64(orphaned))
+	if orphaned > 0 {
+		err := fmt.Errorf("aborted multipart upload %s is still listed", uploadID)
+		log.Printf("Error while checking multipart abort (endpoint:%s): %s", p.name, err)
+		return err
+	}
+	return nil
+}
+
+// abortMultipartUpload aborts an upload left behind by a failed check
+func (p *Probe) abortMultipartUpload(core minio.Core, objectName string, uploadID string) {
+	ctx, cancel := p.newContext(0)
+	defer cancel()
+	_ = core.AbortMultipartUpload(ctx, p.latencyBucketName, objectName, uploadID)
+}
+
+// performIncompleteUploadsCheck counts the multipart uploads in progress in the latency and durability buckets,
+// a growing count reveals leaking upload sessions
+func (p *Probe) performIncompleteUploadsCheck() error {
+	bucketNames := []string{p.latencyBucketName}
+	clients := []*minio.Client{p.endpoint.s3Client}
+	// The durability bucket isn't prepared when durability is disabled
+	if p.durabilityProbeRatePerMin > 0 {
+		bucketNames = append(bucketNames, p.durabilityBucketName)
+		clients = append(clients, p.durabilityClient())
+	}
+	for i, bucketName := range bucketNames {
+		count := 0
+		operation := func(ctx context.Context) error {
+			var err error
+			count, err = countMultipartUploads(ctx, minio.Core{Client: clients[i]}, bucketName)
+			return err
+		}
+		if err := p.mesureOperation("list_multipart_uploads", operation); err != nil {
+			return err
+		}
+		s3IncompleteMultipartUploads.WithLabelValues(p.name, bucketName).Set(float64(count))
+	}
+	return nil
+}
+
+// countMultipartUploads lists all the multipart uploads in progress in a bucket. Unlike
+// ListIncompleteUploads, the parts of each upload are not listed
+func countMultipartUploads(ctx context.Context, core minio.Core, bucketName string) (int, error) {
+	count := 0
+	keyMarker, uploadIDMarker := "", ""
+	for {
+		result, err := core.ListMultipartUploads(ctx, bucketName, "", keyMarker, uploadIDMarker, "", 1000)
+		if err != nil {
+			return 0, err
+		}
+		count += len(result.Uploads)
+		if !result.IsTruncated {
+			return count, nil
+		}
+		keyMarker, uploadIDMarker = result.NextKeyMarker, result.NextUploadIDMarker
+	}
+}
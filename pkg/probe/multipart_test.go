@@ -0,0 +1,167 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/criteo/s3-probe/pkg/config"
+
+	minio "github.com/minio/minio-go/v7"
+)
+
+func TestCountMultipartUploadsFollowsMarkers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.URL.Query()["location"]; ok {
+			w.Write([]byte(`<LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/">us-east-1</LocationConstraint>`))
+			return
+		}
+		if r.URL.Query().Get("key-marker") == "" {
+			fmt.Fprint(w, `<ListMultipartUploadsResult><IsTruncated>true</IsTruncated><NextKeyMarker>b</NextKeyMarker><NextUploadIdMarker>2</NextUploadIdMarker>`+
+				`<Upload><Key>a</Key><UploadId>1</UploadId></Upload><Upload><Key>b</Key><UploadId>2</UploadId></Upload></ListMultipartUploadsResult>`)
+			return
+		}
+		fmt.Fprint(w, `<ListMultipartUploadsResult><IsTruncated>false</IsTruncated><Upload><Key>c</Key><UploadId>3</UploadId></Upload></ListMultipartUploadsResult>`)
+	}))
+	defer server.Close()
+
+	client, err := newMinioClientFromEndpoint(server.URL, "access", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, err := countMultipartUploads(context.Background(), minio.Core{Client: client}, "latency")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("Expected 3 uploads got %d", count)
+	}
+}
+
+// newMultipartUploadTestProbe returns a probe uploading 3 parts to a server failing the upload of failingPart,
+// the requests received by the server are returned as "<method> <phase>"
+func newMultipartUploadTestProbe(t *testing.T, failingPart string) (Probe, func() []string) {
+	var mu sync.Mutex
+	requests := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if _, ok := query["location"]; ok {
+			w.Write([]byte(`<LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/">us-east-1</LocationConstraint>`))
+			return
+		}
+		phase := "object"
+		if _, ok := query["uploads"]; ok {
+			phase = "uploads"
+		} else if query.Get("partNumber") != "" {
+			phase = "part " + query.Get("partNumber")
+		} else if query.Get("uploadId") != "" {
+			phase = "upload"
+		}
+		mu.Lock()
+		requests = append(requests, r.Method+" "+phase)
+		mu.Unlock()
+
+		switch {
+		case phase == "uploads":
+			fmt.Fprint(w, `<InitiateMultipartUploadResult><UploadId>upload-1</UploadId></InitiateMultipartUploadResult>`)
+		case phase == "part "+failingPart:
+			w.WriteHeader(http.StatusBadRequest)
+		case r.Method == http.MethodPut:
+			w.Header().Set("ETag", `"part"`)
+		case r.Method == http.MethodPost:
+			fmt.Fprint(w, `<CompleteMultipartUploadResult><Bucket>latency</Bucket><Key>object</Key><ETag>"object"</ETag></CompleteMultipartUploadResult>`)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	testConfig := config.GetTestConfig()
+	multipartUploadCheck, multipartUploadParts, multipartPartSize := true, 3, 16
+	testConfig.MultipartUploadCheck = &multipartUploadCheck
+	testConfig.MultipartUploadParts = &multipartUploadParts
+	testConfig.MultipartPartSize = &multipartPartSize
+	p, err := NewProbe(S3Service{Name: "multipart"}, server.URL, []S3Endpoint{}, &testConfig, make(chan bool, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string{}, requests...)
+	}
+}
+
+func TestPerformMultipartUploadCheck(t *testing.T) {
+	p, requests := newMultipartUploadTestProbe(t, "")
+	if err := p.performMultipartUploadCheck(); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"POST uploads", "PUT part 1", "PUT part 2", "PUT part 3", "POST upload", "DELETE object"}
+	if fmt.Sprint(requests()) != fmt.Sprint(expected) {
+		t.Errorf("Expected requests %v got %v", expected, requests())
+	}
+}
+
+func TestPerformMultipartUploadCheckAbortsFailedUpload(t *testing.T) {
+	p, requests := newMultipartUploadTestProbe(t, "2")
+	if err := p.performMultipartUploadCheck(); err == nil {
+		t.Fatal("Multipart upload check should fail when a part can't be uploaded")
+	}
+	expected := []string{"POST uploads", "PUT part 1", "PUT part 2", "DELETE upload"}
+	if fmt.Sprint(requests()) != fmt.Sprint(expected) {
+		t.Errorf("Expected requests %v got %v", expected, requests())
+	}
+}
+
+func TestMultipartUploadCheckRejectsEmptyUploads(t *testing.T) {
+	testConfig := config.GetTestConfig()
+	multipartUploadCheck, multipartUploadParts := true, 0
+	testConfig.MultipartUploadCheck = &multipartUploadCheck
+	testConfig.MultipartUploadParts = &multipartUploadParts
+	if _, err := NewProbe(S3Service{Name: "multipart"}, "localhost:9000", []S3Endpoint{}, &testConfig, make(chan bool, 1)); err == nil {
+		t.Error("Multipart uploads without parts should be rejected")
+	}
+}
+
+func TestPerformIncompleteUploadsCheckUsesTheDurabilityClient(t *testing.T) {
+	var mu sync.Mutex
+	listings := map[string]string{}
+	p, _ := newLatencyTestProbe(t, func(w http.ResponseWriter, r *http.Request) bool {
+		if _, ok := r.URL.Query()["uploads"]; !ok {
+			return false
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		credential := strings.SplitN(strings.SplitN(r.Header.Get("Authorization"), "Credential=", 2)[1], "/", 2)[0]
+		listings[strings.Trim(r.URL.Path, "/")] = credential
+		fmt.Fprint(w, `<ListMultipartUploadsResult><IsTruncated>false</IsTruncated></ListMultipartUploadsResult>`)
+		return true
+	})
+	durabilityEndpoint, err := newS3Endpoint(p.endpoint.Name, "durability-access", "durability-secret", transportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.durabilityEndpoint = durabilityEndpoint
+
+	p.durabilityProbeRatePerMin = 1
+	if err := p.performIncompleteUploadsCheck(); err != nil {
+		t.Fatal(err)
+	}
+	if listings[p.durabilityBucketName] != "durability-access" || listings[p.latencyBucketName] == "durability-access" {
+		t.Errorf("The durability bucket should be listed with the durability credentials only, got %v", listings)
+	}
+
+	listings = map[string]string{}
+	p.durabilityProbeRatePerMin = 0
+	if err := p.performIncompleteUploadsCheck(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := listings[p.durabilityBucketName]; ok || len(listings) != 1 {
+		t.Errorf("The durability bucket should not be listed when durability is disabled, got %v", listings)
+	}
+}
@@ -0,0 +1,98 @@
+package probe
+
+import (
+	"sync"
+	"time"
+
+	"github.com/criteo/s3-probe/pkg/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var oldestInflightDesc = prometheus.NewDesc(
+	"s3_probe_oldest_inflight_seconds",
+	"Age of the oldest operation in flight on the S3 endpoint, above the operation timeout it is stuck ignoring its deadline",
+	[]string{"endpoint"}, nil,
+)
+
+// inflightOperations tracks the start time of the operations in flight of a probe
+type inflightOperations struct {
+	mu     sync.Mutex
+	next   uint64
+	starts map[uint64]time.Time
+}
+
+func newInflightOperations() *inflightOperations {
+	return &inflightOperations{starts: map[uint64]time.Time{}}
+}
+
+// start records an operation starting and returns the function to call once it is done
+func (o *inflightOperations) start(now time.Time) func() {
+	if o == nil {
+		return func() {}
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	id := o.next
+	o.next++
+	o.starts[id] = now
+	return func() {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		delete(o.starts, id)
+	}
+}
+
+// oldest returns the age of the oldest operation in flight, or zero if none is
+func (o *inflightOperations) oldest(now time.Time) time.Duration {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	age := time.Duration(0)
+	for _, start := range o.starts {
+		if d := now.Sub(start); d > age {
+			age = d
+		}
+	}
+	return age
+}
+
+// inflightCollector reports the oldest operation in flight of each running probe at scrape time
+type inflightCollector struct {
+	mu     sync.Mutex
+	probes map[string]*inflightOperations
+}
+
+var inflightProbes = &inflightCollector{probes: map[string]*inflightOperations{}}
+
+func init() {
+	metrics.Registerer.MustRegister(inflightProbes)
+}
+
+// track reports the operations of the probe of the endpoint, replacing any previous probe
+func (c *inflightCollector) track(endpoint string, operations *inflightOperations) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.probes[endpoint] = operations
+}
+
+// untrack stops reporting the operations of a terminated probe unless it has already been replaced
+func (c *inflightCollector) untrack(endpoint string, operations *inflightOperations) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.probes[endpoint] == operations {
+		delete(c.probes, endpoint)
+	}
+}
+
+func (c *inflightCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- oldestInflightDesc
+}
+
+func (c *inflightCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for endpoint, operations := range c.probes {
+		ch <- prometheus.MustNewConstMetric(oldestInflightDesc, prometheus.GaugeValue, operations.oldest(now).Seconds(), endpoint)
+	}
+}
@@ -0,0 +1,103 @@
+package probe
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/criteo/s3-probe/pkg/metrics"
+)
+
+// ErrOnDemandRunInProgress is returned when an on-demand run is requested while another one is running on the same probe
+var ErrOnDemandRunInProgress = errors.New("an on-demand run is already in progress for this probe")
+
+// ErrProbePreparing is returned when an on-demand run is requested while the buckets of the probe are being prepared
+var ErrProbePreparing = errors.New("the buckets of this probe are being prepared")
+
+// OperationResult is the outcome of a single operation of an on-demand run
+type OperationResult struct {
+	Operation       string  `json:"operation"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	Error           string  `json:"error,omitempty"`
+	// OperationID is sent in the X-Probe-Operation-Id header of the requests of the operation
+	OperationID string `json:"operation_id,omitempty"`
+	// RequestID is the request ID returned by the endpoint for the last request of the operation
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// CycleReport is the outcome of an on-demand run
+type CycleReport struct {
+	Service    string            `json:"service"`
+	Operations []OperationResult `json:"operations"`
+	Error      string            `json:"error,omitempty"`
+}
+
+// operationRecorder collects the operations performed during an on-demand run
+type operationRecorder struct {
+	mu      sync.Mutex
+	results []OperationResult
+}
+
+func (r *operationRecorder) record(operationName string, duration time.Duration, err error, trace *operationTrace) {
+	result := OperationResult{
+		Operation:       operationName,
+		DurationSeconds: duration.Seconds(),
+		OperationID:     trace.operationID(),
+		RequestID:       trace.lastRequestID(),
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.results = append(r.results, result)
+}
+
+// onDemandNameSuffix is appended to the endpoint label of the metrics of on-demand runs,
+// so that they don't feed the series of the scheduled checks
+const onDemandNameSuffix = "/on-demand"
+
+// RunOnce synchronously performs one check cycle and reports every operation
+// performed. Durability checks are only run when requested. Objects are removed without
+// waiting for the cleanup delay, and the series of the run are deleted once it completes
+func (p *Probe) RunOnce(durability bool) (CycleReport, error) {
+	// The buckets may not exist yet and the durability items are still being written
+	if p.preparation.isPreparing() {
+		return CycleReport{}, ErrProbePreparing
+	}
+	select {
+	case p.onDemandSlot <- struct{}{}:
+		defer func() { <-p.onDemandSlot }()
+	default:
+		return CycleReport{}, ErrOnDemandRunInProgress
+	}
+
+	// The run is performed on a copy so that operations of the regular
+	// cycles running concurrently are not recorded, it is awaited on shutdown like them
+	run, release := p.snapshot()
+	defer release()
+	p.checks.Add(1)
+	defer p.checks.Done()
+	run.recorder = &operationRecorder{}
+	run.name = p.name + onDemandNameSuffix
+	run.cleanupDelay = 0
+	defer metrics.DeleteSeries("endpoint", run.name)
+
+	var err error
+	if run.gateway {
+		err = run.performGatewayChecks()
+	} else {
+		err = run.performLatencyChecks()
+		if err == nil && durability {
+			start := time.Now()
+			err = run.performDurabilityChecks()
+			run.recorder.record("durability_list", time.Since(start), err, nil)
+		}
+	}
+
+	report := CycleReport{Service: p.name, Operations: run.recorder.results}
+	if err != nil {
+		report.Error = err.Error()
+	}
+	return report, nil
+}
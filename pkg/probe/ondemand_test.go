@@ -0,0 +1,56 @@
+package probe
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRunOnceRejectsConcurrentRuns(t *testing.T) {
+	p := Probe{name: "test", onDemandSlot: make(chan struct{}, 1)}
+	p.onDemandSlot <- struct{}{}
+	if _, err := p.RunOnce(false); err != ErrOnDemandRunInProgress {
+		t.Errorf("Expected concurrent run to be rejected, got %v", err)
+	}
+}
+
+func TestRunOnceRejectsPreparingProbes(t *testing.T) {
+	p := Probe{name: "test", onDemandSlot: make(chan struct{}, 1), preparation: &preparationState{}}
+	p.preparation.set(true)
+	if _, err := p.RunOnce(true); err != ErrProbePreparing {
+		t.Errorf("Expected run on a preparing probe to be rejected, got %v", err)
+	}
+}
+
+func TestRunOnceDoesNotFeedTheSeriesOfTheProbe(t *testing.T) {
+	p, _ := newLatencyTestProbe(t, nil)
+	p.name = "on-demand"
+	p.onDemandSlot = make(chan struct{}, 1)
+	report, err := p.RunOnce(false)
+	if err != nil || report.Error != "" {
+		t.Fatalf("On-demand run should succeed: %v %s", err, report.Error)
+	}
+	if len(report.Operations) == 0 {
+		t.Error("Operations of the run should be reported")
+	}
+	for _, name := range []string{p.name, p.name + onDemandNameSuffix} {
+		if s3TotalCounter.DeleteLabelValues("put_object", name, p.datacenter) {
+			t.Errorf("On-demand run should leave no series for %s", name)
+		}
+	}
+}
+
+func TestOperationRecorderKeepsErrors(t *testing.T) {
+	recorder := operationRecorder{}
+	recorder.record("put_object", time.Second, nil, nil)
+	recorder.record("get_object", time.Second, errors.New("failure"), nil)
+	if len(recorder.results) != 2 {
+		t.Fatalf("Expected 2 results got %d", len(recorder.results))
+	}
+	if recorder.results[0].Error != "" || recorder.results[1].Error != "failure" {
+		t.Errorf("Unexpected results %v", recorder.results)
+	}
+	if recorder.results[0].DurationSeconds != 1 {
+		t.Errorf("Expected 1s duration got %f", recorder.results[0].DurationSeconds)
+	}
+}
@@ -0,0 +1,77 @@
+package probe
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/criteo/s3-probe/pkg/config"
+	consul_api "github.com/hashicorp/consul/api"
+	"github.com/pkg/errors"
+)
+
+// serviceOverrideKeys are the service metadata overriding the global configuration of a probe
+var serviceOverrideKeys = []string{"probe_rate", "latency_item_size", "durability_item_total", "latency_bucket"}
+
+// extractServiceOverrides returns the override keys found in the metadata of a service
+func extractServiceOverrides(meta map[string]string) map[string]string {
+	overrides := map[string]string{}
+	for _, key := range serviceOverrideKeys {
+		if value, ok := meta[key]; ok {
+			overrides[key] = value
+		}
+	}
+	return overrides
+}
+
+// getOverridesFromConsul returns the overrides of the first service entry, instances of a service share their metadata
+func getOverridesFromConsul(serviceEntries []*consul_api.ServiceEntry) map[string]string {
+	if len(serviceEntries) == 0 {
+		return map[string]string{}
+	}
+	return extractServiceOverrides(serviceEntries[0].Service.Meta)
+}
+
+// ServiceConfig returns the configuration a service is probed with, the global one with the overrides of the service
+func ServiceConfig(service S3Service, cfg *config.Config) (*config.Config, error) {
+	cfg, err := applyServiceOverrides(cfg, service.Overrides)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid overrides for %s", service.Name)
+	}
+	return cfg, nil
+}
+
+// applyServiceOverrides returns a copy of cfg with the overrides of a service applied
+func applyServiceOverrides(cfg *config.Config, overrides map[string]string) (*config.Config, error) {
+	if len(overrides) == 0 {
+		return cfg, nil
+	}
+	overridden := *cfg
+	keys := []string{}
+	for key := range overrides {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := overrides[key]
+		switch key {
+		case "latency_bucket":
+			overridden.LatencyBucketName = &value
+			continue
+		}
+		number, err := strconv.Atoi(value)
+		if err != nil || number < 1 {
+			return nil, errors.Errorf("Invalid %s override %q: a positive integer is expected", key, value)
+		}
+		switch key {
+		case "probe_rate":
+			overridden.ProbeRatePerMin = &number
+		case "latency_item_size":
+			overridden.LatencyItemSize = &number
+		case "durability_item_total":
+			overridden.DurabilityItemTotal = &number
+		default:
+			return nil, errors.Errorf("Unknown override %s", key)
+		}
+	}
+	return &overridden, nil
+}
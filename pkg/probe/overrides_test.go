@@ -0,0 +1,62 @@
+package probe
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/criteo/s3-probe/pkg/config"
+	consul_api "github.com/hashicorp/consul/api"
+)
+
+func TestGetOverridesFromConsul(t *testing.T) {
+	entries := []*consul_api.ServiceEntry{{
+		Service: &consul_api.AgentService{Meta: map[string]string{"probe_rate": "10", "latency_bucket": "small-latency", "owner": "storage"}},
+	}}
+	overrides := getOverridesFromConsul(entries)
+	expected := map[string]string{"probe_rate": "10", "latency_bucket": "small-latency"}
+	if !reflect.DeepEqual(overrides, expected) {
+		t.Errorf("Expected overrides %v, got %v", expected, overrides)
+	}
+	if overrides := getOverridesFromConsul([]*consul_api.ServiceEntry{}); len(overrides) != 0 {
+		t.Errorf("A service without entries should have no override, got %v", overrides)
+	}
+}
+
+func TestApplyServiceOverrides(t *testing.T) {
+	cfg := config.GetTestConfig()
+	overridden, err := applyServiceOverrides(&cfg, map[string]string{
+		"probe_rate":            "10",
+		"latency_item_size":     "1024",
+		"durability_item_total": "50",
+		"latency_bucket":        "small-latency",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *overridden.ProbeRatePerMin != 10 || *overridden.LatencyItemSize != 1024 ||
+		*overridden.DurabilityItemTotal != 50 || *overridden.LatencyBucketName != "small-latency" {
+		t.Errorf("Overrides were not applied: %d %d %d %s", *overridden.ProbeRatePerMin, *overridden.LatencyItemSize,
+			*overridden.DurabilityItemTotal, *overridden.LatencyBucketName)
+	}
+	if *cfg.ProbeRatePerMin == 10 || *cfg.LatencyBucketName == "small-latency" {
+		t.Error("Overrides should not modify the global configuration")
+	}
+
+	for _, value := range []string{"fast", "0", "-1"} {
+		if _, err := applyServiceOverrides(&cfg, map[string]string{"probe_rate": value}); err == nil {
+			t.Errorf("probe_rate override %q should be rejected", value)
+		}
+	}
+}
+
+func TestS3ServiceEqualsOverrides(t *testing.T) {
+	service := S3Service{Name: "my-service", Endpoint: "127.0.0.1", Overrides: map[string]string{"probe_rate": "10"}}
+	otherService := S3Service{Name: "my-service", Endpoint: "127.0.0.1", Overrides: map[string]string{"probe_rate": "20"}}
+	if service.Equals(&otherService) {
+		t.Error("S3Service equality should have return false due to different overrides")
+	}
+	otherService.Overrides = map[string]string{"probe_rate": "10"}
+	if !service.Equals(&otherService) {
+		t.Error("S3Service equality should have return true with the same overrides")
+	}
+}
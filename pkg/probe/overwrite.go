@@ -0,0 +1,174 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"sync"
+
+	"github.com/criteo/s3-probe/pkg/metrics"
+
+	minio "github.com/minio/minio-go/v7"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var s3ConcurrentOverwriteInconsistencyCounter = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_concurrent_overwrite_inconsistency_total",
+	Help: "Total number of concurrent overwrites of a key on S3 endpoint not resolving to a single version read by every GET",
+}, []string{"endpoint"})
+
+var s3OverwriteStaleCounter = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_overwrite_stale_total",
+	Help: "Total number of overwritten objects on S3 endpoint read back with other content than the last written",
+}, []string{"endpoint"})
+
+// checkOverwrittenContent checks that an overwritten object is read with the content written last
+func checkOverwrittenContent(first []byte, second []byte, read []byte) error {
+	if bytes.Equal(read, second) {
+		return nil
+	}
+	if bytes.Equal(read, first) {
+		return fmt.Errorf("overwritten object read with its previous content")
+	}
+	return fmt.Errorf("overwritten object read with content matching none of the writes")
+}
+
+// checkOverwriteReads checks that every read returned the same content, written by one of the writers
+func checkOverwriteReads(written map[[sha256.Size]byte]bool, reads [][sha256.Size]byte) error {
+	for i, read := range reads {
+		if !written[read] {
+			return fmt.Errorf("read %d returned content written by none of the writers", i)
+		}
+		if read != reads[0] {
+			return fmt.Errorf("read %d returned a different version than read 0", i)
+		}
+	}
+	return nil
+}
+
+// performConcurrentOverwriteCheck overwrites the same key concurrently with distinct
+// contents, then checks that all the reads return the single winning version
+func (p *Probe) performConcurrentOverwriteCheck() error {
+	objectName, _ := randomHex(20)
+	objectSize := int64(p.latencyItemSize)
+	defer p.cleanTempObject(p.endpoint.s3Client, p.latencyBucketName, objectName)
+
+	written := map[[sha256.Size]byte]bool{}
+	var wg sync.WaitGroup
+	errs := make(chan error, p.concurrentOverwriteWriters)
+	for i := 0; i < p.concurrentOverwriteWriters; i++ {
+		content := make([]byte, objectSize)
+		_, _ = rand.Read(content)
+		written[sha256.Sum256(content)] = true
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			operation := func(ctx context.Context) error {
+				_, err := p.endpoint.s3Client.PutObject(ctx, p.latencyBucketName, objectName, bytes.NewReader(content), objectSize, minio.PutObjectOptions{})
+				if err == nil {
+					s3BytesPutCounter.WithLabelValues(p.name).Add(float64(objectSize))
+				}
+				return err
+			}
+			if err := p.mesureOperation("concurrent_overwrite_put_object", operation); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	if err := <-errs; err != nil {
+		return err
+	}
+
+	reads := [][sha256.Size]byte{}
+	for i := 0; i < p.concurrentOverwriteWriters; i++ {
+		operation := func(ctx context.Context) error {
+			obj, err := p.endpoint.s3Client.GetObject(ctx, p.latencyBucketName, objectName, minio.GetObjectOptions{})
+			if err != nil {
+				return err
+			}
+			defer obj.Close()
+			hash := sha256.New()
+			n, err := io.Copy(hash, obj)
+			s3BytesGetCounter.WithLabelValues(p.name).Add(float64(n))
+			if err != nil {
+				return err
+			}
+			var sum [sha256.Size]byte
+			copy(sum[:], hash.Sum(nil))
+			reads = append(reads, sum)
+			return nil
+		}
+		if err := p.mesureOperation("concurrent_overwrite_get_object", operation); err != nil {
+			return err
+		}
+	}
+
+	if err := checkOverwriteReads(written, reads); err != nil {
+		s3ConcurrentOverwriteInconsistencyCounter.WithLabelValues(p.name).Inc()
+		log.Printf("Error while checking concurrent overwrites (endpoint:%s): %s", p.name, err)
+		return err
+	}
+	return nil
+}
+
+// performOverwriteCheck writes two contents under the same key and checks that the
+// object is then read with the second one
+func (p *Probe) performOverwriteCheck() error {
+	objectName, _ := randomHex(20)
+	objectSize := int64(p.latencyItemSize)
+	defer p.cleanTempObject(p.endpoint.s3Client, p.latencyBucketName, objectName)
+
+	first := make([]byte, objectSize)
+	_, _ = rand.Read(first)
+	second := make([]byte, objectSize)
+	_, _ = rand.Read(second)
+
+	ctx, cancel := p.newContext(0)
+	defer cancel()
+	_, err := p.endpoint.s3Client.PutObject(ctx, p.latencyBucketName, objectName, bytes.NewReader(first), objectSize, minio.PutObjectOptions{})
+	if err != nil {
+		log.Printf("Error while uploading object for overwrite check (endpoint:%s): %s", p.name, err)
+		return err
+	}
+	s3BytesPutCounter.WithLabelValues(p.name).Add(float64(objectSize))
+
+	operation := func(ctx context.Context) error {
+		_, err := p.endpoint.s3Client.PutObject(ctx, p.latencyBucketName, objectName, bytes.NewReader(second), objectSize, minio.PutObjectOptions{})
+		if err == nil {
+			s3BytesPutCounter.WithLabelValues(p.name).Add(float64(objectSize))
+		}
+		return err
+	}
+	if err := p.mesureOperation("overwrite_object", operation); err != nil {
+		return err
+	}
+
+	var read []byte
+	operation = func(ctx context.Context) error {
+		obj, err := p.endpoint.s3Client.GetObject(ctx, p.latencyBucketName, objectName, minio.GetObjectOptions{})
+		if err != nil {
+			return err
+		}
+		defer obj.Close()
+		read, err = ioutil.ReadAll(obj)
+		s3BytesGetCounter.WithLabelValues(p.name).Add(float64(len(read)))
+		return err
+	}
+	if err := p.mesureOperation("overwrite_get_object", operation); err != nil {
+		return err
+	}
+
+	if err := checkOverwrittenContent(first, second, read); err != nil {
+		s3OverwriteStaleCounter.WithLabelValues(p.name).Inc()
+		log.Printf("Error while checking overwritten object (endpoint:%s): %s", p.name, err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package probe
+
+import (
+	"crypto/sha256"
+	"testing"
+)
+
+func TestCheckOverwriteReads(t *testing.T) {
+	first := sha256.Sum256([]byte("first"))
+	second := sha256.Sum256([]byte("second"))
+	written := map[[sha256.Size]byte]bool{first: true, second: true}
+
+	if err := checkOverwriteReads(written, [][sha256.Size]byte{second, second, second}); err != nil {
+		t.Errorf("Reads of the same winning version should be consistent: %s", err)
+	}
+	if err := checkOverwriteReads(written, [][sha256.Size]byte{first, second}); err == nil {
+		t.Errorf("Reads of different versions should be inconsistent")
+	}
+	if err := checkOverwriteReads(written, [][sha256.Size]byte{sha256.Sum256([]byte("other"))}); err == nil {
+		t.Errorf("Read of content never written should be inconsistent")
+	}
+}
+
+func TestCheckOverwrittenContent(t *testing.T) {
+	first := []byte("first")
+	second := []byte("second")
+	if err := checkOverwrittenContent(first, second, second); err != nil {
+		t.Errorf("Expected no error got %s", err)
+	}
+	if err := checkOverwrittenContent(first, second, first); err == nil {
+		t.Errorf("Expected the previous content to be detected")
+	}
+	if err := checkOverwrittenContent(first, second, []byte("fircond")); err == nil {
+		t.Errorf("Expected a merged content to be detected")
+	}
+}
@@ -0,0 +1,52 @@
+package probe
+
+import (
+	"log"
+	"sync/atomic"
+
+	"github.com/criteo/s3-probe/pkg/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var probePaused = metrics.Factory.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "s3_probe_paused",
+	Help: "Whether the checks of the probe are paused (1) or not (0)",
+}, []string{"endpoint"})
+
+// pausedHealthGauges report the health of the endpoint, their series are deleted on pause
+// so that a paused probe doesn't keep reporting the outcome of its last checks
+var pausedHealthGauges = []prometheus.Collector{
+	s3Up,
+	s3ExpectedDurabilityItems,
+	s3FoundDurabilityItems,
+	s3ExpectedDatacenterDurabilityItems,
+	s3FoundDatacenterDurabilityItems,
+	s3DurabilityWithinTolerance,
+	s3DurabilityItemsStale,
+}
+
+// pauseState tracks whether the scheduled checks of a probe are paused
+type pauseState struct {
+	paused int32
+}
+
+func (s *pauseState) isPaused() bool {
+	return s != nil && atomic.LoadInt32(&s.paused) == 1
+}
+
+// Pause stops the scheduled checks of the probe until Resume, the probe stays watched
+// and on-demand runs are still allowed. s3_up and the durability gauges are cleared until the next checks
+func (p *Probe) Pause() {
+	atomic.StoreInt32(&p.pause.paused, 1)
+	probePaused.WithLabelValues(p.name).Set(1)
+	metrics.DeleteCollectorSeries(pausedHealthGauges, "endpoint", p.name)
+	log.Printf("Probing paused for %s", p.name)
+}
+
+// Resume restarts the scheduled checks of a paused probe
+func (p *Probe) Resume() {
+	atomic.StoreInt32(&p.pause.paused, 0)
+	probePaused.WithLabelValues(p.name).Set(0)
+	log.Printf("Probing resumed for %s", p.name)
+}
@@ -0,0 +1,56 @@
+package probe
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/criteo/s3-probe/pkg/config"
+)
+
+func TestPausedProbeSkipsChecks(t *testing.T) {
+	p := Probe{name: "paused", checks: &sync.WaitGroup{}, cleanups: &sync.WaitGroup{}, pause: &pauseState{}}
+	p.Pause()
+	ran := false
+	if p.runCheck(func(*Probe) error {
+		ran = true
+		return nil
+	}) {
+		t.Error("Checks of a paused probe should not start")
+	}
+	if !p.Status().Paused {
+		t.Error("Expected the probe to be reported paused")
+	}
+
+	p.Resume()
+	p.runCheck(func(*Probe) error {
+		ran = true
+		return nil
+	})
+	p.WaitChecks(time.Second)
+	if !ran {
+		t.Error("Checks should run once the probe is resumed")
+	}
+}
+
+func TestPauseClearsTheHealthOfTheEndpoint(t *testing.T) {
+	cfg := config.GetTestConfig()
+	p, err := NewProbe(S3Service{Name: "paused-health"}, "127.0.0.1:9000", []S3Endpoint{}, &cfg, make(chan bool))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !probePaused.DeleteLabelValues("paused-health") {
+		t.Error("s3_probe_paused should be set when the probe is created")
+	}
+	s3Up.WithLabelValues(p.name).Set(1)
+	s3FoundDurabilityItems.WithLabelValues(p.name).Set(10)
+
+	p.Pause()
+	if s3Up.DeleteLabelValues(p.name) || s3FoundDurabilityItems.DeleteLabelValues(p.name) {
+		t.Error("A paused probe should not report the health of its endpoint")
+	}
+	p.recordCycle(func() error { return nil })
+	if s3Up.DeleteLabelValues(p.name) {
+		t.Error("A cycle completing once the probe is paused should not report the health of its endpoint")
+	}
+}
@@ -0,0 +1,41 @@
+package probe
+
+import (
+	"sync/atomic"
+
+	"github.com/criteo/s3-probe/pkg/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var probePreparing = metrics.Factory.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "s3_probe_preparing",
+	Help: "Whether the buckets used by the probe are being prepared (1) or not (0), durability metrics are not updated meanwhile",
+}, []string{"endpoint"})
+
+// preparationState tracks whether the buckets used by a probe are being prepared
+type preparationState struct {
+	preparing int32
+}
+
+func (s *preparationState) set(preparing bool) {
+	if preparing {
+		atomic.StoreInt32(&s.preparing, 1)
+	} else {
+		atomic.StoreInt32(&s.preparing, 0)
+	}
+}
+
+func (s *preparationState) isPreparing() bool {
+	return s != nil && atomic.LoadInt32(&s.preparing) == 1
+}
+
+// setPreparing records whether the probe is preparing its buckets
+func (p *Probe) setPreparing(preparing bool) {
+	p.preparation.set(preparing)
+	if preparing {
+		probePreparing.WithLabelValues(p.name).Set(1)
+	} else {
+		probePreparing.WithLabelValues(p.name).Set(0)
+	}
+}
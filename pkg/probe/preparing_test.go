@@ -0,0 +1,105 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPreparationState(t *testing.T) {
+	var nilState *preparationState
+	if nilState.isPreparing() {
+		t.Errorf("A probe without preparation state should not be preparing")
+	}
+	p := Probe{name: "test", preparation: &preparationState{}}
+	p.setPreparing(true)
+	if !p.preparation.isPreparing() {
+		t.Errorf("Probe should be preparing")
+	}
+	p.setPreparing(false)
+	if p.preparation.isPreparing() {
+		t.Errorf("Probe should not be preparing anymore")
+	}
+}
+
+func TestPrepareProbingTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer server.Close()
+
+	endpoint, err := newS3Endpoint(server.URL, "access", "secret", transportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := Probe{
+		name:                    "test",
+		endpoint:                endpoint,
+		preparation:             &preparationState{},
+		latencyBucketName:       "latency",
+		defaultOperationTimeout: time.Minute,
+		prepareTimeout:          100 * time.Millisecond,
+	}
+	start := time.Now()
+	err = p.PrepareProbing()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Preparation should time out, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Preparation should be bounded by the prepare timeout, took %s", elapsed)
+	}
+}
+
+func TestPreparationContextWithoutTimeout(t *testing.T) {
+	p := Probe{stopping: newStopSignal()}
+	ctx, cancel := p.newPreparationContext()
+	defer cancel()
+	if _, ok := ctx.Deadline(); ok {
+		t.Error("Preparation should not be bounded with a zero prepare timeout")
+	}
+	p.Stop()
+	p.Stop()
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Error("Preparation should be cancelled once the probe is stopped")
+	}
+}
+
+func TestPrepareProbingSkipsDurabilityWithZeroRate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.URL.Query()["location"]; ok {
+			w.Write([]byte(`<LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/">us-east-1</LocationConstraint>`))
+			return
+		}
+		// only the latency bucket exists, touching the durability bucket fails
+		if r.Method == http.MethodHead && r.URL.Path == "/latency/" {
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	endpoint, err := newS3Endpoint(server.URL, "access", "secret", transportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := Probe{
+		name:                      "test",
+		endpoint:                  endpoint,
+		preparation:               &preparationState{},
+		latencyBucketName:         "latency",
+		durabilityBucketName:      "durability",
+		durabilityProbeRatePerMin: 0,
+		defaultOperationTimeout:   time.Second,
+	}
+	if err := p.PrepareProbing(); err != nil {
+		t.Errorf("Durability bucket should not be prepared with a zero rate: %s", err)
+	}
+}
@@ -0,0 +1,120 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/criteo/s3-probe/pkg/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// presignedURLExpiry is the validity of the URLs generated by the presigned check,
+// it only needs to cover the request following the signature
+const presignedURLExpiry = 5 * time.Minute
+
+var s3PresignedStatusMismatchCounter = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_presigned_status_mismatch_total",
+	Help: "Total number of presigned URL requests answered with an unexpected HTTP status",
+}, []string{"endpoint", "status"})
+
+// presignedStatusError is returned when a presigned URL request gets an unexpected status
+type presignedStatusError struct {
+	Expected int
+	Actual   int
+}
+
+func (e *presignedStatusError) Error() string {
+	if e.Actual == http.StatusForbidden {
+		return fmt.Sprintf("presigned URL request returned status %d instead of %d, the signature was rejected (clock skew?)", e.Actual, e.Expected)
+	}
+	return fmt.Sprintf("presigned URL request returned status %d instead of %d", e.Actual, e.Expected)
+}
+
+// performPresignedCheck uploads an object and reads it back through presigned URLs, checking the
+// HTTP status returned by the endpoint or any intermediary in front of it
+func (p *Probe) performPresignedCheck() error {
+	objectName, _ := randomHex(20)
+	objectSize := int64(p.latencyItemSize)
+	objectData, _ := randomObject(objectSize)
+	defer p.cleanTempObject(p.endpoint.s3Client, p.latencyBucketName, objectName)
+
+	ctx, cancel := p.newContext(0)
+	defer cancel()
+	presignedPutURL, err := p.endpoint.s3Client.PresignedPutObject(ctx, p.latencyBucketName, objectName, presignedURLExpiry)
+	if err != nil {
+		log.Printf("Error while presigning object upload URL (endpoint:%s): %s", p.name, err)
+		return err
+	}
+
+	status := 0
+	operation := func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, presignedPutURL.String(), objectData)
+		if err != nil {
+			return err
+		}
+		req.ContentLength = objectSize
+		resp, err := p.endpoint.httpClient().Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		status = resp.StatusCode
+		if status == http.StatusOK {
+			s3BytesPutCounter.WithLabelValues(p.name).Add(float64(objectSize))
+		}
+		return nil
+	}
+	if err := p.mesureOperation("presigned_put", operation); err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		s3PresignedStatusMismatchCounter.WithLabelValues(p.name, fmt.Sprint(status)).Inc()
+		err := &presignedStatusError{Expected: http.StatusOK, Actual: status}
+		log.Printf("Error while uploading through presigned URL (endpoint:%s): %s", p.name, err)
+		return err
+	}
+
+	presignedURL, err := p.endpoint.s3Client.PresignedGetObject(ctx, p.latencyBucketName, objectName, presignedURLExpiry, url.Values{})
+	if err != nil {
+		log.Printf("Error while presigning object URL (endpoint:%s): %s", p.name, err)
+		return err
+	}
+
+	operation = func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, presignedURL.String(), nil)
+		if err != nil {
+			return err
+		}
+		if p.presignedRange != "" {
+			req.Header.Set("Range", p.presignedRange)
+		}
+		resp, err := p.endpoint.httpClient().Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		n, err := io.Copy(ioutil.Discard, resp.Body)
+		s3BytesGetCounter.WithLabelValues(p.name).Add(float64(n))
+		status = resp.StatusCode
+		return err
+	}
+	if err := p.mesureOperation("presigned_get", operation); err != nil {
+		return err
+	}
+
+	if status != p.presignedExpectedStatus {
+		s3PresignedStatusMismatchCounter.WithLabelValues(p.name, fmt.Sprint(status)).Inc()
+		err := &presignedStatusError{Expected: p.presignedExpectedStatus, Actual: status}
+		log.Printf("Error while checking presigned URL (endpoint:%s): %s", p.name, err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package probe
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+func TestPerformPresignedCheck(t *testing.T) {
+	presigned := 0
+	p, requests := newLatencyTestProbe(t, func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Query().Get("X-Amz-Signature") != "" {
+			presigned++
+		}
+		return false
+	})
+	p.presignedExpectedStatus = http.StatusOK
+	if err := p.performPresignedCheck(); err != nil {
+		t.Fatal(err)
+	}
+	if operations(requests()) != "PUT,GET,DELETE" || presigned != 2 {
+		t.Errorf("Expected the object to be uploaded and read through presigned URLs, got %v", requests())
+	}
+	for _, operation := range []string{"presigned_put", "presigned_get"} {
+		if !s3TotalCounter.DeleteLabelValues(operation, p.name, p.datacenter) {
+			t.Errorf("Expected the %s operation to be measured", operation)
+		}
+	}
+}
+
+func TestPerformPresignedCheckRejectedUpload(t *testing.T) {
+	p, requests := newLatencyTestProbe(t, func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method != http.MethodPut {
+			return false
+		}
+		w.WriteHeader(http.StatusForbidden)
+		return true
+	})
+	p.presignedExpectedStatus = http.StatusOK
+	err := p.performPresignedCheck()
+	var statusErr *presignedStatusError
+	if !errors.As(err, &statusErr) || statusErr.Actual != http.StatusForbidden {
+		t.Fatalf("Expected a presigned status error got %v", err)
+	}
+	if operations(requests()) != "PUT,DELETE" {
+		t.Errorf("The object should not be read after a failed upload, got %v", requests())
+	}
+
+	metric := &io_prometheus_client.Metric{}
+	s3PresignedStatusMismatchCounter.WithLabelValues(p.name, "403").Write(metric)
+	if *metric.Counter.Value != 1 {
+		t.Errorf("Expected 1 status mismatch got %f", *metric.Counter.Value)
+	}
+}
@@ -4,143 +4,533 @@ import (
 	"bytes"
 	"context"
 	"crypto/rand"
+	"crypto/tls"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
+	"net/http"
 	"regexp"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/criteo/s3-probe/pkg/config"
+	"github.com/criteo/s3-probe/pkg/metrics"
 
 	minio "github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
 	"github.com/minio/minio-go/v7/pkg/lifecycle"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
-var s3LatencySummary = promauto.NewSummaryVec(prometheus.SummaryOpts{
+var s3LatencySummary = metrics.Factory.NewSummaryVec(prometheus.SummaryOpts{
 	Name:       "s3_latency_seconds",
 	Help:       "Latency for operation on the S3 endpoint",
 	MaxAge:     1 * time.Minute,
 	Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
-}, []string{"operation", "endpoint"})
+}, []string{"operation", "endpoint", "datacenter"})
 
-var s3LatencyHistogram = promauto.NewHistogramVec(prometheus.HistogramOpts{
+var s3LatencyHistogram = metrics.Factory.NewHistogramVec(prometheus.HistogramOpts{
 	Name:    "s3_latency_histogram_seconds",
 	Help:    "Latency for operation on the S3 endpoint",
 	Buckets: []float64{.001, .0025, .005, .010, .015, .020, .025, .030, .040, .050, .060, .075, .100, .250, .500, 1, 2.5, 5, 10, 15, 30, 45, 60},
-}, []string{"operation", "endpoint"})
+}, []string{"operation", "endpoint", "datacenter"})
 
-var s3TotalCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+var s3TotalCounter = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
 	Name: "s3_request_total",
 	Help: "Total number of requests on S3 endpoint",
-}, []string{"operation", "endpoint"})
+}, []string{"operation", "endpoint", "datacenter"})
 
-var s3SuccessCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+var s3SuccessCounter = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
 	Name: "s3_request_success_total",
 	Help: "Total number of successful requests on S3 endpoint",
-}, []string{"operation", "endpoint"})
+}, []string{"operation", "endpoint", "datacenter"})
 
-var s3GatewayTotalCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+var s3GatewayTotalCounter = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
 	Name: "s3_gateway_request_total",
 	Help: "Total number of gateway requests on S3 endpoint",
 }, []string{"operation", "endpoint", "gateway_endpoint"})
 
-var s3GatewaySuccessCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+var s3GatewaySuccessCounter = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
 	Name: "s3_gateway_request_success_total",
 	Help: "Total number of successful gateway requests on S3 endpoint",
 }, []string{"operation", "endpoint", "gateway_endpoint"})
 
-var s3GatewayErrorCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+var s3GatewayErrorCounter = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
 	Name: "s3_gateway_request_error_total",
 	Help: "Total number of failed gateway requests on S3 endpoint",
 }, []string{"operation", "endpoint", "gateway_endpoint"})
 
-var s3ExpectedDurabilityItems = promauto.NewGaugeVec(prometheus.GaugeOpts{
+var s3GatewayHealthyEndpoints = metrics.Factory.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "s3_gateway_healthy_endpoints",
+	Help: "Number of gateway destinations on which the last gateway check of S3 endpoint succeeded",
+}, []string{"endpoint"})
+
+var s3GatewayTotalEndpoints = metrics.Factory.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "s3_gateway_total_endpoints",
+	Help: "Number of gateway destinations checked for S3 endpoint",
+}, []string{"endpoint"})
+
+var s3GatewayExpectedErrorCounter = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_gateway_request_expected_error_total",
+	Help: "Total number of gateway requests on S3 endpoint failing with an expected error code",
+}, []string{"operation", "endpoint", "gateway_endpoint"})
+
+var s3GatewayChecksSkippedCounter = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_gateway_checks_skipped_total",
+	Help: "Total number of gateway checks skipped because too many are still reading the replicated object",
+}, []string{"endpoint"})
+
+var s3BytesPutCounter = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_probe_bytes_put_total",
+	Help: "Total number of bytes uploaded by the probe on S3 endpoint",
+}, []string{"endpoint"})
+
+var s3BytesGetCounter = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_probe_bytes_get_total",
+	Help: "Total number of bytes downloaded by the probe from S3 endpoint",
+}, []string{"endpoint"})
+
+var s3ExpectedDurabilityItems = metrics.Factory.NewGaugeVec(prometheus.GaugeOpts{
 	Name: "s3_durability_items_expected",
 	Help: "Number of items that should be present on the endpoint",
 }, []string{"endpoint"})
 
-var s3FoundDurabilityItems = promauto.NewGaugeVec(prometheus.GaugeOpts{
+var s3ExpectedDatacenterDurabilityItems = metrics.Factory.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "s3_durability_datacenter_items_expected",
+	Help: "Number of items that should be present in the durability bucket of the datacenter",
+}, []string{"endpoint", "datacenter"})
+
+var s3FoundDatacenterDurabilityItems = metrics.Factory.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "s3_durability_datacenter_items_found",
+	Help: "Number of items that are present in the durability bucket of the datacenter",
+}, []string{"endpoint", "datacenter"})
+
+var s3FoundDurabilityItems = metrics.Factory.NewGaugeVec(prometheus.GaugeOpts{
 	Name: "s3_durability_items_found",
 	Help: "Number of items that are present on the endpoint",
 }, []string{"endpoint"})
 
-var probeBucketAttempt = promauto.NewCounterVec(prometheus.CounterOpts{
+var s3DurabilityWithinTolerance = metrics.Factory.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "s3_durability_within_tolerance",
+	Help: "Whether the number of missing durability items is within the configured tolerance (1) or not (0)",
+}, []string{"endpoint", "datacenter"})
+
+var s3DurabilityItemsStale = metrics.Factory.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "s3_durability_items_stale",
+	Help: "Whether the durability items don't have the configured size (1) or do (0)",
+}, []string{"endpoint", "datacenter"})
+
+var probeBucketAttempt = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
 	Name: "probe_bucket_created_total",
 	Help: "Total number of monitoring bucket created",
 }, []string{"endpoint"})
 
-var probeGatewayBucketAttempt = promauto.NewCounterVec(prometheus.CounterOpts{
+var probeGatewayBucketAttempt = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
 	Name: "probe_gateway_bucket_created_total",
 	Help: "Total number of monitoring gateway bucket created",
 }, []string{"endpoint", "gateway_endpoint"})
 
+var probeGatewayPrepareErrorCounter = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_gateway_prepare_error_total",
+	Help: "Total number of gateway destinations whose bucket couldn't be prepared",
+}, []string{"endpoint", "gateway_endpoint"})
+
+var probePrepareDuration = metrics.Factory.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "s3_probe_prepare_duration_seconds",
+	Help:    "Time spent preparing the buckets used by the probe",
+	Buckets: []float64{.1, .5, 1, 5, 10, 30, 60, 120, 300, 600, 1800, 3600},
+}, []string{"endpoint", "phase", "outcome"})
+
 const millisecondInMinute = 60_000
 
+// durabilityItemPrefix is the name prefix of the items written in the durability bucket
+const durabilityItemPrefix = "fake-item-"
+
 // Probe is a S3 probe
 type Probe struct {
-	name                      string
-	gateway                   bool
-	endpoint                  S3Endpoint
-	secretKey                 string
-	accessKey                 string
-	latencyBucketName         string
-	durabilityBucketName      string
-	gatewayBucketName         string
-	probeRatePerMin           int
-	durabilityProbeRatePerMin int
-	latencyItemSize           int
-	durabilityItemSize        int
-	durabilityItemTotal       int
-	durabilityTimeout         time.Duration
-	latencyTimeout            time.Duration
-	cleanupDelay              time.Duration
-	gatewayEndpoints          []S3Endpoint
-	controlChan               chan bool
+	name                         string
+	gateway                      bool
+	endpoint                     S3Endpoint
+	secretKey                    string
+	accessKey                    string
+	latencyBucketName            string
+	durabilityBucketName         string
+	gatewayBucketName            string
+	probeRatePerMin              int
+	durabilityProbeRatePerMin    int
+	latencyItemSize              int
+	durabilityItemSize           int
+	durabilityItemTotal          int
+	durabilityTimeout            time.Duration
+	latencyTimeout               time.Duration
+	cleanupDelay                 time.Duration
+	gatewayEndpoints             []S3Endpoint
+	controlChan                  chan bool
+	upState                      *upState
+	aclCheck                     bool
+	cannedACL                    string
+	durabilityListRetries        int
+	durabilityListRetryDelay     time.Duration
+	anonymousClient              *minio.Client
+	gatewayCheckSlots            chan struct{}
+	listOrderCheck               bool
+	listOrderItems               int
+	defaultOperationTimeout      time.Duration
+	idleThreshold                time.Duration
+	idleTracker                  *idleTracker
+	gatewayIgnoredErrorCodes     map[string]bool
+	expectedVersioning           string
+	remediateVersioning          bool
+	summaryOperations            map[string]bool
+	removeMissingObjectCheck     bool
+	gatewayObjectsThreshold      int
+	contentMD5Check              bool
+	contentMD5NegativeCheck      bool
+	operationSlots               chan struct{}
+	presignedCheck               bool
+	presignedExpectedStatus      int
+	presignedRange               string
+	onDemandSlot                 chan struct{}
+	recorder                     *operationRecorder
+	repairDurabilityOnSizeChange bool
+	compressionCheck             bool
+	durabilityTolerance          int
+	bucketScanName               string
+	bucketScanRatePerMin         int
+	bucketScanTimeout            time.Duration
+	bucketScanSlot               chan struct{}
+	restoreBucketName            string
+	restoreObjectName            string
+	restoreDays                  int
+	preparation                  *preparationState
+	multipartAbortCheck          bool
+	concurrentGetRatePerMin      int
+	concurrentGets               int
+	corsBucketName               string
+	expectedCors                 *corsConfiguration
+	corsPreflightOrigin          string
+	listDelimiterCheck           bool
+	operationSchedule            *operationSchedule
+	clockSkewThreshold           time.Duration
+	lastModifiedCheck            bool
+	canaryBucketName             string
+	canaryObjectKey              string
+	canaryChecksum               string
+	durabilityEndpoint           S3Endpoint
+	prepareTimeout               time.Duration
+	durabilityLifecycleCheck     bool
+	backendStatsRatePerMin       int
+	instanceEndpoints            []S3Endpoint
+	concurrentOverwriteWriters   int
+	keyLengthCheckMax            int
+	incompleteUploadsCheck       bool
+	clock                        clock
+	warmup                       *warmupState
+	copyDestinationBucketName    string
+	contentDispositionCheck      bool
+	manifestItems                []manifestItem
+	manifestBucketName           string
+	durabilityDatacenter         string
+	gatewayPrepareRequireAll     bool
+	gatewayPreparation           *gatewayPreparation
+	overwriteCheck               bool
+	capacityRampMax              int
+	capacityRampWindow           time.Duration
+	capacityRampInterval         time.Duration
+	capacityLatencyThreshold     time.Duration
+	capacityRampSlot             chan struct{}
+	inflight                     *inflightOperations
+	ssecWrongKeyCheck            bool
+	checks                       *sync.WaitGroup
+	// cleanups tracks the removals of the objects created by the checks
+	cleanups        *sync.WaitGroup
+	tickPhaseOffset bool
+	tickJitter      float64
+	lastCycle       *cycleStatus
+	endpointUpdates chan endpointUpdate
+	instanceUpdates chan []S3Endpoint
+	clientUsage     *clientUsage
+	terminated      chan struct{}
+	stopping        *stopSignal
+	pause           *pauseState
+	meshTLS         *tls.Config
+	// datacenter is the datacenter of the service, added as a label of the latency, request and durability metrics
+	datacenter             string
+	multipartUploadCheck   bool
+	multipartUploadParts   int
+	multipartPartSize      int
+	listPaginationCheck    bool
+	listPaginationItems    int
+	listPaginationPageSize int
+	bulkDeleteCheck        bool
+	bulkDeleteItems        int
+	versionedBucketName    string
+	taggingCheck           bool
 }
 
 // S3Endpoint holds the endpoint name address and the client to connect to it
 type S3Endpoint struct {
-	Name     string
-	s3Client *minio.Client
+	Name      string
+	s3Client  *minio.Client
+	transport *http.Transport
 }
 
 // NewProbe creates a new S3 probe
 func NewProbe(service S3Service, endpoint string, gatewayEndpoints []S3Endpoint, cfg *config.Config, controlChan chan bool) (Probe, error) {
-	minioClient, err := newMinioClientFromEndpoint(endpoint, *cfg.AccessKey, *cfg.SecretKey)
+	// Services in the Connect mesh are reached through their sidecar with mTLS
+	endpointOptions := newTransportOptions(cfg)
+	endpointOptions.tlsConfig = service.MeshTLS
+	s3Endpoint, err := newS3Endpoint(endpoint, *cfg.AccessKey, *cfg.SecretKey, endpointOptions)
+	if err != nil {
+		return Probe{}, err
+	}
+
+	// Durability checks share the endpoint client unless they have their own credentials
+	var durabilityEndpoint S3Endpoint
+	if *cfg.DurabilityAccessKey != "" {
+		durabilityEndpoint, err = newS3Endpoint(endpoint, *cfg.DurabilityAccessKey, *cfg.DurabilitySecretKey, endpointOptions)
+		if err != nil {
+			return Probe{}, err
+		}
+	}
+
+	instanceEndpoints, err := newInstanceEndpoints(endpoint, service.InstanceEndpoints, cfg)
+	if err != nil {
+		return Probe{}, err
+	}
+
+	var anonymousClient *minio.Client
+	if *cfg.AnonymousAccessCheck {
+		anonymousClient, _, err = newMinioClientWithTransport(endpoint, "", "", endpointOptions)
+		if err != nil {
+			return Probe{}, err
+		}
+	}
+
+	var gatewayCheckSlots chan struct{}
+	if *cfg.MaxGatewayReplicationWaits > 0 {
+		gatewayCheckSlots = make(chan struct{}, *cfg.MaxGatewayReplicationWaits)
+	}
+
+	durabilityTolerance, err := parseDurabilityTolerance(*cfg.DurabilityTolerance, *cfg.DurabilityItemTotal)
+	if err != nil {
+		return Probe{}, err
+	}
+
+	if err := validateTickJitter(*cfg.TickJitter); err != nil {
+		return Probe{}, err
+	}
+
+	if *cfg.ListPaginationCheck && (*cfg.ListPaginationItems < 1 || *cfg.ListPaginationPageSize < 1) {
+		return Probe{}, fmt.Errorf("invalid listing of %d objects by pages of %d keys", *cfg.ListPaginationItems, *cfg.ListPaginationPageSize)
+	}
+
+	if *cfg.BulkDeleteCheck && *cfg.BulkDeleteItems < 1 {
+		return Probe{}, fmt.Errorf("invalid bulk delete of %d objects", *cfg.BulkDeleteItems)
+	}
+
+	if *cfg.MultipartUploadCheck && (*cfg.MultipartUploadParts < 1 || *cfg.MultipartPartSize < 1) {
+		return Probe{}, fmt.Errorf("invalid multipart upload of %d parts of %d bytes", *cfg.MultipartUploadParts, *cfg.MultipartPartSize)
+	}
+
+	var expectedCors *corsConfiguration
+	if *cfg.CorsBucketName != "" {
+		expectedCors = &corsConfiguration{}
+		if *cfg.CorsExpectedFile != "" {
+			expectedCors, err = loadCorsConfiguration(*cfg.CorsExpectedFile)
+			if err != nil {
+				return Probe{}, err
+			}
+		}
+	}
+
+	durabilityBucketName := *cfg.DurabilityBucketName
+	durabilityDatacenter := ""
+	if *cfg.DurabilityPerDatacenter && service.Datacenter != "" {
+		durabilityBucketName = datacenterBucketName(durabilityBucketName, service.Datacenter)
+		durabilityDatacenter = service.Datacenter
+	}
+
+	// Versioning would keep every version of the objects of the other checks
+	if versioned := *cfg.VersionedBucket; versioned != "" && (versioned == *cfg.LatencyBucketName || versioned == durabilityBucketName) {
+		return Probe{}, fmt.Errorf("the versioned bucket %s must differ from the latency and durability buckets", versioned)
+	}
+
+	var manifestItems []manifestItem
+	if *cfg.ManifestFile != "" {
+		manifestItems, err = loadManifest(*cfg.ManifestFile)
+		if err != nil {
+			return Probe{}, err
+		}
+	}
+	manifestBucketName := *cfg.ManifestBucket
+	if manifestBucketName == "" {
+		manifestBucketName = *cfg.DurabilityBucketName
+	}
+
+	operationSchedule, err := parseOperationSchedule(*cfg.OperationSchedule)
 	if err != nil {
 		return Probe{}, err
 	}
 
+	canaryBucketName := *cfg.CanaryBucket
+	if canaryBucketName == "" {
+		canaryBucketName = *cfg.LatencyBucketName
+	}
+
+	var operationSlots chan struct{}
+	if *cfg.MaxInflightOperations > 0 {
+		operationSlots = make(chan struct{}, *cfg.MaxInflightOperations)
+	}
+
+	gatewayIgnoredErrorCodes := map[string]bool{}
+	for _, code := range config.ParseList(*cfg.GatewayIgnoredErrorCodes) {
+		gatewayIgnoredErrorCodes[code] = true
+	}
+
+	var summaryOperations map[string]bool
+	if operations := config.ParseList(*cfg.SummaryOperations); len(operations) > 0 {
+		summaryOperations = map[string]bool{}
+		for _, operation := range operations {
+			summaryOperations[operation] = true
+		}
+	}
+
+	// New probes start unpaused, a recreated probe doesn't keep the state of the previous one
+	probePaused.WithLabelValues(service.Name).Set(0)
 	log.Printf("Probe created for: %s", endpoint)
 	return Probe{
-		name:                      service.Name,
-		gateway:                   service.Gateway,
-		endpoint:                  S3Endpoint{Name: endpoint, s3Client: minioClient},
-		secretKey:                 *cfg.SecretKey,
-		accessKey:                 *cfg.AccessKey,
-		latencyBucketName:         *cfg.LatencyBucketName,
-		durabilityBucketName:      *cfg.DurabilityBucketName,
-		gatewayBucketName:         *cfg.GatewayBucketName,
-		probeRatePerMin:           *cfg.ProbeRatePerMin,
-		durabilityProbeRatePerMin: *cfg.DurabilityProbeRatePerMin,
-		latencyItemSize:           *cfg.LatencyItemSize,
-		durabilityItemSize:        *cfg.DurabilityItemSize,
-		durabilityItemTotal:       *cfg.DurabilityItemTotal,
-		durabilityTimeout:         *cfg.DurabilityTimeout,
-		latencyTimeout:            *cfg.LatencyTimeout,
-		cleanupDelay:              *cfg.CleanupDelay,
-		controlChan:               controlChan,
-		gatewayEndpoints:          gatewayEndpoints,
+		name:                         service.Name,
+		gateway:                      service.Gateway,
+		endpoint:                     s3Endpoint,
+		secretKey:                    *cfg.SecretKey,
+		accessKey:                    *cfg.AccessKey,
+		latencyBucketName:            *cfg.LatencyBucketName,
+		durabilityBucketName:         durabilityBucketName,
+		gatewayBucketName:            *cfg.GatewayBucketName,
+		probeRatePerMin:              *cfg.ProbeRatePerMin,
+		durabilityProbeRatePerMin:    *cfg.DurabilityProbeRatePerMin,
+		latencyItemSize:              *cfg.LatencyItemSize,
+		durabilityItemSize:           *cfg.DurabilityItemSize,
+		durabilityItemTotal:          *cfg.DurabilityItemTotal,
+		durabilityTimeout:            *cfg.DurabilityTimeout,
+		latencyTimeout:               *cfg.LatencyTimeout,
+		cleanupDelay:                 *cfg.CleanupDelay,
+		controlChan:                  controlChan,
+		gatewayEndpoints:             gatewayEndpoints,
+		upState:                      newUpState(*cfg.UpThreshold, *cfg.DownThreshold),
+		aclCheck:                     *cfg.ACLCheck,
+		cannedACL:                    *cfg.CannedACL,
+		durabilityListRetries:        *cfg.DurabilityListRetries,
+		durabilityListRetryDelay:     *cfg.DurabilityListRetryDelay,
+		anonymousClient:              anonymousClient,
+		gatewayCheckSlots:            gatewayCheckSlots,
+		listOrderCheck:               *cfg.ListOrderCheck,
+		listOrderItems:               *cfg.ListOrderItems,
+		defaultOperationTimeout:      *cfg.DefaultOperationTimeout,
+		idleThreshold:                *cfg.IdleThreshold,
+		idleTracker:                  &idleTracker{},
+		gatewayIgnoredErrorCodes:     gatewayIgnoredErrorCodes,
+		expectedVersioning:           *cfg.ExpectedVersioning,
+		remediateVersioning:          *cfg.RemediateVersioning,
+		summaryOperations:            summaryOperations,
+		removeMissingObjectCheck:     *cfg.RemoveMissingObjectCheck,
+		gatewayObjectsThreshold:      *cfg.GatewayObjectsThreshold,
+		contentMD5Check:              *cfg.ContentMD5Check,
+		contentMD5NegativeCheck:      *cfg.ContentMD5NegativeCheck,
+		operationSlots:               operationSlots,
+		presignedCheck:               *cfg.PresignedCheck,
+		presignedExpectedStatus:      *cfg.PresignedExpectedStatus,
+		presignedRange:               *cfg.PresignedRange,
+		onDemandSlot:                 make(chan struct{}, 1),
+		repairDurabilityOnSizeChange: *cfg.RepairDurabilityOnSizeChange,
+		compressionCheck:             *cfg.CompressionCheck,
+		durabilityTolerance:          durabilityTolerance,
+		bucketScanName:               *cfg.BucketScanName,
+		bucketScanRatePerMin:         *cfg.BucketScanRatePerMin,
+		bucketScanTimeout:            *cfg.BucketScanTimeout,
+		bucketScanSlot:               make(chan struct{}, 1),
+		restoreBucketName:            *cfg.RestoreBucketName,
+		restoreObjectName:            *cfg.RestoreObjectName,
+		restoreDays:                  *cfg.RestoreDays,
+		preparation:                  &preparationState{},
+		multipartAbortCheck:          *cfg.MultipartAbortCheck,
+		concurrentGetRatePerMin:      *cfg.ConcurrentGetRatePerMin,
+		concurrentGets:               *cfg.ConcurrentGets,
+		corsBucketName:               *cfg.CorsBucketName,
+		expectedCors:                 expectedCors,
+		corsPreflightOrigin:          *cfg.CorsPreflightOrigin,
+		listDelimiterCheck:           *cfg.ListDelimiterCheck,
+		operationSchedule:            operationSchedule,
+		clockSkewThreshold:           *cfg.ClockSkewThreshold,
+		lastModifiedCheck:            *cfg.LastModifiedCheck,
+		canaryBucketName:             canaryBucketName,
+		canaryObjectKey:              *cfg.CanaryObjectKey,
+		canaryChecksum:               *cfg.CanaryChecksum,
+		durabilityEndpoint:           durabilityEndpoint,
+		prepareTimeout:               *cfg.PrepareTimeout,
+		durabilityLifecycleCheck:     *cfg.DurabilityLifecycleCheck,
+		backendStatsRatePerMin:       *cfg.BackendStatsRatePerMin,
+		instanceEndpoints:            instanceEndpoints,
+		concurrentOverwriteWriters:   *cfg.ConcurrentOverwriteWriters,
+		keyLengthCheckMax:            *cfg.KeyLengthCheckMax,
+		incompleteUploadsCheck:       *cfg.IncompleteUploadsCheck,
+		clock:                        systemClock{},
+		warmup:                       newWarmupState(*cfg.WarmupCycles),
+		copyDestinationBucketName:    *cfg.CopyDestinationBucket,
+		contentDispositionCheck:      *cfg.ContentDispositionCheck,
+		manifestItems:                manifestItems,
+		manifestBucketName:           manifestBucketName,
+		durabilityDatacenter:         durabilityDatacenter,
+		gatewayPrepareRequireAll:     *cfg.GatewayPrepareRequireAll,
+		gatewayPreparation:           newGatewayPreparation(),
+		overwriteCheck:               *cfg.OverwriteCheck,
+		capacityRampMax:              *cfg.CapacityRampMax,
+		capacityRampWindow:           *cfg.CapacityRampWindow,
+		capacityRampInterval:         *cfg.CapacityRampInterval,
+		capacityLatencyThreshold:     *cfg.CapacityLatencyThreshold,
+		capacityRampSlot:             make(chan struct{}, 1),
+		inflight:                     newInflightOperations(),
+		ssecWrongKeyCheck:            *cfg.SSECWrongKeyCheck,
+		checks:                       &sync.WaitGroup{},
+		cleanups:                     &sync.WaitGroup{},
+		tickPhaseOffset:              *cfg.TickPhaseOffset,
+		tickJitter:                   *cfg.TickJitter,
+		lastCycle:                    &cycleStatus{},
+		endpointUpdates:              make(chan endpointUpdate),
+		instanceUpdates:              make(chan []S3Endpoint),
+		clientUsage:                  newClientUsage(),
+		terminated:                   make(chan struct{}),
+		stopping:                     newStopSignal(),
+		pause:                        &pauseState{},
+		meshTLS:                      service.MeshTLS,
+		datacenter:                   service.Datacenter,
+		multipartUploadCheck:         *cfg.MultipartUploadCheck,
+		multipartUploadParts:         *cfg.MultipartUploadParts,
+		multipartPartSize:            *cfg.MultipartPartSize,
+		listPaginationCheck:          *cfg.ListPaginationCheck,
+		listPaginationItems:          *cfg.ListPaginationItems,
+		listPaginationPageSize:       *cfg.ListPaginationPageSize,
+		bulkDeleteCheck:              *cfg.BulkDeleteCheck,
+		bulkDeleteItems:              *cfg.BulkDeleteItems,
+		versionedBucketName:          *cfg.VersionedBucket,
+		taggingCheck:                 *cfg.TaggingCheck,
 	}, nil
 }
 
 func newMinioClientFromEndpoint(endpoint string, accessKey string, secretKey string) (*minio.Client, error) {
+	client, _, err := newMinioClientWithTransport(endpoint, accessKey, secretKey, transportOptions{})
+	return client, err
+}
+
+// newMinioClientWithTransport creates a client with its own transport, so that
+// its connections can be closed without affecting other clients
+func newMinioClientWithTransport(endpoint string, accessKey string, secretKey string, options transportOptions) (*minio.Client, *http.Transport, error) {
 	re := regexp.MustCompile("^(http[s]?://)?(.*)")
 	match := re.FindStringSubmatch(endpoint)
 	secure := false
@@ -150,24 +540,85 @@ func newMinioClientFromEndpoint(endpoint string, accessKey string, secretKey str
 	} else if match[1] == "http://" {
 		endpoint = match[2]
 	}
-	return minio.New(endpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
-		Secure: secure,
+	transport, err := minio.DefaultTransport(secure)
+	if err != nil {
+		return nil, nil, err
+	}
+	options.apply(transport)
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:     credentials.NewStaticV4(accessKey, secretKey, ""),
+		Secure:    secure,
+		Transport: &instrumentedTransport{transport: transport},
 	})
+	return client, transport, err
+}
+
+// newS3Endpoint creates the client of an endpoint
+func newS3Endpoint(endpoint string, accessKey string, secretKey string, options transportOptions) (S3Endpoint, error) {
+	client, transport, err := newMinioClientWithTransport(endpoint, accessKey, secretKey, options)
+	if err != nil {
+		return S3Endpoint{}, err
+	}
+	return S3Endpoint{Name: endpoint, s3Client: client, transport: transport}, nil
+}
+
+// close closes the idle connections of the endpoint client
+func (e *S3Endpoint) close() {
+	if e.transport != nil {
+		e.transport.CloseIdleConnections()
+	}
+}
+
+// httpClient returns a client sending raw HTTP requests through the transport of the endpoint,
+// instrumented as the requests of its S3 client
+func (e *S3Endpoint) httpClient() *http.Client {
+	var transport http.RoundTripper = http.DefaultTransport
+	if e.transport != nil {
+		transport = e.transport
+	}
+	return &http.Client{Transport: &instrumentedTransport{transport: transport}}
+}
+
+// durabilityClient returns the client of the durability checks, which has its own credentials if configured
+func (p *Probe) durabilityClient() *minio.Client {
+	if p.durabilityEndpoint.s3Client != nil {
+		return p.durabilityEndpoint.s3Client
+	}
+	return p.endpoint.s3Client
+}
+
+// closeEndpoints closes the connections to the endpoint and the gateway destinations of a terminated probe
+func (p *Probe) closeEndpoints() {
+	p.endpoint.close()
+	p.durabilityEndpoint.close()
+	for i := range p.gatewayEndpoints {
+		p.gatewayEndpoints[i].close()
+	}
+	for i := range p.instanceEndpoints {
+		p.instanceEndpoints[i].close()
+	}
 }
 
 type timer struct {
 	C      <-chan time.Time
-	Ticker *time.Ticker
+	Ticker ticker
 }
 
-func newTimer(rate int) timer {
+func newTimer(c clock, rate int) timer {
 	if rate == 0 {
+		return newIntervalTimer(c, 0)
+	}
+	return newIntervalTimer(c, time.Duration(millisecondInMinute/rate)*time.Millisecond)
+}
+
+// newIntervalTimer ticks every interval, or never if interval is zero
+func newIntervalTimer(c clock, interval time.Duration) timer {
+	if interval <= 0 {
 		fakeTimer := make(chan time.Time)
 		return timer{C: fakeTimer, Ticker: nil}
 	}
-	ticker := time.NewTicker(time.Duration(millisecondInMinute/rate) * time.Millisecond)
-	return timer{Ticker: ticker, C: ticker.C}
+	ticker := c.NewTicker(interval)
+	return timer{Ticker: ticker, C: ticker.Chan()}
 }
 
 func (t *timer) Stop() {
@@ -178,34 +629,111 @@ func (t *timer) Stop() {
 
 func (p *Probe) PrepareProbing() error {
 	log.Printf("Prepare probing for %s", p.name)
+	p.setPreparing(true)
+	defer p.setPreparing(false)
+
+	// Manifest objects are seeded outside of the probe which must not write anything
+	if p.readOnly() && !p.gateway {
+		return nil
+	}
+
+	ctx, cancel := p.newPreparationContext()
+	defer cancel()
 
 	if p.gateway {
-		err := p.prepareGatewayBucket()
+		err := p.mesurePreparation(ctx, "gateway", p.prepareGatewayBucket)
 		if err != nil {
 			log.Printf("Error: cannot prepare gateway latency bucket on %s: %s", p.name, err)
 			return err
 		}
 	} else {
-		err := p.prepareLatencyBucket()
+		err := p.mesurePreparation(ctx, "latency", p.prepareLatencyBucket)
 		if err != nil {
 			log.Printf("Error: cannot prepare latency bucket on %s: %s", p.name, err)
 			return err
 		}
-		err = p.prepareDurabilityBucket()
+		if p.copyDestinationBucketName != "" {
+			err = p.mesurePreparation(ctx, "copy_destination", p.prepareCopyDestinationBucket)
+			if err != nil {
+				log.Printf("Error: cannot prepare copy destination bucket on %s: %s", p.name, err)
+				return err
+			}
+		}
+		if p.versionedBucketName != "" {
+			err = p.mesurePreparation(ctx, "versioned", p.prepareVersionedBucket)
+			if err != nil {
+				log.Printf("Error: cannot prepare versioned bucket on %s: %s", p.name, err)
+				return err
+			}
+		}
+		// Durability is disabled with a zero rate, its items would never be checked
+		if p.durabilityProbeRatePerMin == 0 {
+			return nil
+		}
+		err = p.mesurePreparation(ctx, "durability", p.prepareDurabilityBucket)
 		if err != nil {
 			log.Printf("Error: cannot prepare durability bucket on %s: %s", p.name, err)
 			return err
 		}
+		if p.expectedVersioning != "" && p.remediateVersioning {
+			err = p.prepareVersioning(ctx)
+			if err != nil {
+				log.Printf("Error: cannot set versioning on durability bucket on %s: %s", p.name, err)
+				return err
+			}
+		}
 	}
 	return nil
 }
 
+// newPreparationContext returns the context of the preparation, bounded by the prepare timeout unless it is zero.
+// Each operation of the preparation is bounded by the default operation timeout anyway
+func (p *Probe) newPreparationContext() (context.Context, context.CancelFunc) {
+	parent := p.stopContext()
+	if p.prepareTimeout <= 0 {
+		return context.WithCancel(parent)
+	}
+	return context.WithTimeout(parent, p.prepareTimeout)
+}
+
+// mesurePreparation runs a preparation phase and records its duration and outcome
+func (p *Probe) mesurePreparation(ctx context.Context, phase string, prepare func(ctx context.Context) error) error {
+	start := time.Now()
+	err := prepare(ctx)
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("%s preparation timed out after %s: %w", phase, p.prepareTimeout, err)
+	}
+	outcome := "success"
+	if err != nil {
+		outcome = "failure"
+	}
+	probePrepareDuration.WithLabelValues(p.name, phase, outcome).Observe(time.Since(start).Seconds())
+	return err
+}
+
 // StartProbing start to probe the S3 endpoint
 func (p *Probe) StartProbing() error {
 	log.Printf("Starting probing for %s", p.name)
+	inflightProbes.track(p.name, p.inflight)
 
-	tickerProbe := newTimer(p.probeRatePerMin)
-	tickerDurabilityProbe := newTimer(p.durabilityProbeRatePerMin)
+	tickerProbe := p.newProbeTimer(p.probeRatePerMin)
+	tickerDurabilityProbe := p.newProbeTimer(p.durabilityProbeRatePerMin)
+	bucketScanRatePerMin := 0
+	if p.bucketScanName != "" && !p.gateway {
+		bucketScanRatePerMin = p.bucketScanRatePerMin
+	}
+	tickerBucketScan := p.newProbeTimer(bucketScanRatePerMin)
+	concurrentGetRatePerMin := 0
+	if !p.gateway && !p.readOnly() {
+		concurrentGetRatePerMin = p.concurrentGetRatePerMin
+	}
+	tickerConcurrentGet := p.newProbeTimer(concurrentGetRatePerMin)
+	tickerBackendStats := p.newProbeTimer(p.backendStatsRatePerMin)
+	capacityRampInterval := time.Duration(0)
+	if p.capacityRampMax > 0 && !p.gateway && !p.readOnly() {
+		capacityRampInterval = p.capacityRampInterval
+	}
+	tickerCapacityRamp := newIntervalTimer(p.clock, capacityRampInterval)
 
 	for {
 		select {
@@ -215,26 +743,114 @@ func (p *Probe) StartProbing() error {
 			log.Printf("Terminating probe on %s", p.name)
 			tickerProbe.Stop()
 			tickerDurabilityProbe.Stop()
+			tickerBucketScan.Stop()
+			tickerConcurrentGet.Stop()
+			tickerBackendStats.Stop()
+			tickerCapacityRamp.Stop()
+			inflightProbes.untrack(p.name, p.inflight)
+			p.closeEndpoints()
+			p.Stop()
+			close(p.terminated)
 			return nil
+		case update := <-p.endpointUpdates:
+			p.applyEndpointUpdate(update)
+		case instances := <-p.instanceUpdates:
+			p.applyInstanceUpdate(instances)
 		case <-tickerProbe.C:
 			if p.gateway {
-				go p.performGatewayChecks()
+				if !p.acquireGatewayCheckSlot() {
+					s3GatewayChecksSkippedCounter.WithLabelValues(p.name).Inc()
+					continue
+				}
+				started := p.runCheck(func(run *Probe) error {
+					defer run.releaseGatewayCheckSlot()
+					run.recordCycle(run.performGatewayChecks)
+					return nil
+				})
+				if !started {
+					p.releaseGatewayCheckSlot()
+				}
 			} else {
-				go p.performLatencyChecks()
+				if !p.readOnly() {
+					p.runCycle((*Probe).performLatencyChecks)
+				}
+				if p.canaryObjectKey != "" {
+					p.runCheck((*Probe).performCanaryCheck)
+				}
 			}
 		case <-tickerDurabilityProbe.C:
-			if !p.gateway {
-				go p.performDurabilityChecks()
+			if p.clockSkewThreshold > 0 {
+				p.runCheck((*Probe).performClockSkewCheck)
+			}
+			if !p.gateway && p.readOnly() {
+				p.runCycle((*Probe).performManifestCheck)
+			} else if !p.gateway {
+				p.runCheck((*Probe).performDurabilityChecks)
+				if len(p.instanceEndpoints) > 0 {
+					p.runCheck((*Probe).performDurabilityInstanceComparison)
+				}
+				if p.expectedVersioning != "" {
+					p.runCheck((*Probe).performVersioningCheck)
+				}
+				if p.durabilityLifecycleCheck {
+					p.runCheck((*Probe).performDurabilityLifecycleCheck)
+				}
+				if p.keyLengthCheckMax > 0 {
+					p.runCheck((*Probe).performKeyLengthCheck)
+				}
+				if p.incompleteUploadsCheck {
+					p.runCheck((*Probe).performIncompleteUploadsCheck)
+				}
+				if p.restoreObjectName != "" {
+					p.runCheck((*Probe).performRestoreCheck)
+				}
+				if p.corsBucketName != "" {
+					p.runCheck((*Probe).performCorsCheck)
+				}
+			} else if p.gatewayObjectsThreshold > 0 {
+				p.runCheck(func(run *Probe) error {
+					run.performGatewayBucketObjectsCheck()
+					return nil
+				})
 			}
+		case <-tickerBucketScan.C:
+			p.runCheck((*Probe).performBucketScan)
+		case <-tickerConcurrentGet.C:
+			p.runCheck((*Probe).performConcurrentGetCheck)
+		case <-tickerBackendStats.C:
+			p.runCheck((*Probe).performBackendStatsCheck)
+		case <-tickerCapacityRamp.C:
+			p.runCheck((*Probe).performCapacityRamp)
 		}
 	}
 }
 
+// acquireGatewayCheckSlot reserves a slot for a gateway check, returning false
+// if too many checks are already reading the replicated object. The slot is released once the reads
+// complete, the removal of the object happening in the background
+func (p *Probe) acquireGatewayCheckSlot() bool {
+	if p.gatewayCheckSlots == nil {
+		return true
+	}
+	select {
+	case p.gatewayCheckSlots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *Probe) releaseGatewayCheckSlot() {
+	if p.gatewayCheckSlots != nil {
+		<-p.gatewayCheckSlots
+	}
+}
+
 func (p *Probe) performDurabilityChecks() error {
-	ctx, cancel := context.WithTimeout(context.Background(), p.durabilityTimeout)
+	ctx, cancel := p.newContext(p.durabilityTimeout)
 	defer cancel()
 	s3ExpectedDurabilityItems.WithLabelValues(p.name).Set(float64(p.durabilityItemTotal))
-	objectCh := p.endpoint.s3Client.ListObjects(ctx, p.durabilityBucketName, minio.ListObjectsOptions{})
+	objectCh := p.durabilityClient().ListObjects(ctx, p.durabilityBucketName, minio.ListObjectsOptions{})
 	objectTotal := 0
 	for object := range objectCh {
 		if object.Err != nil {
@@ -244,16 +860,55 @@ func (p *Probe) performDurabilityChecks() error {
 		objectTotal++
 	}
 	s3FoundDurabilityItems.WithLabelValues(p.name).Set(float64(objectTotal))
+	if p.durabilityDatacenter != "" {
+		s3ExpectedDatacenterDurabilityItems.WithLabelValues(p.name, p.durabilityDatacenter).Set(float64(p.durabilityItemTotal))
+		s3FoundDatacenterDurabilityItems.WithLabelValues(p.name, p.durabilityDatacenter).Set(float64(objectTotal))
+	}
+	if p.durabilityItemTotal-objectTotal <= p.durabilityTolerance {
+		s3DurabilityWithinTolerance.WithLabelValues(p.name, p.datacenter).Set(1)
+	} else {
+		s3DurabilityWithinTolerance.WithLabelValues(p.name, p.datacenter).Set(0)
+	}
 	return nil
 }
 
+// datacenterBucketName returns the durability bucket of a datacenter, so that the loss of items
+// can be attributed to the datacenter they were written to
+func datacenterBucketName(bucketName string, datacenter string) string {
+	return bucketName + "-" + strings.ToLower(datacenter)
+}
+
+// parseDurabilityTolerance converts a tolerance given either as a number of
+// items or as a percentage of the total (e.g. 5 or 0.1%) to a number of items
+func parseDurabilityTolerance(tolerance string, itemTotal int) (int, error) {
+	if tolerance == "" {
+		return 0, nil
+	}
+	if strings.HasSuffix(tolerance, "%") {
+		percentage, err := strconv.ParseFloat(strings.TrimSuffix(tolerance, "%"), 64)
+		if err != nil || percentage < 0 {
+			return 0, fmt.Errorf("invalid durability tolerance %q", tolerance)
+		}
+		return int(percentage * float64(itemTotal) / 100), nil
+	}
+	items, err := strconv.Atoi(tolerance)
+	if err != nil || items < 0 {
+		return 0, fmt.Errorf("invalid durability tolerance %q", tolerance)
+	}
+	return items, nil
+}
+
 func (p *Probe) performLatencyChecks() error {
+	cycle := p.operationSchedule.next()
+
 	operation := func(ctx context.Context) error {
 		_, err := p.endpoint.s3Client.ListBuckets(ctx)
 		return err
 	}
-	if err := p.mesureOperation("list_buckets", operation); err != nil {
-		return err
+	if p.operationSchedule.due("list_buckets", cycle) {
+		if err := p.mesureOperation("list_buckets", operation); err != nil {
+			return err
+		}
 	}
 
 	objectName, _ := randomHex(20)
@@ -263,11 +918,44 @@ func (p *Probe) performLatencyChecks() error {
 
 	operation = func(ctx context.Context) error {
 		_, err := p.endpoint.s3Client.PutObject(ctx, p.latencyBucketName, objectName, objectData, objectSize, minio.PutObjectOptions{})
+		if err == nil {
+			s3BytesPutCounter.WithLabelValues(p.name).Add(float64(objectSize))
+		}
 		return err
 	}
-	if err := p.mesureOperation("put_object", operation); err != nil {
+	if p.operationSchedule.due("put_object", cycle) {
+		if err := p.mesureOperation("put_object", operation); err != nil {
+			return err
+		}
+	} else {
+		// The object is still needed by the following operations
+		ctx, cancel := p.newContext(p.latencyTimeout)
+		err := operation(ctx)
+		cancel()
+		if err != nil {
+			log.Printf("Error while uploading object for latency check (endpoint:%s): %s", p.name, err)
+			return err
+		}
+	}
+
+	operation = func(ctx context.Context) error {
+		info, err := p.endpoint.s3Client.StatObject(ctx, p.latencyBucketName, objectName, minio.StatObjectOptions{})
+		if err == nil && info.Size != objectSize {
+			err = fmt.Errorf("stat of %s returned %d bytes, expected %d", objectName, info.Size, objectSize)
+		}
 		return err
 	}
+	if p.operationSchedule.due("stat_object", cycle) {
+		if err := p.mesureOperation("stat_object", operation); err != nil {
+			return err
+		}
+	}
+
+	if p.taggingCheck {
+		if err := p.performObjectTaggingCheck(objectName); err != nil {
+			return err
+		}
+	}
 
 	operation = func(ctx context.Context) error {
 		obj, err := p.endpoint.s3Client.GetObject(ctx, p.latencyBucketName, objectName, minio.GetObjectOptions{})
@@ -276,30 +964,160 @@ func (p *Probe) performLatencyChecks() error {
 		}
 		defer obj.Close()
 		data := make([]byte, p.latencyItemSize)
-		for {
-			_, err = obj.Read(data)
-			if err == io.EOF {
-				return nil
-			} else if err != nil {
-				return err
-			}
+		return readObjectChecked(obj, data, func(n int) {
+			s3BytesGetCounter.WithLabelValues(p.name).Add(float64(n))
+		})
+	}
+	if p.operationSchedule.due("get_object", cycle) {
+		if err := p.mesureOperation("get_object", operation); err != nil {
+			return err
 		}
 	}
-	if err := p.mesureOperation("get_object", operation); err != nil {
-		return err
+
+	if p.operationSchedule.due("copy_object", cycle) {
+		if err := p.performCopyObject(objectName, objectSize); err != nil {
+			return err
+		}
 	}
 
+	// When not scheduled, the object is removed by the deferred cleanup
 	operation = func(ctx context.Context) error {
 		err := p.endpoint.s3Client.RemoveObject(ctx, p.latencyBucketName, objectName, minio.RemoveObjectOptions{})
 		return err
 	}
-	if err := p.mesureOperation("remove_object", operation); err != nil {
-		return err
+	if p.operationSchedule.due("remove_object", cycle) {
+		if err := p.mesureOperation("remove_object", operation); err != nil {
+			return err
+		}
+	}
+
+	if p.removeMissingObjectCheck {
+		if err := p.performRemoveMissingObjectCheck(); err != nil {
+			return err
+		}
+	}
+
+	if p.anonymousClient != nil {
+		if err := p.performAnonymousAccessCheck(); err != nil {
+			return err
+		}
+	}
+
+	if p.listOrderCheck {
+		if err := p.performListOrderCheck(); err != nil {
+			return err
+		}
+	}
+
+	if p.listPaginationCheck {
+		if err := p.performListPaginationCheck(); err != nil {
+			return err
+		}
+	}
+
+	if p.bulkDeleteCheck {
+		if err := p.performBulkDeleteCheck(); err != nil {
+			return err
+		}
+	}
+
+	if p.listDelimiterCheck {
+		if err := p.performListDelimiterCheck(); err != nil {
+			return err
+		}
+	}
+
+	if p.aclCheck {
+		if err := p.performACLCheck(); err != nil {
+			return err
+		}
+	}
+
+	if p.contentMD5Check {
+		if err := p.performContentMD5Check(); err != nil {
+			return err
+		}
+	}
+
+	if p.presignedCheck {
+		if err := p.performPresignedCheck(); err != nil {
+			return err
+		}
+	}
+
+	if p.compressionCheck {
+		if err := p.performCompressionCheck(); err != nil {
+			return err
+		}
+	}
+
+	if p.multipartUploadCheck {
+		if err := p.performMultipartUploadCheck(); err != nil {
+			return err
+		}
+	}
+
+	if p.multipartAbortCheck {
+		if err := p.performMultipartAbortCheck(); err != nil {
+			return err
+		}
+	}
+
+	if p.lastModifiedCheck {
+		if err := p.performLastModifiedCheck(); err != nil {
+			return err
+		}
+	}
+
+	if p.overwriteCheck {
+		if err := p.performOverwriteCheck(); err != nil {
+			return err
+		}
+	}
+
+	if p.concurrentOverwriteWriters > 0 {
+		if err := p.performConcurrentOverwriteCheck(); err != nil {
+			return err
+		}
+	}
+
+	if p.copyDestinationBucketName != "" {
+		if err := p.performCrossBucketCopyCheck(); err != nil {
+			return err
+		}
+	}
+
+	if p.versionedBucketName != "" {
+		if err := p.performVersioningRoundTripCheck(); err != nil {
+			return err
+		}
+	}
+
+	if p.contentDispositionCheck {
+		if err := p.performContentDispositionCheck(); err != nil {
+			return err
+		}
+	}
+
+	if p.ssecWrongKeyCheck {
+		if err := p.performSSECWrongKeyCheck(); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+// performRemoveMissingObjectCheck checks that removing an absent object is idempotent
+func (p *Probe) performRemoveMissingObjectCheck() error {
+	objectRandSuffix, _ := randomHex(20)
+	objectName := fmt.Sprintf("missing-%s", objectRandSuffix)
+	operation := func(ctx context.Context) error {
+		return p.endpoint.s3Client.RemoveObject(ctx, p.latencyBucketName, objectName, minio.RemoveObjectOptions{})
+	}
+	return p.mesureOperation("remove_missing_object", operation)
+}
+
 func (p *Probe) performGatewayChecks() error {
 	objectRandSuffix, _ := randomHex(20)
 	objectName := fmt.Sprintf("%s-%s", p.name, objectRandSuffix)
@@ -312,76 +1130,215 @@ func (p *Probe) performGatewayChecks() error {
 
 	operation := func(ctx context.Context) error {
 		_, err := p.endpoint.s3Client.PutObject(ctx, p.gatewayBucketName, objectName, objectData, objectSize, minio.PutObjectOptions{})
+		if err == nil {
+			s3BytesPutCounter.WithLabelValues(p.name).Add(float64(objectSize))
+		}
 		return err
 	}
 	operationName := "gateway_put_object"
 	if err := p.mesureOperation(operationName, operation); err != nil {
 		log.Printf("Error while executing %s (endpoint:%s): %s", operationName, p.name, err)
+		// No destination can be read without the object
+		if !errors.Is(err, errGlobalRateLimited) {
+			s3GatewayHealthyEndpoints.WithLabelValues(p.name).Set(0)
+		}
 		return err
 	}
 
+	healthyEndpoints := 0
 	for i := range p.gatewayEndpoints {
+		if !p.ensureGatewayDestinationPrepared(p.gatewayEndpoints[i]) {
+			continue
+		}
+		healthy := true
 		operationName = "gateway_get_object"
 		s3GatewayTotalCounter.WithLabelValues(operationName, p.name, p.gatewayEndpoints[i].Name).Inc()
-		obj, err := p.gatewayEndpoints[i].s3Client.GetObject(context.Background(), p.gatewayBucketName, objectName, minio.GetObjectOptions{})
+		ctx, cancel := p.newContext(0)
+		obj, err := p.gatewayEndpoints[i].s3Client.GetObject(ctx, p.gatewayBucketName, objectName, minio.GetObjectOptions{})
 		if err != nil {
 			log.Printf("Error while executing %s: %s", operationName, err)
 			s3GatewayErrorCounter.WithLabelValues(operationName, p.name, p.gatewayEndpoints[i].Name).Inc()
+			healthy = false
 		} else {
-			// Read data by chunks of 1024 bytes
-			data := make([]byte, 1024)
-			for _, err = obj.Read(data); err == nil; {
-			}
-			if err != io.EOF {
+			n, err := io.Copy(ioutil.Discard, obj)
+			s3BytesGetCounter.WithLabelValues(p.name).Add(float64(n))
+			if err != nil {
 				log.Printf("Error while executing %s: %s", operationName, err)
 				s3GatewayErrorCounter.WithLabelValues(operationName, p.name, p.gatewayEndpoints[i].Name).Inc()
+				healthy = false
 			} else {
 				s3GatewaySuccessCounter.WithLabelValues(operationName, p.name, p.gatewayEndpoints[i].Name).Inc()
 			}
 			obj.Close()
 		}
+		cancel()
 
 		operationName = "gateway_remove_object"
 		s3GatewayTotalCounter.WithLabelValues(operationName, p.name, p.gatewayEndpoints[i].Name).Inc()
-		err = p.gatewayEndpoints[i].s3Client.RemoveObject(context.Background(), p.gatewayBucketName, objectName, minio.RemoveObjectOptions{})
-		if err != nil {
+		ctx, cancel = p.newContext(0)
+		err = p.gatewayEndpoints[i].s3Client.RemoveObject(ctx, p.gatewayBucketName, objectName, minio.RemoveObjectOptions{})
+		cancel()
+		if err != nil && p.gatewayIgnoredErrorCodes[minio.ToErrorResponse(err).Code] {
+			s3GatewayExpectedErrorCounter.WithLabelValues(operationName, p.name, p.gatewayEndpoints[i].Name).Inc()
+		} else if err != nil {
 			log.Printf("Error while executing %s: %s", operationName, err)
 			s3GatewayErrorCounter.WithLabelValues(operationName, p.name, p.gatewayEndpoints[i].Name).Inc()
+			healthy = false
 		} else {
 			s3GatewaySuccessCounter.WithLabelValues(operationName, p.name, p.gatewayEndpoints[i].Name).Inc()
 		}
+		if healthy {
+			healthyEndpoints++
+		}
+	}
+	s3GatewayHealthyEndpoints.WithLabelValues(p.name).Set(float64(healthyEndpoints))
+	s3GatewayTotalEndpoints.WithLabelValues(p.name).Set(float64(len(p.gatewayEndpoints)))
+
+	return nil
+}
+
+// performCopyObject copies the latency object to a new key server side, checks that the copy has
+// the size of its source and removes it
+func (p *Probe) performCopyObject(objectName string, objectSize int64) error {
+	copyName := objectName + "-copy"
+	operation := func(ctx context.Context) error {
+		dst := minio.CopyDestOptions{Bucket: p.latencyBucketName, Object: copyName}
+		src := minio.CopySrcOptions{Bucket: p.latencyBucketName, Object: objectName}
+		_, err := p.endpoint.s3Client.CopyObject(ctx, dst, src)
+		return err
+	}
+	if err := p.mesureOperation("copy_object", operation); err != nil {
+		p.cleanTempObject(p.endpoint.s3Client, p.latencyBucketName, copyName)
+		return err
 	}
 
+	ctx, cancel := p.newContext(0)
+	defer cancel()
+	info, err := p.endpoint.s3Client.StatObject(ctx, p.latencyBucketName, copyName, minio.StatObjectOptions{})
+	if err == nil && info.Size != objectSize {
+		err = fmt.Errorf("copy of %s has %d bytes, expected %d", objectName, info.Size, objectSize)
+	}
+	if err != nil {
+		log.Printf("Error while checking copied object (endpoint:%s): %s", p.name, err)
+		p.cleanTempObject(p.endpoint.s3Client, p.latencyBucketName, copyName)
+		return err
+	}
+	if err := p.endpoint.s3Client.RemoveObject(ctx, p.latencyBucketName, copyName, minio.RemoveObjectOptions{}); err != nil {
+		log.Printf("Error while removing copied object (endpoint:%s): %s", p.name, err)
+		return err
+	}
 	return nil
 }
 
-func (p *Probe) cleanTempObject(s3Client *minio.Client, bucketName string, objectName string) {
-	// purpose of the cleanupDelay is to let server side operations complete if
-	// timeout has been observe on probe side
-	time.Sleep(p.cleanupDelay)
+// cleanTempObject removes objects created by a check once the cleanup delay elapsed. The removal runs
+// in its own goroutine, tracked apart from the checks, so that checks complete without waiting for it.
+// Several objects are removed one by one after a single delay
+func (p *Probe) cleanTempObject(s3Client *minio.Client, bucketName string, objectNames ...string) {
+	if len(objectNames) == 0 {
+		return
+	}
+	p.cleanups.Add(1)
+	go func() {
+		defer p.cleanups.Done()
+		// purpose of the cleanupDelay is to let server side operations complete if
+		// timeout has been observe on probe side. A stopped probe removes its objects right away
+		_ = p.sleepContext(p.stopContext(), p.cleanupDelay)
+
+		for _, objectName := range objectNames {
+			ctx, cancel := p.newContext(0)
+			_ = s3Client.RemoveObject(ctx, bucketName, objectName, minio.RemoveObjectOptions{})
+			cancel()
+		}
+	}()
+}
 
-	_ = s3Client.RemoveObject(context.Background(), bucketName, objectName, minio.RemoveObjectOptions{})
+// newContext returns a context bounded by the given timeout, falling back to
+// the default operation timeout when timeout is zero
+func (p *Probe) newContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	return p.newContextFrom(context.Background(), timeout)
+}
+
+// newContextFrom returns a context bounded by the given timeout and cancelled along with parent
+func (p *Probe) newContextFrom(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		timeout = p.defaultOperationTimeout
+	}
+	return context.WithTimeout(parent, timeout)
+}
+
+// sleepContext waits for the given delay unless ctx is done first
+func (p *Probe) sleepContext(ctx context.Context, delay time.Duration) error {
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	ticker := p.clock.NewTicker(delay)
+	defer ticker.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-ticker.Chan():
+		return nil
+	}
 }
 
 func (p *Probe) mesureOperation(operationName string, operation func(ctx context.Context) error) error {
+	if !allowGlobalOperation(time.Now()) {
+		s3GlobalRateLimitedCounter.WithLabelValues(operationName, p.name).Inc()
+		return errGlobalRateLimited
+	}
+	if err := p.acquireOperationSlot(operationName); err != nil {
+		log.Printf("Error while executing %s (endpoint:%s): %s", operationName, p.name, err)
+		return err
+	}
+	defer p.releaseOperationSlot()
+
 	start := time.Now()
-	ctx, cancel := context.WithTimeout(context.Background(), p.latencyTimeout)
+	defer p.inflight.start(start)()
+	ctx, cancel := p.newContext(p.latencyTimeout)
 	defer cancel()
+	ctx, freshConnection := withConnectionTrace(ctx)
+	ctx, trace := withOperationTrace(ctx)
+	ctx, connect := withConnectTimer(ctx)
+	idle := p.idleTracker.idleSince(start)
 	err := operation(ctx)
+	p.idleTracker.touch(time.Now())
 
-	s3TotalCounter.WithLabelValues(operationName, p.name).Inc()
-	s3LatencyHistogram.WithLabelValues(operationName, p.name).Observe(time.Since(start).Seconds())
-	s3LatencySummary.WithLabelValues(operationName, p.name).Observe(time.Since(start).Seconds())
+	s3TotalCounter.WithLabelValues(operationName, p.name, p.datacenter).Inc()
+	if n := trace.retryCount(); n > 0 {
+		s3SDKRetriesCounter.WithLabelValues(operationName, p.name).Add(float64(n))
+	}
+	s3RequestProtocolCounter.WithLabelValues(operationName, p.name, protocolLabel(trace.responseProtocol())).Inc()
+	if d, ok := connect.duration(); ok {
+		s3ConnectHistogram.WithLabelValues(operationName, p.name).Observe(d.Seconds())
+	}
+	if p.idleThreshold > 0 && freshConnection.Load() {
+		s3FreshConnectionCounter.WithLabelValues(operationName, p.name).Inc()
+	}
+	if p.warmup.active() {
+		s3LatencyWarmupHistogram.WithLabelValues(operationName, p.name).Observe(time.Since(start).Seconds())
+	} else if p.idleThreshold > 0 && idle > p.idleThreshold && freshConnection.Load() {
+		s3LatencyAfterIdleHistogram.WithLabelValues(operationName, p.name).Observe(time.Since(start).Seconds())
+	} else {
+		s3LatencyHistogram.WithLabelValues(operationName, p.name, p.datacenter).Observe(time.Since(start).Seconds())
+		// Summaries are costly so they can be restricted to a subset of operations
+		if p.summaryOperations == nil || p.summaryOperations[operationName] {
+			s3LatencySummary.WithLabelValues(operationName, p.name, p.datacenter).Observe(time.Since(start).Seconds())
+		}
+	}
+	if p.recorder != nil {
+		p.recorder.record(operationName, time.Since(start), err, trace)
+	}
 
 	if err != nil {
-		log.Printf("Error while executing %s (endpoint:%s): %s", operationName, p.name, err)
+		countErrorRetryability(operationName, p.name, err)
+		log.Printf("Error while executing %s (endpoint:%s, operation_id:%s, request_id:%s): %s", operationName, p.name, trace.operationID(), trace.lastRequestID(), err)
 		return err
 	}
-	s3SuccessCounter.WithLabelValues(operationName, p.name).Inc()
+	s3SuccessCounter.WithLabelValues(operationName, p.name, p.datacenter).Inc()
 	return nil
 }
 
-func (p *Probe) checkDurabilityBucketHasEnoughObject() (bool, error) {
+func (p *Probe) checkDurabilityBucketHasEnoughObject(parent context.Context) (bool, error) {
 	var countObj = 0
 	// Create a done channel to control 'ListObjectsV2' go routine.
 	doneCh := make(chan struct{})
@@ -389,7 +1346,10 @@ func (p *Probe) checkDurabilityBucketHasEnoughObject() (bool, error) {
 	// Indicate to our routine to exit cleanly upon return.
 	defer close(doneCh)
 
-	objectCh := p.endpoint.s3Client.ListObjects(context.Background(), p.durabilityBucketName, minio.ListObjectsOptions{})
+	ctx, cancel := p.newContextFrom(parent, p.durabilityTimeout)
+	defer cancel()
+
+	objectCh := p.durabilityClient().ListObjects(ctx, p.durabilityBucketName, minio.ListObjectsOptions{})
 	for object := range objectCh {
 		if object.Err != nil {
 			return false, object.Err
@@ -403,23 +1363,47 @@ func (p *Probe) checkDurabilityBucketHasEnoughObject() (bool, error) {
 	return false, nil
 }
 
-func (p *Probe) prepareDurabilityBucket() error {
+func (p *Probe) prepareDurabilityBucket(parent context.Context) error {
 	log.Printf("Checking if durability bucket is present on %s", p.name)
-	exists, errBucketExists := p.endpoint.s3Client.BucketExists(context.Background(), p.durabilityBucketName)
+	ctx, cancel := p.newContextFrom(parent, 0)
+	defer cancel()
+	exists, errBucketExists := p.durabilityClient().BucketExists(ctx, p.durabilityBucketName)
 	if errBucketExists != nil {
 		return errBucketExists
 	}
 
 	if exists {
-		hasEnoughObjects, err := p.checkDurabilityBucketHasEnoughObject()
+		hasEnoughObjects, err := p.checkDurabilityBucketHasEnoughObject(parent)
+		// Freshly written items may not be listed yet on eventually consistent
+		// backends, so give the listing a few chances before re-preparing
+		for i := 0; err == nil && !hasEnoughObjects && i < p.durabilityListRetries; i++ {
+			log.Printf("Durability bucket on %s lacks items, listing again in (%s)", p.name, p.durabilityListRetryDelay)
+			if err = p.sleepContext(parent, p.durabilityListRetryDelay); err != nil {
+				break
+			}
+			hasEnoughObjects, err = p.checkDurabilityBucketHasEnoughObject(parent)
+		}
 		if err != nil {
 			return err
 		}
 		if hasEnoughObjects {
-			return nil
+			sizeMatches, err := p.checkDurabilityItemSize(parent)
+			if err != nil {
+				return err
+			}
+			if sizeMatches {
+				s3DurabilityItemsStale.WithLabelValues(p.name, p.datacenter).Set(0)
+				return nil
+			}
+			if !p.repairDurabilityOnSizeChange {
+				log.Printf("Warning: durability items on %s don't have the configured size (%d bytes)", p.name, p.durabilityItemSize)
+				s3DurabilityItemsStale.WithLabelValues(p.name, p.datacenter).Set(1)
+				return nil
+			}
+			log.Printf("Durability items on %s don't have the configured size (%d bytes), writing them again", p.name, p.durabilityItemSize)
 		}
 	} else {
-		err := p.endpoint.s3Client.MakeBucket(context.Background(), p.durabilityBucketName, minio.MakeBucketOptions{})
+		err := makeBucket(ctx, p.durabilityClient(), p.durabilityBucketName)
 		if err != nil {
 			return err
 		}
@@ -427,30 +1411,79 @@ func (p *Probe) prepareDurabilityBucket() error {
 
 	log.Printf("Preparing durability bucket on %s", p.name)
 	probeBucketAttempt.WithLabelValues(p.name).Inc()
-	objectSuffix := "fake-item-"
+	objectSuffix := durabilityItemPrefix
 	objectSize := int64(p.durabilityItemSize)
 	objectData, _ := randomObject(objectSize)
 
+	putItem := func(objectName string) error {
+		ctx, cancel := p.newContextFrom(parent, 0)
+		defer cancel()
+		_, err := p.durabilityClient().PutObject(ctx, p.durabilityBucketName, objectName, objectData, objectSize, minio.PutObjectOptions{})
+		if err == nil {
+			s3BytesPutCounter.WithLabelValues(p.name).Add(float64(objectSize))
+		}
+		return err
+	}
+
 	var objectName string
 	for i := 0; i < p.durabilityItemTotal; i++ {
 		objectName = objectSuffix + strconv.Itoa(i)
-		_, err := p.endpoint.s3Client.PutObject(context.Background(), p.durabilityBucketName, objectName, objectData, objectSize, minio.PutObjectOptions{})
+		err := putItem(objectName)
 
 		for err != nil {
+			if parent.Err() != nil || !isRetryableError(err) {
+				return err
+			}
 			log.Printf("Error (item: %d): %s, retrying in (5s)", i, err)
-			time.Sleep(5 * time.Second)
-			_, err = p.endpoint.s3Client.PutObject(context.Background(), p.durabilityBucketName, objectName, objectData, objectSize, minio.PutObjectOptions{})
+			if sleepErr := p.sleepContext(parent, 5*time.Second); sleepErr != nil {
+				return err
+			}
+			err = putItem(objectName)
 		}
 		if i%100 == 0 {
 			log.Printf("%s> %d objects written (%d%%)", p.name, i, int((float64(i)/float64(p.durabilityItemTotal))*100))
 		}
 	}
+	s3DurabilityItemsStale.WithLabelValues(p.name, p.datacenter).Set(0)
 	return nil
 }
 
-func (p *Probe) prepareLatencyBucket() error {
+// checkDurabilityItemSize checks that the first, middle and last durability items have the configured size,
+// items written before a change of the item size are otherwise kept as is
+func (p *Probe) checkDurabilityItemSize(parent context.Context) (bool, error) {
+	ctx, cancel := p.newContextFrom(parent, 0)
+	defer cancel()
+	for _, item := range sampledDurabilityItems(p.durabilityItemTotal) {
+		objectInfo, err := p.durabilityClient().StatObject(ctx, p.durabilityBucketName, fmt.Sprintf("%s%d", durabilityItemPrefix, item), minio.StatObjectOptions{})
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if objectInfo.Size != int64(p.durabilityItemSize) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// sampledDurabilityItems returns the indexes of the first, middle and last of total durability items
+func sampledDurabilityItems(total int) []int {
+	items := []int{}
+	for _, item := range []int{0, total / 2, total - 1} {
+		if item >= 0 && item < total && (len(items) == 0 || items[len(items)-1] != item) {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func (p *Probe) prepareLatencyBucket(parent context.Context) error {
 	log.Printf("Checking if latency bucket is present on %s", p.name)
-	exists, errBucketExists := p.endpoint.s3Client.BucketExists(context.Background(), p.latencyBucketName)
+	ctx, cancel := p.newContextFrom(parent, 0)
+	defer cancel()
+	exists, errBucketExists := p.endpoint.s3Client.BucketExists(ctx, p.latencyBucketName)
 	if errBucketExists != nil {
 		return errBucketExists
 	}
@@ -460,41 +1493,80 @@ func (p *Probe) prepareLatencyBucket() error {
 	log.Printf("Preparing latency bucket on %s", p.name)
 	probeBucketAttempt.WithLabelValues(p.name).Inc()
 
-	err := p.endpoint.s3Client.MakeBucket(context.Background(), p.latencyBucketName, minio.MakeBucketOptions{})
+	err := makeBucket(ctx, p.endpoint.s3Client, p.latencyBucketName)
 	if err != nil {
 		return err
 	}
 
-	setBucketLifecycle1d(p.endpoint.s3Client, p.latencyBucketName)
+	setBucketLifecycle1d(ctx, p.endpoint.s3Client, p.latencyBucketName)
 	return nil
 }
 
-func (p *Probe) prepareGatewayBucket() error {
+// prepareGatewayBucket prepares the bucket on every gateway destination. Unless all destinations
+// are required, it only fails if none could be prepared so that the reachable ones are still probed.
+// The preparation of the others is retried by the gateway checks
+func (p *Probe) prepareGatewayBucket(parent context.Context) error {
 	log.Printf("Checking if gateway buckets are present on %s", p.name)
 	if len(p.gatewayEndpoints) == 0 {
 		return errors.New("couldn't find any gateway destinations")
 	}
+	ctx, cancel := p.newContextFrom(parent, 0)
+	defer cancel()
+	failures := 0
+	var lastErr error
 	for i := range p.gatewayEndpoints {
-		exists, errBucketExists := p.gatewayEndpoints[i].s3Client.BucketExists(context.Background(), p.gatewayBucketName)
-		if errBucketExists != nil {
-			return errBucketExists
-		}
-		if exists {
+		err := p.prepareGatewayEndpointBucket(ctx, p.gatewayEndpoints[i])
+		if err == nil {
+			p.gatewayPreparation.set(p.gatewayEndpoints[i].Name)
 			continue
 		}
-		log.Printf("Preparing gateway bucket on %s", p.gatewayEndpoints[i].Name)
-		probeGatewayBucketAttempt.WithLabelValues(p.name, p.gatewayEndpoints[i].Name).Inc()
-
-		err := p.gatewayEndpoints[i].s3Client.MakeBucket(context.Background(), p.gatewayBucketName, minio.MakeBucketOptions{})
-		if err != nil {
+		if p.gatewayPrepareRequireAll {
 			return err
 		}
-		setBucketLifecycle1d(p.gatewayEndpoints[i].s3Client, p.gatewayBucketName)
+		log.Printf("Error: cannot prepare gateway bucket on %s: %s", p.gatewayEndpoints[i].Name, err)
+		probeGatewayPrepareErrorCounter.WithLabelValues(p.name, p.gatewayEndpoints[i].Name).Inc()
+		failures++
+		lastErr = err
+	}
+	if failures == len(p.gatewayEndpoints) {
+		return fmt.Errorf("no gateway destination could be prepared: %w", lastErr)
+	}
+	return nil
+}
+
+// prepareGatewayEndpointBucket creates the gateway bucket on a gateway destination if missing
+func (p *Probe) prepareGatewayEndpointBucket(ctx context.Context, endpoint S3Endpoint) error {
+	exists, err := endpoint.s3Client.BucketExists(ctx, p.gatewayBucketName)
+	if err != nil || exists {
+		return err
+	}
+	log.Printf("Preparing gateway bucket on %s", endpoint.Name)
+	probeGatewayBucketAttempt.WithLabelValues(p.name, endpoint.Name).Inc()
+
+	if err := makeBucket(ctx, endpoint.s3Client, p.gatewayBucketName); err != nil {
+		return err
 	}
+	setBucketLifecycle1d(ctx, endpoint.s3Client, p.gatewayBucketName)
 	return nil
 }
 
-func setBucketLifecycle1d(client *minio.Client, bucketName string) {
+// makeBucket creates a bucket, considering it a success if the bucket has been
+// created concurrently (e.g. by another probe replica)
+func makeBucket(ctx context.Context, client *minio.Client, bucketName string) error {
+	err := client.MakeBucket(ctx, bucketName, minio.MakeBucketOptions{})
+	if isBucketAlreadyExistsError(err) {
+		log.Printf("Bucket %s already exists, skipping creation", bucketName)
+		return nil
+	}
+	return err
+}
+
+func isBucketAlreadyExistsError(err error) bool {
+	code := minio.ToErrorResponse(err).Code
+	return code == "BucketAlreadyOwnedByYou" || code == "BucketAlreadyExists"
+}
+
+func setBucketLifecycle1d(ctx context.Context, client *minio.Client, bucketName string) {
 	lc := lifecycle.NewConfiguration()
 	lc.Rules = []lifecycle.Rule{
 		{
@@ -505,7 +1577,7 @@ func setBucketLifecycle1d(client *minio.Client, bucketName string) {
 			},
 		},
 	}
-	client.SetBucketLifecycle(context.Background(), bucketName, lc)
+	client.SetBucketLifecycle(ctx, bucketName, lc)
 }
 
 func randomHex(n int) (string, error) {
@@ -2,7 +2,15 @@ package probe
 
 import (
 	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
 	"log"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -10,6 +18,7 @@ import (
 
 	minio "github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
+	io_prometheus_client "github.com/prometheus/client_model/go"
 )
 
 func TestPrepareBucketCreateBucketIfNotExists(t *testing.T) {
@@ -18,7 +27,7 @@ func TestPrepareBucketCreateBucketIfNotExists(t *testing.T) {
 	probe.latencyBucketName = probe.latencyBucketName + suffix
 	probe.durabilityBucketName = probe.durabilityBucketName + suffix
 	probe.durabilityItemTotal = 10
-	err := probe.prepareLatencyBucket()
+	err := probe.prepareLatencyBucket(context.Background())
 	if err != nil {
 		t.Errorf("Bucket Creation failed: %s", err)
 	}
@@ -28,12 +37,12 @@ func TestPrepareBucketCreateBucketIfNotExists(t *testing.T) {
 		t.Errorf("Bucket preparation failed")
 	}
 
-	err = probe.prepareLatencyBucket()
+	err = probe.prepareLatencyBucket(context.Background())
 	if err != nil {
 		t.Errorf("Bucket Creation failed: %s", err)
 	}
 
-	err = probe.prepareDurabilityBucket()
+	err = probe.prepareDurabilityBucket(context.Background())
 	if err != nil {
 		t.Errorf("Bucket Creation failed: %s", err)
 	}
@@ -50,7 +59,7 @@ func TestPrepareBucketFailedIfNotAuth(t *testing.T) {
 
 	suffix, _ := randomHex(8)
 	probe.latencyBucketName = probe.latencyBucketName + suffix
-	err := probe.prepareLatencyBucket()
+	err := probe.prepareLatencyBucket(context.Background())
 	if err == nil {
 		t.Errorf("Bucket Creation client's errors are not properly handled")
 	}
@@ -62,7 +71,7 @@ func TestPerformLatencyCheckSuccess(t *testing.T) {
 	probe.latencyBucketName = probe.latencyBucketName + suffix
 	probe.durabilityBucketName = probe.durabilityBucketName + suffix
 	probe.durabilityItemTotal = 10
-	err := probe.prepareDurabilityBucket()
+	err := probe.prepareDurabilityBucket(context.Background())
 	if err != nil {
 		t.Errorf("Bucket Creation failed: %s", err)
 	}
@@ -79,7 +88,7 @@ func TestPerformLatencyCheckFailWithTimeout(t *testing.T) {
 	probe.durabilityBucketName = probe.durabilityBucketName + suffix
 	probe.durabilityItemTotal = 10
 	probe.latencyTimeout = 1 * time.Nanosecond
-	err := probe.prepareLatencyBucket()
+	err := probe.prepareLatencyBucket(context.Background())
 	if err != nil {
 		t.Errorf("Bucket Creation failed: %s", err)
 	}
@@ -93,7 +102,7 @@ func TestDurabilityLatencyCheckSuccess(t *testing.T) {
 	probe, _ := getTestProbe()
 	suffix, _ := randomHex(8)
 	probe.latencyBucketName = probe.latencyBucketName + suffix
-	err := probe.prepareLatencyBucket()
+	err := probe.prepareLatencyBucket(context.Background())
 	if err != nil {
 		t.Errorf("Bucket Creation failed: %s", err)
 	}
@@ -144,12 +153,12 @@ func TestPrepareGatewayBucketCreateBucketIfNotExists(t *testing.T) {
 	suffix, _ := randomHex(8)
 	probe.gatewayBucketName = probe.gatewayBucketName + suffix
 	probe.gatewayEndpoints = append(probe.gatewayEndpoints, probe.endpoint)
-	err := probe.prepareGatewayBucket()
+	err := probe.prepareGatewayBucket(context.Background())
 	if err != nil {
 		t.Errorf("Bucket Creation failed: %s", err)
 	}
 	// Preparing an already ready bucket should not result in error
-	err = probe.prepareGatewayBucket()
+	err = probe.prepareGatewayBucket(context.Background())
 	if err != nil {
 		t.Errorf("Bucket Creation failed: %s", err)
 	}
@@ -159,7 +168,7 @@ func TestPrepareGatewayBucketCreateBucketFailIfNoGateways(t *testing.T) {
 	probe, _ := getTestProbe()
 	suffix, _ := randomHex(8)
 	probe.gatewayBucketName = probe.gatewayBucketName + suffix
-	err := probe.prepareGatewayBucket()
+	err := probe.prepareGatewayBucket(context.Background())
 	if err == nil {
 		t.Errorf("Bucket didn't fail without gateways")
 	}
@@ -170,7 +179,7 @@ func TestPerformGatewayCheckSuccess(t *testing.T) {
 	suffix, _ := randomHex(8)
 	probe.gatewayBucketName = probe.gatewayBucketName + suffix
 	probe.gatewayEndpoints = append(probe.gatewayEndpoints, probe.endpoint)
-	err := probe.prepareGatewayBucket()
+	err := probe.prepareGatewayBucket(context.Background())
 	if err != nil {
 		t.Errorf("Bucket Creation failed: %s", err)
 	}
@@ -178,13 +187,577 @@ func TestPerformGatewayCheckSuccess(t *testing.T) {
 	if err != nil {
 		t.Errorf("Probe check is failing: %s", err)
 	}
+
+	m, _ := s3GatewayHealthyEndpoints.GetMetricWithLabelValues(probe.name)
+	metric := &io_prometheus_client.Metric{}
+	m.Write(metric)
+	if int(*metric.Gauge.Value) != len(probe.gatewayEndpoints) {
+		t.Errorf("Expected %d healthy gateway endpoints got %f", len(probe.gatewayEndpoints), *metric.Gauge.Value)
+	}
 }
 
 func TestTimerReturnAFakeTimer(t *testing.T) {
-	ticker := newTimer(0)
+	ticker := newTimer(systemClock{}, 0)
 	if ticker.Ticker != nil {
 		t.Errorf("Fake ticker doesn't work")
 	}
 
 	ticker.Stop()
 }
+
+func TestPerformACLCheckSuccess(t *testing.T) {
+	probe, _ := getTestProbe()
+	suffix, _ := randomHex(8)
+	probe.latencyBucketName = probe.latencyBucketName + suffix
+	err := probe.prepareLatencyBucket(context.Background())
+	if err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	err = probe.performACLCheck()
+	if err != nil {
+		t.Errorf("ACL check is failing: %s", err)
+	}
+}
+
+func TestMakeBucketSucceedIfBucketAlreadyExists(t *testing.T) {
+	probe, _ := getTestProbe()
+	suffix, _ := randomHex(8)
+	bucketName := probe.latencyBucketName + suffix
+	err := makeBucket(context.Background(), probe.endpoint.s3Client, bucketName)
+	if err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	// Simulate a concurrent creation by another probe replica
+	err = makeBucket(context.Background(), probe.endpoint.s3Client, bucketName)
+	if err != nil {
+		t.Errorf("Bucket Creation should succeed when the bucket already exists: %s", err)
+	}
+}
+
+func TestIsBucketAlreadyExistsError(t *testing.T) {
+	if !isBucketAlreadyExistsError(minio.ErrorResponse{Code: "BucketAlreadyOwnedByYou"}) {
+		t.Errorf("BucketAlreadyOwnedByYou should be considered as an existing bucket")
+	}
+	if !isBucketAlreadyExistsError(minio.ErrorResponse{Code: "BucketAlreadyExists"}) {
+		t.Errorf("BucketAlreadyExists should be considered as an existing bucket")
+	}
+	if isBucketAlreadyExistsError(minio.ErrorResponse{Code: "AccessDenied"}) {
+		t.Errorf("AccessDenied shouldn't be considered as an existing bucket")
+	}
+	if isBucketAlreadyExistsError(nil) {
+		t.Errorf("A nil error shouldn't be considered as an existing bucket")
+	}
+}
+
+func TestPrepareBucketsSucceedIfBucketAlreadyExists(t *testing.T) {
+	for _, code := range []string{"BucketAlreadyOwnedByYou", "BucketAlreadyExists"} {
+		// The bucket is missing when checked but created concurrently by another probe replica
+		p, requests := newLatencyTestProbe(t, func(w http.ResponseWriter, r *http.Request) bool {
+			_, lifecycle := r.URL.Query()["lifecycle"]
+			if r.Method != http.MethodPut || lifecycle || strings.Count(strings.Trim(r.URL.Path, "/"), "/") > 0 {
+				return false
+			}
+			w.WriteHeader(http.StatusConflict)
+			fmt.Fprintf(w, `<Error><Code>%s</Code><Message>exists</Message></Error>`, code)
+			return true
+		})
+		p.gatewayEndpoints = []S3Endpoint{p.endpoint}
+		p.gatewayBucketName = "monitoring-gateway-test"
+		prepares := []struct {
+			bucketName string
+			prepare    func(ctx context.Context) error
+		}{
+			{p.latencyBucketName, p.prepareLatencyBucket},
+			{p.durabilityBucketName, p.prepareDurabilityBucket},
+			{p.gatewayBucketName, p.prepareGatewayBucket},
+		}
+		for _, phase := range prepares {
+			if err := phase.prepare(context.Background()); err != nil {
+				t.Errorf("Preparation of %s should succeed on %s: %s", phase.bucketName, code, err)
+			}
+		}
+		made := map[string]bool{}
+		for _, request := range requests() {
+			made[request] = true
+		}
+		for _, phase := range prepares {
+			if !made["PUT /"+phase.bucketName+"/"] {
+				t.Errorf("Bucket %s should have been created", phase.bucketName)
+			}
+		}
+	}
+}
+
+func TestPerformAnonymousAccessCheckSuccess(t *testing.T) {
+	probe, _ := getTestProbe()
+	suffix, _ := randomHex(8)
+	probe.latencyBucketName = probe.latencyBucketName + suffix
+	probe.anonymousClient, _ = newMinioClientFromEndpoint(probe.endpoint.Name, "", "")
+	err := probe.prepareLatencyBucket(context.Background())
+	if err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	err = probe.performAnonymousAccessCheck()
+	if err != nil {
+		t.Errorf("Anonymous access check is failing: %s", err)
+	}
+}
+
+func TestPerformListOrderCheckSuccess(t *testing.T) {
+	probe, _ := getTestProbe()
+	suffix, _ := randomHex(8)
+	probe.latencyBucketName = probe.latencyBucketName + suffix
+	probe.listOrderItems = 5
+	err := probe.prepareLatencyBucket(context.Background())
+	if err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	err = probe.performListOrderCheck()
+	if err != nil {
+		t.Errorf("List order check is failing: %s", err)
+	}
+}
+
+func TestNewContextFallbackToDefaultTimeout(t *testing.T) {
+	probe := Probe{defaultOperationTimeout: time.Minute}
+	ctx, cancel := probe.newContext(0)
+	defer cancel()
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		t.Fatalf("Context should have a deadline")
+	}
+	if time.Until(deadline) > time.Minute || time.Until(deadline) < 59*time.Second {
+		t.Errorf("Context deadline should match the default operation timeout")
+	}
+
+	ctx, cancel = probe.newContext(time.Second)
+	defer cancel()
+	deadline, ok = ctx.Deadline()
+	if !ok || time.Until(deadline) > time.Second {
+		t.Errorf("Specific timeout should override the default operation timeout")
+	}
+}
+
+func TestNoOperationRunsWithoutDeadline(t *testing.T) {
+	files, _ := filepath.Glob("*.go")
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			t.Fatalf("Cannot parse %s: %s", file, err)
+		}
+		for _, decl := range f.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Name.Name == "newContext" {
+				continue
+			}
+			ast.Inspect(fn, func(n ast.Node) bool {
+				sel, ok := n.(*ast.SelectorExpr)
+				if !ok {
+					return true
+				}
+				if pkg, ok := sel.X.(*ast.Ident); ok && pkg.Name == "context" && (sel.Sel.Name == "Background" || sel.Sel.Name == "TODO") {
+					t.Errorf("%s: context.%s used in %s, use newContext instead", fset.Position(sel.Pos()), sel.Sel.Name, fn.Name.Name)
+				}
+				return true
+			})
+		}
+	}
+}
+
+func TestPrepareVersioningRemediateDrift(t *testing.T) {
+	probe, _ := getTestProbe()
+	suffix, _ := randomHex(8)
+	probe.durabilityBucketName = probe.durabilityBucketName + suffix
+	probe.expectedVersioning = minio.Enabled
+	err := probe.prepareDurabilityBucket(context.Background())
+	if err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	err = probe.prepareVersioning(context.Background())
+	if err != nil {
+		t.Errorf("Versioning remediation failed: %s", err)
+	}
+	err = probe.performVersioningCheck()
+	if err != nil {
+		t.Errorf("Versioning check is failing: %s", err)
+	}
+}
+
+func TestPerformRemoveMissingObjectCheckSuccess(t *testing.T) {
+	probe, _ := getTestProbe()
+	suffix, _ := randomHex(8)
+	probe.latencyBucketName = probe.latencyBucketName + suffix
+	err := probe.prepareLatencyBucket(context.Background())
+	if err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	err = probe.performRemoveMissingObjectCheck()
+	if err != nil {
+		t.Errorf("Removing a missing object should succeed: %s", err)
+	}
+}
+
+func TestCountGatewayBucketObjects(t *testing.T) {
+	probe, _ := getTestProbe()
+	suffix, _ := randomHex(8)
+	probe.gatewayBucketName = probe.gatewayBucketName + suffix
+	probe.gatewayEndpoints = append(probe.gatewayEndpoints, probe.endpoint)
+	err := probe.prepareGatewayBucket(context.Background())
+	if err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	count, err := probe.countGatewayBucketObjects(probe.endpoint)
+	if err != nil || count != 0 {
+		t.Errorf("Gateway bucket should be empty, got %d objects (%s)", count, err)
+	}
+}
+
+func TestPerformContentMD5CheckSuccess(t *testing.T) {
+	probe, _ := getTestProbe()
+	suffix, _ := randomHex(8)
+	probe.latencyBucketName = probe.latencyBucketName + suffix
+	probe.contentMD5NegativeCheck = true
+	err := probe.prepareLatencyBucket(context.Background())
+	if err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	err = probe.performContentMD5Check()
+	if err != nil {
+		t.Errorf("Content-MD5 check is failing: %s", err)
+	}
+}
+
+func TestPerformPresignedCheckSuccess(t *testing.T) {
+	probe, _ := getTestProbe()
+	suffix, _ := randomHex(8)
+	probe.latencyBucketName = probe.latencyBucketName + suffix
+	err := probe.prepareLatencyBucket(context.Background())
+	if err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	err = probe.performPresignedCheck()
+	if err != nil {
+		t.Errorf("Presigned check is failing: %s", err)
+	}
+
+	probe.presignedRange = "bytes=0-0"
+	probe.presignedExpectedStatus = 206
+	err = probe.performPresignedCheck()
+	if err != nil {
+		t.Errorf("Ranged presigned check is failing: %s", err)
+	}
+}
+
+func TestPresignedStatusErrorMentionsSignatureOnForbidden(t *testing.T) {
+	err := &presignedStatusError{Expected: 200, Actual: 403}
+	if !strings.Contains(err.Error(), "signature") {
+		t.Errorf("Forbidden status should point at the signature: %s", err)
+	}
+}
+
+func TestPrepareDurabilityBucketRepairItemsOnSizeChange(t *testing.T) {
+	probe, _ := getTestProbe()
+	suffix, _ := randomHex(8)
+	probe.durabilityBucketName = probe.durabilityBucketName + suffix
+	err := probe.prepareDurabilityBucket(context.Background())
+	if err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+
+	probe.durabilityItemSize = probe.durabilityItemSize * 2
+	sizeMatches, err := probe.checkDurabilityItemSize(context.Background())
+	if err != nil || sizeMatches {
+		t.Errorf("Durability items should not match the new size (%s)", err)
+	}
+
+	probe.repairDurabilityOnSizeChange = true
+	err = probe.prepareDurabilityBucket(context.Background())
+	if err != nil {
+		t.Errorf("Durability bucket repair failed: %s", err)
+	}
+	sizeMatches, err = probe.checkDurabilityItemSize(context.Background())
+	if err != nil || !sizeMatches {
+		t.Errorf("Durability items should have been written again with the new size (%s)", err)
+	}
+}
+
+func TestSampledDurabilityItems(t *testing.T) {
+	cases := map[int][]int{
+		0:   {},
+		1:   {0},
+		2:   {0, 1},
+		3:   {0, 1, 2},
+		100: {0, 50, 99},
+	}
+	for total, expected := range cases {
+		if items := sampledDurabilityItems(total); !reflect.DeepEqual(items, expected) {
+			t.Errorf("Expected items %v out of %d, got %v", expected, total, items)
+		}
+	}
+}
+
+func TestPerformCompressionCheckSuccess(t *testing.T) {
+	probe, _ := getTestProbe()
+	suffix, _ := randomHex(8)
+	probe.latencyBucketName = probe.latencyBucketName + suffix
+	err := probe.prepareLatencyBucket(context.Background())
+	if err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	err = probe.performCompressionCheck()
+	if err != nil {
+		t.Errorf("Compression check is failing: %s", err)
+	}
+}
+
+func TestParseDurabilityTolerance(t *testing.T) {
+	cases := map[string]int{"": 0, "0": 0, "5": 5, "1%": 1000, "0.5%": 500}
+	for tolerance, expected := range cases {
+		items, err := parseDurabilityTolerance(tolerance, 100000)
+		if err != nil || items != expected {
+			t.Errorf("Tolerance %q: expected %d got %d (%s)", tolerance, expected, items, err)
+		}
+	}
+	for _, tolerance := range []string{"-1", "abc", "x%", "-2%"} {
+		if _, err := parseDurabilityTolerance(tolerance, 100000); err == nil {
+			t.Errorf("Tolerance %q should be rejected", tolerance)
+		}
+	}
+}
+
+func TestDurabilityBucketPerDatacenter(t *testing.T) {
+	testConfig := config.GetTestConfig()
+	service := S3Service{Name: "test", Datacenter: "EU-West-1"}
+	probe, err := NewProbe(service, "localhost:9000", []S3Endpoint{}, &testConfig, make(chan bool, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if probe.durabilityBucketName != *testConfig.DurabilityBucketName || probe.datacenter != "EU-West-1" {
+		t.Errorf("The datacenter should only label metrics by default, got bucket %s", probe.durabilityBucketName)
+	}
+
+	durabilityPerDatacenter := true
+	testConfig.DurabilityPerDatacenter = &durabilityPerDatacenter
+	probe, err = NewProbe(service, "localhost:9000", []S3Endpoint{}, &testConfig, make(chan bool, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := *testConfig.DurabilityBucketName + "-eu-west-1"
+	if probe.durabilityBucketName != expected {
+		t.Errorf("Expected durability bucket %s got %s", expected, probe.durabilityBucketName)
+	}
+}
+
+func TestPerformBucketScan(t *testing.T) {
+	probe, _ := getTestProbe()
+	suffix, _ := randomHex(8)
+	probe.durabilityBucketName = probe.durabilityBucketName + suffix
+	err := probe.prepareDurabilityBucket(context.Background())
+	if err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	probe.bucketScanName = probe.durabilityBucketName
+	err = probe.performBucketScan()
+	if err != nil {
+		t.Errorf("Bucket scan is failing: %s", err)
+	}
+
+	m, _ := s3BucketObjectCount.GetMetricWithLabelValues(probe.name, probe.bucketScanName)
+	metric := &io_prometheus_client.Metric{}
+	m.Write(metric)
+	if int(*metric.Gauge.Value) != probe.durabilityItemTotal {
+		t.Errorf("Expected %d objects got %f", probe.durabilityItemTotal, *metric.Gauge.Value)
+	}
+}
+
+func TestPerformMultipartAbortCheckSuccess(t *testing.T) {
+	probe, _ := getTestProbe()
+	suffix, _ := randomHex(8)
+	probe.latencyBucketName = probe.latencyBucketName + suffix
+	err := probe.prepareLatencyBucket(context.Background())
+	if err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	err = probe.performMultipartAbortCheck()
+	if err != nil {
+		t.Errorf("Multipart abort check is failing: %s", err)
+	}
+}
+
+func TestPerformMultipartUploadCheckSuccess(t *testing.T) {
+	probe, _ := getTestProbe()
+	suffix, _ := randomHex(8)
+	probe.latencyBucketName = probe.latencyBucketName + suffix
+	err := probe.prepareLatencyBucket(context.Background())
+	if err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	err = probe.performMultipartUploadCheck()
+	if err != nil {
+		t.Errorf("Multipart upload check is failing: %s", err)
+	}
+}
+
+func TestPerformConcurrentGetCheckSuccess(t *testing.T) {
+	probe, _ := getTestProbe()
+	suffix, _ := randomHex(8)
+	probe.latencyBucketName = probe.latencyBucketName + suffix
+	err := probe.prepareLatencyBucket(context.Background())
+	if err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	err = probe.performConcurrentGetCheck()
+	if err != nil {
+		t.Errorf("Concurrent GET check is failing: %s", err)
+	}
+}
+
+func TestPerformListDelimiterCheckSuccess(t *testing.T) {
+	probe, _ := getTestProbe()
+	suffix, _ := randomHex(8)
+	probe.latencyBucketName = probe.latencyBucketName + suffix
+	err := probe.prepareLatencyBucket(context.Background())
+	if err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	err = probe.performListDelimiterCheck()
+	if err != nil {
+		t.Errorf("List delimiter check is failing: %s", err)
+	}
+}
+
+func TestPerformLastModifiedCheckSuccess(t *testing.T) {
+	probe, _ := getTestProbe()
+	suffix, _ := randomHex(8)
+	probe.latencyBucketName = probe.latencyBucketName + suffix
+	err := probe.prepareLatencyBucket(context.Background())
+	if err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	err = probe.performLastModifiedCheck()
+	if err != nil {
+		t.Errorf("LastModified check is failing: %s", err)
+	}
+}
+
+func TestCheckLastModified(t *testing.T) {
+	previous := time.Date(2021, 6, 1, 10, 0, 0, 500000000, time.UTC)
+	if err := checkLastModified(previous, previous.Add(-400*time.Millisecond)); err != nil {
+		t.Errorf("Dates within the same second should be accepted: %s", err)
+	}
+	if err := checkLastModified(previous, previous.Add(time.Second)); err != nil {
+		t.Errorf("A later date should be accepted: %s", err)
+	}
+	if err := checkLastModified(previous, previous.Add(-time.Second)); err == nil {
+		t.Errorf("An earlier date should be rejected")
+	}
+}
+
+func TestPerformDurabilityLifecycleCheckWithoutLifecycle(t *testing.T) {
+	probe, _ := getTestProbe()
+	suffix, _ := randomHex(8)
+	probe.durabilityBucketName = probe.durabilityBucketName + suffix
+	err := probe.prepareDurabilityBucket(context.Background())
+	if err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	err = probe.performDurabilityLifecycleCheck()
+	if err != nil {
+		t.Errorf("Durability lifecycle check is failing: %s", err)
+	}
+
+	m, _ := s3DurabilityUnexpectedLifecycle.GetMetricWithLabelValues(probe.name)
+	metric := &io_prometheus_client.Metric{}
+	m.Write(metric)
+	if *metric.Gauge.Value != 0 {
+		t.Errorf("Durability bucket without lifecycle should not be flagged")
+	}
+}
+
+func TestPerformConcurrentOverwriteCheckSuccess(t *testing.T) {
+	probe, _ := getTestProbe()
+	suffix, _ := randomHex(8)
+	probe.latencyBucketName = probe.latencyBucketName + suffix
+	probe.concurrentOverwriteWriters = 4
+	err := probe.prepareLatencyBucket(context.Background())
+	if err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	err = probe.performConcurrentOverwriteCheck()
+	if err != nil {
+		t.Errorf("Concurrent overwrite check is failing: %s", err)
+	}
+}
+
+func TestPerformKeyLengthCheck(t *testing.T) {
+	probe, _ := getTestProbe()
+	suffix, _ := randomHex(8)
+	probe.latencyBucketName = probe.latencyBucketName + suffix
+	probe.keyLengthCheckMax = 1024
+	err := probe.prepareLatencyBucket(context.Background())
+	if err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	err = probe.performKeyLengthCheck()
+	if err != nil {
+		t.Errorf("Key length check is failing: %s", err)
+	}
+
+	m, _ := s3MaxWorkingKeyLength.GetMetricWithLabelValues(probe.name)
+	metric := &io_prometheus_client.Metric{}
+	m.Write(metric)
+	if *metric.Gauge.Value != 1024 {
+		t.Errorf("Expected keys of 1024 characters to work got %f", *metric.Gauge.Value)
+	}
+}
+
+func TestPerformCrossBucketCopyCheckSuccess(t *testing.T) {
+	probe, _ := getTestProbe()
+	suffix, _ := randomHex(8)
+	probe.latencyBucketName = probe.latencyBucketName + suffix
+	probe.copyDestinationBucketName = "copy-destination" + suffix
+	err := probe.prepareLatencyBucket(context.Background())
+	if err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	err = probe.prepareCopyDestinationBucket(context.Background())
+	if err != nil {
+		t.Errorf("Destination bucket creation failed: %s", err)
+	}
+	err = probe.performCrossBucketCopyCheck()
+	if err != nil {
+		t.Errorf("Cross bucket copy check is failing: %s", err)
+	}
+}
+
+func TestPerformContentDispositionCheckSuccess(t *testing.T) {
+	probe, _ := getTestProbe()
+	suffix, _ := randomHex(8)
+	probe.latencyBucketName = probe.latencyBucketName + suffix
+	err := probe.prepareLatencyBucket(context.Background())
+	if err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	err = probe.performContentDispositionCheck()
+	if err != nil {
+		t.Errorf("Content-Disposition check is failing: %s", err)
+	}
+}
+
+func TestPerformOverwriteCheckSuccess(t *testing.T) {
+	probe, _ := getTestProbe()
+	suffix, _ := randomHex(8)
+	probe.latencyBucketName = probe.latencyBucketName + suffix
+	err := probe.prepareLatencyBucket(context.Background())
+	if err != nil {
+		t.Errorf("Bucket Creation failed: %s", err)
+	}
+	err = probe.performOverwriteCheck()
+	if err != nil {
+		t.Errorf("Overwrite check is failing: %s", err)
+	}
+}
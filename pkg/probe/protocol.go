@@ -0,0 +1,41 @@
+package probe
+
+import (
+	"crypto/tls"
+	"net/http"
+
+	"github.com/criteo/s3-probe/pkg/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var s3RequestProtocolCounter = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_request_protocol_total",
+	Help: "Total number of operations on S3 endpoint by HTTP protocol of the last response",
+}, []string{"operation", "endpoint", "protocol"})
+
+// protocolLabel bounds the values of the protocol label
+func protocolLabel(proto string) string {
+	switch proto {
+	case "HTTP/1.1", "HTTP/2.0":
+		return proto
+	case "":
+		return "none"
+	}
+	return "other"
+}
+
+// disableHTTP2 prevents the transport from negotiating HTTP/2. The default transport of the SDK
+// already stays on HTTP/1.1 as it sets its own TLS configuration without ForceAttemptHTTP2, this
+// keeps the protocol pinned should the SDK or the transport start negotiating HTTP/2
+func disableHTTP2(transport *http.Transport) {
+	transport.ForceAttemptHTTP2 = false
+	transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+}
+
+// responseProtocol returns the protocol of the last response
+func (t *operationTrace) responseProtocol() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.protocol
+}
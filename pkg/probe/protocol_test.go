@@ -0,0 +1,43 @@
+package probe
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestForceHTTP1(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<ListAllMyBucketsResult><Buckets></Buckets></ListAllMyBucketsResult>`))
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	client, transport, err := newMinioClientWithTransport(server.URL, "access", "secret", transportOptions{forceHTTP1: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport.TLSClientConfig.RootCAs = server.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+	ctx, trace := withOperationTrace(context.Background())
+	if _, err := client.ListBuckets(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if trace.responseProtocol() != "HTTP/1.1" {
+		t.Errorf("Expected HTTP/1.1 got %s", trace.responseProtocol())
+	}
+}
+
+func TestProtocolLabel(t *testing.T) {
+	for proto, expected := range map[string]string{
+		"HTTP/1.1": "HTTP/1.1",
+		"HTTP/2.0": "HTTP/2.0",
+		"HTTP/1.0": "other",
+		"":         "none",
+	} {
+		if label := protocolLabel(proto); label != expected {
+			t.Errorf("Expected %s for %q got %s", expected, proto, label)
+		}
+	}
+}
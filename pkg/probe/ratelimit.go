@@ -0,0 +1,75 @@
+package probe
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/criteo/s3-probe/pkg/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var s3GlobalRateLimitedCounter = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_global_rate_limited_total",
+	Help: "Total number of operations on S3 endpoint skipped because the global operation budget was exhausted",
+}, []string{"operation", "endpoint"})
+
+// errGlobalRateLimited is returned for operations skipped by the global rate limit, the
+// cycle they belong to tells nothing about the health of the endpoint
+var errGlobalRateLimited = errors.New("global operation budget exhausted")
+
+// tokenBucket allows a number of operations per minute, refilled continuously,
+// with bursts up to a minute worth of operations
+type tokenBucket struct {
+	mu       sync.Mutex
+	perMin   int
+	tokens   float64
+	lastFill time.Time
+}
+
+// take consumes a token if one is available
+func (b *tokenBucket) take(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.lastFill.IsZero() {
+		b.tokens += now.Sub(b.lastFill).Minutes() * float64(b.perMin)
+		if b.tokens > float64(b.perMin) {
+			b.tokens = float64(b.perMin)
+		}
+	}
+	b.lastFill = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+var (
+	globalRateLimitMu sync.Mutex
+	globalRateLimit   *tokenBucket
+)
+
+// SetGlobalRateLimit caps the operations performed by all the probes of the process
+// to opsPerMin, 0 removes the cap
+func SetGlobalRateLimit(opsPerMin int) {
+	globalRateLimitMu.Lock()
+	defer globalRateLimitMu.Unlock()
+	if opsPerMin <= 0 {
+		globalRateLimit = nil
+		return
+	}
+	if globalRateLimit != nil && globalRateLimit.perMin == opsPerMin {
+		return
+	}
+	globalRateLimit = &tokenBucket{perMin: opsPerMin, tokens: float64(opsPerMin)}
+}
+
+// allowGlobalOperation tells whether the global budget allows one more operation
+func allowGlobalOperation(now time.Time) bool {
+	globalRateLimitMu.Lock()
+	bucket := globalRateLimit
+	globalRateLimitMu.Unlock()
+	return bucket == nil || bucket.take(now)
+}
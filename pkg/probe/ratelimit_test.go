@@ -0,0 +1,45 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketRefillsOverTime(t *testing.T) {
+	bucket := &tokenBucket{perMin: 2, tokens: 2}
+	now := time.Now()
+	if !bucket.take(now) || !bucket.take(now) {
+		t.Fatalf("Expected the initial budget to be available")
+	}
+	if bucket.take(now) {
+		t.Errorf("Expected the budget to be exhausted")
+	}
+	if !bucket.take(now.Add(30 * time.Second)) {
+		t.Errorf("Expected a token to be refilled after half a minute")
+	}
+	if bucket.take(now.Add(30 * time.Second)) {
+		t.Errorf("Expected a single token to be refilled")
+	}
+	bucket.take(now.Add(time.Hour))
+	if bucket.tokens > 2 {
+		t.Errorf("Expected the budget to be capped to a minute of operations, got %f", bucket.tokens)
+	}
+}
+
+func TestGlobalRateLimitSkipsOperations(t *testing.T) {
+	SetGlobalRateLimit(1)
+	defer SetGlobalRateLimit(0)
+
+	p := Probe{name: "test", defaultOperationTimeout: time.Minute, idleTracker: &idleTracker{}}
+	operation := func() error {
+		return p.mesureOperation("list_buckets", func(ctx context.Context) error { return nil })
+	}
+	if err := operation(); err != nil {
+		t.Fatalf("Expected the first operation to run got %s", err)
+	}
+	if err := operation(); !errors.Is(err, errGlobalRateLimited) {
+		t.Errorf("Expected the second operation to be rate limited got %v", err)
+	}
+}
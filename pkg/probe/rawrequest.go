@@ -0,0 +1,39 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/minio/minio-go/v7/pkg/signer"
+)
+
+// doSignedRequest sends a request signed with the probe credentials, for the
+// S3 APIs minio-go doesn't provide. The caller must close the response body
+func (p *Probe) doSignedRequest(ctx context.Context, method string, bucketName string, objectName string, query string, body []byte) (*http.Response, error) {
+	location, err := p.endpoint.s3Client.GetBucketLocation(ctx, bucketName)
+	if err != nil {
+		return nil, err
+	}
+	return p.doSignedPathRequest(ctx, method, "/"+bucketName+"/"+objectName, query, body, location)
+}
+
+// doSignedPathRequest sends a request on any path of the endpoint, signed for the given region.
+// The caller must close the response body
+func (p *Probe) doSignedPathRequest(ctx context.Context, method string, path string, query string, body []byte, region string) (*http.Response, error) {
+	target := *p.endpoint.s3Client.EndpointURL()
+	target.Path = path
+	target.RawQuery = query
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(sum[:]))
+	req.ContentLength = int64(len(body))
+	req = signer.SignV4(*req, p.accessKey, p.secretKey, "", region)
+
+	return p.endpoint.httpClient().Do(req)
+}
@@ -0,0 +1,89 @@
+package probe
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/criteo/s3-probe/pkg/metrics"
+
+	minio "github.com/minio/minio-go/v7"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var s3RestoreRequestCounter = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_restore_request_total",
+	Help: "Total number of restore requests sent for the archived object, by outcome",
+}, []string{"endpoint", "outcome"})
+
+var s3RestoreReadyCounter = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_restore_ready_total",
+	Help: "Total number of checks where the restored object could be read",
+}, []string{"endpoint"})
+
+// restoreOutcomes maps the status of a restore request to the outcome reported
+var restoreOutcomes = map[int]string{
+	http.StatusAccepted:       "accepted",
+	http.StatusOK:             "already_restored",
+	http.StatusConflict:       "in_progress",
+	http.StatusNotImplemented: "not_supported",
+}
+
+// performRestoreCheck requests the restoration of an archived object and checks whether it can be read.
+// Restores are asynchronous so the object is expected to become readable on a later check
+func (p *Probe) performRestoreCheck() error {
+	outcome := ""
+	operation := func(ctx context.Context) error {
+		var err error
+		outcome, err = p.requestRestore(ctx)
+		return err
+	}
+	err := p.mesureOperation("restore_object", operation)
+	if outcome != "" {
+		s3RestoreRequestCounter.WithLabelValues(p.name, outcome).Inc()
+	}
+	if err != nil {
+		return err
+	}
+	if outcome == "not_supported" {
+		log.Printf("Restore is not supported on %s", p.name)
+		return nil
+	}
+
+	ctx, cancel := p.newContext(0)
+	defer cancel()
+	n, err := readObject(ctx, p.endpoint.s3Client, p.restoreBucketName, p.restoreObjectName)
+	s3BytesGetCounter.WithLabelValues(p.name).Add(float64(n))
+	if minio.ToErrorResponse(err).Code == "InvalidObjectState" {
+		// still archived, the restore has not completed yet
+		return nil
+	}
+	if err != nil {
+		log.Printf("Error while reading restored object (endpoint:%s): %s", p.name, err)
+		return err
+	}
+	s3RestoreReadyCounter.WithLabelValues(p.name).Inc()
+	return nil
+}
+
+// requestRestore sends a restore request, which minio-go doesn't provide, and returns its outcome
+func (p *Probe) requestRestore(ctx context.Context) (string, error) {
+	body := []byte(fmt.Sprintf(`<RestoreRequest xmlns="http://s3.amazonaws.com/doc/2006-03-01/"><Days>%d</Days></RestoreRequest>`, p.restoreDays))
+	resp, err := p.doSignedRequest(ctx, http.MethodPost, p.restoreBucketName, p.restoreObjectName, "restore", body)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if outcome, ok := restoreOutcomes[resp.StatusCode]; ok {
+		return outcome, nil
+	}
+	errorResponse := minio.ErrorResponse{StatusCode: resp.StatusCode}
+	_ = xml.NewDecoder(resp.Body).Decode(&errorResponse)
+	if errorResponse.Code == "NotImplemented" {
+		return "not_supported", nil
+	}
+	return "error", fmt.Errorf("restore request returned status %d: %s", resp.StatusCode, errorResponse.Code)
+}
@@ -0,0 +1,58 @@
+package probe
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newRestoreTestProbe(t *testing.T, restoreStatus int) Probe {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.URL.Query()["location"]; ok {
+			w.Write([]byte(`<LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/">us-east-1</LocationConstraint>`))
+			return
+		}
+		if _, ok := r.URL.Query()["restore"]; !ok || r.Method != http.MethodPost || r.Header.Get("Authorization") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(restoreStatus)
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := newMinioClientFromEndpoint(server.URL, "access", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Probe{
+		name:              "test",
+		endpoint:          S3Endpoint{Name: server.URL, s3Client: client},
+		accessKey:         "access",
+		secretKey:         "secret",
+		restoreBucketName: "archive",
+		restoreObjectName: "object",
+		restoreDays:       1,
+	}
+}
+
+func TestRequestRestoreOutcome(t *testing.T) {
+	cases := map[int]string{
+		http.StatusAccepted:       "accepted",
+		http.StatusOK:             "already_restored",
+		http.StatusConflict:       "in_progress",
+		http.StatusNotImplemented: "not_supported",
+	}
+	for status, expected := range cases {
+		p := newRestoreTestProbe(t, status)
+		outcome, err := p.requestRestore(context.Background())
+		if err != nil || outcome != expected {
+			t.Errorf("Status %d: expected %s got %s (%v)", status, expected, outcome, err)
+		}
+	}
+
+	p := newRestoreTestProbe(t, http.StatusInternalServerError)
+	if outcome, err := p.requestRestore(context.Background()); err == nil || outcome != "error" {
+		t.Errorf("Unexpected status should be an error, got %s", outcome)
+	}
+}
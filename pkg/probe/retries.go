@@ -0,0 +1,68 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/criteo/s3-probe/pkg/metrics"
+
+	minio "github.com/minio/minio-go/v7"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var s3SDKRetriesCounter = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_sdk_retries_total",
+	Help: "Total number of requests retried by the S3 SDK within operations on S3 endpoint",
+}, []string{"operation", "endpoint"})
+
+var s3RetryableErrorCounter = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_retryable_error_total",
+	Help: "Total number of operations on S3 endpoint failed with a server or transient error, worth retrying",
+}, []string{"operation", "endpoint"})
+
+var s3NonRetryableErrorCounter = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_nonretryable_error_total",
+	Help: "Total number of operations on S3 endpoint failed with a client error, which retrying wouldn't fix",
+}, []string{"operation", "endpoint"})
+
+// retryableCodes are client errors reporting a transient condition of the endpoint
+var retryableCodes = map[string]bool{
+	"RequestTimeout":      true,
+	"SlowDown":            true,
+	"Throttling":          true,
+	"ThrottlingException": true,
+	"RequestThrottled":    true,
+}
+
+// isRetryableError tells whether an operation failed with an error that a retry may fix:
+// server errors, throttling and network errors are retryable, other client errors are not
+func isRetryableError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	response := minio.ToErrorResponse(err)
+	if response.StatusCode == 0 {
+		// Errors raised by the SDK itself are argument errors, the others come from the network
+		return response.Code == ""
+	}
+	if response.StatusCode >= http.StatusInternalServerError || response.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	return retryableCodes[response.Code]
+}
+
+// countErrorRetryability counts the error of an operation as retryable or not
+func countErrorRetryability(operationName string, endpoint string, err error) {
+	if isRetryableError(err) {
+		s3RetryableErrorCounter.WithLabelValues(operationName, endpoint).Inc()
+	} else {
+		s3NonRetryableErrorCounter.WithLabelValues(operationName, endpoint).Inc()
+	}
+}
+
+// DisableSDKRetries makes the SDK send each request once, so that the latency measured
+// for an operation is the one of a single attempt. This applies to every client of the process
+func DisableSDKRetries() {
+	minio.MaxRetry = 1
+}
@@ -0,0 +1,84 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	minio "github.com/minio/minio-go/v7"
+)
+
+func TestOperationTraceCountsSDKRetries(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// fail the first attempt with a retryable error
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`<ListAllMyBucketsResult><Buckets></Buckets></ListAllMyBucketsResult>`))
+	}))
+	defer server.Close()
+
+	client, err := newMinioClientFromEndpoint(server.URL, "access", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, trace := withOperationTrace(context.Background())
+	if _, err := client.ListBuckets(ctx); err != nil {
+		t.Fatalf("Listing buckets should succeed after a retry: %s", err)
+	}
+	if trace.retryCount() != 1 {
+		t.Errorf("Expected 1 retry got %d", trace.retryCount())
+	}
+}
+
+func TestDisableSDKRetries(t *testing.T) {
+	maxRetry := minio.MaxRetry
+	defer func() { minio.MaxRetry = maxRetry }()
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	DisableSDKRetries()
+	client, err := newMinioClientFromEndpoint(server.URL, "access", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ListBuckets(context.Background()); err == nil {
+		t.Errorf("Listing buckets should fail")
+	}
+	if requests != 1 {
+		t.Errorf("Expected a single attempt got %d", requests)
+	}
+}
+
+func TestIsRetryableError(t *testing.T) {
+	cases := []struct {
+		err       error
+		retryable bool
+	}{
+		{minio.ErrorResponse{StatusCode: http.StatusServiceUnavailable, Code: "ServiceUnavailable"}, true},
+		{minio.ErrorResponse{StatusCode: http.StatusInternalServerError, Code: "InternalError"}, true},
+		{minio.ErrorResponse{StatusCode: http.StatusTooManyRequests}, true},
+		{minio.ErrorResponse{StatusCode: http.StatusBadRequest, Code: "RequestTimeout"}, true},
+		{minio.ErrorResponse{StatusCode: http.StatusForbidden, Code: "AccessDenied"}, false},
+		{minio.ErrorResponse{StatusCode: http.StatusNotFound, Code: "NoSuchBucket"}, false},
+		{minio.ErrorResponse{Code: "InvalidArgument"}, false},
+		{errors.New("connection reset by peer"), true},
+		{context.Canceled, false},
+		{nil, false},
+	}
+	for _, c := range cases {
+		if isRetryableError(c.err) != c.retryable {
+			t.Errorf("Expected retryable %t for %v", c.retryable, c.err)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package probe
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/criteo/s3-probe/pkg/config"
+)
+
+// operationSchedule runs latency operations only every Nth cycle, operations
+// without schedule run every cycle
+type operationSchedule struct {
+	cycle uint64
+	every map[string]uint64
+}
+
+// parseOperationSchedule parses a comma separated list of operation=N
+func parseOperationSchedule(value string) (*operationSchedule, error) {
+	schedule := &operationSchedule{every: map[string]uint64{}}
+	for _, element := range config.ParseList(value) {
+		parts := strings.SplitN(element, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid operation schedule %q, expected operation=N", element)
+		}
+		every, err := strconv.ParseUint(strings.TrimSpace(parts[1]), 10, 64)
+		if err != nil || every == 0 {
+			return nil, fmt.Errorf("invalid operation schedule %q, expected operation=N", element)
+		}
+		schedule.every[strings.TrimSpace(parts[0])] = every
+	}
+	return schedule, nil
+}
+
+// next returns the number of the cycle starting
+func (s *operationSchedule) next() uint64 {
+	if s == nil {
+		return 0
+	}
+	return atomic.AddUint64(&s.cycle, 1) - 1
+}
+
+// due tells whether the operation runs during the given cycle
+func (s *operationSchedule) due(operationName string, cycle uint64) bool {
+	if s == nil {
+		return true
+	}
+	every, ok := s.every[operationName]
+	return !ok || cycle%every == 0
+}
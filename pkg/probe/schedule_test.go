@@ -0,0 +1,38 @@
+package probe
+
+import "testing"
+
+func TestOperationSchedule(t *testing.T) {
+	schedule, err := parseOperationSchedule("put_object=3, remove_object=1")
+	if err != nil {
+		t.Fatalf("Schedule should be parsed: %s", err)
+	}
+	due := 0
+	for i := 0; i < 9; i++ {
+		cycle := schedule.next()
+		if schedule.due("put_object", cycle) {
+			due++
+		}
+		if !schedule.due("get_object", cycle) || !schedule.due("remove_object", cycle) {
+			t.Errorf("Operations should run every cycle unless scheduled otherwise")
+		}
+	}
+	if due != 3 {
+		t.Errorf("Expected put_object to run 3 times out of 9 got %d", due)
+	}
+}
+
+func TestOperationScheduleRejectsInvalidValues(t *testing.T) {
+	for _, value := range []string{"put_object", "put_object=0", "put_object=-1", "put_object=a"} {
+		if _, err := parseOperationSchedule(value); err == nil {
+			t.Errorf("Schedule %q should be rejected", value)
+		}
+	}
+}
+
+func TestNilOperationScheduleRunsEverything(t *testing.T) {
+	var schedule *operationSchedule
+	if !schedule.due("put_object", schedule.next()) {
+		t.Errorf("Operations should run every cycle without schedule")
+	}
+}
@@ -0,0 +1,136 @@
+package probe
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/criteo/s3-probe/pkg/metrics"
+)
+
+// runCheck runs a check in its own goroutine, tracked so that it can be awaited on shutdown.
+// The check runs on a snapshot of the probe, unaffected by the endpoint updates applied meanwhile.
+// The check is skipped, returning false, when the probe is paused or the global cap of concurrent
+// checks is reached. Checks report their errors through metrics, the returned error is ignored
+func (p *Probe) runCheck(check func(run *Probe) error) bool {
+	if p.pause.isPaused() {
+		return false
+	}
+	slots, ok := acquireGlobalCheckSlot()
+	if !ok {
+		s3GlobalChecksSkippedCounter.WithLabelValues(p.name).Inc()
+		return false
+	}
+	run, release := p.snapshot()
+	p.checks.Add(1)
+	go func() {
+		defer p.checks.Done()
+		defer releaseGlobalCheckSlot(slots)
+		defer release()
+		check(run)
+	}()
+	return true
+}
+
+// runCycle runs a check cycle updating s3_up in its own goroutine, like runCheck
+func (p *Probe) runCycle(check func(run *Probe) error) {
+	p.runCheck(func(run *Probe) error {
+		run.recordCycle(func() error {
+			return check(run)
+		})
+		return nil
+	})
+}
+
+// WaitChecks waits for the in-flight checks of the probe and the removal of the objects they created
+// to complete, up to timeout. It returns false if some were still running when the timeout expired
+func (p *Probe) WaitChecks(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		p.WaitDrained()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+	}
+	// Checks completing right at the deadline are still considered done
+	select {
+	case <-done:
+		return true
+	default:
+		return false
+	}
+}
+
+// WaitDrained waits for the in-flight checks of the probe and the removal of the objects they created,
+// without limit: the operations they run are bounded by their own timeouts
+func (p *Probe) WaitDrained() {
+	p.checks.Wait()
+	p.cleanups.Wait()
+}
+
+// DeleteMetrics deletes the series of the probe metrics labeled with the endpoint of the probe,
+// so that a removed probe doesn't leave stale series exported
+func (p *Probe) DeleteMetrics() {
+	deleted := metrics.DeleteSeries("endpoint", p.name)
+	log.Printf("Deleted %d metric series of %s", deleted, p.name)
+}
+
+// stopSignal is closed once the probe is stopped, during its preparation or once terminated
+type stopSignal struct {
+	once *sync.Once
+	done chan struct{}
+}
+
+func newStopSignal() *stopSignal {
+	return &stopSignal{once: &sync.Once{}, done: make(chan struct{})}
+}
+
+// Stop cancels the preparation of the probe and the waits of its checks and cleanups. It may be called
+// several times, the checks themselves are stopped through the control channel
+func (p *Probe) Stop() {
+	if p.stopping == nil {
+		return
+	}
+	p.stopping.once.Do(func() {
+		close(p.stopping.done)
+	})
+}
+
+// stopContext returns the context cancelled by Stop, probes without stop signal are never stopped
+func (p *Probe) stopContext() context.Context {
+	if p.stopping == nil {
+		return probeContext{}
+	}
+	return probeContext{stopped: p.stopping.done}
+}
+
+// probeContext is cancelled once the probe is stopped, it bounds the waits which must not outlive the probe.
+// It has no deadline, operations run with it still get one from newContextFrom
+type probeContext struct {
+	stopped <-chan struct{}
+}
+
+func (c probeContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (c probeContext) Done() <-chan struct{} {
+	return c.stopped
+}
+
+func (c probeContext) Err() error {
+	select {
+	case <-c.stopped:
+		return context.Canceled
+	default:
+		return nil
+	}
+}
+
+func (c probeContext) Value(key interface{}) interface{} {
+	return nil
+}
@@ -0,0 +1,62 @@
+package probe
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWaitChecksWaitsForRunningChecks(t *testing.T) {
+	p := Probe{checks: &sync.WaitGroup{}, cleanups: &sync.WaitGroup{}}
+	release := make(chan struct{})
+	p.runCheck(func(*Probe) error {
+		<-release
+		return nil
+	})
+
+	if p.WaitChecks(10 * time.Millisecond) {
+		t.Error("WaitChecks should time out while a check is running")
+	}
+	close(release)
+	if !p.WaitChecks(time.Second) {
+		t.Error("WaitChecks should return true once the checks completed")
+	}
+}
+
+func TestDeleteMetricsRemovesTheSeriesOfTheProbe(t *testing.T) {
+	s3Up.WithLabelValues("deleted").Set(1)
+	s3Up.WithLabelValues("kept").Set(1)
+	s3GatewayErrorCounter.WithLabelValues("get_object", "deleted", "destination").Inc()
+
+	p := Probe{name: "deleted"}
+	p.DeleteMetrics()
+
+	if s3Up.DeleteLabelValues("deleted") || s3GatewayErrorCounter.DeleteLabelValues("get_object", "deleted", "destination") {
+		t.Error("The series of the probe should have been deleted")
+	}
+	if !s3Up.DeleteLabelValues("kept") {
+		t.Error("The series of other probes should be kept")
+	}
+}
+
+func TestStopRemovesTheObjectsWithoutTheCleanupDelay(t *testing.T) {
+	p, requests := newLatencyTestProbe(t, nil)
+	p.cleanupDelay = time.Hour
+	p.cleanTempObject(p.endpoint.s3Client, p.latencyBucketName, "leftover")
+
+	if p.WaitChecks(10 * time.Millisecond) {
+		t.Fatal("The removal should wait for the cleanup delay")
+	}
+	p.Stop()
+	if !p.WaitChecks(time.Second) {
+		t.Fatal("The removal should not wait for the cleanup delay once the probe is stopped")
+	}
+	expected := http.MethodDelete + " /" + p.latencyBucketName + "/leftover"
+	for _, request := range requests() {
+		if request == expected {
+			return
+		}
+	}
+	t.Errorf("Expected %s in %v", expected, requests())
+}
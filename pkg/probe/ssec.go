@@ -0,0 +1,98 @@
+package probe
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+
+	"github.com/criteo/s3-probe/pkg/metrics"
+
+	minio "github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var s3SSECWrongKeyLeakCounter = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_sse_c_wrong_key_leak_total",
+	Help: "Total number of SSE-C objects on S3 endpoint read with a wrong customer key, any increase is a security issue",
+}, []string{"endpoint"})
+
+var errSSECWrongKeyLeak = errors.New("SSE-C object could be read with a wrong customer key")
+
+// isWrongKeyRejection tells whether a read failed because the customer key was refused
+func isWrongKeyRejection(err error) bool {
+	response := minio.ToErrorResponse(err)
+	switch response.Code {
+	case "AccessDenied", "InvalidArgument", "InvalidRequest":
+		return true
+	}
+	return response.StatusCode == http.StatusBadRequest || response.StatusCode == http.StatusForbidden
+}
+
+// newSSECKey returns an SSE-C encryption with a random customer key
+func newSSECKey() (encrypt.ServerSide, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return encrypt.NewSSEC(key)
+}
+
+// performSSECWrongKeyCheck uploads an object encrypted with a customer key and checks that
+// reading it with another key is refused. SSE-C requires the endpoint to be reached over HTTPS
+func (p *Probe) performSSECWrongKeyCheck() error {
+	objectName, _ := randomHex(20)
+	objectSize := int64(p.latencyItemSize)
+	objectData, _ := randomObject(objectSize)
+	defer p.cleanTempObject(p.endpoint.s3Client, p.latencyBucketName, objectName)
+
+	writeKey, err := newSSECKey()
+	if err != nil {
+		return err
+	}
+	readKey, err := newSSECKey()
+	if err != nil {
+		return err
+	}
+
+	operation := func(ctx context.Context) error {
+		_, err := p.endpoint.s3Client.PutObject(ctx, p.latencyBucketName, objectName, objectData, objectSize, minio.PutObjectOptions{ServerSideEncryption: writeKey})
+		if err == nil {
+			s3BytesPutCounter.WithLabelValues(p.name).Add(float64(objectSize))
+		}
+		return err
+	}
+	if err := p.mesureOperation("sse_c_put_object", operation); err != nil {
+		return err
+	}
+
+	// The read is expected to fail so it isn't measured as an operation
+	ctx, cancel := p.newContext(0)
+	defer cancel()
+	err = p.readWithSSECKey(ctx, objectName, readKey)
+	if err == nil {
+		s3SSECWrongKeyLeakCounter.WithLabelValues(p.name).Inc()
+		log.Printf("Error: %s (endpoint:%s, object:%s)", errSSECWrongKeyLeak, p.name, objectName)
+		return errSSECWrongKeyLeak
+	}
+	if !isWrongKeyRejection(err) {
+		log.Printf("Error while reading SSE-C object with a wrong key (endpoint:%s): %s", p.name, err)
+		return fmt.Errorf("read with a wrong SSE-C key failed for another reason: %w", err)
+	}
+	return nil
+}
+
+func (p *Probe) readWithSSECKey(ctx context.Context, objectName string, key encrypt.ServerSide) error {
+	obj, err := p.endpoint.s3Client.GetObject(ctx, p.latencyBucketName, objectName, minio.GetObjectOptions{ServerSideEncryption: key})
+	if err != nil {
+		return err
+	}
+	defer obj.Close()
+	data, err := ioutil.ReadAll(obj)
+	s3BytesGetCounter.WithLabelValues(p.name).Add(float64(len(data)))
+	return err
+}
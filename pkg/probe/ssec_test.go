@@ -0,0 +1,27 @@
+package probe
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	minio "github.com/minio/minio-go/v7"
+)
+
+func TestIsWrongKeyRejection(t *testing.T) {
+	cases := []struct {
+		err      error
+		rejected bool
+	}{
+		{minio.ErrorResponse{StatusCode: http.StatusForbidden, Code: "AccessDenied"}, true},
+		{minio.ErrorResponse{StatusCode: http.StatusBadRequest, Code: "InvalidArgument"}, true},
+		{minio.ErrorResponse{StatusCode: http.StatusBadRequest}, true},
+		{minio.ErrorResponse{StatusCode: http.StatusInternalServerError, Code: "InternalError"}, false},
+		{errors.New("connection reset by peer"), false},
+	}
+	for _, c := range cases {
+		if isWrongKeyRejection(c.err) != c.rejected {
+			t.Errorf("Expected rejection %t for %v", c.rejected, c.err)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package probe
+
+import (
+	"sync"
+	"time"
+)
+
+// Status is the state of a probe as reported by the status endpoint
+type Status struct {
+	// LastCheck is the end of the last check cycle, zero before the first one
+	LastCheck time.Time
+	// LastError is the error of the last check cycle, empty if it succeeded
+	LastError string
+	Preparing bool
+	Paused    bool
+}
+
+// cycleStatus holds the outcome of the last check cycle of a probe
+type cycleStatus struct {
+	mu        sync.Mutex
+	lastCheck time.Time
+	lastError string
+}
+
+func (s *cycleStatus) record(now time.Time, err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastCheck = now
+	s.lastError = ""
+	if err != nil {
+		s.lastError = err.Error()
+	}
+}
+
+// Status returns the outcome of the last check cycle and whether the probe is preparing its buckets or paused
+func (p *Probe) Status() Status {
+	status := Status{Preparing: p.preparation.isPreparing(), Paused: p.pause.isPaused()}
+	if p.lastCycle != nil {
+		p.lastCycle.mu.Lock()
+		status.LastCheck = p.lastCycle.lastCheck
+		status.LastError = p.lastCycle.lastError
+		p.lastCycle.mu.Unlock()
+	}
+	return status
+}
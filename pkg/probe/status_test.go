@@ -0,0 +1,37 @@
+package probe
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStatusReportsTheLastCycle(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	p := Probe{name: "status", clock: clock, upState: newUpState(1, 1), lastCycle: &cycleStatus{}, preparation: &preparationState{}}
+	if status := p.Status(); !status.LastCheck.IsZero() || status.LastError != "" {
+		t.Errorf("No cycle should be reported before the first one, got %+v", status)
+	}
+
+	p.recordCycle(func() error { return errors.New("get_object failed") })
+	if status := p.Status(); !status.LastCheck.Equal(time.Unix(1000, 0)) || status.LastError != "get_object failed" {
+		t.Errorf("Expected the failed cycle to be reported, got %+v", status)
+	}
+
+	clock.advance(time.Minute)
+	p.recordCycle(func() error { return nil })
+	if status := p.Status(); !status.LastCheck.Equal(time.Unix(1060, 0)) || status.LastError != "" {
+		t.Errorf("Expected the successful cycle to be reported, got %+v", status)
+	}
+
+	p.recordCycle(func() error { return errGlobalRateLimited })
+	if status := p.Status(); status.LastError != "" {
+		t.Errorf("Rate limited cycles should not be reported, got %+v", status)
+	}
+
+	p.setPreparing(true)
+	if !p.Status().Preparing {
+		t.Error("Expected the preparation to be reported")
+	}
+	p.setPreparing(false)
+}
@@ -0,0 +1,57 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/criteo/s3-probe/pkg/metrics"
+
+	minio "github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/tags"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var s3ObjectTaggingMismatchCounter = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_object_tagging_mismatch_total",
+	Help: "Total number of objects whose tags read back differ from the tags set by the tagging check",
+}, []string{"endpoint"})
+
+// performObjectTaggingCheck sets a tag with a random value on the latency object and checks
+// that reading the tags of the object returns exactly that tag
+func (p *Probe) performObjectTaggingCheck(objectName string) error {
+	value, _ := randomHex(16)
+	expected := map[string]string{"s3-probe": value}
+	objectTags, err := tags.MapToObjectTags(expected)
+	if err != nil {
+		return err
+	}
+
+	operation := func(ctx context.Context) error {
+		return p.endpoint.s3Client.PutObjectTagging(ctx, p.latencyBucketName, objectName, objectTags, minio.PutObjectTaggingOptions{})
+	}
+	if err := p.mesureOperation("put_object_tagging", operation); err != nil {
+		return err
+	}
+
+	var actual map[string]string
+	operation = func(ctx context.Context) error {
+		objectTags, err := p.endpoint.s3Client.GetObjectTagging(ctx, p.latencyBucketName, objectName, minio.GetObjectTaggingOptions{})
+		if err != nil {
+			return err
+		}
+		actual = objectTags.ToMap()
+		return nil
+	}
+	if err := p.mesureOperation("get_object_tagging", operation); err != nil {
+		return err
+	}
+
+	if len(actual) != len(expected) || actual["s3-probe"] != value {
+		s3ObjectTaggingMismatchCounter.WithLabelValues(p.name).Inc()
+		err := fmt.Errorf("tags of %s are %v instead of %v", objectName, actual, expected)
+		log.Printf("Error while checking object tagging (endpoint:%s): %s", p.name, err)
+		return err
+	}
+	return nil
+}
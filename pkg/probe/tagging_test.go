@@ -0,0 +1,53 @@
+package probe
+
+import (
+	"net/http"
+	"testing"
+
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+// newTaggingTestProbe returns a probe whose endpoint answers tagging requests with the tags
+// set on the object, or with tags when they are given
+func newTaggingTestProbe(t *testing.T, tags string) (Probe, func() []string) {
+	stored := ""
+	p, requests := newLatencyTestProbe(t, func(w http.ResponseWriter, r *http.Request) bool {
+		if _, ok := r.URL.Query()["tagging"]; !ok {
+			return false
+		}
+		if r.Method == http.MethodPut {
+			stored = string(readBody(r))
+			return true
+		}
+		if tags != "" {
+			stored = tags
+		}
+		w.Write([]byte(stored))
+		return true
+	})
+	p.taggingCheck = true
+	return p, requests
+}
+
+func TestPerformObjectTaggingCheck(t *testing.T) {
+	p, requests := newTaggingTestProbe(t, "")
+	if err := p.performLatencyChecks(); err != nil {
+		t.Fatal(err)
+	}
+	// The tags are set and read between the stat and the read of the object
+	if expected := "GET,PUT,HEAD,PUT,GET,GET,PUT,HEAD,DELETE,DELETE,DELETE"; operations(requests()) != expected {
+		t.Errorf("Expected requests %s got %v", expected, requests())
+	}
+}
+
+func TestPerformObjectTaggingCheckMismatch(t *testing.T) {
+	p, _ := newTaggingTestProbe(t, `<Tagging><TagSet><Tag><Key>s3-probe</Key><Value>stale</Value></Tag></TagSet></Tagging>`)
+	if err := p.performLatencyChecks(); err == nil {
+		t.Fatal("Latency checks should fail when tags are not read back")
+	}
+	metric := &io_prometheus_client.Metric{}
+	s3ObjectTaggingMismatchCounter.WithLabelValues(p.name).Write(metric)
+	if *metric.Counter.Value != 1 {
+		t.Errorf("Expected 1 tagging mismatch got %f", *metric.Counter.Value)
+	}
+}
@@ -0,0 +1,66 @@
+package probe
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/criteo/s3-probe/pkg/metrics"
+
+	minio "github.com/minio/minio-go/v7"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var s3ConcurrentGetThroughput = metrics.Factory.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "s3_concurrent_get_throughput_bytes_per_second",
+	Help: "Aggregate read throughput of the last concurrent GET check",
+}, []string{"endpoint"})
+
+// performConcurrentGetCheck reads the same object with concurrent GETs to measure
+// the aggregate read throughput, each GET latency is reported as concurrent_get_object
+func (p *Probe) performConcurrentGetCheck() error {
+	objectName, _ := randomHex(20)
+	objectSize := int64(p.latencyItemSize)
+	objectData, _ := randomObject(objectSize)
+	defer p.cleanTempObject(p.endpoint.s3Client, p.latencyBucketName, objectName)
+
+	ctx, cancel := p.newContext(0)
+	defer cancel()
+	_, err := p.endpoint.s3Client.PutObject(ctx, p.latencyBucketName, objectName, objectData, objectSize, minio.PutObjectOptions{})
+	if err != nil {
+		log.Printf("Error while uploading object for concurrent GET check (endpoint:%s): %s", p.name, err)
+		return err
+	}
+	s3BytesPutCounter.WithLabelValues(p.name).Add(float64(objectSize))
+
+	var bytesRead int64
+	var wg sync.WaitGroup
+	errs := make(chan error, p.concurrentGets)
+	start := time.Now()
+	for i := 0; i < p.concurrentGets; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			operation := func(ctx context.Context) error {
+				n, err := readObject(ctx, p.endpoint.s3Client, p.latencyBucketName, objectName)
+				atomic.AddInt64(&bytesRead, n)
+				s3BytesGetCounter.WithLabelValues(p.name).Add(float64(n))
+				return err
+			}
+			if err := p.mesureOperation("concurrent_get_object", operation); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	close(errs)
+
+	if err := <-errs; err != nil {
+		return err
+	}
+	s3ConcurrentGetThroughput.WithLabelValues(p.name).Set(float64(bytesRead) / elapsed.Seconds())
+	return nil
+}
@@ -0,0 +1,144 @@
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/criteo/s3-probe/pkg/config"
+)
+
+// transportOptions are the settings of the transport of the clients of a probe
+type transportOptions struct {
+	forceHTTP1 bool
+	// connectTimeout bounds the dial and the TLS handshake, the SDK defaults are kept when zero
+	connectTimeout time.Duration
+	// tlsConfig replaces the TLS configuration of the SDK, e.g. for mTLS through the Consul Connect mesh
+	tlsConfig *tls.Config
+}
+
+func newTransportOptions(cfg *config.Config) transportOptions {
+	return transportOptions{forceHTTP1: *cfg.ForceHTTP1, connectTimeout: *cfg.ConnectTimeout}
+}
+
+func (o transportOptions) apply(transport *http.Transport) {
+	if o.forceHTTP1 {
+		disableHTTP2(transport)
+	}
+	if o.connectTimeout > 0 {
+		transport.DialContext = (&net.Dialer{
+			Timeout:   o.connectTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext
+		transport.TLSHandshakeTimeout = o.connectTimeout
+	}
+	if o.tlsConfig != nil {
+		transport.TLSClientConfig = o.tlsConfig.Clone()
+	}
+}
+
+type operationTraceKey struct{}
+
+// operationIDHeader carries the identifier generated by the probe for each operation,
+// so that failures can be found in the access logs of the endpoint
+const operationIDHeader = "X-Probe-Operation-Id"
+
+// operationTrace records the requests sent and the responses received by the SDK during an operation
+type operationTrace struct {
+	id       string
+	mu       sync.Mutex
+	sent     map[string]bool
+	retries  int
+	date     string
+	protocol string
+	// requestID is the identifier of the last response returned by the endpoint
+	requestID string
+}
+
+// withOperationTrace returns a context tracing the requests sent with it
+func withOperationTrace(ctx context.Context) (context.Context, *operationTrace) {
+	id, _ := randomHex(8)
+	trace := &operationTrace{id: id, sent: map[string]bool{}}
+	return context.WithValue(ctx, operationTraceKey{}, trace), trace
+}
+
+// traceFromContext returns the trace of the operation, nil if the context isn't traced
+func traceFromContext(ctx context.Context) *operationTrace {
+	trace, _ := ctx.Value(operationTraceKey{}).(*operationTrace)
+	return trace
+}
+
+// recordRequest counts requests sent more than once, which are the retries performed internally by the SDK
+func (t *operationTrace) recordRequest(req *http.Request) {
+	key := req.Method + " " + req.URL.String()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.sent[key] {
+		t.retries++
+	}
+	t.sent[key] = true
+}
+
+func (t *operationTrace) recordResponse(resp *http.Response) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.date = resp.Header.Get("Date")
+	t.protocol = resp.Proto
+	if requestID := resp.Header.Get("X-Amz-Request-Id"); requestID != "" {
+		t.requestID = requestID
+	}
+}
+
+// lastRequestID returns the identifier of the last response, empty for an untraced operation
+func (t *operationTrace) lastRequestID() string {
+	if t == nil {
+		return ""
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.requestID
+}
+
+// operationID returns the identifier generated for the operation, empty for an untraced operation
+func (t *operationTrace) operationID() string {
+	if t == nil {
+		return ""
+	}
+	return t.id
+}
+
+func (t *operationTrace) retryCount() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.retries
+}
+
+// responseDate returns the Date header of the last response
+func (t *operationTrace) responseDate() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.date
+}
+
+// instrumentedTransport traces the requests sent with a traced context
+type instrumentedTransport struct {
+	transport http.RoundTripper
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	trace := traceFromContext(req.Context())
+	if trace != nil {
+		trace.recordRequest(req)
+		// The header isn't signed, the request is cloned as a RoundTripper must not modify it
+		req = req.Clone(req.Context())
+		req.Header.Set(operationIDHeader, trace.id)
+	}
+	resp, err := t.transport.RoundTrip(req)
+	if trace != nil && err == nil {
+		trace.recordResponse(resp)
+	}
+	return resp, err
+}
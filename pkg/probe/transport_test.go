@@ -0,0 +1,64 @@
+package probe
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOperationTraceIdentifiers(t *testing.T) {
+	var operationIDs []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		operationIDs = append(operationIDs, r.Header.Get(operationIDHeader))
+		w.Header().Set("X-Amz-Request-Id", "16A8B2C3D4E5F607")
+		w.Write([]byte(`<ListAllMyBucketsResult><Buckets></Buckets></ListAllMyBucketsResult>`))
+	}))
+	defer server.Close()
+
+	client, err := newMinioClientFromEndpoint(server.URL, "access", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, trace := withOperationTrace(context.Background())
+	if _, err := client.ListBuckets(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if trace.operationID() == "" || len(operationIDs) != 1 || operationIDs[0] != trace.operationID() {
+		t.Errorf("Expected operation ID %q to be sent, got %v", trace.operationID(), operationIDs)
+	}
+	if trace.lastRequestID() != "16A8B2C3D4E5F607" {
+		t.Errorf("Expected request ID of the response got %q", trace.lastRequestID())
+	}
+
+	var untraced *operationTrace
+	if untraced.operationID() != "" || untraced.lastRequestID() != "" {
+		t.Errorf("Untraced operations should have no identifiers")
+	}
+}
+
+func TestEndpointHTTPClientIsInstrumented(t *testing.T) {
+	var operationID string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		operationID = r.Header.Get(operationIDHeader)
+	}))
+	defer server.Close()
+
+	endpoint, err := newS3Endpoint(server.URL, "access", "secret", transportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, trace := withOperationTrace(context.Background())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := endpoint.httpClient().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if operationID != trace.operationID() {
+		t.Errorf("Raw requests should go through the transport of the endpoint, got operation ID %q", operationID)
+	}
+}
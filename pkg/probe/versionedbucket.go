@@ -0,0 +1,113 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"log"
+
+	minio "github.com/minio/minio-go/v7"
+)
+
+// performVersioningRoundTripCheck writes two versions of the same key to the versioned bucket, reads the
+// first one back by its version id and removes it, each step being measured as its own operation
+func (p *Probe) performVersioningRoundTripCheck() error {
+	objectName, _ := randomHex(20)
+	objectSize := int64(p.latencyItemSize)
+
+	versions := [][]byte{}
+	versionIDs := []string{}
+	defer func() {
+		for _, versionID := range versionIDs {
+			p.removeObjectVersion(objectName, versionID)
+		}
+	}()
+	for i := 0; i < 2; i++ {
+		content := make([]byte, objectSize)
+		_, _ = rand.Read(content)
+		versionID := ""
+		operation := func(ctx context.Context) error {
+			info, err := p.endpoint.s3Client.PutObject(ctx, p.versionedBucketName, objectName, bytes.NewReader(content), objectSize, minio.PutObjectOptions{})
+			if err != nil {
+				return err
+			}
+			s3BytesPutCounter.WithLabelValues(p.name).Add(float64(objectSize))
+			if info.VersionID == "" {
+				// the object is still written, it is removed like any object of an unversioned bucket
+				versionIDs = append(versionIDs, "")
+				return fmt.Errorf("no version id returned for %s, versioning is not enabled on bucket %s", objectName, p.versionedBucketName)
+			}
+			versionID = info.VersionID
+			return nil
+		}
+		if err := p.mesureOperation("put_object_version", operation); err != nil {
+			return err
+		}
+		versions = append(versions, content)
+		versionIDs = append(versionIDs, versionID)
+	}
+	if versionIDs[0] == versionIDs[1] {
+		err := fmt.Errorf("both versions of %s have the version id %s", objectName, versionIDs[0])
+		log.Printf("Error while checking versioning (endpoint:%s): %s", p.name, err)
+		return err
+	}
+
+	operation := func(ctx context.Context) error {
+		obj, err := p.endpoint.s3Client.GetObject(ctx, p.versionedBucketName, objectName, minio.GetObjectOptions{VersionID: versionIDs[0]})
+		if err != nil {
+			return err
+		}
+		defer obj.Close()
+		content, err := ioutil.ReadAll(obj)
+		s3BytesGetCounter.WithLabelValues(p.name).Add(float64(len(content)))
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(content, versions[0]) {
+			return fmt.Errorf("version %s of %s doesn't have the content it was written with", versionIDs[0], objectName)
+		}
+		return nil
+	}
+	if err := p.mesureOperation("get_object_version", operation); err != nil {
+		return err
+	}
+
+	operation = func(ctx context.Context) error {
+		return p.endpoint.s3Client.RemoveObject(ctx, p.versionedBucketName, objectName, minio.RemoveObjectOptions{VersionID: versionIDs[0]})
+	}
+	if err := p.mesureOperation("remove_object_version", operation); err != nil {
+		return err
+	}
+	versionIDs = versionIDs[1:]
+	return nil
+}
+
+// removeObjectVersion removes a version left behind by the versioning round-trip check
+func (p *Probe) removeObjectVersion(objectName string, versionID string) {
+	ctx, cancel := p.newContext(0)
+	defer cancel()
+	_ = p.endpoint.s3Client.RemoveObject(ctx, p.versionedBucketName, objectName, minio.RemoveObjectOptions{VersionID: versionID})
+}
+
+// prepareVersionedBucket creates the bucket of the versioning round-trip check and enables its versioning
+func (p *Probe) prepareVersionedBucket(parent context.Context) error {
+	ctx, cancel := p.newContextFrom(parent, 0)
+	defer cancel()
+	exists, err := p.endpoint.s3Client.BucketExists(ctx, p.versionedBucketName)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		log.Printf("Preparing versioned bucket on %s", p.name)
+		if err := makeBucket(ctx, p.endpoint.s3Client, p.versionedBucketName); err != nil {
+			return err
+		}
+	}
+	versioning, err := p.endpoint.s3Client.GetBucketVersioning(ctx, p.versionedBucketName)
+	if err != nil || versioning.Status == "Enabled" {
+		return err
+	}
+	return p.endpoint.s3Client.EnableVersioning(ctx, p.versionedBucketName)
+}
@@ -0,0 +1,75 @@
+package probe
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/criteo/s3-probe/pkg/config"
+)
+
+// newVersionedTestProbe returns a probe whose versioned bucket keeps every version written,
+// returning no version id when versioning is disabled
+func newVersionedTestProbe(t *testing.T, versioning bool) (Probe, map[string][]byte, func() []string) {
+	versions := map[string][]byte{}
+	p, requests := newLatencyTestProbe(t, func(w http.ResponseWriter, r *http.Request) bool {
+		versionID := r.URL.Query().Get("versionId")
+		switch r.Method {
+		case http.MethodPut:
+			content := readBody(r)
+			if versioning {
+				versionID = fmt.Sprintf("v%d", len(versions)+1)
+				versions[versionID] = content
+				w.Header().Set("x-amz-version-id", versionID)
+			}
+			w.Header().Set("ETag", `"object"`)
+		case http.MethodGet:
+			content, ok := versions[versionID]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return true
+			}
+			w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+			w.Header().Set("Last-Modified", "Tue, 01 Jun 2021 10:00:00 GMT")
+			w.Header().Set("ETag", `"object"`)
+			w.Write(content)
+		case http.MethodDelete:
+			delete(versions, versionID)
+			w.WriteHeader(http.StatusNoContent)
+		}
+		return true
+	})
+	p.versionedBucketName = "versioned"
+	return p, versions, requests
+}
+
+func TestPerformVersioningRoundTripCheck(t *testing.T) {
+	p, versions, _ := newVersionedTestProbe(t, true)
+	if err := p.performVersioningRoundTripCheck(); err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 0 {
+		t.Errorf("Expected all versions to be removed got %v", versions)
+	}
+}
+
+func TestPerformVersioningRoundTripCheckWithoutVersioning(t *testing.T) {
+	p, _, requests := newVersionedTestProbe(t, false)
+	if err := p.performVersioningRoundTripCheck(); err == nil {
+		t.Error("Versioning round-trip should fail when no version id is returned")
+	}
+	if operations(requests()) != "PUT,DELETE" {
+		t.Errorf("The object written without version id should be removed, got %v", requests())
+	}
+}
+
+func TestNewProbeRejectsVersioningTheOtherBuckets(t *testing.T) {
+	cfg := config.GetTestConfig()
+	for _, bucket := range []string{*cfg.LatencyBucketName, *cfg.DurabilityBucketName} {
+		versioned := bucket
+		cfg.VersionedBucket = &versioned
+		if _, err := NewProbe(S3Service{Name: "versioned"}, "127.0.0.1:9000", []S3Endpoint{}, &cfg, make(chan bool)); err == nil {
+			t.Errorf("The versioned bucket should not be the bucket %s", bucket)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package probe
+
+import (
+	"context"
+	"log"
+
+	"github.com/criteo/s3-probe/pkg/metrics"
+
+	minio "github.com/minio/minio-go/v7"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var s3BucketVersioningMatches = metrics.Factory.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "s3_bucket_versioning_matches",
+	Help: "Whether the versioning status of the bucket matches the expected one (1) or not (0)",
+}, []string{"endpoint", "bucket"})
+
+// performVersioningCheck compares the versioning status of the durability bucket with the expected one
+func (p *Probe) performVersioningCheck() error {
+	ctx, cancel := p.newContext(0)
+	defer cancel()
+	versioning, err := p.durabilityClient().GetBucketVersioning(ctx, p.durabilityBucketName)
+	if err != nil {
+		log.Printf("Error while getting bucket versioning (endpoint:%s, bucket:%s): %s", p.name, p.durabilityBucketName, err)
+		return err
+	}
+
+	if versioning.Status != p.expectedVersioning {
+		log.Printf("Versioning of bucket %s on %s is '%s' instead of '%s'", p.durabilityBucketName, p.name, versioning.Status, p.expectedVersioning)
+		s3BucketVersioningMatches.WithLabelValues(p.name, p.durabilityBucketName).Set(0)
+		return nil
+	}
+	s3BucketVersioningMatches.WithLabelValues(p.name, p.durabilityBucketName).Set(1)
+	return nil
+}
+
+// prepareVersioning sets the expected versioning status on the durability bucket
+func (p *Probe) prepareVersioning(parent context.Context) error {
+	ctx, cancel := p.newContextFrom(parent, 0)
+	defer cancel()
+	versioning, err := p.durabilityClient().GetBucketVersioning(ctx, p.durabilityBucketName)
+	if err != nil {
+		return err
+	}
+	if versioning.Status == p.expectedVersioning {
+		return nil
+	}
+	log.Printf("Setting versioning of bucket %s on %s to '%s'", p.durabilityBucketName, p.name, p.expectedVersioning)
+	return p.durabilityClient().SetBucketVersioning(ctx, p.durabilityBucketName, minio.BucketVersioningConfiguration{Status: p.expectedVersioning})
+}
@@ -0,0 +1,53 @@
+package probe
+
+import (
+	"sync/atomic"
+
+	"github.com/criteo/s3-probe/pkg/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var s3LatencyWarmupHistogram = metrics.Factory.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "s3_latency_warmup_histogram_seconds",
+	Help:    "Latency for operation on the S3 endpoint during the warm-up cycles of a probe",
+	Buckets: []float64{.001, .0025, .005, .010, .015, .020, .025, .030, .040, .050, .060, .075, .100, .250, .500, 1, 2.5, 5, 10, 15, 30, 45, 60},
+}, []string{"operation", "endpoint"})
+
+// warmupState counts the check cycles completed by a probe so that the
+// operations of its first cycles are kept out of the main latency histogram
+type warmupState struct {
+	cycles    uint64
+	completed uint64
+}
+
+func newWarmupState(cycles int) *warmupState {
+	if cycles < 0 {
+		cycles = 0
+	}
+	return &warmupState{cycles: uint64(cycles)}
+}
+
+// active tells whether the probe is still warming up
+func (s *warmupState) active() bool {
+	if s == nil {
+		return false
+	}
+	return atomic.LoadUint64(&s.completed) < s.cycles
+}
+
+// cycleCompleted records the end of a check cycle
+func (s *warmupState) cycleCompleted() {
+	if s == nil {
+		return
+	}
+	atomic.AddUint64(&s.completed, 1)
+}
+
+// reset starts the warm-up again, e.g. once the probe switched to new connections
+func (s *warmupState) reset() {
+	if s == nil {
+		return
+	}
+	atomic.StoreUint64(&s.completed, 0)
+}
@@ -0,0 +1,39 @@
+package probe
+
+import (
+	"testing"
+)
+
+func TestWarmupEndsAfterConfiguredCycles(t *testing.T) {
+	s := newWarmupState(2)
+	for i := 0; i < 2; i++ {
+		if !s.active() {
+			t.Fatalf("Expected warm-up to be active after %d cycles", i)
+		}
+		s.cycleCompleted()
+	}
+	if s.active() {
+		t.Errorf("Expected warm-up to be over after 2 cycles")
+	}
+}
+
+func TestNoWarmupByDefault(t *testing.T) {
+	if newWarmupState(0).active() {
+		t.Errorf("Expected no warm-up without cycles")
+	}
+	var s *warmupState
+	if s.active() {
+		t.Errorf("Expected no warm-up without state")
+	}
+}
+
+func TestWarmupRestartsOnReset(t *testing.T) {
+	s := newWarmupState(1)
+	s.cycleCompleted()
+	s.reset()
+	if !s.active() {
+		t.Errorf("Expected warm-up to be active again after a reset")
+	}
+	var nilState *warmupState
+	nilState.reset()
+}
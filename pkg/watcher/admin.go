@@ -0,0 +1,82 @@
+package watcher
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// ServeProbeAdmin pauses or resumes the scheduled checks of a watched service on
+// POST /probes/{name}/pause and POST /probes/{name}/resume. The pause is kept when the probe
+// of the service is recreated. Requests must carry the -admin-token as Bearer token when set
+func (w *Watcher) ServeProbeAdmin(rw http.ResponseWriter, r *http.Request) {
+	if !w.allowAdmin(rw, r) {
+		return
+	}
+	// Service names read from a discovery file may contain slashes, the action is the last element
+	path := strings.TrimPrefix(r.URL.Path, "/probes/")
+	separator := strings.LastIndex(path, "/")
+	if separator <= 0 {
+		http.Error(rw, "expected /probes/{name}/pause or /probes/{name}/resume", http.StatusNotFound)
+		return
+	}
+	serviceName, action := path[:separator], path[separator+1:]
+
+	if action != "pause" && action != "resume" {
+		http.Error(rw, "unknown action: "+action, http.StatusNotFound)
+		return
+	}
+
+	w.mu.Lock()
+	ws, ok := w.watchedServices[serviceName]
+	if ok && ws.probe != nil {
+		if action == "pause" {
+			w.paused[serviceName] = true
+			ws.probe.Pause()
+		} else {
+			delete(w.paused, serviceName)
+			ws.probe.Resume()
+		}
+	}
+	w.mu.Unlock()
+	if !ok || ws.probe == nil {
+		http.Error(rw, "unknown service: "+serviceName, http.StatusNotFound)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	response := map[string]interface{}{"service": serviceName, "paused": ws.probe.Status().Paused}
+	if err := json.NewEncoder(rw).Encode(response); err != nil {
+		log.Printf("Error while writing pause state of %s: %s", serviceName, err)
+	}
+}
+
+// allowAdmin rejects the requests of the endpoints acting on the probes which are not
+// an authorized POST, so that a crawler or a scrape target cannot trigger them
+func (w *Watcher) allowAdmin(rw http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		rw.Header().Set("Allow", http.MethodPost)
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	if !w.authorized(r) {
+		rw.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(rw, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// authorized tells whether a request carries the admin token, any request is when no token is set
+func (w *Watcher) authorized(r *http.Request) bool {
+	w.mu.Lock()
+	token := *w.cfg.AdminToken
+	w.mu.Unlock()
+	if token == "" {
+		return true
+	}
+	expected := "Bearer " + token
+	return subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(expected)) == 1
+}
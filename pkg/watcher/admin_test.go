@@ -0,0 +1,105 @@
+package watcher
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/criteo/s3-probe/pkg/config"
+	"github.com/criteo/s3-probe/pkg/probe"
+)
+
+func TestServeProbeAdminPausesAndResumes(t *testing.T) {
+	cfg := config.GetTestConfig()
+	service := probe.S3Service{Name: "s3-am5/10.0.0.1:80", Endpoint: "10.0.0.1:80"}
+	p, err := probe.NewProbe(service, service.Endpoint, []probe.S3Endpoint{}, &cfg, make(chan bool))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := Watcher{cfg: &cfg, watchedServices: map[string]watchedService{service.Name: {service: service, probe: &p}}, paused: map[string]bool{}}
+
+	rec := httptest.NewRecorder()
+	w.ServeProbeAdmin(rec, httptest.NewRequest("POST", "/probes/s3-am5/10.0.0.1:80/pause", nil))
+	if rec.Code != http.StatusOK || !p.Status().Paused {
+		t.Fatalf("Expected the probe to be paused, got %d %s", rec.Code, rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	w.ServeProbeAdmin(rec, httptest.NewRequest("POST", "/probes/s3-am5/10.0.0.1:80/resume", nil))
+	if rec.Code != http.StatusOK || p.Status().Paused {
+		t.Fatalf("Expected the probe to be resumed, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestServeProbeAdminRejectsInvalidRequests(t *testing.T) {
+	cfg := config.GetTestConfig()
+	w := Watcher{cfg: &cfg, watchedServices: map[string]watchedService{}}
+	requests := []struct {
+		method string
+		target string
+		code   int
+	}{
+		{"GET", "/probes/test/pause", http.StatusMethodNotAllowed},
+		{"POST", "/probes/unknown/pause", http.StatusNotFound},
+		{"POST", "/probes/pause", http.StatusNotFound},
+	}
+	for _, request := range requests {
+		rec := httptest.NewRecorder()
+		w.ServeProbeAdmin(rec, httptest.NewRequest(request.method, request.target, nil))
+		if rec.Code != request.code {
+			t.Errorf("%s %s: expected %d got %d", request.method, request.target, request.code, rec.Code)
+		}
+	}
+}
+
+func TestServeProbeAdminRequiresTheAdminToken(t *testing.T) {
+	cfg := config.GetTestConfig()
+	token := "secret"
+	cfg.AdminToken = &token
+	service := probe.S3Service{Name: "s3-par", Endpoint: "10.0.0.1:80"}
+	p, err := probe.NewProbe(service, service.Endpoint, []probe.S3Endpoint{}, &cfg, make(chan bool))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := Watcher{cfg: &cfg, watchedServices: map[string]watchedService{service.Name: {service: service, probe: &p}}, paused: map[string]bool{}}
+
+	for _, authorization := range []string{"", "Bearer wrong", "secret"} {
+		rec := httptest.NewRecorder()
+		request := httptest.NewRequest("POST", "/probes/s3-par/pause", nil)
+		request.Header.Set("Authorization", authorization)
+		w.ServeProbeAdmin(rec, request)
+		if rec.Code != http.StatusUnauthorized || p.Status().Paused {
+			t.Errorf("Authorization %q: expected 401 got %d", authorization, rec.Code)
+		}
+	}
+	rec := httptest.NewRecorder()
+	request := httptest.NewRequest("POST", "/probes/s3-par/pause", nil)
+	request.Header.Set("Authorization", "Bearer secret")
+	w.ServeProbeAdmin(rec, request)
+	if rec.Code != http.StatusOK || !p.Status().Paused {
+		t.Errorf("Expected the probe to be paused with the admin token, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestPauseIsKeptWhenTheProbeIsRecreated(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if _, ok := r.URL.Query()["location"]; ok {
+			rw.Write([]byte(`<LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/">us-east-1</LocationConstraint>`))
+		}
+	}))
+	defer server.Close()
+	cfg := config.GetTestConfig()
+	rate := 0
+	cfg.DurabilityProbeRatePerMin = &rate
+	w := Watcher{cfg: &cfg, watchedServices: map[string]watchedService{}, paused: map[string]bool{"s3-par": true}}
+
+	w.createNewProbes([]probe.S3Service{{Name: "s3-par", Endpoint: strings.TrimPrefix(server.URL, "http://")}})
+	ws, ok := w.watchedServices["s3-par"]
+	if !ok {
+		t.Fatal("Expected the probe to be created")
+	}
+	defer w.flushOldProbes([]probe.S3Service{ws.service})
+	if !ws.probe.Status().Paused {
+		t.Error("The probe of a paused service should be created paused")
+	}
+}
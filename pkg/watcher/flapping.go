@@ -0,0 +1,125 @@
+package watcher
+
+import (
+	"log"
+	"time"
+
+	"github.com/criteo/s3-probe/pkg/metrics"
+	"github.com/criteo/s3-probe/pkg/probe"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var probeFlappingGauge = metrics.Factory.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "s3_probe_flapping",
+	Help: "Whether the discovered description of the service changes on consecutive discoveries (1) or not (0)",
+}, []string{"service"})
+
+// flapState is the discovery history of a service
+type flapState struct {
+	last        probe.S3Service
+	changes     int
+	stableSince time.Time
+	flapping    bool
+	// missing is set while the service isn't discovered anymore
+	missing bool
+}
+
+// changed records whether the service changed on the last discovery and updates its flapping state
+func (s *flapState) changed(changed bool, window time.Duration, now time.Time) {
+	if changed {
+		s.changes++
+		s.stableSince = now
+	} else {
+		s.changes = 0
+	}
+	if s.changes >= 2 {
+		s.flapping = true
+	} else if s.changes == 0 && now.Sub(s.stableSince) >= window {
+		s.flapping = false
+	}
+}
+
+// flapDetector spots services whose description changes on consecutive discoveries,
+// which would otherwise recreate their probe on every cycle
+type flapDetector struct {
+	states map[string]*flapState
+}
+
+// observe records the services of a discovery. A service is flapping once it changed on two
+// consecutive discoveries and stays so until its description is stable for window. A service
+// no longer discovered counts as a change, its state is kept until it has been gone for window
+func (d *flapDetector) observe(services []probe.S3Service, window time.Duration, now time.Time) {
+	if d.states == nil {
+		d.states = map[string]*flapState{}
+	}
+	seen := map[string]bool{}
+	for i := range services {
+		service := services[i]
+		seen[service.Name] = true
+		state, ok := d.states[service.Name]
+		if !ok {
+			d.states[service.Name] = &flapState{last: service, stableSince: now}
+			probeFlappingGauge.WithLabelValues(service.Name).Set(0)
+			continue
+		}
+		state.changed(state.missing || !state.last.Equals(&service), window, now)
+		state.last = service
+		state.missing = false
+		d.report(service.Name, state)
+	}
+	for name, state := range d.states {
+		if seen[name] {
+			continue
+		}
+		if !state.missing {
+			state.missing = true
+			state.changed(true, window, now)
+			d.report(name, state)
+		} else if now.Sub(state.stableSince) >= window {
+			delete(d.states, name)
+			probeFlappingGauge.DeleteLabelValues(name)
+		}
+	}
+}
+
+// report exports the flapping state of a service
+func (d *flapDetector) report(name string, state *flapState) {
+	if state.flapping {
+		probeFlappingGauge.WithLabelValues(name).Set(1)
+	} else {
+		probeFlappingGauge.WithLabelValues(name).Set(0)
+	}
+}
+
+// isFlapping tells whether the service is currently flapping
+func (d *flapDetector) isFlapping(name string) bool {
+	state, ok := d.states[name]
+	return ok && state.flapping
+}
+
+// dampRecreations drops the recreation of flapping services, i.e. services both added and
+// removed, so that their running probe is kept until their description is stable
+func (d *flapDetector) dampRecreations(servicesToAdd []probe.S3Service, servicesToRemove []probe.S3Service) ([]probe.S3Service, []probe.S3Service) {
+	removed := map[string]bool{}
+	for _, s := range servicesToRemove {
+		removed[s.Name] = true
+	}
+	damped := map[string]bool{}
+	add := []probe.S3Service{}
+	for _, s := range servicesToAdd {
+		if removed[s.Name] && d.isFlapping(s.Name) {
+			log.Printf("Service %s is flapping, keeping its current probe", s.Name)
+			damped[s.Name] = true
+			continue
+		}
+		add = append(add, s)
+	}
+	remove := []probe.S3Service{}
+	for _, s := range servicesToRemove {
+		if !damped[s.Name] {
+			remove = append(remove, s)
+		}
+	}
+	return add, remove
+}
@@ -0,0 +1,92 @@
+package watcher
+
+import (
+	"testing"
+	"time"
+
+	probe2 "github.com/criteo/s3-probe/pkg/probe"
+
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+func flappingGaugeValue(t *testing.T, service string) float64 {
+	m, err := probeFlappingGauge.GetMetricWithLabelValues(service)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metric := &io_prometheus_client.Metric{}
+	m.Write(metric)
+	return *metric.Gauge.Value
+}
+
+func TestFlapDetectorFlagsConsecutiveChanges(t *testing.T) {
+	d := flapDetector{}
+	start := time.Now()
+	endpoints := []string{"a", "b", "a", "b"}
+	for i, endpoint := range endpoints {
+		d.observe([]probe2.S3Service{{Name: "flappy", Endpoint: endpoint}}, time.Minute, start.Add(time.Duration(i)*time.Second))
+	}
+	if !d.isFlapping("flappy") || flappingGaugeValue(t, "flappy") != 1 {
+		t.Errorf("Expected service to be flapping")
+	}
+
+	// Stable but not for the whole window yet
+	d.observe([]probe2.S3Service{{Name: "flappy", Endpoint: "b"}}, time.Minute, start.Add(30*time.Second))
+	if !d.isFlapping("flappy") {
+		t.Errorf("Expected service to be flapping until stable for the window")
+	}
+	d.observe([]probe2.S3Service{{Name: "flappy", Endpoint: "b"}}, time.Minute, start.Add(2*time.Minute))
+	if d.isFlapping("flappy") || flappingGaugeValue(t, "flappy") != 0 {
+		t.Errorf("Expected service to be stable")
+	}
+}
+
+func TestFlapDetectorIgnoresSingleChange(t *testing.T) {
+	d := flapDetector{}
+	now := time.Now()
+	d.observe([]probe2.S3Service{{Name: "moved", Endpoint: "a"}}, time.Minute, now)
+	d.observe([]probe2.S3Service{{Name: "moved", Endpoint: "b"}}, time.Minute, now)
+	if d.isFlapping("moved") {
+		t.Errorf("Expected a single change not to be flapping")
+	}
+}
+
+func TestDampRecreationsKeepsFlappingProbes(t *testing.T) {
+	d := flapDetector{}
+	now := time.Now()
+	for _, endpoint := range []string{"a", "b", "a"} {
+		d.observe([]probe2.S3Service{{Name: "flappy", Endpoint: endpoint}, {Name: "other", Endpoint: endpoint}}, time.Minute, now)
+	}
+	d.states["other"].flapping = false
+
+	servicesToAdd := []probe2.S3Service{{Name: "flappy", Endpoint: "a"}, {Name: "other", Endpoint: "a"}, {Name: "new"}}
+	servicesToRemove := []probe2.S3Service{{Name: "flappy", Endpoint: "b"}, {Name: "other", Endpoint: "b"}, {Name: "old"}}
+	add, remove := d.dampRecreations(servicesToAdd, servicesToRemove)
+	if len(add) != 2 || add[0].Name != "other" || add[1].Name != "new" {
+		t.Errorf("Unexpected services to add %v", add)
+	}
+	if len(remove) != 2 || remove[0].Name != "other" || remove[1].Name != "old" {
+		t.Errorf("Unexpected services to remove %v", remove)
+	}
+}
+
+func TestFlapDetectorKeepsUnseenServicesThroughTheWindow(t *testing.T) {
+	d := flapDetector{}
+	start := time.Now()
+	service := []probe2.S3Service{{Name: "vanishing", Endpoint: "a"}}
+	d.observe(service, time.Minute, start)
+	d.observe([]probe2.S3Service{}, time.Minute, start.Add(time.Second))
+	if _, ok := d.states["vanishing"]; !ok {
+		t.Fatalf("Expected the state of an unseen service to be kept")
+	}
+	d.observe(service, time.Minute, start.Add(2*time.Second))
+	if !d.isFlapping("vanishing") {
+		t.Errorf("Expected a service vanishing and coming back to be flapping")
+	}
+
+	d.observe([]probe2.S3Service{}, time.Minute, start.Add(3*time.Second))
+	d.observe([]probe2.S3Service{}, time.Minute, start.Add(2*time.Minute))
+	if _, ok := d.states["vanishing"]; ok {
+		t.Errorf("Expected the state of a service gone for the window to be forgotten")
+	}
+}
@@ -0,0 +1,58 @@
+package watcher
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/criteo/s3-probe/pkg/probe"
+)
+
+// targetGroup is an entry of the Prometheus http_sd and file_sd formats
+type targetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+// serviceTargetGroup describes a service with the labels read by the discovery file of the probe,
+// so that the served targets can be fed back to -sd-file
+func serviceTargetGroup(service probe.S3Service) targetGroup {
+	labels := map[string]string{
+		"service": service.Name,
+		"gateway": strconv.FormatBool(service.Gateway),
+	}
+	if service.Datacenter != "" {
+		labels["dc"] = service.Datacenter
+	}
+	if service.Gateway {
+		readEndpoints := []string{}
+		for _, readEndpoint := range service.GatewayReadEnpoints {
+			readEndpoints = append(readEndpoints, readEndpoint.Name)
+		}
+		labels["gateway_read_endpoints"] = strings.Join(readEndpoints, ",")
+	}
+	for key, value := range service.Overrides {
+		labels[key] = value
+	}
+	return targetGroup{Targets: []string{service.Endpoint}, Labels: labels}
+}
+
+// ServeSD returns the services currently probed in the Prometheus http_sd format
+func (w *Watcher) ServeSD(rw http.ResponseWriter, r *http.Request) {
+	services := w.getWatchedServices()
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].Name < services[j].Name
+	})
+	groups := []targetGroup{}
+	for _, service := range services {
+		groups = append(groups, serviceTargetGroup(service))
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(rw).Encode(groups); err != nil {
+		log.Printf("Error while writing discovered services: %s", err)
+	}
+}
@@ -0,0 +1,45 @@
+package watcher
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/criteo/s3-probe/pkg/probe"
+)
+
+func TestServeSD(t *testing.T) {
+	w := Watcher{watchedServices: map[string]watchedService{
+		"s3-par": {service: probe.S3Service{Name: "s3-par", Endpoint: "10.0.0.1:80", Datacenter: "par", Overrides: map[string]string{"probe_rate": "10"}}},
+		"gateway": {service: probe.S3Service{Name: "gateway", Endpoint: "gateway:80", Gateway: true,
+			GatewayReadEnpoints: []probe.S3Endpoint{{Name: "10.0.0.1:80"}, {Name: "10.0.0.2:80"}}}},
+	}}
+	rec := httptest.NewRecorder()
+	w.ServeSD(rec, httptest.NewRequest("GET", "/sd", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 got %d", rec.Code)
+	}
+
+	groups := []targetGroup{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &groups); err != nil {
+		t.Fatalf("Invalid http_sd response %s: %s", rec.Body.String(), err)
+	}
+	expected := []targetGroup{
+		{Targets: []string{"gateway:80"}, Labels: map[string]string{"service": "gateway", "gateway": "true", "gateway_read_endpoints": "10.0.0.1:80,10.0.0.2:80"}},
+		{Targets: []string{"10.0.0.1:80"}, Labels: map[string]string{"service": "s3-par", "gateway": "false", "dc": "par", "probe_rate": "10"}},
+	}
+	if !reflect.DeepEqual(groups, expected) {
+		t.Errorf("Expected %v got %v", expected, groups)
+	}
+}
+
+func TestServeSDWithoutServices(t *testing.T) {
+	w := Watcher{watchedServices: map[string]watchedService{}}
+	rec := httptest.NewRecorder()
+	w.ServeSD(rec, httptest.NewRequest("GET", "/sd", nil))
+	if body := rec.Body.String(); body != "[]\n" {
+		t.Errorf("Expected an empty list got %q", body)
+	}
+}
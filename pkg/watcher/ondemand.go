@@ -0,0 +1,70 @@
+package watcher
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/criteo/s3-probe/pkg/config"
+	"github.com/criteo/s3-probe/pkg/probe"
+)
+
+// ServeProbe runs one check cycle synchronously on the watched service given
+// by the service query parameter and returns the results as JSON.
+// Durability checks are included when durability=true. As the cycle writes objects,
+// only POST requests carrying the -admin-token as Bearer token when set are accepted.
+func (w *Watcher) ServeProbe(rw http.ResponseWriter, r *http.Request) {
+	if !w.allowAdmin(rw, r) {
+		return
+	}
+	serviceName := r.URL.Query().Get("service")
+	w.mu.Lock()
+	ws, ok := w.watchedServices[serviceName]
+	w.mu.Unlock()
+	if !ok || ws.probe == nil {
+		http.Error(rw, "unknown service: "+serviceName, http.StatusNotFound)
+		return
+	}
+
+	report, err := ws.probe.RunOnce(r.URL.Query().Get("durability") == "true")
+	if err == probe.ErrOnDemandRunInProgress {
+		http.Error(rw, err.Error(), http.StatusConflict)
+		return
+	}
+	if err == probe.ErrProbePreparing {
+		http.Error(rw, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(rw).Encode(report); err != nil {
+		log.Printf("Error while writing on-demand report for %s: %s", serviceName, err)
+	}
+}
+
+// ServeConfig returns the configuration the watcher currently runs with as JSON, credentials redacted.
+// With the service query parameter, the overrides from the metadata of that watched service are applied
+func (w *Watcher) ServeConfig(rw http.ResponseWriter, r *http.Request) {
+	serviceName := r.URL.Query().Get("service")
+	w.mu.Lock()
+	cfg := w.cfg
+	ws, ok := w.watchedServices[serviceName]
+	w.mu.Unlock()
+
+	if serviceName != "" {
+		if !ok {
+			http.Error(rw, "unknown service: "+serviceName, http.StatusNotFound)
+			return
+		}
+		var err error
+		if cfg, err = probe.ServiceConfig(ws.service, cfg); err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(rw).Encode(config.Redacted(*cfg)); err != nil {
+		log.Printf("Error while writing configuration: %s", err)
+	}
+}
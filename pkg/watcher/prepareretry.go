@@ -0,0 +1,98 @@
+package watcher
+
+import (
+	"sync"
+	"time"
+
+	"github.com/criteo/s3-probe/pkg/metrics"
+	"github.com/criteo/s3-probe/pkg/probe"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var probePrepareFailuresCounter = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+	Name: "s3_probe_prepare_failures_total",
+	Help: "Total number of failed preparations of a probe",
+}, []string{"service"})
+
+// prepareRetryState is the preparation history of a service whose probe failed to prepare
+type prepareRetryState struct {
+	failures    int
+	nextAttempt time.Time
+	lastError   string
+}
+
+// prepareRetries schedules the preparation of failed probes with an exponential backoff,
+// so that transient errors don't leave a service unmonitored until the next discovery.
+// mu protects states, which are also read by the status endpoint
+type prepareRetries struct {
+	mu     sync.Mutex
+	states map[string]*prepareRetryState
+}
+
+// due tells whether the preparation of a service can be attempted
+func (r *prepareRetries) due(name string, now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	state, ok := r.states[name]
+	return !ok || !now.Before(state.nextAttempt)
+}
+
+// failed records a failed preparation and returns the delay before the next attempt, doubling
+// from initial up to max with each consecutive failure
+func (r *prepareRetries) failed(name string, now time.Time, err error, initial time.Duration, max time.Duration) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.states == nil {
+		r.states = map[string]*prepareRetryState{}
+	}
+	state, ok := r.states[name]
+	if !ok {
+		state = &prepareRetryState{}
+		r.states[name] = state
+	}
+	delay := initial
+	for i := 0; i < state.failures && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	state.failures++
+	state.nextAttempt = now.Add(delay)
+	state.lastError = err.Error()
+	return delay
+}
+
+// succeeded resets the backoff of a service
+func (r *prepareRetries) succeeded(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.states, name)
+}
+
+// forget drops the backoff of the services no longer discovered
+func (r *prepareRetries) forget(services []probe.S3Service) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	discovered := map[string]bool{}
+	for _, service := range services {
+		discovered[service.Name] = true
+	}
+	for name := range r.states {
+		if !discovered[name] {
+			delete(r.states, name)
+		}
+	}
+}
+
+// failures returns a copy of the states of the services whose preparation failed
+func (r *prepareRetries) failures() map[string]prepareRetryState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	failures := map[string]prepareRetryState{}
+	for name, state := range r.states {
+		failures[name] = *state
+	}
+	return failures
+}
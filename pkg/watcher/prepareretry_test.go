@@ -0,0 +1,50 @@
+package watcher
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/criteo/s3-probe/pkg/probe"
+)
+
+func TestPrepareRetriesBackOffExponentially(t *testing.T) {
+	retries := prepareRetries{}
+	now := time.Unix(0, 0)
+	expected := []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, time.Minute, time.Minute}
+	for i, want := range expected {
+		if delay := retries.failed("test", now, errors.New("failure"), 10*time.Second, time.Minute); delay != want {
+			t.Errorf("Failure %d: expected a %s delay got %s", i+1, want, delay)
+		}
+	}
+
+	if retries.due("test", now.Add(30*time.Second)) {
+		t.Error("Preparation should not be retried before the end of the backoff")
+	}
+	if !retries.due("test", now.Add(time.Minute)) {
+		t.Error("Preparation should be retried at the end of the backoff")
+	}
+	if !retries.due("other", now) {
+		t.Error("Services which never failed should be prepared")
+	}
+
+	retries.succeeded("test")
+	if delay := retries.failed("test", now, errors.New("failure"), 10*time.Second, time.Minute); delay != 10*time.Second {
+		t.Errorf("A success should reset the backoff, got a %s delay", delay)
+	}
+}
+
+func TestPrepareRetriesForgetServicesNoLongerDiscovered(t *testing.T) {
+	retries := prepareRetries{}
+	now := time.Unix(0, 0)
+	retries.failed("kept", now, errors.New("failure"), time.Minute, time.Hour)
+	retries.failed("removed", now, errors.New("failure"), time.Minute, time.Hour)
+
+	retries.forget([]probe.S3Service{{Name: "kept"}})
+	if retries.due("kept", now) {
+		t.Error("Services still discovered should keep their backoff")
+	}
+	if !retries.due("removed", now) {
+		t.Error("Services no longer discovered should be forgotten")
+	}
+}
@@ -0,0 +1,98 @@
+package watcher
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// serviceStatus describes a discovered service in the status endpoint
+type serviceStatus struct {
+	Service              string   `json:"service"`
+	Endpoint             string   `json:"endpoint,omitempty"`
+	Gateway              bool     `json:"gateway"`
+	GatewayReadEndpoints []string `json:"gateway_read_endpoints,omitempty"`
+	// PrepareState is preparing, prepared, or failed for services whose probe failed to prepare
+	PrepareState       string     `json:"prepare_state"`
+	PrepareFailures    int        `json:"prepare_failures,omitempty"`
+	PrepareError       string     `json:"prepare_error,omitempty"`
+	NextPrepareAttempt *time.Time `json:"next_prepare_attempt,omitempty"`
+	Paused             bool       `json:"paused"`
+	LastCheck          *time.Time `json:"last_check,omitempty"`
+	LastError          string     `json:"last_error,omitempty"`
+}
+
+// statuses returns the status of the watched services and of the services whose probe failed to prepare, sorted by name
+func (w *Watcher) statuses() []serviceStatus {
+	w.mu.Lock()
+	watched := make([]watchedService, 0, len(w.watchedServices))
+	for _, ws := range w.watchedServices {
+		watched = append(watched, ws)
+	}
+	w.mu.Unlock()
+
+	statuses := []serviceStatus{}
+	for _, ws := range watched {
+		status := serviceStatus{
+			Service:              ws.service.Name,
+			Endpoint:             ws.service.Endpoint,
+			Gateway:              ws.service.Gateway,
+			GatewayReadEndpoints: []string{},
+			PrepareState:         "prepared",
+		}
+		for _, readEndpoint := range ws.service.GatewayReadEnpoints {
+			status.GatewayReadEndpoints = append(status.GatewayReadEndpoints, readEndpoint.Name)
+		}
+		if ws.probe != nil {
+			probeStatus := ws.probe.Status()
+			if probeStatus.Preparing {
+				status.PrepareState = "preparing"
+			}
+			if !probeStatus.LastCheck.IsZero() {
+				status.LastCheck = &probeStatus.LastCheck
+			}
+			status.LastError = probeStatus.LastError
+			status.Paused = probeStatus.Paused
+		}
+		statuses = append(statuses, status)
+	}
+	for name, failure := range w.retries.failures() {
+		// a service whose preparation is retried is reported as preparing
+		if isWatched(watched, name) {
+			continue
+		}
+		nextAttempt := failure.nextAttempt
+		statuses = append(statuses, serviceStatus{
+			Service:            name,
+			PrepareState:       "failed",
+			PrepareFailures:    failure.failures,
+			PrepareError:       failure.lastError,
+			NextPrepareAttempt: &nextAttempt,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Service < statuses[j].Service
+	})
+	return statuses
+}
+
+// isWatched tells whether a service is among the watched services
+func isWatched(watched []watchedService, name string) bool {
+	for _, ws := range watched {
+		if ws.service.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ServeStatus returns the discovered services with their endpoints, the outcome of their last
+// check cycle and the state of their preparation as JSON
+func (w *Watcher) ServeStatus(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(rw).Encode(w.statuses()); err != nil {
+		log.Printf("Error while writing status: %s", err)
+	}
+}
@@ -0,0 +1,82 @@
+package watcher
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/criteo/s3-probe/pkg/config"
+	"github.com/criteo/s3-probe/pkg/probe"
+)
+
+func TestServeStatus(t *testing.T) {
+	w := Watcher{watchedServices: map[string]watchedService{
+		"s3-par": {service: probe.S3Service{Name: "s3-par", Endpoint: "10.0.0.1:80"}},
+		"gateway": {service: probe.S3Service{Name: "gateway", Endpoint: "gateway:80", Gateway: true,
+			GatewayReadEnpoints: []probe.S3Endpoint{{Name: "10.0.0.1:80"}}}},
+	}}
+	w.retries.failed("s3-am5", time.Unix(0, 0), errors.New("bucket creation failed"), time.Minute, time.Hour)
+
+	rec := httptest.NewRecorder()
+	w.ServeStatus(rec, httptest.NewRequest("GET", "/status", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 got %d", rec.Code)
+	}
+	statuses := []serviceStatus{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &statuses); err != nil {
+		t.Fatalf("Invalid status %s: %s", rec.Body.String(), err)
+	}
+	if len(statuses) != 3 {
+		t.Fatalf("Expected 3 services got %s", rec.Body.String())
+	}
+
+	gateway, failed, standard := statuses[0], statuses[1], statuses[2]
+	if gateway.Service != "gateway" || !gateway.Gateway || len(gateway.GatewayReadEndpoints) != 1 || gateway.PrepareState != "prepared" {
+		t.Errorf("Unexpected gateway status %+v", gateway)
+	}
+	if failed.Service != "s3-am5" || failed.PrepareState != "failed" || failed.PrepareFailures != 1 ||
+		failed.PrepareError != "bucket creation failed" || !failed.NextPrepareAttempt.Equal(time.Unix(60, 0)) {
+		t.Errorf("Unexpected failed service status %+v", failed)
+	}
+	if standard.Service != "s3-par" || standard.Endpoint != "10.0.0.1:80" || standard.LastCheck != nil {
+		t.Errorf("Unexpected service status %+v", standard)
+	}
+}
+
+func TestStatusReportsPreparingServices(t *testing.T) {
+	requested := make(chan struct{}, 1)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		select {
+		case requested <- struct{}{}:
+		default:
+		}
+		<-release
+		rw.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	cfg := config.GetTestConfig()
+	w := Watcher{cfg: &cfg, watchedServices: map[string]watchedService{}}
+	done := make(chan struct{})
+	go func() {
+		w.createNewProbes([]probe.S3Service{{Name: "s3-par", Endpoint: strings.TrimPrefix(server.URL, "http://")}})
+		close(done)
+	}()
+	<-requested
+
+	statuses := w.statuses()
+	if len(statuses) != 1 || statuses[0].Service != "s3-par" || statuses[0].PrepareState != "preparing" {
+		t.Errorf("Expected s3-par to be preparing, got %+v", statuses)
+	}
+	close(release)
+	<-done
+	statuses = w.statuses()
+	if len(statuses) != 1 || statuses[0].PrepareState != "failed" {
+		t.Errorf("Expected s3-par preparation to have failed, got %+v", statuses)
+	}
+}
@@ -2,18 +2,21 @@ package watcher
 
 import (
 	"log"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/criteo/s3-probe/pkg/config"
+	"github.com/criteo/s3-probe/pkg/metrics"
 	"github.com/criteo/s3-probe/pkg/probe"
 
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
 type watchedService struct {
 	service   probe.S3Service
 	probeChan chan bool
+	probe     *probe.Probe
 }
 
 // Watcher manages the pool of S3 endpoints to monitor
@@ -21,9 +24,63 @@ type Watcher struct {
 	consulClient    probe.ConsulClient
 	cfg             *config.Config
 	watchedServices map[string]watchedService
+	reloadChan      chan config.Config
+	stopChan        chan struct{}
+	retryChan       chan struct{}
+	retries         prepareRetries
+	flaps           flapDetector
+	// paused are the services paused through the admin endpoints, their probes are paused again when recreated
+	paused map[string]bool
+	// mu protects watchedServices and the replacement of cfg and consulClient, which are
+	// read by the HTTP handlers and the catalog watch
+	mu sync.Mutex
 }
 
-var serviceDiscoveryErrorCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+// nonProbeSettings are the configuration fields which don't affect running probes,
+// changing them doesn't require probes to be recreated
+var nonProbeSettings = map[string]bool{
+	"ConsulAddr":                true,
+	"Tag":                       true,
+	"GatewayTag":                true,
+	"Interval":                  true,
+	"Addr":                      true,
+	"PushgatewayAddr":           true,
+	"PushgatewayJob":            true,
+	"PushInterval":              true,
+	"DiscoveryConcurrency":      true,
+	"EndpointTemplate":          true,
+	"ProbeHost":                 true,
+	"ConfigFile":                true,
+	"DisableSDKRetries":         true,
+	"EndpointIDLabel":           true,
+	"FlappingStabilityWindow":   true,
+	"GlobalMaxOpsPerMin":        true,
+	"ConsulBlockingQueries":     true,
+	"ServiceInclude":            true,
+	"ServiceExclude":            true,
+	"SDFile":                    true,
+	"ShutdownTimeout":           true,
+	"GlobalMaxConcurrentChecks": true,
+	"PrepareRetryDelay":         true,
+	"PrepareRetryMaxDelay":      true,
+	"ConnectService":            true,
+	"HybridDiscovery":           true,
+	"DiscoveryPrecedence":       true,
+	"AdminToken":                true,
+}
+
+// restartOnlySettings are the configuration fields read once at startup, a reload doesn't apply them
+var restartOnlySettings = map[string]bool{
+	"Addr":              true,
+	"PushgatewayAddr":   true,
+	"PushgatewayJob":    true,
+	"PushInterval":      true,
+	"ProbeHost":         true,
+	"DisableSDKRetries": true,
+	"EndpointIDLabel":   true,
+}
+
+var serviceDiscoveryErrorCounter = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
 	Name: "s3_service_discovery_error_total",
 	Help: "Total number of service errors",
 }, []string{"service"})
@@ -38,26 +95,234 @@ func NewWatcher(cfg config.Config) Watcher {
 		cfg:             &cfg,
 		consulClient:    client,
 		watchedServices: map[string]watchedService{},
+		paused:          map[string]bool{},
+		reloadChan:      make(chan config.Config, 1),
+		stopChan:        make(chan struct{}),
+		retryChan:       make(chan struct{}, 1),
+	}
+}
+
+// Stop makes WatchPools stop every probe and return once their in-flight checks completed
+func (w *Watcher) Stop() {
+	close(w.stopChan)
+}
+
+// Reload hands a new configuration over to the watcher, probes whose settings
+// changed are stopped and recreated with it on the next discovery. It doesn't wait for the
+// discovery loop, a configuration not yet picked up is replaced by the newer one
+func (w *Watcher) Reload(cfg config.Config) {
+	for {
+		select {
+		case w.reloadChan <- cfg:
+			return
+		default:
+		}
+		select {
+		case <-w.reloadChan:
+		default:
+		}
 	}
 }
 
+// catalogRetryDelay is the delay before a failed blocking query is sent again
+const catalogRetryDelay = 10 * time.Second
+
 // WatchPools poll consul services with specified tag and create
-// probe gorountines
+// probe gorountines. With blocking queries, discovery also runs as soon as the
+// consul catalog changes, polling remains as a periodic reconciliation. It returns after Stop
 func (w *Watcher) WatchPools(interval time.Duration) {
+	catalogChanges := make(chan struct{}, 1)
+	if *w.cfg.ConsulBlockingQueries {
+		go w.watchCatalog(catalogChanges)
+	}
 	for {
 		log.Printf("Discovering S3 endpoints (interval: %s)", interval)
 		servicesFromConsul := w.getServices()
 		watchedServices := w.getWatchedServices()
 		servicesToAdd, servicesToRemove := w.getServicesToModify(servicesFromConsul, watchedServices)
+		w.flaps.observe(servicesFromConsul, *w.cfg.FlappingStabilityWindow, time.Now())
+		if *w.cfg.FlappingStabilityWindow > 0 {
+			servicesToAdd, servicesToRemove = w.flaps.dampRecreations(servicesToAdd, servicesToRemove)
+		}
+		w.retries.forget(servicesFromConsul)
+		servicesToAdd, servicesToRemove = w.updateEndpoints(servicesToAdd, servicesToRemove)
 		w.flushOldProbes(servicesToRemove)
 		w.createNewProbes(servicesToAdd)
-		time.Sleep(interval)
+		w.updateInstances(servicesFromConsul)
+
+		select {
+		case <-time.After(interval):
+		case <-catalogChanges:
+			log.Printf("Consul catalog changed")
+		case <-w.retryChan:
+			log.Printf("Retrying the preparation of failed probes")
+		case cfg := <-w.reloadChan:
+			w.reloadConfig(cfg)
+			interval = *w.cfg.Interval
+		case <-w.stopChan:
+			w.stopProbes(*w.cfg.ShutdownTimeout)
+			return
+		}
+	}
+}
+
+// stopProbes stops every probe and waits up to timeout for their in-flight checks
+func (w *Watcher) stopProbes(timeout time.Duration) {
+	w.mu.Lock()
+	probes := []*probe.Probe{}
+	for _, ws := range w.watchedServices {
+		probes = append(probes, ws.probe)
+	}
+	w.mu.Unlock()
+
+	log.Printf("Stopping %d probes", len(probes))
+	w.flushOldProbes(w.getWatchedServices())
+	deadline := time.Now().Add(timeout)
+	for _, p := range probes {
+		if !p.WaitChecks(time.Until(deadline)) {
+			log.Printf("Checks still running after %s, exiting anyway", timeout)
+			return
+		}
+	}
+	log.Printf("All probes stopped")
+}
+
+// watchCatalog sends blocking queries to consul and notifies each change of the catalog on changes
+func (w *Watcher) watchCatalog(changes chan<- struct{}) {
+	index := uint64(0)
+	for {
+		newIndex, err := w.getConsulClient().WaitForCatalogChange(index)
+		if err != nil {
+			log.Printf("Error while waiting for consul catalog changes, retrying in %s: %s", catalogRetryDelay, err)
+			time.Sleep(catalogRetryDelay)
+			continue
+		}
+		// The index going backwards means it was reset, consul then recommends to start over
+		if newIndex < index {
+			newIndex = 0
+		}
+		if index != 0 && newIndex != index {
+			select {
+			case changes <- struct{}{}:
+			default:
+			}
+		}
+		index = newIndex
+	}
+}
+
+func (w *Watcher) getConsulClient() probe.ConsulClient {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.consulClient
+}
+
+// reloadConfig switches the watcher to a new configuration and stops the probes it affects,
+// they are recreated by the following discovery
+func (w *Watcher) reloadConfig(cfg config.Config) {
+	consulClient, err := probe.MakeConsulClient(&cfg)
+	if err != nil {
+		log.Printf("Error while reloading configuration, keeping the current one: %s", err)
+		return
+	}
+
+	probeSettingsChanged := false
+	for _, setting := range config.ChangedSettings(*w.cfg, cfg) {
+		if restartOnlySettings[setting] {
+			log.Printf("Configuration reloaded: %s changed but is only applied on restart", setting)
+			continue
+		}
+		log.Printf("Configuration reloaded: %s changed", setting)
+		if !nonProbeSettings[setting] {
+			probeSettingsChanged = true
+		}
+	}
+	w.mu.Lock()
+	w.cfg = &cfg
+	w.consulClient = consulClient
+	w.mu.Unlock()
+	probe.SetGlobalRateLimit(*cfg.GlobalMaxOpsPerMin)
+	probe.SetGlobalMaxConcurrentChecks(*cfg.GlobalMaxConcurrentChecks)
+
+	if probeSettingsChanged {
+		w.flushOldProbes(w.getWatchedServices())
+	}
+}
+
+// updateEndpoints switches the running probes of services whose endpoints only changed to their new
+// endpoints, instead of recreating them, and returns the services still to add and remove
+func (w *Watcher) updateEndpoints(servicesToAdd []probe.S3Service, servicesToRemove []probe.S3Service) ([]probe.S3Service, []probe.S3Service) {
+	updated := map[string]bool{}
+	add := []probe.S3Service{}
+	for _, s3service := range servicesToAdd {
+		w.mu.Lock()
+		ws, ok := w.watchedServices[s3service.Name]
+		w.mu.Unlock()
+		if !ok || ws.probe == nil || !ws.service.SameExceptEndpoints(&s3service) {
+			add = append(add, s3service)
+			continue
+		}
+		log.Printf("Endpoints of %s changed, updating its probe", s3service.Name)
+		if err := ws.probe.UpdateEndpoints(s3service.Endpoint, s3service.GatewayReadEnpoints, w.cfg); err != nil {
+			log.Printf("Error while updating endpoints of %s, recreating its probe: %s", s3service.Name, err)
+			add = append(add, s3service)
+			continue
+		}
+		// The instances of the probe are switched by updateInstances
+		s3service.InstanceEndpoints = ws.service.InstanceEndpoints
+		w.mu.Lock()
+		ws.service = s3service
+		w.watchedServices[s3service.Name] = ws
+		w.mu.Unlock()
+		updated[s3service.Name] = true
+	}
+	remove := []probe.S3Service{}
+	for _, s3service := range servicesToRemove {
+		if !updated[s3service.Name] {
+			remove = append(remove, s3service)
+		}
+	}
+	return add, remove
+}
+
+// updateInstances switches the running probes of services whose instances changed to their new instances
+func (w *Watcher) updateInstances(servicesFromConsul []probe.S3Service) {
+	for _, s3service := range servicesFromConsul {
+		w.mu.Lock()
+		ws, ok := w.watchedServices[s3service.Name]
+		w.mu.Unlock()
+		if !ok || ws.probe == nil || ws.service.SameInstances(&s3service) {
+			continue
+		}
+		log.Printf("Instances of %s changed, updating its probe", s3service.Name)
+		if err := ws.probe.UpdateInstances(s3service.InstanceEndpoints, w.cfg); err != nil {
+			log.Printf("Error while updating instances of %s: %s", s3service.Name, err)
+			continue
+		}
+		w.mu.Lock()
+		ws.service.InstanceEndpoints = s3service.InstanceEndpoints
+		w.watchedServices[s3service.Name] = ws
+		w.mu.Unlock()
 	}
+}
 
+// notifyRetry wakes the discovery loop up to retry the preparation of failed probes
+func (w *Watcher) notifyRetry() {
+	select {
+	case w.retryChan <- struct{}{}:
+	default:
+	}
 }
 
 func (w *Watcher) createNewProbes(servicesToAdd []probe.S3Service) {
 	for _, s3service := range servicesToAdd {
+		if w.stopping() {
+			return
+		}
+		// Probes which failed to prepare wait for their backoff, even if discovery runs earlier
+		if !w.retries.due(s3service.Name, time.Now()) {
+			continue
+		}
 		log.Printf("Creating new probe for: %s, gateway: %t", s3service.Name, s3service.Gateway)
 		probeChan := make(chan bool)
 
@@ -67,30 +332,89 @@ func (w *Watcher) createNewProbes(servicesToAdd []probe.S3Service) {
 			continue
 		}
 
-		err = p.PrepareProbing()
+		// The service is watched during its preparation so that its status reports it
+		w.mu.Lock()
+		if w.paused[s3service.Name] {
+			p.Pause()
+		}
+		w.watchedServices[s3service.Name] = watchedService{service: s3service, probeChan: probeChan, probe: &p}
+		w.mu.Unlock()
+
+		err = w.prepareProbe(&p)
 		if err != nil {
-			log.Println("Error while preparing probe:", err)
+			w.mu.Lock()
+			delete(w.watchedServices, s3service.Name)
+			w.mu.Unlock()
 			close(probeChan)
+		}
+		if err != nil && w.stopping() {
+			return
+		}
+		if err != nil {
+			probePrepareFailuresCounter.WithLabelValues(s3service.Name).Inc()
+			delay := w.retries.failed(s3service.Name, time.Now(), err, *w.cfg.PrepareRetryDelay, *w.cfg.PrepareRetryMaxDelay)
+			log.Printf("Error while preparing probe, retrying in %s: %s", delay, err)
+			time.AfterFunc(delay, w.notifyRetry)
 			continue
 		}
-
-		w.watchedServices[s3service.Name] = watchedService{service: s3service, probeChan: probeChan}
+		w.retries.succeeded(s3service.Name)
 		go p.StartProbing()
 	}
 }
 
+// prepareProbe prepares a new probe, the preparation is cancelled if the watcher is stopped meanwhile
+func (w *Watcher) prepareProbe(p *probe.Probe) error {
+	prepared := make(chan struct{})
+	defer close(prepared)
+	go func() {
+		select {
+		case <-w.stopChan:
+			p.Stop()
+		case <-prepared:
+		}
+	}()
+	return p.PrepareProbing()
+}
+
+// stopping tells whether Stop was called
+func (w *Watcher) stopping() bool {
+	select {
+	case <-w.stopChan:
+		return true
+	default:
+		return false
+	}
+}
+
 func (w *Watcher) flushOldProbes(servicesToRemove []probe.S3Service) {
 	for _, s3service := range servicesToRemove {
 		log.Printf("Removing old probe for: %s", s3service.Name)
+		w.mu.Lock()
 		ws, ok := w.watchedServices[s3service.Name]
+		delete(w.watchedServices, s3service.Name)
+		w.mu.Unlock()
 		if ok {
-			delete(w.watchedServices, s3service.Name)
 			ws.probeChan <- false
 			close(ws.probeChan)
+			if ws.probe != nil {
+				go w.deleteMetricsOnceDrained(s3service.Name, ws.probe)
+			}
 		}
 	}
 }
 
+// deleteMetricsOnceDrained deletes the series of a removed probe once its in-flight checks completed, they
+// would export them again otherwise. The series are kept when the service got a new probe meanwhile
+func (w *Watcher) deleteMetricsOnceDrained(serviceName string, p *probe.Probe) {
+	p.WaitDrained()
+	w.mu.Lock()
+	_, recreated := w.watchedServices[serviceName]
+	w.mu.Unlock()
+	if !recreated {
+		p.DeleteMetrics()
+	}
+}
+
 // getServicesToModify compare services as seen in consul and services that are running in the probe. Every service that
 // Are in consul and not on the probe are added to the probe. Services in the probe that are not in consul are removed
 func (w *Watcher) getServicesToModify(servicesFromConsul []probe.S3Service, watchedServices []probe.S3Service) ([]probe.S3Service, []probe.S3Service) {
@@ -102,6 +426,8 @@ func (w *Watcher) getServicesToModify(servicesFromConsul []probe.S3Service, watc
 func (w *Watcher) getWatchedServices() []probe.S3Service {
 	currentServices := []probe.S3Service{}
 
+	w.mu.Lock()
+	defer w.mu.Unlock()
 	for _, ws := range w.watchedServices {
 		currentServices = append(currentServices, ws.service)
 	}
@@ -109,26 +435,78 @@ func (w *Watcher) getWatchedServices() []probe.S3Service {
 }
 
 func (w *Watcher) getServices() []probe.S3Service {
-	services, err := w.consulClient.GetAllMatchingRegisteredServices()
+	consulClient := w.getConsulClient()
+	services, err := consulClient.GetAllMatchingRegisteredServices()
 	if err != nil {
 		serviceDiscoveryErrorCounter.WithLabelValues("N/A").Inc()
 		log.Printf("Fail to query all registered services from consul: %s\n", err)
 		return []probe.S3Service{}
 	}
 
+	concurrency := *w.cfg.DiscoveryConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	serviceNames := make(chan string)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
 	results := make([]probe.S3Service, 0)
-	for serviceName, isGateway := range services {
-		endpoint, readEndpoints, err := w.consulClient.GetServiceEndPoints(serviceName, isGateway)
-		if err != nil {
-			serviceDiscoveryErrorCounter.WithLabelValues(serviceName).Inc()
-			log.Printf("Resolving service endpoints failed for %s: %s\n", serviceName, err)
-			continue
-		}
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for serviceName := range serviceNames {
+				isGateway := services[serviceName]
+				endpoints, err := consulClient.GetServiceEndPoints(serviceName, isGateway)
+				if err != nil {
+					serviceDiscoveryErrorCounter.WithLabelValues(serviceName).Inc()
+					log.Printf("Resolving service endpoints failed for %s: %s\n", serviceName, err)
+					continue
+				}
 
-		s := probe.S3Service{Name: serviceName, Endpoint: endpoint, Gateway: isGateway, GatewayReadEnpoints: readEndpoints}
-		results = append(results, s)
+				s := probe.S3Service{
+					Name:                serviceName,
+					Endpoint:            endpoints.Endpoint,
+					Gateway:             isGateway,
+					GatewayReadEnpoints: endpoints.GatewayReadEndpoints,
+					Overrides:           endpoints.Overrides,
+					MeshTLS:             endpoints.MeshTLS,
+				}
+				if *w.cfg.DurabilityInstanceCheck && !isGateway {
+					s.InstanceEndpoints, err = consulClient.GetServiceInstances(serviceName)
+					if err != nil {
+						serviceDiscoveryErrorCounter.WithLabelValues(serviceName).Inc()
+						log.Printf("Resolving service instances failed for %s: %s\n", serviceName, err)
+						continue
+					}
+				}
+				if !isGateway {
+					// The datacenter labels the metrics of the probe, it is only required when
+					// durability items are partitioned by datacenter. It is resolved along with the
+					// endpoint so that a failing query doesn't recreate the probe without it
+					s.Datacenter = endpoints.Datacenter
+					if s.Datacenter == "" && *w.cfg.DurabilityPerDatacenter {
+						serviceDiscoveryErrorCounter.WithLabelValues(serviceName).Inc()
+						log.Printf("Resolving service datacenter failed for %s\n", serviceName)
+						continue
+					}
+				}
+				mu.Lock()
+				results = append(results, s)
+				mu.Unlock()
+			}
+		}()
+	}
+	for serviceName := range services {
+		serviceNames <- serviceName
 	}
+	close(serviceNames)
+	wg.Wait()
 
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Name < results[j].Name
+	})
 	return results
 }
 
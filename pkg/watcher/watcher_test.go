@@ -3,16 +3,22 @@ package watcher
 import (
 	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/criteo/s3-probe/pkg/config"
+	"github.com/criteo/s3-probe/pkg/metrics"
 	probe2 "github.com/criteo/s3-probe/pkg/probe"
 
 	"github.com/smartystreets/assertions/assert"
 	"github.com/smartystreets/assertions/should"
 
+	"github.com/prometheus/client_golang/prometheus"
 	io_prometheus_client "github.com/prometheus/client_model/go"
 )
 
@@ -22,6 +28,10 @@ type consulClientMock struct {
 	ServiceEndPoints        map[string]string
 	ReadEndPoints           map[string][]probe2.S3Endpoint
 	ServiceEndPointsError   error
+	Instances               map[string][]string
+	Datacenters             map[string]string
+	Overrides               map[string]map[string]string
+	CatalogIndexes          chan uint64
 }
 
 func (cc *consulClientMock) GetAllMatchingRegisteredServices() (map[string]bool, error) {
@@ -31,11 +41,24 @@ func (cc *consulClientMock) GetAllMatchingRegisteredServices() (map[string]bool,
 	return cc.RegisteredServices, nil
 }
 
-func (cc *consulClientMock) GetServiceEndPoints(serviceName string, isGateway bool) (string, []probe2.S3Endpoint, error) {
+func (cc *consulClientMock) GetServiceEndPoints(serviceName string, isGateway bool) (probe2.ServiceEndpoints, error) {
 	if cc.ServiceEndPointsError != nil {
-		return "", []probe2.S3Endpoint{}, cc.ServiceEndPointsError
+		return probe2.ServiceEndpoints{}, cc.ServiceEndPointsError
 	}
-	return cc.ServiceEndPoints[serviceName], cc.ReadEndPoints[serviceName], nil
+	return probe2.ServiceEndpoints{
+		Endpoint:             cc.ServiceEndPoints[serviceName],
+		GatewayReadEndpoints: cc.ReadEndPoints[serviceName],
+		Overrides:            cc.Overrides[serviceName],
+		Datacenter:           cc.Datacenters[serviceName],
+	}, nil
+}
+
+func (cc *consulClientMock) GetServiceInstances(serviceName string) ([]string, error) {
+	return cc.Instances[serviceName], nil
+}
+
+func (cc *consulClientMock) WaitForCatalogChange(lastIndex uint64) (uint64, error) {
+	return <-cc.CatalogIndexes, nil
 }
 
 func TestGetServiceFailureToListServices(t *testing.T) {
@@ -103,13 +126,14 @@ func TestGetService(t *testing.T) {
 		t.Errorf("Expected 2 S3Service but got %d", len(services))
 	}
 
-	if services[0].Name != "myservice" || services[0].Endpoint != "127.0.0.1" ||
-		services[0].Gateway != false || len(services[0].GatewayReadEnpoints) != 0 {
+	// Services are sorted by name
+	if services[1].Name != "myservice" || services[1].Endpoint != "127.0.0.1" ||
+		services[1].Gateway != false || len(services[1].GatewayReadEnpoints) != 0 {
 		t.Errorf("myservice don't match expectation")
 	}
 
-	if services[1].Name != "myotherservice" || services[1].Endpoint != "127.0.0.2" ||
-		services[1].Gateway != true || len(services[1].GatewayReadEnpoints) != 2 {
+	if services[0].Name != "myotherservice" || services[0].Endpoint != "127.0.0.2" ||
+		services[0].Gateway != true || len(services[0].GatewayReadEnpoints) != 2 {
 		t.Errorf("myotherservice don't match expectation")
 	}
 
@@ -128,6 +152,104 @@ func TestGetService(t *testing.T) {
 	}
 }
 
+func TestGetServiceWithInstances(t *testing.T) {
+	consulClient := &consulClientMock{}
+	consulClient.RegisteredServices = map[string]bool{"myservice": false, "myotherservice": true}
+	consulClient.ServiceEndPoints = map[string]string{"myservice": "127.0.0.1", "myotherservice": "127.0.0.2"}
+	consulClient.Instances = map[string][]string{"myservice": {"10.0.0.1:9000", "10.0.0.2:9000"}, "myotherservice": {"10.0.1.1:9000"}}
+
+	cfg := config.GetTestConfig()
+	durabilityInstanceCheck := true
+	cfg.DurabilityInstanceCheck = &durabilityInstanceCheck
+	watcher := Watcher{consulClient: consulClient, cfg: &cfg, watchedServices: map[string]watchedService{}}
+
+	services := watcher.getServices()
+	if len(services) != 2 {
+		t.Fatalf("Expected 2 S3Service but got %d", len(services))
+	}
+	if !reflect.DeepEqual(services[1].InstanceEndpoints, []string{"10.0.0.1:9000", "10.0.0.2:9000"}) {
+		t.Errorf("Expected instances of myservice got %v", services[1].InstanceEndpoints)
+	}
+	if len(services[0].InstanceEndpoints) != 0 {
+		t.Errorf("Instances of gateways should not be resolved, got %v", services[0].InstanceEndpoints)
+	}
+}
+
+func TestGetServiceWithDatacenter(t *testing.T) {
+	consulClient := &consulClientMock{}
+	consulClient.RegisteredServices = map[string]bool{"myservice": false, "myotherservice": true}
+	consulClient.ServiceEndPoints = map[string]string{"myservice": "127.0.0.1", "myotherservice": "127.0.0.2"}
+	consulClient.Datacenters = map[string]string{"myservice": "eu-west-1", "myotherservice": "eu-west-1"}
+
+	cfg := config.GetTestConfig()
+	durabilityPerDatacenter := true
+	cfg.DurabilityPerDatacenter = &durabilityPerDatacenter
+	watcher := Watcher{consulClient: consulClient, cfg: &cfg, watchedServices: map[string]watchedService{}}
+
+	services := watcher.getServices()
+	if len(services) != 2 {
+		t.Fatalf("Expected 2 S3Service but got %d", len(services))
+	}
+	if services[1].Datacenter != "eu-west-1" {
+		t.Errorf("Expected datacenter of myservice got %q", services[1].Datacenter)
+	}
+	if services[0].Datacenter != "" {
+		t.Errorf("Datacenter of gateways should not be resolved, got %q", services[0].Datacenter)
+	}
+}
+
+func TestGetServiceDatacenterLabel(t *testing.T) {
+	consulClient := &consulClientMock{}
+	consulClient.RegisteredServices = map[string]bool{"myservice": false}
+	consulClient.ServiceEndPoints = map[string]string{"myservice": "127.0.0.1"}
+	consulClient.Datacenters = map[string]string{"myservice": "eu-west-1"}
+
+	cfg := config.GetTestConfig()
+	watcher := Watcher{consulClient: consulClient, cfg: &cfg, watchedServices: map[string]watchedService{}}
+
+	services := watcher.getServices()
+	if len(services) != 1 || services[0].Datacenter != "eu-west-1" {
+		t.Fatalf("Expected the datacenter of myservice to label its metrics got %v", services)
+	}
+
+	delete(consulClient.Datacenters, "myservice")
+	services = watcher.getServices()
+	if len(services) != 1 || services[0].Datacenter != "" {
+		t.Errorf("Services should be probed without datacenter label when it can't be resolved, got %v", services)
+	}
+
+	durabilityPerDatacenter := true
+	cfg.DurabilityPerDatacenter = &durabilityPerDatacenter
+	if services = watcher.getServices(); len(services) != 0 {
+		t.Errorf("Services without datacenter can't partition durability items, got %v", services)
+	}
+}
+
+func TestWatchCatalogNotifiesChanges(t *testing.T) {
+	consulClient := &consulClientMock{CatalogIndexes: make(chan uint64)}
+	w := Watcher{consulClient: consulClient, watchedServices: map[string]watchedService{}}
+	changes := make(chan struct{}, 1)
+	go w.watchCatalog(changes)
+
+	// The first index only initializes the watch, the wait time elapsing returns the same index
+	consulClient.CatalogIndexes <- 10
+	consulClient.CatalogIndexes <- 10
+	select {
+	case <-changes:
+		t.Fatalf("No change should be notified without a new index")
+	default:
+	}
+
+	consulClient.CatalogIndexes <- 11
+	// Wait for the following query to be sure the change was handled
+	consulClient.CatalogIndexes <- 11
+	select {
+	case <-changes:
+	default:
+		t.Errorf("Expected a change to be notified")
+	}
+}
+
 func s3ServicesFromStrings(strings []string) (s3Services []probe2.S3Service) {
 	for i := range strings {
 		s3Services = append(s3Services, probe2.S3Service{Name: strings[i]})
@@ -236,3 +358,293 @@ func TestFlushOldProbesSendStopCommand(t *testing.T) {
 		t.Errorf("The assertion failed: %s", result)
 	}
 }
+
+func TestDeleteMetricsOnceDrained(t *testing.T) {
+	gauge := metrics.Factory.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "test_watcher_delete_series",
+		Help: "Test gauge",
+	}, []string{"endpoint"})
+	defer metrics.Registerer.Unregister(gauge)
+	cfg := config.GetTestConfig()
+	p, err := probe2.NewProbe(probe2.S3Service{Name: "drained"}, "127.0.0.1:9000", []probe2.S3Endpoint{}, &cfg, make(chan bool))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := Watcher{watchedServices: map[string]watchedService{"drained": {}}}
+
+	gauge.WithLabelValues("drained").Set(1)
+	w.deleteMetricsOnceDrained("drained", &p)
+	if !gauge.DeleteLabelValues("drained") {
+		t.Errorf("The series should be kept when the service got a new probe")
+	}
+
+	gauge.WithLabelValues("drained").Set(1)
+	delete(w.watchedServices, "drained")
+	w.deleteMetricsOnceDrained("drained", &p)
+	if gauge.DeleteLabelValues("drained") {
+		t.Errorf("The series of a removed probe should be deleted")
+	}
+}
+
+func TestReloadConfigRecreatesProbesWhenProbeSettingsChange(t *testing.T) {
+	cfg := config.GetTestConfig()
+	controlChan := make(chan bool, 1)
+	w := Watcher{
+		cfg:             &cfg,
+		watchedServices: map[string]watchedService{"test": {service: probe2.S3Service{Name: "test"}, probeChan: controlChan}},
+	}
+
+	newCfg := config.GetTestConfig()
+	rate := *cfg.ProbeRatePerMin + 1
+	newCfg.ProbeRatePerMin = &rate
+	w.reloadConfig(newCfg)
+
+	if len(controlChan) != 1 {
+		t.Errorf("Stop command not received")
+	}
+	if *w.cfg.ProbeRatePerMin != rate {
+		t.Errorf("New configuration not applied")
+	}
+}
+
+func TestReloadConfigKeepsProbesWhenOnlyDiscoverySettingsChange(t *testing.T) {
+	cfg := config.GetTestConfig()
+	controlChan := make(chan bool, 1)
+	w := Watcher{
+		cfg:             &cfg,
+		watchedServices: map[string]watchedService{"test": {service: probe2.S3Service{Name: "test"}, probeChan: controlChan}},
+	}
+
+	newCfg := config.GetTestConfig()
+	concurrency := *cfg.DiscoveryConcurrency + 1
+	newCfg.DiscoveryConcurrency = &concurrency
+	w.reloadConfig(newCfg)
+
+	if len(controlChan) != 0 {
+		t.Errorf("Probe should not have been stopped")
+	}
+	result := assert.So(w.watchedServices, should.ContainKey, "test")
+	if result.Failed() {
+		t.Errorf("The assertion failed: %s", result)
+	}
+}
+
+func TestReloadDoesNotWaitForTheDiscoveryLoop(t *testing.T) {
+	w := Watcher{reloadChan: make(chan config.Config, 1)}
+	first := config.GetTestConfig()
+	second := config.GetTestConfig()
+	w.Reload(first)
+	w.Reload(second)
+
+	if cfg := <-w.reloadChan; cfg.ProbeRatePerMin != second.ProbeRatePerMin {
+		t.Errorf("The latest configuration should be the one picked up")
+	}
+}
+
+func TestServeProbeUnknownService(t *testing.T) {
+	cfg := config.GetTestConfig()
+	w := Watcher{cfg: &cfg, watchedServices: map[string]watchedService{}}
+	rec := httptest.NewRecorder()
+	w.ServeProbe(rec, httptest.NewRequest("POST", "/probe?service=unknown", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 got %d", rec.Code)
+	}
+}
+
+func TestServeProbeRequiresAnAuthorizedPost(t *testing.T) {
+	cfg := config.GetTestConfig()
+	token := "secret"
+	cfg.AdminToken = &token
+	w := Watcher{cfg: &cfg, watchedServices: map[string]watchedService{}}
+	requests := []struct {
+		method string
+		auth   string
+		code   int
+	}{
+		{"GET", "Bearer secret", http.StatusMethodNotAllowed},
+		{"POST", "", http.StatusUnauthorized},
+		{"POST", "Bearer wrong", http.StatusUnauthorized},
+		{"POST", "Bearer secret", http.StatusNotFound},
+	}
+	for _, request := range requests {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(request.method, "/probe?service=unknown", nil)
+		if request.auth != "" {
+			req.Header.Set("Authorization", request.auth)
+		}
+		w.ServeProbe(rec, req)
+		if rec.Code != request.code {
+			t.Errorf("%s with %q: expected %d got %d", request.method, request.auth, request.code, rec.Code)
+		}
+	}
+}
+
+func TestServeConfigRedactsSecrets(t *testing.T) {
+	cfg := config.GetTestConfig()
+	w := Watcher{cfg: &cfg, watchedServices: map[string]watchedService{}}
+	rec := httptest.NewRecorder()
+	w.ServeConfig(rec, httptest.NewRequest("GET", "/config", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 got %d", rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), *cfg.SecretKey) {
+		t.Errorf("The secret key should not be served")
+	}
+	if !strings.Contains(rec.Body.String(), `"LatencyBucketName":"`+*cfg.LatencyBucketName+`"`) {
+		t.Errorf("Expected the latency bucket in %s", rec.Body.String())
+	}
+}
+
+func TestServeConfigOfAService(t *testing.T) {
+	cfg := config.GetTestConfig()
+	w := Watcher{cfg: &cfg, watchedServices: map[string]watchedService{
+		"s3-par": {service: probe2.S3Service{Name: "s3-par", Overrides: map[string]string{"probe_rate": "7"}}},
+	}}
+	rec := httptest.NewRecorder()
+	w.ServeConfig(rec, httptest.NewRequest("GET", "/config?service=s3-par", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 got %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), `"ProbeRatePerMin":7`) {
+		t.Errorf("Expected the overridden probe rate in %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	w.ServeConfig(rec, httptest.NewRequest("GET", "/config?service=unknown", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 got %d", rec.Code)
+	}
+}
+
+func TestGetServicesToModifyHandleReplacedGatewayReadEndpoint(t *testing.T) {
+	current := []probe2.S3Endpoint{{Name: "10.0.0.2"}, {Name: "10.0.0.4"}}
+	servicesFromConsul := []probe2.S3Service{{Name: "s1", Endpoint: "10.0.0.1", Gateway: true, GatewayReadEnpoints: current}}
+	servicesWatchedServices := []probe2.S3Service{{Name: "s1", Endpoint: "10.0.0.1", Gateway: true, GatewayReadEnpoints: []probe2.S3Endpoint{{Name: "10.0.0.2"}, {Name: "10.0.0.3"}}}}
+	w := Watcher{}
+	serviceToAdd, serviceToRemove := w.getServicesToModify(servicesFromConsul, servicesWatchedServices)
+	if len(serviceToAdd) != 1 || len(serviceToRemove) != 1 {
+		t.Fatalf("getServicesToModify should have return s1 service in both serviceToRemove and serviceToAdd")
+	}
+	if !reflect.DeepEqual(serviceToAdd[0].GatewayReadEnpoints, current) {
+		t.Errorf("Probe should be recreated with the current gateway read endpoints, got %v", serviceToAdd[0].GatewayReadEnpoints)
+	}
+}
+
+func TestGetServicesToModifyHandleRemovedGatewayReadEndpoint(t *testing.T) {
+	servicesFromConsul := []probe2.S3Service{{Name: "s1", Endpoint: "10.0.0.1", Gateway: true, GatewayReadEnpoints: []probe2.S3Endpoint{{Name: "10.0.0.2"}}}}
+	servicesWatchedServices := []probe2.S3Service{{Name: "s1", Endpoint: "10.0.0.1", Gateway: true, GatewayReadEnpoints: []probe2.S3Endpoint{{Name: "10.0.0.2"}, {Name: "10.0.0.3"}}}}
+	w := Watcher{}
+	serviceToAdd, serviceToRemove := w.getServicesToModify(servicesFromConsul, servicesWatchedServices)
+	if len(serviceToAdd) != 1 || len(serviceToRemove) != 1 {
+		t.Fatalf("getServicesToModify should have return s1 service in both serviceToRemove and serviceToAdd")
+	}
+	if len(serviceToAdd[0].GatewayReadEnpoints) != 1 || serviceToAdd[0].GatewayReadEnpoints[0].Name != "10.0.0.2" {
+		t.Errorf("Removed gateway read endpoint should not be probed anymore, got %v", serviceToAdd[0].GatewayReadEnpoints)
+	}
+}
+
+func TestWatchPoolsReturnsAfterStop(t *testing.T) {
+	cfg := config.GetTestConfig()
+	controlChan := make(chan bool, 1)
+	service := probe2.S3Service{Name: "test", Endpoint: "127.0.0.1:9000"}
+	p, err := probe2.NewProbe(service, service.Endpoint, []probe2.S3Endpoint{}, &cfg, controlChan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := Watcher{
+		consulClient:    &consulClientMock{RegisteredServices: map[string]bool{"test": false}, ServiceEndPoints: map[string]string{"test": "127.0.0.1:9000"}},
+		cfg:             &cfg,
+		watchedServices: map[string]watchedService{"test": {service: service, probeChan: controlChan, probe: &p}},
+		stopChan:        make(chan struct{}),
+	}
+
+	done := make(chan struct{})
+	go func() {
+		w.WatchPools(time.Hour)
+		close(done)
+	}()
+	w.Stop()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("WatchPools did not return after Stop")
+	}
+	if len(controlChan) != 1 {
+		t.Errorf("Stop command not received")
+	}
+	if len(w.getWatchedServices()) != 0 {
+		t.Errorf("Probes should have been removed")
+	}
+}
+
+func TestStopCancelsThePreparationOfNewProbes(t *testing.T) {
+	prepared := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		// the endpoint never answers, only a cancellation ends the preparation
+		select {
+		case <-prepared:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(prepared)
+
+	cfg := config.GetTestConfig()
+	prepareTimeout := time.Duration(0)
+	cfg.PrepareTimeout = &prepareTimeout
+	w := Watcher{
+		cfg:             &cfg,
+		watchedServices: map[string]watchedService{},
+		stopChan:        make(chan struct{}),
+	}
+	done := make(chan struct{})
+	go func() {
+		w.createNewProbes([]probe2.S3Service{{Name: "test", Endpoint: strings.TrimPrefix(server.URL, "http://")}})
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	w.Stop()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("The preparation was not cancelled by Stop")
+	}
+	if len(w.getWatchedServices()) != 0 {
+		t.Errorf("Probes stopped during their preparation should not be watched")
+	}
+}
+
+func TestUpdateEndpointsKeepsRunningProbe(t *testing.T) {
+	cfg := config.GetTestConfig()
+	rate := 0
+	cfg.ProbeRatePerMin = &rate
+	cfg.DurabilityProbeRatePerMin = &rate
+	controlChan := make(chan bool)
+	service := probe2.S3Service{Name: "test", Endpoint: "127.0.0.1:9000"}
+	p, err := probe2.NewProbe(service, service.Endpoint, []probe2.S3Endpoint{}, &cfg, controlChan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go p.StartProbing()
+	defer func() { controlChan <- false }()
+	w := Watcher{
+		cfg:             &cfg,
+		watchedServices: map[string]watchedService{"test": {service: service, probeChan: controlChan, probe: &p}},
+	}
+
+	moved := probe2.S3Service{Name: "test", Endpoint: "127.0.0.2:9000"}
+	other := probe2.S3Service{Name: "other", Endpoint: "127.0.0.3:9000"}
+	add, remove := w.updateEndpoints([]probe2.S3Service{moved, other}, []probe2.S3Service{service})
+	if len(add) != 1 || add[0].Name != "other" || len(remove) != 0 {
+		t.Errorf("Only the new service should be added, got %v and %v", add, remove)
+	}
+	if w.watchedServices["test"].service.Endpoint != "127.0.0.2:9000" {
+		t.Errorf("Expected the watched service to be updated")
+	}
+
+	gateway := probe2.S3Service{Name: "test", Endpoint: "127.0.0.2:9000", Gateway: true}
+	add, remove = w.updateEndpoints([]probe2.S3Service{gateway}, []probe2.S3Service{moved})
+	if len(add) != 1 || len(remove) != 1 {
+		t.Errorf("A service changing more than its endpoints should be recreated")
+	}
+}